@@ -4,7 +4,9 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 
 	"github.com/savsgio/kratgo/kratgo"
 	"github.com/savsgio/kratgo/modules/config"
@@ -40,6 +42,19 @@ func main() {
 		panic(err)
 	}
 
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+
+		if err := kratgo.Shutdown(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}()
+
 	if err = kratgo.ListenAndServe(); err != nil {
 		panic(err)
 	}
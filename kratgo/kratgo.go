@@ -6,6 +6,7 @@ import (
 	"github.com/savsgio/kratgo/modules/config"
 	"github.com/savsgio/kratgo/modules/invalidator"
 	"github.com/savsgio/kratgo/modules/proxy"
+	"github.com/savsgio/kratgo/modules/tracing"
 )
 
 // New ...
@@ -20,40 +21,62 @@ func New(cfg config.Config) (*Kratgo, error) {
 
 	c, err := cache.New(cache.Config{
 		FileConfig: cfg.Cache,
+		Store:      cfg.CacheStore,
 		LogLevel:   cfg.LogLevel,
 		LogOutput:  logFile,
 	})
 	if err != nil {
 		return nil, err
 	}
+	k.Cache = c
 
-	if k.Proxy, err = proxy.New(proxy.Config{
+	t, err := tracing.New(tracing.Config{
+		FileConfig: cfg.Proxy.Tracing,
+		LogLevel:   cfg.LogLevel,
+		LogOutput:  logFile,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if t != nil {
+		k.Tracer = t
+	}
+
+	p, err := proxy.New(proxy.Config{
 		FileConfig: cfg.Proxy,
 		Cache:      c,
+		Tracer:     t,
 		HTTPScheme: defaultHTTPScheme,
+		EvalVars:   cfg.EvalVars,
 		LogLevel:   cfg.LogLevel,
 		LogOutput:  logFile,
-	}); err != nil {
+	})
+	if err != nil {
 		return nil, err
 	}
+	k.Proxy = p
 
 	i, err := invalidator.New(invalidator.Config{
 		FileConfig: cfg.Invalidator,
 		Cache:      c,
+		Refresher:  p,
 		LogLevel:   cfg.LogLevel,
 		LogOutput:  logFile,
 	})
 	if err != nil {
 		return nil, err
 	}
+	k.Invalidator = i
 
 	if k.Admin, err = admin.New(admin.Config{
-		FileConfig:  cfg.Admin,
-		Cache:       c,
-		Invalidator: i,
-		HTTPScheme:  defaultHTTPScheme,
-		LogLevel:    cfg.LogLevel,
-		LogOutput:   logFile,
+		FileConfig:     cfg.Admin,
+		Cache:          c,
+		Invalidator:    i,
+		Proxy:          p,
+		ConfigFilePath: cfg.FilePath,
+		HTTPScheme:     defaultHTTPScheme,
+		LogLevel:       cfg.LogLevel,
+		LogOutput:      logFile,
 	}); err != nil {
 		return nil, err
 	}
@@ -77,3 +100,25 @@ func (k *Kratgo) ListenAndServe() error {
 
 	return <-err
 }
+
+// Shutdown persists the pending invalidations, if it's configured,
+// exports the pending spans, if tracing is enabled, and stops the cache
+func (k *Kratgo) Shutdown() error {
+	var err error
+
+	if k.Invalidator != nil {
+		err = k.Invalidator.Stop()
+	}
+
+	if k.Cache != nil {
+		k.Cache.Close()
+	}
+
+	if k.Tracer != nil {
+		if tErr := k.Tracer.Stop(); err == nil {
+			err = tErr
+		}
+	}
+
+	return err
+}
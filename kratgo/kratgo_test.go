@@ -24,6 +24,26 @@ func (mock *mockServer) ListenAndServe() error {
 	return nil
 }
 
+type mockInvalidator struct {
+	stopCalled bool
+}
+
+func (mock *mockInvalidator) Stop() error {
+	mock.stopCalled = true
+
+	return nil
+}
+
+type mockTracer struct {
+	stopCalled bool
+}
+
+func (mock *mockTracer) Stop() error {
+	mock.stopCalled = true
+
+	return nil
+}
+
 func TestKratgo_New(t *testing.T) {
 	type args struct {
 		cfg config.Config
@@ -205,3 +225,33 @@ func TestKratgo_ListenAndServe(t *testing.T) {
 		t.Error("Kratgo.ListenAndServe() admin server is not listening")
 	}
 }
+
+func TestKratgo_Shutdown(t *testing.T) {
+	k := new(Kratgo)
+
+	if err := k.Shutdown(); err != nil {
+		t.Errorf("Kratgo.Shutdown() without invalidator unexpected error: %v", err)
+	}
+
+	invalidatorMock := new(mockInvalidator)
+	k.Invalidator = invalidatorMock
+
+	if err := k.Shutdown(); err != nil {
+		t.Errorf("Kratgo.Shutdown() unexpected error: %v", err)
+	}
+
+	if !invalidatorMock.stopCalled {
+		t.Error("Kratgo.Shutdown() invalidator has not been stopped")
+	}
+
+	tracerMock := new(mockTracer)
+	k.Tracer = tracerMock
+
+	if err := k.Shutdown(); err != nil {
+		t.Errorf("Kratgo.Shutdown() unexpected error: %v", err)
+	}
+
+	if !tracerMock.stopCalled {
+		t.Error("Kratgo.Shutdown() tracer has not been stopped")
+	}
+}
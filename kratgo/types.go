@@ -2,12 +2,17 @@ package kratgo
 
 import (
 	"os"
+
+	"github.com/savsgio/kratgo/modules/cache"
 )
 
 // Kratgo ...
 type Kratgo struct {
-	Proxy Server
-	Admin Server
+	Proxy       Server
+	Admin       Server
+	Invalidator Invalidator
+	Tracer      Tracer
+	Cache       *cache.Cache
 
 	logFile *os.File
 }
@@ -18,3 +23,13 @@ type Kratgo struct {
 type Server interface {
 	ListenAndServe() error
 }
+
+// Invalidator ...
+type Invalidator interface {
+	Stop() error
+}
+
+// Tracer ...
+type Tracer interface {
+	Stop() error
+}
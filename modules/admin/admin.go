@@ -1,41 +1,170 @@
 package admin
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/config"
+
 	"github.com/savsgio/atreugo/v11"
 	logger "github.com/savsgio/go-logger/v2"
+	"github.com/valyala/fasthttp"
 )
 
+// listenAddrs returns all the addresses where the admin api listens
+func listenAddrs(cfg config.Admin) []string {
+	if len(cfg.Addrs) == 0 {
+		return []string{cfg.Addr}
+	}
+
+	addrs := make([]string, 0, len(cfg.Addrs)+1)
+	if cfg.Addr != "" {
+		addrs = append(addrs, cfg.Addr)
+	}
+
+	return append(addrs, cfg.Addrs...)
+}
+
+// parseListenAddr returns the network and the address,
+// that could be an unix socket with the prefix "unix:"
+func parseListenAddr(addr string) (string, string) {
+	if strings.HasPrefix(addr, unixAddrPrefix) {
+		return "unix", addr[len(unixAddrPrefix):]
+	}
+
+	return "", addr
+}
+
+// bodySizeLimit returns the callback of the received headers that skips reading the bodies
+// bigger than the max size, so they are responded with a 413 by checkBodySize, instead of a 400 by the server.
+// The connection is always closed after the response, even if it's not handled by checkBodySize (ex: a 404),
+// as the unread body must never be parsed as the next request.
+// The chunked bodies have not length, so the bigger ones are still responded with a 400
+func bodySizeLimit(maxSize int) func(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+	return func(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+		header.Del(headerBodyTooLarge)
+
+		if header.ContentLength() > maxSize {
+			header.SetContentLength(0)
+			header.SetConnectionClose()
+			header.Set(headerBodyTooLarge, "true")
+		}
+
+		return fasthttp.RequestConfig{}
+	}
+}
+
+// checkBodySize responds with a 413 if the request body is too large, closing the connection
+// as the body has not been read
+func checkBodySize(ctx *atreugo.RequestCtx) error {
+	if len(ctx.Request.Header.Peek(headerBodyTooLarge)) > 0 {
+		ctx.SetConnectionClose()
+		return ctx.TextResponse("Request body too large", fasthttp.StatusRequestEntityTooLarge)
+	}
+
+	return ctx.Next()
+}
+
 // New ...
 func New(cfg Config) (*Admin, error) {
+	if cfg.FileConfig.BenchEcho && cfg.FileConfig.Token == "" {
+		return nil, fmt.Errorf("Admin.BenchEcho configuration requires the Admin.Token")
+	}
+
+	if cfg.FileConfig.Snapshot && cfg.FileConfig.Token == "" {
+		return nil, fmt.Errorf("Admin.Snapshot configuration requires the Admin.Token")
+	}
+
 	a := new(Admin)
 	a.fileConfig = cfg.FileConfig
 
 	logName := "kratgo-admin"
 	log := logger.New(logName, cfg.LogLevel, cfg.LogOutput)
 
-	a.server = atreugo.New(atreugo.Config{
-		Addr:    cfg.FileConfig.Addr,
-		LogName: logName,
-	})
-	a.server.SetLogOutput(cfg.LogOutput)
+	maxRequestBodySize := cfg.FileConfig.MaxRequestBodySize
+	if maxRequestBodySize <= 0 {
+		maxRequestBodySize = fasthttp.DefaultMaxRequestBodySize
+	}
+
+	for _, addr := range listenAddrs(cfg.FileConfig) {
+		network, addr := parseListenAddr(addr)
+
+		server := atreugo.New(atreugo.Config{
+			Addr:               addr,
+			Network:            network,
+			LogName:            logName,
+			ReadTimeout:        time.Duration(cfg.FileConfig.ReadTimeout) * time.Millisecond,
+			WriteTimeout:       time.Duration(cfg.FileConfig.WriteTimeout) * time.Millisecond,
+			MaxRequestBodySize: maxRequestBodySize,
+			HeaderReceived:     bodySizeLimit(maxRequestBodySize),
+		})
+		server.SetLogOutput(cfg.LogOutput)
+
+		a.servers = append(a.servers, server)
+	}
 
 	a.httpScheme = cfg.HTTPScheme
 	a.cache = cfg.Cache
 	a.invalidator = cfg.Invalidator
+	a.proxy = cfg.Proxy
+	a.configFilePath = cfg.ConfigFilePath
 	a.log = log
 
+	a.signatureMaxAge = int64(cfg.FileConfig.SignedInvalidation.MaxAge)
+	if a.signatureMaxAge <= 0 {
+		a.signatureMaxAge = defaultSignatureMaxAge
+	}
+
 	a.init()
 
 	return a, nil
 }
 
 func (a *Admin) init() {
-	a.server.Path("POST", "/invalidate/", a.invalidateView)
+	for _, server := range a.servers {
+		server.UseBefore(checkBodySize)
+
+		server.Path("POST", "/invalidate/", a.invalidateView)
+		server.Path("GET", "/entry", a.entryView)
+		server.Path("GET", "/stats/", a.statsView)
+		server.Path("GET", "/status/", a.statusView)
+		server.Path("POST", "/purge-host/", a.purgeHostView)
+		server.Path("GET", "/maintenance/", a.maintenanceView)
+		server.Path("POST", "/maintenance/", a.setMaintenanceView)
+		server.Path("POST", "/canary-ramp/", a.restartCanaryRampView)
+
+		if a.fileConfig.SignedInvalidation.Secret != "" {
+			server.Path("GET", "/invalidate/", a.signedInvalidateView)
+		}
+
+		if a.configFilePath != "" {
+			server.Path("POST", "/reload-rules/", a.reloadRulesView)
+		}
+
+		if a.fileConfig.BenchEcho {
+			server.Path("GET", "/bench-echo", a.benchEchoView)
+		}
+
+		if a.fileConfig.Snapshot {
+			server.Path("GET", "/export/", a.exportView)
+			server.Path("POST", "/import/", a.importView)
+		}
+	}
 }
 
 // ListenAndServe ...
 func (a *Admin) ListenAndServe() error {
 	go a.invalidator.Start()
 
-	return a.server.ListenAndServe()
+	err := make(chan error, len(a.servers))
+
+	for _, server := range a.servers {
+		go func(server Server) {
+			err <- server.ListenAndServe()
+		}(server)
+	}
+
+	// Any listener error aborts, the others are not longer waited
+	return <-err
 }
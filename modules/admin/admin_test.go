@@ -1,9 +1,14 @@
 package admin
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -11,9 +16,12 @@ import (
 	"github.com/savsgio/kratgo/modules/cache"
 	"github.com/savsgio/kratgo/modules/config"
 	"github.com/savsgio/kratgo/modules/invalidator"
+	"github.com/savsgio/kratgo/modules/proxy"
 
 	"github.com/savsgio/atreugo/v11"
 	logger "github.com/savsgio/go-logger/v2"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
 )
 
 var testCache *cache.Cache
@@ -40,8 +48,10 @@ type mockPath struct {
 type mockServer struct {
 	listenAndServeCalled bool
 	logOutput            io.Writer
+	err                  error
 
-	paths []mockPath
+	paths       []mockPath
+	middlewares []atreugo.Middleware
 
 	mu sync.RWMutex
 }
@@ -51,6 +61,10 @@ func (mock *mockServer) ListenAndServe() error {
 	mock.listenAndServeCalled = true
 	mock.mu.Unlock()
 
+	if mock.err != nil {
+		return mock.err
+	}
+
 	time.Sleep(250 * time.Millisecond)
 
 	return nil
@@ -66,14 +80,23 @@ func (mock *mockServer) Path(httpMethod string, url string, viewFn atreugo.View)
 	return nil
 }
 
+func (mock *mockServer) UseBefore(fns ...atreugo.Middleware) *atreugo.Router {
+	mock.middlewares = append(mock.middlewares, fns...)
+
+	return nil
+}
+
 func (mock *mockServer) SetLogOutput(output io.Writer) {
 	mock.logOutput = output
 }
 
 type mockInvalidator struct {
-	addCalled   bool
-	startCalled bool
-	err         error
+	addCalled        bool
+	addAndWaitCalled bool
+	startCalled      bool
+	entry            invalidator.Entry
+	status           invalidator.Status
+	err              error
 
 	mu sync.RWMutex
 }
@@ -87,11 +110,75 @@ func (mock *mockInvalidator) Start() {
 func (mock *mockInvalidator) Add(e invalidator.Entry) error {
 	mock.mu.Lock()
 	mock.addCalled = true
+	mock.entry = e
 	mock.mu.Unlock()
 
 	return mock.err
 }
 
+func (mock *mockInvalidator) Status() invalidator.Status {
+	return mock.status
+}
+
+func (mock *mockInvalidator) AddAndWait(e invalidator.Entry, timeout time.Duration) error {
+	mock.mu.Lock()
+	mock.addAndWaitCalled = true
+	mock.mu.Unlock()
+
+	return mock.err
+}
+
+type mockProxy struct {
+	stats       proxy.Stats
+	maintenance bool
+
+	canaryRamp          bool
+	canaryRampRestarted bool
+	canaryPercent       float64
+
+	reloadedRules *config.Proxy
+	reloadErr     error
+
+	benchEchoAuthorization []byte
+}
+
+func (mock *mockProxy) Stats() proxy.Stats {
+	return mock.stats
+}
+
+func (mock *mockProxy) SetMaintenance(enabled bool) {
+	mock.maintenance = enabled
+}
+
+func (mock *mockProxy) Maintenance() bool {
+	return mock.maintenance
+}
+
+func (mock *mockProxy) RestartCanaryRamp() bool {
+	mock.canaryRampRestarted = mock.canaryRamp
+
+	return mock.canaryRamp
+}
+
+func (mock *mockProxy) CanaryPercent() float64 {
+	return mock.canaryPercent
+}
+
+func (mock *mockProxy) ReloadRules(cfg config.Proxy) error {
+	if mock.reloadErr != nil {
+		return mock.reloadErr
+	}
+
+	mock.reloadedRules = &cfg
+
+	return nil
+}
+
+func (mock *mockProxy) BenchEcho(ctx *fasthttp.RequestCtx) {
+	mock.benchEchoAuthorization = append([]byte{}, ctx.Request.Header.Peek(fasthttp.HeaderAuthorization)...)
+	ctx.SetBodyString("echo")
+}
+
 func getMockPath(paths []mockPath, url, method string) *mockPath {
 	for _, v := range paths {
 		if v.url == url && v.method == method {
@@ -168,6 +255,44 @@ func TestAdmin_New(t *testing.T) {
 				err: false,
 			},
 		},
+		{
+			name: "BenchEchoWithoutToken",
+			args: args{
+				cfg: Config{
+					FileConfig: config.Admin{
+						Addr:      "localhost:9999",
+						BenchEcho: true,
+					},
+					Cache:       testCache,
+					Invalidator: invalidatorMock,
+					HTTPScheme:  httpScheme,
+					LogLevel:    logLevel,
+					LogOutput:   logOutput,
+				},
+			},
+			want: want{
+				err: true,
+			},
+		},
+		{
+			name: "SnapshotWithoutToken",
+			args: args{
+				cfg: Config{
+					FileConfig: config.Admin{
+						Addr:     "localhost:9999",
+						Snapshot: true,
+					},
+					Cache:       testCache,
+					Invalidator: invalidatorMock,
+					HTTPScheme:  httpScheme,
+					LogLevel:    logLevel,
+					LogOutput:   logOutput,
+				},
+			},
+			want: want{
+				err: true,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -180,8 +305,8 @@ func TestAdmin_New(t *testing.T) {
 				return
 			}
 
-			if a.server == nil {
-				t.Errorf("New() server is '%v'", nil)
+			if len(a.servers) != 1 {
+				t.Errorf("New() servers == '%d', want '%d'", len(a.servers), 1)
 			}
 
 			if a.httpScheme != httpScheme {
@@ -207,11 +332,176 @@ func TestAdmin_New(t *testing.T) {
 	}
 }
 
+func Test_listenAddrs(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Admin
+		want []string
+	}{
+		{
+			name: "Addr",
+			cfg:  config.Admin{Addr: "localhost:6082"},
+			want: []string{"localhost:6082"},
+		},
+		{
+			name: "Addrs",
+			cfg:  config.Admin{Addrs: []string{"10.0.0.1:6082", "unix:/run/kratgo.sock"}},
+			want: []string{"10.0.0.1:6082", "unix:/run/kratgo.sock"},
+		},
+		{
+			name: "AddrAndAddrs",
+			cfg:  config.Admin{Addr: "localhost:6082", Addrs: []string{"10.0.0.1:6082"}},
+			want: []string{"localhost:6082", "10.0.0.1:6082"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listenAddrs(tt.cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listenAddrs() = '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseListenAddr(t *testing.T) {
+	network, addr := parseListenAddr("unix:/run/kratgo.sock")
+	if network != "unix" || addr != "/run/kratgo.sock" {
+		t.Errorf("parseListenAddr() = '%s, %s', want '%s, %s'", network, addr, "unix", "/run/kratgo.sock")
+	}
+
+	network, addr = parseListenAddr("localhost:6082")
+	if network != "" || addr != "localhost:6082" {
+		t.Errorf("parseListenAddr() = '%s, %s', want '%s, %s'", network, addr, "", "localhost:6082")
+	}
+}
+
+func TestAdmin_MaxRequestBodySize(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.MaxRequestBodySize = 64
+	cfg.Invalidator = new(mockInvalidator)
+
+	admin, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+
+	go admin.servers[0].(*atreugo.Atreugo).Serve(ln)
+
+	client := &fasthttp.HostClient{
+		Addr: "admin",
+		Dial: func(addr string) (net.Conn, error) { return ln.Dial() },
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		wantStatusCode int
+	}{
+		{name: "Ok", body: `{"host": "www.kratgo.com"}`, wantStatusCode: fasthttp.StatusOK},
+		{name: "TooLarge", body: `{"host": "` + strings.Repeat("a", 64) + `"}`, wantStatusCode: fasthttp.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := fasthttp.AcquireRequest()
+			defer fasthttp.ReleaseRequest(req)
+
+			resp := fasthttp.AcquireResponse()
+			defer fasthttp.ReleaseResponse(resp)
+
+			req.SetRequestURI("http://admin/invalidate/")
+			req.Header.SetMethod("POST")
+			req.SetBodyString(tt.body)
+
+			if err := client.DoTimeout(req, resp, time.Second); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if statusCode := resp.StatusCode(); statusCode != tt.wantStatusCode {
+				t.Errorf("Admin server status code == '%d', want '%d'", statusCode, tt.wantStatusCode)
+			}
+		})
+	}
+}
+
+func Test_bodySizeLimit(t *testing.T) {
+	header := new(fasthttp.RequestHeader)
+	header.Set(headerBodyTooLarge, "true")
+	header.SetContentLength(10)
+
+	bodySizeLimit(10)(header)
+
+	if v := header.Peek(headerBodyTooLarge); len(v) > 0 {
+		t.Errorf("bodySizeLimit() header '%s' == '%s', want empty", headerBodyTooLarge, v)
+	}
+
+	header.SetContentLength(11)
+	bodySizeLimit(10)(header)
+
+	if v := header.Peek(headerBodyTooLarge); len(v) == 0 {
+		t.Errorf("bodySizeLimit() header '%s' is empty", headerBodyTooLarge)
+	}
+
+	if contentLength := header.ContentLength(); contentLength != 0 {
+		t.Errorf("bodySizeLimit() content length == '%d', want '%d'", contentLength, 0)
+	}
+
+	if !header.ConnectionClose() {
+		t.Errorf("bodySizeLimit() connection close == '%v', want '%v'", false, true)
+	}
+}
+
+func TestAdmin_MaxRequestBodySize_NotFound(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.MaxRequestBodySize = 64
+	cfg.Invalidator = new(mockInvalidator)
+
+	admin, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+
+	go admin.servers[0].(*atreugo.Atreugo).Serve(ln)
+
+	conn, err := ln.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// The unread body of the unknown path must never be served as other request of the same connection
+	smuggled := "GET /status/ HTTP/1.1\r\nHost: admin\r\nX-Padding: " + strings.Repeat("a", 64) + "\r\n\r\n"
+	req := fmt.Sprintf("POST /nope HTTP/1.1\r\nHost: admin\r\nContent-Length: %d\r\n\r\n%s", len(smuggled), smuggled)
+
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	data, _ := ioutil.ReadAll(conn)
+
+	if n := strings.Count(string(data), "HTTP/1.1 "); n != 1 {
+		t.Fatalf("Admin server responses == '%d', want '%d': %s", n, 1, data)
+	}
+
+	if !strings.HasPrefix(string(data), "HTTP/1.1 404") {
+		t.Errorf("Admin server response == '%s', want a '%d'", data, fasthttp.StatusNotFound)
+	}
+}
+
 func TestAdmin_init(t *testing.T) {
 	serverMock := new(mockServer)
 
 	admin := new(Admin)
-	admin.server = serverMock
+	admin.servers = []Server{serverMock}
 	admin.init()
 
 	expectedPaths := []mockPath{
@@ -220,12 +510,97 @@ func TestAdmin_init(t *testing.T) {
 			url:    "/invalidate/",
 			view:   admin.invalidateView,
 		},
+		{
+			method: "GET",
+			url:    "/entry",
+			view:   admin.entryView,
+		},
+		{
+			method: "GET",
+			url:    "/stats/",
+			view:   admin.statsView,
+		},
+		{
+			method: "GET",
+			url:    "/status/",
+			view:   admin.statusView,
+		},
+		{
+			method: "POST",
+			url:    "/purge-host/",
+			view:   admin.purgeHostView,
+		},
+		{
+			method: "GET",
+			url:    "/maintenance/",
+			view:   admin.maintenanceView,
+		},
+		{
+			method: "POST",
+			url:    "/maintenance/",
+			view:   admin.setMaintenanceView,
+		},
+		{
+			method: "POST",
+			url:    "/canary-ramp/",
+			view:   admin.restartCanaryRampView,
+		},
+	}
+
+	if len(serverMock.middlewares) != 1 {
+		t.Errorf("Admin.server.init() registered middlewares == '%d', want '%d'", len(serverMock.middlewares), 1)
 	}
 
 	if len(expectedPaths) != len(serverMock.paths) {
 		t.Fatalf("Admin.server.init() registered paths == '%v', want '%v'", serverMock.paths, expectedPaths)
 	}
 
+	signedServerMock := new(mockServer)
+	admin.servers = []Server{signedServerMock}
+	admin.fileConfig.SignedInvalidation.Secret = "secret"
+	admin.init()
+
+	if p := getMockPath(signedServerMock.paths, "/invalidate/", "GET"); p == nil {
+		t.Errorf("Admin.server.init() with secret has not registered 'GET /invalidate/'")
+	}
+
+	reloadServerMock := new(mockServer)
+	admin.servers = []Server{reloadServerMock}
+	admin.configFilePath = "/etc/kratgo/kratgo.conf.yml"
+	admin.init()
+
+	if p := getMockPath(reloadServerMock.paths, "/reload-rules/", "POST"); p == nil {
+		t.Errorf("Admin.server.init() with config file has not registered 'POST /reload-rules/'")
+	}
+
+	benchServerMock := new(mockServer)
+	admin.servers = []Server{benchServerMock}
+	admin.fileConfig.BenchEcho = true
+	admin.init()
+
+	if p := getMockPath(benchServerMock.paths, "/bench-echo", "GET"); p == nil {
+		t.Errorf("Admin.server.init() with bench echo has not registered 'GET /bench-echo'")
+	}
+
+	if p := getMockPath(serverMock.paths, "/bench-echo", "GET"); p != nil {
+		t.Errorf("Admin.server.init() without bench echo has registered 'GET /bench-echo'")
+	}
+
+	snapshotServerMock := new(mockServer)
+	admin.servers = []Server{snapshotServerMock}
+	admin.fileConfig.Snapshot = true
+	admin.init()
+
+	for _, route := range []struct{ url, method string }{{"/export/", "GET"}, {"/import/", "POST"}} {
+		if p := getMockPath(snapshotServerMock.paths, route.url, route.method); p == nil {
+			t.Errorf("Admin.server.init() with snapshot has not registered '%s %s'", route.method, route.url)
+		}
+
+		if p := getMockPath(serverMock.paths, route.url, route.method); p != nil {
+			t.Errorf("Admin.server.init() without snapshot has registered '%s %s'", route.method, route.url)
+		}
+	}
+
 	for _, path := range serverMock.paths {
 		p := getMockPath(expectedPaths, path.url, path.method)
 		if p == nil {
@@ -246,7 +621,7 @@ func TestAdmin_ListenAndServe(t *testing.T) {
 	invalidatorMock := new(mockInvalidator)
 
 	admin := new(Admin)
-	admin.server = serverMock
+	admin.servers = []Server{serverMock}
 	admin.invalidator = invalidatorMock
 
 	admin.ListenAndServe()
@@ -263,3 +638,17 @@ func TestAdmin_ListenAndServe(t *testing.T) {
 		t.Error("Admin.ListenAndServe() server is not listening")
 	}
 }
+
+func TestAdmin_ListenAndServe_MultipleServers(t *testing.T) {
+	serverErr := errors.New("Could not listen")
+	serverMock := new(mockServer)
+	failServerMock := &mockServer{err: serverErr}
+
+	admin := new(Admin)
+	admin.servers = []Server{serverMock, failServerMock}
+	admin.invalidator = new(mockInvalidator)
+
+	if err := admin.ListenAndServe(); err != serverErr {
+		t.Errorf("Admin.ListenAndServe() error == '%v', want '%v'", err, serverErr)
+	}
+}
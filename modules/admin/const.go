@@ -0,0 +1,18 @@
+package admin
+
+import "time"
+
+const authHeaderPrefix = "Bearer "
+
+const unixAddrPrefix = "unix:"
+
+const defaultInvalidateWaitTimeout = 30 * time.Second
+
+const entryViewMaxBodySize = 64 * 1024
+
+const defaultSignatureMaxAge = 300 // seconds
+
+const snapshotContentType = "application/x-msgpack"
+
+// headerBodyTooLarge marks the requests whose body has not been read, as it's bigger than the max size
+const headerBodyTooLarge = "X-Kratgo-Body-Too-Large"
@@ -1,14 +1,45 @@
 package admin
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"strconv"
+	"time"
 
+	"github.com/savsgio/kratgo/modules/cache"
+	"github.com/savsgio/kratgo/modules/config"
 	"github.com/savsgio/kratgo/modules/invalidator"
 
 	"github.com/savsgio/atreugo/v11"
+	"github.com/savsgio/gotils"
+	"github.com/valyala/fasthttp"
 )
 
+func (a *Admin) isAuthorized(ctx *atreugo.RequestCtx) bool {
+	if a.fileConfig.Token == "" {
+		return true
+	}
+
+	auth := gotils.B2S(ctx.Request.Header.Peek(fasthttp.HeaderAuthorization))
+	if len(auth) <= len(authHeaderPrefix) || auth[:len(authHeaderPrefix)] != authHeaderPrefix {
+		return false
+	}
+
+	token := auth[len(authHeaderPrefix):]
+
+	return subtle.ConstantTimeCompare(gotils.S2B(token), gotils.S2B(a.fileConfig.Token)) == 1
+}
+
 func (a *Admin) invalidateView(ctx *atreugo.RequestCtx) error {
+	if !a.isAuthorized(ctx) {
+		return ctx.TextResponse("Unauthorized", fasthttp.StatusUnauthorized)
+	}
+
 	entry := invalidator.AcquireEntry()
 	body := ctx.PostBody()
 
@@ -22,13 +53,337 @@ func (a *Admin) invalidateView(ctx *atreugo.RequestCtx) error {
 		return err
 	}
 
-	if err = a.invalidator.Add(*entry); err != nil {
-		a.log.Errorf("Could not add a invalidation entry '%s': %v", body, err)
-		invalidator.ReleaseEntry(entry)
-		return ctx.TextResponse(err.Error(), 400)
+	args := ctx.QueryArgs()
+
+	if args.GetBool("wait") {
+		timeout := defaultInvalidateWaitTimeout
+		if seconds, errTimeout := args.GetUint("timeout"); errTimeout == nil && seconds > 0 {
+			timeout = time.Duration(seconds) * time.Second
+		}
+
+		err = a.invalidator.AddAndWait(*entry, timeout)
+	} else {
+		err = a.invalidator.Add(*entry)
 	}
 
 	invalidator.ReleaseEntry(entry)
 
+	return a.invalidationResponse(ctx, body, err)
+}
+
+func (a *Admin) invalidationResponse(ctx *atreugo.RequestCtx, desc []byte, err error) error {
+	switch err {
+	case nil:
+		return ctx.TextResponse("OK")
+	case invalidator.ErrEmptyFields, invalidator.ErrRefreshWithoutHost, invalidator.ErrQueryWithoutPath:
+		a.log.Errorf("Could not add a invalidation entry '%s': %v", desc, err)
+		return ctx.TextResponse(err.Error(), fasthttp.StatusBadRequest)
+	case invalidator.ErrWaitTimeout:
+		a.log.Warningf("Invalidation entry '%s': %v", desc, err)
+		return ctx.TextResponse(err.Error(), fasthttp.StatusGatewayTimeout)
+	case invalidator.ErrStopped:
+		a.log.Warningf("Invalidation entry '%s': %v", desc, err)
+		return ctx.TextResponse(err.Error(), fasthttp.StatusServiceUnavailable)
+	default:
+		a.log.Errorf("Could not invalidate the entry '%s': %v", desc, err)
+		return ctx.TextResponse(err.Error(), fasthttp.StatusInternalServerError)
+	}
+}
+
+// invalidationSignature returns the hex encoded HMAC-SHA256 of the host, the path
+// and the timestamp, separated by new lines
+func invalidationSignature(secret, host, path, timestamp []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(host)
+	mac.Write([]byte{'\n'})
+	mac.Write(path)
+	mac.Write([]byte{'\n'})
+	mac.Write(timestamp)
+
+	sum := mac.Sum(nil)
+	dst := make([]byte, hex.EncodedLen(len(sum)))
+	hex.Encode(dst, sum)
+
+	return dst
+}
+
+// isValidSignature checks the signature of the query arguments in constant time,
+// and that the timestamp is not older (or newer) than the max age, to prevent replays
+func (a *Admin) isValidSignature(args *fasthttp.Args, now int64) bool {
+	timestamp := args.Peek("timestamp")
+
+	ts, err := strconv.ParseInt(gotils.B2S(timestamp), 10, 64)
+	if err != nil || ts < now-a.signatureMaxAge || ts > now+a.signatureMaxAge {
+		return false
+	}
+
+	want := invalidationSignature(
+		gotils.S2B(a.fileConfig.SignedInvalidation.Secret), args.Peek("host"), args.Peek("path"), timestamp,
+	)
+
+	return subtle.ConstantTimeCompare(args.Peek("signature"), want) == 1
+}
+
+// signedInvalidateView invalidates the host and the path of the query arguments,
+// authorized by their signature instead of the token, for the clients that only could do GET requests
+func (a *Admin) signedInvalidateView(ctx *atreugo.RequestCtx) error {
+	args := ctx.QueryArgs()
+
+	if !a.isValidSignature(args, time.Now().Unix()) {
+		return ctx.TextResponse("Unauthorized", fasthttp.StatusUnauthorized)
+	}
+
+	entry := invalidator.AcquireEntry()
+	entry.Host = string(args.Peek("host"))
+	entry.Path = string(args.Peek("path"))
+
+	if a.log.DebugEnabled() {
+		a.log.Debugf("Signed invalidation received: host=%s path=%s", entry.Host, entry.Path)
+	}
+
+	err := a.invalidator.Add(*entry)
+
+	invalidator.ReleaseEntry(entry)
+
+	return a.invalidationResponse(ctx, args.QueryString(), err)
+}
+
+// entryView returns the cached response of the host, the path and the variant (the first one if it's empty).
+// It always requires the token, as the cached responses could be private (ex: by privateCacheKeyHeaders)
+func (a *Admin) entryView(ctx *atreugo.RequestCtx) error {
+	if a.fileConfig.Token == "" {
+		return ctx.TextResponse("The cache inspection requires the Admin.Token", fasthttp.StatusForbidden)
+	} else if !a.isAuthorized(ctx) {
+		return ctx.TextResponse("Unauthorized", fasthttp.StatusUnauthorized)
+	}
+
+	args := ctx.QueryArgs()
+	host := args.Peek("host")
+	path := args.Peek("path")
+	variant := args.Peek("variant")
+
+	if len(host) == 0 || len(path) == 0 {
+		return ctx.TextResponse("The 'host' and 'path' query arguments are mandatory", fasthttp.StatusBadRequest)
+	}
+
+	entry := cache.AcquireEntry()
+	defer cache.ReleaseEntry(entry)
+
+	if err := a.cache.Peek(string(host), entry); err != nil {
+		a.log.Errorf("Could not get data from cache with key '%s': %v", host, err)
+		return ctx.TextResponse(err.Error(), fasthttp.StatusInternalServerError)
+	}
+
+	r := entry.GetResponse(path)
+	if args.Has("variant") {
+		r = entry.GetVariantResponse(path, variant)
+	}
+
+	if r == nil {
+		return ctx.TextResponse("Not found", fasthttp.StatusNotFound)
+	}
+
+	resp := entryResponse{
+		Host:     string(host),
+		Path:     string(r.Path),
+		Variant:  string(r.Variant),
+		Variants: make([]string, 0, 1),
+		Headers:  make([]entryHeader, 0, len(r.Headers)),
+		BodySize: len(r.Body),
+		Body:     r.Body,
+	}
+
+	for i := range entry.Responses {
+		if v := &entry.Responses[i]; bytes.Equal(v.Path, path) {
+			resp.Variants = append(resp.Variants, string(v.Variant))
+		}
+	}
+
+	for _, h := range r.Headers {
+		resp.Headers = append(resp.Headers, entryHeader{Key: string(h.Key), Value: string(h.Value)})
+	}
+
+	if resp.BodySize > entryViewMaxBodySize {
+		resp.Body = resp.Body[:entryViewMaxBodySize]
+		resp.BodyTruncated = true
+	}
+
+	return ctx.JSONResponse(resp)
+}
+
+func (a *Admin) purgeHostView(ctx *atreugo.RequestCtx) error {
+	if !a.isAuthorized(ctx) {
+		return ctx.TextResponse("Unauthorized", fasthttp.StatusUnauthorized)
+	}
+
+	req := purgeHostRequest{}
+	if err := json.Unmarshal(ctx.PostBody(), &req); err != nil {
+		return ctx.TextResponse(err.Error(), fasthttp.StatusBadRequest)
+	}
+
+	if req.Host == "" {
+		return ctx.TextResponse("The 'host' field is mandatory", fasthttp.StatusBadRequest)
+	}
+
+	purged, err := a.cache.Purge(req.Host)
+	if err != nil {
+		a.log.Errorf("Could not purge the host '%s': %v", req.Host, err)
+		return ctx.TextResponse(err.Error(), fasthttp.StatusInternalServerError)
+	}
+
+	a.log.Infof("Purged %d responses of the host '%s'", purged, req.Host)
+
+	return ctx.JSONResponse(purgeHostResponse{Host: req.Host, Purged: purged})
+}
+
+func (a *Admin) maintenanceView(ctx *atreugo.RequestCtx) error {
+	if !a.isAuthorized(ctx) {
+		return ctx.TextResponse("Unauthorized", fasthttp.StatusUnauthorized)
+	}
+
+	if a.proxy == nil {
+		return ctx.TextResponse("Maintenance not available", fasthttp.StatusServiceUnavailable)
+	}
+
+	return ctx.JSONResponse(maintenanceState{Enabled: a.proxy.Maintenance()})
+}
+
+func (a *Admin) setMaintenanceView(ctx *atreugo.RequestCtx) error {
+	if !a.isAuthorized(ctx) {
+		return ctx.TextResponse("Unauthorized", fasthttp.StatusUnauthorized)
+	}
+
+	if a.proxy == nil {
+		return ctx.TextResponse("Maintenance not available", fasthttp.StatusServiceUnavailable)
+	}
+
+	state := maintenanceState{}
+	if err := json.Unmarshal(ctx.PostBody(), &state); err != nil {
+		return ctx.TextResponse(err.Error(), fasthttp.StatusBadRequest)
+	}
+
+	a.proxy.SetMaintenance(state.Enabled)
+
+	return ctx.JSONResponse(maintenanceState{Enabled: a.proxy.Maintenance()})
+}
+
+// restartCanaryRampView starts again the canary ramp from its start percent, ex: when the canary backends are deployed
+func (a *Admin) restartCanaryRampView(ctx *atreugo.RequestCtx) error {
+	if !a.isAuthorized(ctx) {
+		return ctx.TextResponse("Unauthorized", fasthttp.StatusUnauthorized)
+	}
+
+	if a.proxy == nil || !a.proxy.RestartCanaryRamp() {
+		return ctx.TextResponse("Canary ramp not available", fasthttp.StatusServiceUnavailable)
+	}
+
+	return ctx.JSONResponse(canaryRampState{Percent: a.proxy.CanaryPercent()})
+}
+
+// reloadRulesView replaces the nocache and headers rules of the proxy by the ones of the configuration file,
+// keeping the current ones if they are not valid
+func (a *Admin) reloadRulesView(ctx *atreugo.RequestCtx) error {
+	if !a.isAuthorized(ctx) {
+		return ctx.TextResponse("Unauthorized", fasthttp.StatusUnauthorized)
+	}
+
+	if a.proxy == nil {
+		return ctx.TextResponse("Rules reload not available", fasthttp.StatusServiceUnavailable)
+	}
+
+	cfg, err := config.Parse(a.configFilePath)
+	if err != nil {
+		a.log.Errorf("Could not parse the configuration file '%s': %v", a.configFilePath, err)
+		return ctx.TextResponse(err.Error(), fasthttp.StatusBadRequest)
+	}
+
+	if err := a.proxy.ReloadRules(cfg.Proxy); err != nil {
+		a.log.Errorf("Could not reload the rules: %v", err)
+		return ctx.TextResponse(err.Error(), fasthttp.StatusBadRequest)
+	}
+
 	return ctx.TextResponse("OK")
 }
+
+// benchEchoView serves the request through the proxy with a canned backend response
+func (a *Admin) benchEchoView(ctx *atreugo.RequestCtx) error {
+	if !a.isAuthorized(ctx) {
+		return ctx.TextResponse("Unauthorized", fasthttp.StatusUnauthorized)
+	}
+
+	if a.proxy == nil {
+		return ctx.TextResponse("Bench echo not available", fasthttp.StatusServiceUnavailable)
+	}
+
+	// The token is not forwarded to the proxy pipeline, nor cached
+	ctx.Request.Header.Del(fasthttp.HeaderAuthorization)
+	a.proxy.BenchEcho(ctx.RequestCtx)
+
+	return nil
+}
+
+// exportView streams the snapshot of all the cached entries, without buffering it.
+// The errors after the start of the response could only be logged, and the snapshot is truncated
+func (a *Admin) exportView(ctx *atreugo.RequestCtx) error {
+	if !a.isAuthorized(ctx) {
+		return ctx.TextResponse("Unauthorized", fasthttp.StatusUnauthorized)
+	}
+
+	ctx.SetContentType(snapshotContentType)
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		exported, err := a.cache.Export(w)
+		if err != nil {
+			a.log.Errorf("Could not export the cache snapshot: %v", err)
+			return
+		}
+
+		a.log.Infof("Exported %d cache entries", exported)
+	})
+
+	return nil
+}
+
+// importView merges the snapshot of the body into the cache, discarding its expired responses
+func (a *Admin) importView(ctx *atreugo.RequestCtx) error {
+	if !a.isAuthorized(ctx) {
+		return ctx.TextResponse("Unauthorized", fasthttp.StatusUnauthorized)
+	}
+
+	imported, err := a.cache.Import(bytes.NewReader(ctx.PostBody()), time.Now().Unix())
+	if err != nil {
+		a.log.Errorf("Could not import the cache snapshot: %v", err)
+		return ctx.TextResponse(err.Error(), fasthttp.StatusBadRequest)
+	}
+
+	a.log.Infof("Imported %d cached responses", imported)
+
+	return ctx.JSONResponse(importResponse{Imported: imported})
+}
+
+// statusView responds with the status of the invalidator, with a 503 if it's not running
+func (a *Admin) statusView(ctx *atreugo.RequestCtx) error {
+	if !a.isAuthorized(ctx) {
+		return ctx.TextResponse("Unauthorized", fasthttp.StatusUnauthorized)
+	}
+
+	status := statusResponse{Invalidator: a.invalidator.Status()}
+
+	statusCode := fasthttp.StatusOK
+	if !status.Invalidator.Running {
+		statusCode = fasthttp.StatusServiceUnavailable
+	}
+
+	return ctx.JSONResponse(status, statusCode)
+}
+
+func (a *Admin) statsView(ctx *atreugo.RequestCtx) error {
+	if !a.isAuthorized(ctx) {
+		return ctx.TextResponse("Unauthorized", fasthttp.StatusUnauthorized)
+	}
+
+	if a.proxy == nil {
+		return ctx.TextResponse("Stats not available", fasthttp.StatusServiceUnavailable)
+	}
+
+	return ctx.JSONResponse(a.proxy.Stats())
+}
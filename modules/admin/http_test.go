@@ -1,9 +1,21 @@
 package admin
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/savsgio/kratgo/modules/cache"
 	"github.com/savsgio/kratgo/modules/invalidator"
+	"github.com/savsgio/kratgo/modules/proxy"
 
 	"github.com/savsgio/atreugo/v11"
 	"github.com/valyala/fasthttp"
@@ -12,15 +24,17 @@ import (
 func TestAdmin_invalidateView(t *testing.T) {
 	type args struct {
 		method   string
+		query    string
 		body     string
 		addError error
 	}
 
 	type want struct {
-		response   string
-		statusCode int
-		err        bool
-		callAdd    bool
+		response       string
+		statusCode     int
+		err            bool
+		callAdd        bool
+		callAddAndWait bool
 	}
 
 	tests := []struct {
@@ -41,6 +55,35 @@ func TestAdmin_invalidateView(t *testing.T) {
 				callAdd:    true,
 			},
 		},
+		{
+			name: "Wait",
+			args: args{
+				method: "POST",
+				query:  "wait=true&timeout=5",
+				body:   "{\"host\": \"www.kratgo.com\"}",
+			},
+			want: want{
+				response:       "OK",
+				statusCode:     200,
+				err:            false,
+				callAddAndWait: true,
+			},
+		},
+		{
+			name: "WaitTimeout",
+			args: args{
+				method:   "POST",
+				query:    "wait=true",
+				body:     "{\"host\": \"www.kratgo.com\"}",
+				addError: invalidator.ErrWaitTimeout,
+			},
+			want: want{
+				response:       invalidator.ErrWaitTimeout.Error(),
+				statusCode:     504,
+				err:            false,
+				callAddAndWait: true,
+			},
+		},
 		{
 			name: "EmptyJSONBody",
 			args: args{
@@ -86,6 +129,7 @@ func TestAdmin_invalidateView(t *testing.T) {
 			actx.RequestCtx = new(fasthttp.RequestCtx)
 
 			actx.Request.Header.SetMethod(tt.args.method)
+			actx.Request.URI().SetQueryString(tt.args.query)
 			actx.Request.SetBodyString(tt.args.body)
 
 			err = admin.invalidateView(actx)
@@ -97,6 +141,10 @@ func TestAdmin_invalidateView(t *testing.T) {
 				t.Error("Admin.invalidateView() has not called to admin.invalidator.Add(...)")
 			}
 
+			if tt.want.callAddAndWait && !invalidatorMock.addAndWaitCalled {
+				t.Error("Admin.invalidateView() has not called to admin.invalidator.AddAndWait(...)")
+			}
+
 			statusCode := actx.Response.StatusCode()
 			if statusCode != tt.want.statusCode {
 				t.Errorf("Admin.invalidateView() status code == '%d', want '%d'", statusCode, tt.want.statusCode)
@@ -109,3 +157,845 @@ func TestAdmin_invalidateView(t *testing.T) {
 		})
 	}
 }
+
+func TestAdmin_signedInvalidateView(t *testing.T) {
+	secret := "secret"
+	now := time.Now().Unix()
+
+	signedQuery := func(host, path string, ts int64) string {
+		timestamp := strconv.FormatInt(ts, 10)
+		signature := invalidationSignature([]byte(secret), []byte(host), []byte(path), []byte(timestamp))
+
+		return fmt.Sprintf("host=%s&path=%s&timestamp=%s&signature=%s", host, path, timestamp, signature)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		statusCode int
+		callAdd    bool
+	}{
+		{
+			name:       "Ok",
+			query:      signedQuery("www.kratgo.com", "/es/", now),
+			statusCode: 200,
+			callAdd:    true,
+		},
+		{
+			name:       "InvalidSignature",
+			query:      signedQuery("www.kratgo.com", "/es/", now) + "0",
+			statusCode: 401,
+		},
+		{
+			name:       "TamperedPath",
+			query:      strings.Replace(signedQuery("www.kratgo.com", "/es/", now), "path=/es/", "path=/", 1),
+			statusCode: 401,
+		},
+		{
+			name:       "Expired",
+			query:      signedQuery("www.kratgo.com", "/es/", now-defaultSignatureMaxAge-60),
+			statusCode: 401,
+		},
+		{
+			name:       "Future",
+			query:      signedQuery("www.kratgo.com", "/es/", now+defaultSignatureMaxAge+60),
+			statusCode: 401,
+		},
+		{
+			name:       "WithoutTimestamp",
+			query:      "host=www.kratgo.com&signature=abc",
+			statusCode: 401,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.SignedInvalidation.Secret = secret
+
+			admin, err := New(cfg)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			invalidatorMock := new(mockInvalidator)
+			admin.invalidator = invalidatorMock
+
+			actx := new(atreugo.RequestCtx)
+			actx.RequestCtx = new(fasthttp.RequestCtx)
+			actx.Request.Header.SetMethod("GET")
+			actx.Request.URI().SetQueryString(tt.query)
+
+			if err := admin.signedInvalidateView(actx); err != nil {
+				t.Fatalf("Admin.signedInvalidateView() error == '%v'", err)
+			}
+
+			if statusCode := actx.Response.StatusCode(); statusCode != tt.statusCode {
+				t.Errorf("Admin.signedInvalidateView() status code == '%d', want '%d'", statusCode, tt.statusCode)
+			}
+
+			if invalidatorMock.addCalled != tt.callAdd {
+				t.Fatalf("Admin.signedInvalidateView() called to admin.invalidator.Add(...) == '%v', want '%v'",
+					invalidatorMock.addCalled, tt.callAdd)
+			}
+
+			if tt.callAdd && (invalidatorMock.entry.Host != "www.kratgo.com" || invalidatorMock.entry.Path != "/es/") {
+				t.Errorf("Admin.signedInvalidateView() entry == '%+v', want host '%s' and path '%s'",
+					invalidatorMock.entry, "www.kratgo.com", "/es/")
+			}
+		})
+	}
+}
+
+func TestAdmin_isAuthorized(t *testing.T) {
+	type args struct {
+		token         string
+		authorization string
+	}
+
+	type want struct {
+		authorized bool
+	}
+
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "NoTokenConfigured",
+			args: args{},
+			want: want{
+				authorized: true,
+			},
+		},
+		{
+			name: "ValidToken",
+			args: args{
+				token:         "secret",
+				authorization: "Bearer secret",
+			},
+			want: want{
+				authorized: true,
+			},
+		},
+		{
+			name: "InvalidToken",
+			args: args{
+				token:         "secret",
+				authorization: "Bearer other",
+			},
+			want: want{
+				authorized: false,
+			},
+		},
+		{
+			name: "MissingHeader",
+			args: args{
+				token: "secret",
+			},
+			want: want{
+				authorized: false,
+			},
+		},
+		{
+			name: "InvalidScheme",
+			args: args{
+				token:         "secret",
+				authorization: "Basic secret",
+			},
+			want: want{
+				authorized: false,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.Token = tt.args.token
+
+			admin, err := New(cfg)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			actx := new(atreugo.RequestCtx)
+			actx.RequestCtx = new(fasthttp.RequestCtx)
+
+			if tt.args.authorization != "" {
+				actx.Request.Header.Set(fasthttp.HeaderAuthorization, tt.args.authorization)
+			}
+
+			if authorized := admin.isAuthorized(actx); authorized != tt.want.authorized {
+				t.Errorf("Admin.isAuthorized() == '%v', want '%v'", authorized, tt.want.authorized)
+			}
+		})
+	}
+}
+
+func TestAdmin_entryView(t *testing.T) {
+	type args struct {
+		host    string
+		path    string
+		variant *string
+		token   string
+		auth    string
+	}
+
+	type want struct {
+		statusCode int
+		body       []byte
+		variant    string
+	}
+
+	host := "www.kratgo.com"
+	path := "/fast/"
+	body := []byte("Kratgo is not slow")
+	mobileBody := []byte("Kratgo is not slow on mobile")
+	mobile := "device=mobile"
+	unknown := "device=tv"
+
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "Ok",
+			args: args{
+				host:  host,
+				path:  path,
+				token: "secret",
+				auth:  "secret",
+			},
+			want: want{
+				statusCode: 200,
+				body:       body,
+			},
+		},
+		{
+			name: "Variant",
+			args: args{
+				host:    host,
+				path:    path,
+				variant: &mobile,
+				token:   "secret",
+				auth:    "secret",
+			},
+			want: want{
+				statusCode: 200,
+				body:       mobileBody,
+				variant:    mobile,
+			},
+		},
+		{
+			name: "VariantNotFound",
+			args: args{
+				host:    host,
+				path:    path,
+				variant: &unknown,
+				token:   "secret",
+				auth:    "secret",
+			},
+			want: want{
+				statusCode: 404,
+			},
+		},
+		{
+			name: "PathNotFound",
+			args: args{
+				host:  host,
+				path:  "/slow/",
+				token: "secret",
+				auth:  "secret",
+			},
+			want: want{
+				statusCode: 404,
+			},
+		},
+		{
+			name: "HostNotFound",
+			args: args{
+				host:  "www.slow.com",
+				path:  path,
+				token: "secret",
+				auth:  "secret",
+			},
+			want: want{
+				statusCode: 404,
+			},
+		},
+		{
+			name: "MissingArgs",
+			args: args{
+				host:  host,
+				token: "secret",
+				auth:  "secret",
+			},
+			want: want{
+				statusCode: 400,
+			},
+		},
+		{
+			name: "Unauthorized",
+			args: args{
+				host:  host,
+				path:  path,
+				token: "secret",
+			},
+			want: want{
+				statusCode: 401,
+			},
+		},
+		{
+			name: "WithoutToken",
+			args: args{
+				host: host,
+				path: path,
+			},
+			want: want{
+				statusCode: 403,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.Token = tt.args.token
+
+			admin, err := New(cfg)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			admin.cache.Set(host, cache.Entry{
+				Responses: []cache.Response{
+					{
+						Path: []byte(path),
+						Body: body,
+						Headers: []cache.ResponseHeader{
+							{Key: []byte("X-Data"), Value: []byte("1")},
+						},
+					},
+					{
+						Path:    []byte(path),
+						Variant: []byte(mobile),
+						Body:    mobileBody,
+						Headers: []cache.ResponseHeader{
+							{Key: []byte("X-Data"), Value: []byte("1")},
+						},
+					},
+				},
+			})
+
+			actx := new(atreugo.RequestCtx)
+			actx.RequestCtx = new(fasthttp.RequestCtx)
+
+			actx.Request.Header.SetMethod("GET")
+			if tt.args.auth != "" {
+				actx.Request.Header.Set(fasthttp.HeaderAuthorization, authHeaderPrefix+tt.args.auth)
+			}
+
+			actx.QueryArgs().Set("host", tt.args.host)
+			if tt.args.path != "" {
+				actx.QueryArgs().Set("path", tt.args.path)
+			}
+			if tt.args.variant != nil {
+				actx.QueryArgs().Set("variant", *tt.args.variant)
+			}
+
+			if err = admin.entryView(actx); err != nil {
+				t.Fatalf("Admin.entryView() unexpected error: %v", err)
+			}
+
+			statusCode := actx.Response.StatusCode()
+			if statusCode != tt.want.statusCode {
+				t.Fatalf("Admin.entryView() status code == '%d', want '%d'", statusCode, tt.want.statusCode)
+			}
+
+			if statusCode != 200 {
+				return
+			}
+
+			resp := entryResponse{}
+			if err := json.Unmarshal(actx.Response.Body(), &resp); err != nil {
+				t.Fatalf("Admin.entryView() invalid json response: %v", err)
+			}
+
+			if resp.Path != path {
+				t.Errorf("Admin.entryView() path == '%s', want '%s'", resp.Path, path)
+			}
+
+			if resp.Variant != tt.want.variant {
+				t.Errorf("Admin.entryView() variant == '%s', want '%s'", resp.Variant, tt.want.variant)
+			}
+
+			if wantVariants := []string{"", mobile}; !reflect.DeepEqual(resp.Variants, wantVariants) {
+				t.Errorf("Admin.entryView() variants == '%v', want '%v'", resp.Variants, wantVariants)
+			}
+
+			if !bytes.Equal(resp.Body, tt.want.body) {
+				t.Errorf("Admin.entryView() body == '%s', want '%s'", resp.Body, tt.want.body)
+			}
+
+			if resp.BodySize != len(tt.want.body) {
+				t.Errorf("Admin.entryView() body size == '%d', want '%d'", resp.BodySize, len(tt.want.body))
+			}
+
+			if len(resp.Headers) != 1 || resp.Headers[0].Key != "X-Data" || resp.Headers[0].Value != "1" {
+				t.Errorf("Admin.entryView() headers == '%v', want '%v'", resp.Headers, "X-Data: 1")
+			}
+		})
+	}
+}
+
+func TestAdmin_purgeHostView(t *testing.T) {
+	host := "www.kratgo.com"
+
+	tests := []struct {
+		name       string
+		body       string
+		token      string
+		statusCode int
+		purged     int
+	}{
+		{name: "Ok", body: `{"host": "www.kratgo.com"}`, statusCode: 200, purged: 2},
+		{name: "HostNotFound", body: `{"host": "www.slow.com"}`, statusCode: 200, purged: 0},
+		{name: "MissingHost", body: `{}`, statusCode: 400},
+		{name: "InvalidBody", body: `host`, statusCode: 400},
+		{name: "Unauthorized", body: `{"host": "www.kratgo.com"}`, token: "secret", statusCode: 401},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.Token = tt.token
+
+			admin, err := New(cfg)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			admin.cache.Set(host, cache.Entry{
+				Responses: []cache.Response{
+					{Path: []byte("/fast/"), Body: []byte("fast")},
+					{Path: []byte("/faster/"), Body: []byte("faster")},
+				},
+			})
+
+			actx := new(atreugo.RequestCtx)
+			actx.RequestCtx = new(fasthttp.RequestCtx)
+
+			actx.Request.Header.SetMethod("POST")
+			actx.Request.SetBodyString(tt.body)
+
+			if err = admin.purgeHostView(actx); err != nil {
+				t.Fatalf("Admin.purgeHostView() unexpected error: %v", err)
+			}
+
+			statusCode := actx.Response.StatusCode()
+			if statusCode != tt.statusCode {
+				t.Fatalf("Admin.purgeHostView() status code == '%d', want '%d'", statusCode, tt.statusCode)
+			}
+
+			if statusCode != 200 {
+				return
+			}
+
+			resp := purgeHostResponse{}
+			if err := json.Unmarshal(actx.Response.Body(), &resp); err != nil {
+				t.Fatalf("Admin.purgeHostView() invalid json response: %v", err)
+			}
+
+			if resp.Purged != tt.purged {
+				t.Errorf("Admin.purgeHostView() purged == '%d', want '%d'", resp.Purged, tt.purged)
+			}
+
+			if tt.purged > 0 && admin.cache.Len() != 0 {
+				t.Errorf("Admin.purgeHostView() cache length == '%d', want '%d'", admin.cache.Len(), 0)
+			}
+		})
+	}
+}
+
+func TestAdmin_maintenanceView(t *testing.T) {
+	admin, err := New(testConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	newCtx := func(body string) *atreugo.RequestCtx {
+		actx := new(atreugo.RequestCtx)
+		actx.RequestCtx = new(fasthttp.RequestCtx)
+		actx.Request.SetBodyString(body)
+
+		return actx
+	}
+
+	actx := newCtx("")
+	if err := admin.maintenanceView(actx); err != nil {
+		t.Fatalf("Admin.maintenanceView() unexpected error: %v", err)
+	}
+
+	if statusCode := actx.Response.StatusCode(); statusCode != fasthttp.StatusServiceUnavailable {
+		t.Errorf("Admin.maintenanceView() without proxy status code == '%d', want '%d'", statusCode, fasthttp.StatusServiceUnavailable)
+	}
+
+	proxyMock := new(mockProxy)
+	admin.proxy = proxyMock
+
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+		enabled    bool
+	}{
+		{name: "Enable", body: `{"enabled": true}`, statusCode: 200, enabled: true},
+		{name: "InvalidBody", body: `enabled`, statusCode: 400, enabled: true},
+		{name: "Disable", body: `{"enabled": false}`, statusCode: 200, enabled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actx := newCtx(tt.body)
+			if err := admin.setMaintenanceView(actx); err != nil {
+				t.Fatalf("Admin.setMaintenanceView() unexpected error: %v", err)
+			}
+
+			if statusCode := actx.Response.StatusCode(); statusCode != tt.statusCode {
+				t.Fatalf("Admin.setMaintenanceView() status code == '%d', want '%d'", statusCode, tt.statusCode)
+			}
+
+			if proxyMock.maintenance != tt.enabled {
+				t.Errorf("Admin.setMaintenanceView() enabled == '%v', want '%v'", proxyMock.maintenance, tt.enabled)
+			}
+
+			actx = newCtx("")
+			if err := admin.maintenanceView(actx); err != nil {
+				t.Fatalf("Admin.maintenanceView() unexpected error: %v", err)
+			}
+
+			state := maintenanceState{}
+			if err := json.Unmarshal(actx.Response.Body(), &state); err != nil {
+				t.Fatalf("Admin.maintenanceView() invalid json response: %v", err)
+			}
+
+			if state.Enabled != tt.enabled {
+				t.Errorf("Admin.maintenanceView() enabled == '%v', want '%v'", state.Enabled, tt.enabled)
+			}
+		})
+	}
+}
+
+func TestAdmin_restartCanaryRampView(t *testing.T) {
+	tests := []struct {
+		name        string
+		proxy       *mockProxy
+		statusCode  int
+		wantPercent float64
+	}{
+		{name: "WithoutProxy", statusCode: 503},
+		{name: "WithoutRamp", proxy: &mockProxy{}, statusCode: 503},
+		{name: "Restart", proxy: &mockProxy{canaryRamp: true, canaryPercent: 5}, statusCode: 200, wantPercent: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin, err := New(testConfig())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if tt.proxy != nil {
+				admin.proxy = tt.proxy
+			}
+
+			actx := new(atreugo.RequestCtx)
+			actx.RequestCtx = new(fasthttp.RequestCtx)
+
+			if err := admin.restartCanaryRampView(actx); err != nil {
+				t.Fatalf("Admin.restartCanaryRampView() unexpected error: %v", err)
+			}
+
+			if statusCode := actx.Response.StatusCode(); statusCode != tt.statusCode {
+				t.Fatalf("Admin.restartCanaryRampView() status code == '%d', want '%d'", statusCode, tt.statusCode)
+			}
+
+			if tt.statusCode != 200 {
+				return
+			}
+
+			if !tt.proxy.canaryRampRestarted {
+				t.Error("Admin.restartCanaryRampView() ramp not restarted")
+			}
+
+			state := canaryRampState{}
+			if err := json.Unmarshal(actx.Response.Body(), &state); err != nil {
+				t.Fatalf("Admin.restartCanaryRampView() invalid json response: %v", err)
+			}
+
+			if state.Percent != tt.wantPercent {
+				t.Errorf("Admin.restartCanaryRampView() percent == '%v', want '%v'", state.Percent, tt.wantPercent)
+			}
+		})
+	}
+}
+
+func TestAdmin_reloadRulesView(t *testing.T) {
+	f, err := ioutil.TempFile("", "kratgo-reload-rules-*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString("proxy:\n  nocache:\n    - \"$(path) == '/'\"\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	admin, err := New(testConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	admin.configFilePath = f.Name()
+
+	reloadRules := func() *atreugo.RequestCtx {
+		actx := new(atreugo.RequestCtx)
+		actx.RequestCtx = new(fasthttp.RequestCtx)
+
+		if err := admin.reloadRulesView(actx); err != nil {
+			t.Fatalf("Admin.reloadRulesView() unexpected error: %v", err)
+		}
+
+		return actx
+	}
+
+	if statusCode := reloadRules().Response.StatusCode(); statusCode != fasthttp.StatusServiceUnavailable {
+		t.Errorf("Admin.reloadRulesView() without proxy status code == '%d', want '%d'", statusCode, fasthttp.StatusServiceUnavailable)
+	}
+
+	proxyMock := new(mockProxy)
+	admin.proxy = proxyMock
+
+	if statusCode := reloadRules().Response.StatusCode(); statusCode != fasthttp.StatusOK {
+		t.Errorf("Admin.reloadRulesView() status code == '%d', want '%d'", statusCode, fasthttp.StatusOK)
+	}
+
+	if proxyMock.reloadedRules == nil || len(proxyMock.reloadedRules.Nocache) != 1 {
+		t.Errorf("Admin.reloadRulesView() reloaded rules == '%v', want the ones of the file", proxyMock.reloadedRules)
+	}
+
+	proxyMock.reloadErr = errors.New("invalid rule")
+
+	if statusCode := reloadRules().Response.StatusCode(); statusCode != fasthttp.StatusBadRequest {
+		t.Errorf("Admin.reloadRulesView() with invalid rules status code == '%d', want '%d'", statusCode, fasthttp.StatusBadRequest)
+	}
+
+	proxyMock.reloadErr = nil
+	admin.configFilePath = f.Name() + ".missing"
+
+	if statusCode := reloadRules().Response.StatusCode(); statusCode != fasthttp.StatusBadRequest {
+		t.Errorf("Admin.reloadRulesView() with missing file status code == '%d', want '%d'", statusCode, fasthttp.StatusBadRequest)
+	}
+
+	admin.fileConfig.Token = "secret"
+
+	if statusCode := reloadRules().Response.StatusCode(); statusCode != fasthttp.StatusUnauthorized {
+		t.Errorf("Admin.reloadRulesView() without token status code == '%d', want '%d'", statusCode, fasthttp.StatusUnauthorized)
+	}
+}
+
+func TestAdmin_benchEchoView(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.Token = "secret"
+	cfg.FileConfig.BenchEcho = true
+
+	admin, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	benchEcho := func(token string) *atreugo.RequestCtx {
+		actx := new(atreugo.RequestCtx)
+		actx.RequestCtx = new(fasthttp.RequestCtx)
+		actx.Request.SetRequestURI("/bench-echo")
+		actx.Request.Header.Set(fasthttp.HeaderAuthorization, authHeaderPrefix+token)
+
+		if err := admin.benchEchoView(actx); err != nil {
+			t.Fatalf("Admin.benchEchoView() unexpected error: %v", err)
+		}
+
+		return actx
+	}
+
+	if statusCode := benchEcho("secret").Response.StatusCode(); statusCode != fasthttp.StatusServiceUnavailable {
+		t.Errorf("Admin.benchEchoView() without proxy status code == '%d', want '%d'", statusCode, fasthttp.StatusServiceUnavailable)
+	}
+
+	proxyMock := new(mockProxy)
+	admin.proxy = proxyMock
+
+	if statusCode := benchEcho("invalid").Response.StatusCode(); statusCode != fasthttp.StatusUnauthorized {
+		t.Errorf("Admin.benchEchoView() with invalid token status code == '%d', want '%d'", statusCode, fasthttp.StatusUnauthorized)
+	}
+
+	actx := benchEcho("secret")
+	if body := string(actx.Response.Body()); body != "echo" {
+		t.Errorf("Admin.benchEchoView() body == '%s', want '%s'", body, "echo")
+	}
+
+	if len(proxyMock.benchEchoAuthorization) > 0 {
+		t.Errorf("Admin.benchEchoView() has forwarded the token to the proxy: '%s'", proxyMock.benchEchoAuthorization)
+	}
+}
+
+func TestAdmin_statsView(t *testing.T) {
+	admin, err := New(testConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	actx := new(atreugo.RequestCtx)
+	actx.RequestCtx = new(fasthttp.RequestCtx)
+
+	if err := admin.statsView(actx); err != nil {
+		t.Fatalf("Admin.statsView() unexpected error: %v", err)
+	}
+
+	if statusCode := actx.Response.StatusCode(); statusCode != fasthttp.StatusServiceUnavailable {
+		t.Errorf("Admin.statsView() without proxy status code == '%d', want '%d'", statusCode, fasthttp.StatusServiceUnavailable)
+	}
+
+	stats := proxy.Stats{
+		Backends: []proxy.LatencySummary{{Name: "localhost:8080", Count: 10, P50: 1.5, P95: 3, P99: 4}},
+		Routes:   []proxy.LatencySummary{},
+	}
+	admin.proxy = &mockProxy{stats: stats}
+
+	actx.Response.Reset()
+
+	if err := admin.statsView(actx); err != nil {
+		t.Fatalf("Admin.statsView() unexpected error: %v", err)
+	}
+
+	got := proxy.Stats{}
+	if err := json.Unmarshal(actx.Response.Body(), &got); err != nil {
+		t.Fatalf("Admin.statsView() invalid json response: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, stats) {
+		t.Errorf("Admin.statsView() == '%v', want '%v'", got, stats)
+	}
+}
+
+func TestAdmin_statusView(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     invalidator.Status
+		statusCode int
+	}{
+		{
+			name:       "Running",
+			status:     invalidator.Status{Running: true, ActiveWorkers: 1, Pending: 2, Processed: 10},
+			statusCode: fasthttp.StatusOK,
+		},
+		{
+			name:       "Died",
+			status:     invalidator.Status{Running: false, Processed: 10, LastError: "Invalidator has died: error"},
+			statusCode: fasthttp.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin, err := New(testConfig())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			admin.invalidator = &mockInvalidator{status: tt.status}
+
+			actx := new(atreugo.RequestCtx)
+			actx.RequestCtx = new(fasthttp.RequestCtx)
+
+			if err := admin.statusView(actx); err != nil {
+				t.Fatalf("Admin.statusView() unexpected error: %v", err)
+			}
+
+			if statusCode := actx.Response.StatusCode(); statusCode != tt.statusCode {
+				t.Errorf("Admin.statusView() status code == '%d', want '%d'", statusCode, tt.statusCode)
+			}
+
+			got := statusResponse{}
+			if err := json.Unmarshal(actx.Response.Body(), &got); err != nil {
+				t.Fatalf("Admin.statusView() invalid json response: %v", err)
+			}
+
+			if !reflect.DeepEqual(got.Invalidator, tt.status) {
+				t.Errorf("Admin.statusView() == '%v', want '%v'", got.Invalidator, tt.status)
+			}
+		})
+	}
+}
+
+func TestAdmin_exportView_importView(t *testing.T) {
+	admin, err := New(testConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	actx := new(atreugo.RequestCtx)
+	actx.RequestCtx = new(fasthttp.RequestCtx)
+
+	if err := admin.exportView(actx); err != nil {
+		t.Fatalf("Admin.exportView() unexpected error: %v", err)
+	}
+
+	if contentType := string(actx.Response.Header.ContentType()); contentType != snapshotContentType {
+		t.Errorf("Admin.exportView() content type == '%s', want '%s'", contentType, snapshotContentType)
+	}
+
+	snapshot := append([]byte(nil), actx.Response.Body()...)
+	if len(snapshot) == 0 {
+		t.Fatal("Admin.exportView() empty snapshot")
+	}
+
+	tests := []struct {
+		name       string
+		body       []byte
+		statusCode int
+	}{
+		{name: "Snapshot", body: snapshot, statusCode: 200},
+		{name: "Invalid", body: []byte("kratgo"), statusCode: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actx := new(atreugo.RequestCtx)
+			actx.RequestCtx = new(fasthttp.RequestCtx)
+			actx.Request.SetBody(tt.body)
+
+			if err := admin.importView(actx); err != nil {
+				t.Fatalf("Admin.importView() unexpected error: %v", err)
+			}
+
+			if statusCode := actx.Response.StatusCode(); statusCode != tt.statusCode {
+				t.Fatalf("Admin.importView() status code == '%d', want '%d'", statusCode, tt.statusCode)
+			}
+
+			if tt.statusCode != 200 {
+				return
+			}
+
+			resp := importResponse{}
+			if err := json.Unmarshal(actx.Response.Body(), &resp); err != nil {
+				t.Fatalf("Admin.importView() invalid json response: %v", err)
+			}
+
+			if resp.Imported != 0 {
+				t.Errorf("Admin.importView() imported == '%d', want '%d'", resp.Imported, 0)
+			}
+		})
+	}
+}
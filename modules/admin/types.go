@@ -2,13 +2,16 @@ package admin
 
 import (
 	"io"
+	"time"
 
 	"github.com/savsgio/kratgo/modules/cache"
 	"github.com/savsgio/kratgo/modules/config"
 	"github.com/savsgio/kratgo/modules/invalidator"
+	"github.com/savsgio/kratgo/modules/proxy"
 
 	"github.com/savsgio/atreugo/v11"
 	logger "github.com/savsgio/go-logger/v2"
+	"github.com/valyala/fasthttp"
 )
 
 // Config ...
@@ -16,6 +19,10 @@ type Config struct {
 	FileConfig  config.Admin
 	Cache       *cache.Cache
 	Invalidator Invalidator
+	Proxy       Proxy
+
+	// ConfigFilePath is the configuration file to reload the rules from (Optional)
+	ConfigFilePath string
 
 	HTTPScheme string
 
@@ -27,26 +34,86 @@ type Config struct {
 type Admin struct {
 	fileConfig config.Admin
 
-	server      Server
+	servers     []Server
 	cache       *cache.Cache
 	invalidator Invalidator
+	proxy       Proxy
+
+	configFilePath string
 
 	httpScheme string
 
+	signatureMaxAge int64
+
 	log *logger.Logger
 }
 
+type entryHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type entryResponse struct {
+	Host          string        `json:"host"`
+	Path          string        `json:"path"`
+	Variant       string        `json:"variant"`
+	Variants      []string      `json:"variants"`
+	Headers       []entryHeader `json:"headers"`
+	BodySize      int           `json:"bodySize"`
+	Body          []byte        `json:"body"`
+	BodyTruncated bool          `json:"bodyTruncated"`
+}
+
+type purgeHostRequest struct {
+	Host string `json:"host"`
+}
+
+type purgeHostResponse struct {
+	Host   string `json:"host"`
+	Purged int    `json:"purged"`
+}
+
+type statusResponse struct {
+	Invalidator invalidator.Status `json:"invalidator"`
+}
+
+type maintenanceState struct {
+	Enabled bool `json:"enabled"`
+}
+
+type importResponse struct {
+	Imported int `json:"imported"`
+}
+
+type canaryRampState struct {
+	Percent float64 `json:"percent"`
+}
+
 // ###### INTERFACES ######
 
 // Invalidator ...
 type Invalidator interface {
 	Start()
 	Add(e invalidator.Entry) error
+	AddAndWait(e invalidator.Entry, timeout time.Duration) error
+	Status() invalidator.Status
+}
+
+// Proxy ...
+type Proxy interface {
+	Stats() proxy.Stats
+	SetMaintenance(enabled bool)
+	Maintenance() bool
+	RestartCanaryRamp() bool
+	CanaryPercent() float64
+	ReloadRules(cfg config.Proxy) error
+	BenchEcho(ctx *fasthttp.RequestCtx)
 }
 
 // Server ...
 type Server interface {
 	ListenAndServe() error
 	Path(httpMethod string, url string, viewFn atreugo.View) *atreugo.Path
+	UseBefore(fns ...atreugo.Middleware) *atreugo.Router
 	SetLogOutput(output io.Writer)
 }
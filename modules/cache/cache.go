@@ -1,7 +1,11 @@
 package cache
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/savsgio/kratgo/modules/config"
@@ -13,8 +17,8 @@ import (
 
 func bigcacheConfig(cfg config.Cache) bigcache.Config {
 	return bigcache.Config{
-		Shards:             defaultBigcacheShards,
-		LifeWindow:         time.Duration(cfg.TTL) * time.Minute,
+		Shards:             shards(cfg),
+		LifeWindow:         lifeWindow(cfg),
 		CleanWindow:        time.Duration(cfg.CleanFrequency) * time.Minute,
 		MaxEntriesInWindow: cfg.MaxEntries,
 		MaxEntrySize:       cfg.MaxEntrySize,
@@ -23,31 +27,290 @@ func bigcacheConfig(cfg config.Cache) bigcache.Config {
 	}
 }
 
+// shards returns the number of shards, each one with its own lock, or the default one if not configured
+func shards(cfg config.Cache) int {
+	if cfg.Shards == 0 {
+		return defaultBigcacheShards
+	}
+
+	return cfg.Shards
+}
+
+// maxTTL returns the longest TTL in minutes, the global one or one of the content types
+func maxTTL(cfg config.Cache) int {
+	ttl := cfg.TTL
+
+	for _, ct := range cfg.TTLByContentType {
+		if ct.TTL > ttl {
+			ttl = ct.TTL
+		}
+	}
+
+	return ttl
+}
+
+// lifeWindow returns the longest TTL extended with the jitter, so the responses
+// with a longer jittered TTL are not evicted before they expire
+func lifeWindow(cfg config.Cache) time.Duration {
+	ttl := time.Duration(maxTTL(cfg)) * time.Minute
+
+	return ttl + ttl*time.Duration(cfg.TTLJitter)/100
+}
+
+// validateConfig checks the configuration before creating the bigcache instance,
+// to return an error naming the offending field
+func validateConfig(cfg config.Cache) error {
+	if cfg.TTL <= 0 {
+		return fmt.Errorf("Cache.TTL configuration must be greater than 0")
+	}
+
+	if cfg.CleanFrequency <= 0 {
+		return fmt.Errorf("Cache.CleanFrequency configuration must be greater than 0")
+	}
+
+	if cfg.MaxEntries <= 0 {
+		return fmt.Errorf("Cache.MaxEntries configuration must be greater than 0")
+	}
+
+	if cfg.MaxEntrySize <= 0 {
+		return fmt.Errorf("Cache.MaxEntrySize configuration must be greater than 0")
+	}
+
+	if cfg.MaxAge < 0 {
+		return fmt.Errorf("Cache.MaxAge configuration must be 0 (unlimited) or greater")
+	}
+
+	if cfg.TTLJitter < 0 || cfg.TTLJitter >= 100 {
+		return fmt.Errorf("Cache.TTLJitter configuration must be between 0 and 99")
+	}
+
+	for _, ct := range cfg.TTLByContentType {
+		if ct.ContentType == "" || ct.TTL <= 0 {
+			return fmt.Errorf("Cache.TTLByContentType configuration must have content type and TTL greater than 0")
+		}
+	}
+
+	if cfg.HardMaxCacheSize < 0 {
+		return fmt.Errorf("Cache.HardMaxCacheSize configuration must be 0 (unlimited) or greater")
+	}
+
+	// The shard of an entry is selected by a mask of the hash of its key
+	if cfg.Shards < 0 || cfg.Shards&(cfg.Shards-1) != 0 {
+		return fmt.Errorf("Cache.Shards configuration must be a power of two")
+	}
+
+	if mp := cfg.MemoryPressure; mp.HighWatermark != 0 {
+		if mp.HighWatermark < 0 || mp.LowWatermark <= 0 || mp.LowWatermark >= mp.HighWatermark {
+			return fmt.Errorf(
+				"Cache.MemoryPressure configuration must have a lowWatermark greater than 0 and less than the highWatermark",
+			)
+		}
+	}
+
+	if disk := cfg.Tiers.Disk; disk.Path != "" {
+		// The entries are only demoted to disk when the memory is full
+		if cfg.HardMaxCacheSize == 0 {
+			return fmt.Errorf("Cache.Tiers.Disk configuration requires Cache.HardMaxCacheSize")
+		}
+
+		if disk.MaxSize <= 0 {
+			return fmt.Errorf("Cache.Tiers.Disk.MaxSize configuration must be greater than 0")
+		}
+	}
+
+	if cfg.HardMaxCacheSize > 0 {
+		// The hard limit is split between all shards, and an entry must fit in one of them
+		maxShardSize := cfg.HardMaxCacheSize * megabyte / shards(cfg)
+
+		if cfg.MaxEntrySize > maxShardSize {
+			return fmt.Errorf(
+				"Cache.MaxEntrySize configuration (%d bytes) must be less than or equal to %d bytes, "+
+					"the size of each one of the %d shards with Cache.HardMaxCacheSize of %d MB",
+				cfg.MaxEntrySize, maxShardSize, shards(cfg), cfg.HardMaxCacheSize,
+			)
+		}
+	}
+
+	return nil
+}
+
 // New ...
 func New(cfg Config) (*Cache, error) {
-	if cfg.FileConfig.CleanFrequency == 0 {
-		return nil, fmt.Errorf("Cache.CleanFrequency configuration must be greater than 0")
+	if err := validateConfig(cfg.FileConfig); err != nil {
+		return nil, err
 	}
 
 	c := new(Cache)
 	c.fileConfig = cfg.FileConfig
 
-	log := logger.New("kratgo-cache", cfg.LogLevel, cfg.LogOutput)
+	if c.fileConfig.Namespace != "" {
+		c.namespacePrefix = c.fileConfig.Namespace + namespaceSeparator
+	}
+
+	c.log = logger.New("kratgo-cache", cfg.LogLevel, cfg.LogOutput)
+
+	c.store = cfg.Store
+
+	if c.store != nil && c.fileConfig.Tiers.Disk.Path != "" {
+		return nil, fmt.Errorf("Cache.Tiers configuration is only supported by the default store")
+	}
+
+	if c.store == nil {
+		bigcacheCFG := bigcacheConfig(c.fileConfig)
+		bigcacheCFG.Logger = c.log
+		bigcacheCFG.Verbose = cfg.LogLevel == logger.DEBUG
+
+		var tiered *tieredStore
+
+		if c.fileConfig.Tiers.Disk.Path != "" {
+			disk, err := newDiskStore(c.fileConfig.Tiers.Disk)
+			if err != nil {
+				return nil, fmt.Errorf("Could not create the cache: %v", err)
+			}
+
+			// Only the entries evicted to make room are demoted, the expired ones are dropped
+			bigcacheCFG = bigcacheCFG.OnRemoveFilterSet(bigcache.NoSpace)
+			bigcacheCFG.OnRemoveWithReason = func(key string, value []byte, reason bigcache.RemoveReason) {
+				tiered.demote(key, value)
+			}
 
-	bigcacheCFG := bigcacheConfig(c.fileConfig)
-	bigcacheCFG.Logger = log
-	bigcacheCFG.Verbose = cfg.LogLevel == logger.DEBUG
+			tiered = newTieredStore(nil, disk)
+		}
 
-	c.bc, _ = bigcache.NewBigCache(bigcacheCFG)
+		store, err := newBigcacheStore(bigcacheCFG)
+		if err != nil {
+			return nil, fmt.Errorf("Could not create the cache: %v", err)
+		}
+		c.store = store
+
+		// The entries on disk are not expired by the store, so their responses need the expiration
+		if tiered != nil {
+			tiered.memory = store
+			c.store = tiered
+			c.tiered = tiered
+		} else {
+			c.storeExpiration = true
+		}
+	}
+
+	c.done = make(chan struct{})
+
+	if c.tiered != nil {
+		go c.runDemoter()
+	}
+
+	if c.fileConfig.MemoryPressure.HighWatermark > 0 {
+		c.memory = newMemoryWatchdog(c.fileConfig.MemoryPressure)
+		go c.runMemoryWatchdog()
+	}
 
 	return c, nil
 }
 
+// StoredKey returns the key as it's stored, with the namespace prefix,
+// and hashed if the hash of the keys is enabled
+func (c *Cache) StoredKey(k string) string {
+	if c.fileConfig.HashKeys {
+		sum := sha256.Sum256(gotils.S2B(k))
+		k = hex.EncodeToString(sum[:])
+	}
+
+	if c.namespacePrefix == "" {
+		return k
+	}
+
+	return c.namespacePrefix + k
+}
+
+// TrimNamespace returns the key without the namespace prefix,
+// and false if the stored key does not belong to the namespace of the cache
+func (c *Cache) TrimNamespace(storedKey string) (string, bool) {
+	if !strings.HasPrefix(storedKey, c.namespacePrefix) {
+		return "", false
+	}
+
+	return storedKey[len(c.namespacePrefix):], true
+}
+
+// FailOpen reports if the read errors must be handled as misses,
+// so the responses are fetched from the backends instead of failing
+func (c *Cache) FailOpen() bool {
+	return c.fileConfig.FailOpen == nil || *c.fileConfig.FailOpen
+}
+
+// Fresh reports if the response could be served from cache,
+// so it's not expired and its age does not exceed the configured max age
+func (c *Cache) Fresh(r *Response, now int64) bool {
+	if r.Expired(now) {
+		return false
+	}
+
+	return c.fileConfig.MaxAge <= 0 || r.Age(now) <= int64(c.fileConfig.MaxAge)
+}
+
+// Stale reports if the response is not fresh since at most grace seconds,
+// by its expiration or by the max age, whichever comes first
+func (c *Cache) Stale(r *Response, now, grace int64) bool {
+	if c.Fresh(r, now) {
+		return false
+	}
+
+	staleAt := r.ExpiresAt
+	if c.fileConfig.MaxAge > 0 {
+		if maxAgeAt := r.StoredAt + int64(c.fileConfig.MaxAge); staleAt == 0 || maxAgeAt < staleAt {
+			staleAt = maxAgeAt
+		}
+	}
+
+	return now-staleAt <= grace
+}
+
+// TTL returns the TTL in minutes of the responses with the media type,
+// the first one of the content types that matches it, or the global one
+func (c *Cache) TTL(mediaType string) int {
+	for _, ct := range c.fileConfig.TTLByContentType {
+		if strings.EqualFold(ct.ContentType, mediaType) {
+			return ct.TTL
+		}
+
+		if strings.HasSuffix(ct.ContentType, "/*") && len(mediaType) > len(ct.ContentType)-1 &&
+			strings.EqualFold(ct.ContentType[:len(ct.ContentType)-1], mediaType[:len(ct.ContentType)-1]) {
+			return ct.TTL
+		}
+	}
+
+	return c.fileConfig.TTL
+}
+
+// ExpiresAt returns the expiration of a response stored at the given time with the TTL in minutes,
+// randomized within ±TTLJitter percent of it. It returns 0 (the cache expiration)
+// if the jitter is disabled and the TTL is the cache one, only with the default store
+func (c *Cache) ExpiresAt(storedAt int64, ttlMinutes int) int64 {
+	ttl := int64(ttlMinutes) * 60
+
+	if c.fileConfig.TTLJitter <= 0 {
+		if c.storeExpiration && ttlMinutes == maxTTL(c.fileConfig) {
+			return 0
+		}
+
+		return storedAt + ttl
+	}
+
+	jitter := ttl * int64(c.fileConfig.TTLJitter) / 100
+
+	return storedAt + ttl - jitter + rand.Int63n(2*jitter+1)
+}
+
 // Set ...
 func (c *Cache) Set(key string, entry Entry) error {
+	return c.SetStored(c.StoredKey(key), entry)
+}
+
+// SetStored is like Set, but with the stored key (see StoredKey), like the keys of the iterator
+func (c *Cache) SetStored(storedKey string, entry Entry) error {
 	data, _ := Marshal(entry)
 
-	return c.bc.Set(key, data)
+	return c.store.Set(storedKey, data)
 }
 
 // SetBytes ...
@@ -57,11 +320,34 @@ func (c *Cache) SetBytes(key []byte, entry Entry) error {
 
 // Get ...
 func (c *Cache) Get(key string, dst *Entry) error {
-	data, err := c.bc.Get(key)
-	if err == bigcache.ErrEntryNotFound {
+	data, err := c.store.Get(c.StoredKey(key))
+	if err != nil {
+		return err
+	} else if data == nil {
 		return nil
-	} else if err != nil {
+	}
+
+	return Unmarshal(dst, data)
+}
+
+// Peek is like Get, but it doesn't change the cache, as the entries of the disk tier are not promoted
+// to memory. It's for the lookups that are not requests of the entries (ex: the admin api or the invalidator)
+func (c *Cache) Peek(key string, dst *Entry) error {
+	storedKey := c.StoredKey(key)
+
+	var data []byte
+	var err error
+
+	if c.tiered != nil {
+		data, err = c.tiered.Peek(storedKey)
+	} else {
+		data, err = c.store.Get(storedKey)
+	}
+
+	if err != nil {
 		return err
+	} else if data == nil {
+		return nil
 	}
 
 	return Unmarshal(dst, data)
@@ -74,7 +360,12 @@ func (c *Cache) GetBytes(key []byte, dst *Entry) error {
 
 // Del ...
 func (c *Cache) Del(key string) error {
-	return c.bc.Delete(key)
+	return c.DelStored(c.StoredKey(key))
+}
+
+// DelStored is like Del, but with the stored key (see StoredKey), like the keys of the iterator
+func (c *Cache) DelStored(storedKey string) error {
+	return c.store.Delete(storedKey)
 }
 
 // DelBytes ...
@@ -82,17 +373,96 @@ func (c *Cache) DelBytes(key []byte) error {
 	return c.Del(gotils.B2S(key))
 }
 
-// Iterator ...
-func (c *Cache) Iterator() *bigcache.EntryInfoIterator {
-	return c.bc.Iterator()
+// Purge deletes the entry of the key, with all its responses, and returns how many have been dropped
+func (c *Cache) Purge(key string) (int, error) {
+	entry := AcquireEntry()
+	defer ReleaseEntry(entry)
+
+	if err := c.Peek(key, entry); err != nil {
+		return 0, err
+	}
+
+	if err := c.Del(key); err != nil {
+		return 0, err
+	}
+
+	return len(entry.Responses), nil
+}
+
+// ForEach calls fn with the key and the entry of each cached host, of the cache namespace,
+// until fn returns false. If the hash of the keys is enabled, the key is the hash.
+// The entry is reused between calls, so it must not be retained after fn returns.
+// It's safe to call it concurrently with the reads and writes of the cache,
+// but the entries stored meanwhile could be iterated or not, and mutating them in fn is unsupported
+func (c *Cache) ForEach(fn func(key []byte, entry *Entry) bool) error {
+	return c.ForEachStored(func(storedKey string, entry *Entry) bool {
+		key, _ := c.TrimNamespace(storedKey)
+
+		return fn(gotils.S2B(key), entry)
+	})
+}
+
+// ForEachStored is like ForEach, but with the stored keys (see StoredKey), to modify the entries with them
+func (c *Cache) ForEachStored(fn func(storedKey string, entry *Entry) bool) error {
+	entry := AcquireEntry()
+	defer ReleaseEntry(entry)
+
+	var err error
+
+	iterErr := c.store.Iterate(func(storedKey string, value []byte) bool {
+		if _, ok := c.TrimNamespace(storedKey); !ok {
+			return true
+		}
+
+		entry.Reset()
+		if err = Unmarshal(entry, value); err != nil {
+			err = fmt.Errorf("Could not decode cache value of key '%s': %v", storedKey, err)
+			return false
+		}
+
+		return fn(storedKey, entry)
+	})
+	if iterErr != nil {
+		return iterErr
+	}
+
+	return err
 }
 
 // Len ...
 func (c *Cache) Len() int {
-	return c.bc.Len()
+	return c.store.Len()
 }
 
 // Reset ...
 func (c *Cache) Reset() error {
-	return c.bc.Reset()
+	return c.store.Reset()
+}
+
+// Close stops the background goroutines of the cache, the entries pending to be demoted to disk are dropped
+func (c *Cache) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// DroppedDemotions returns the entries evicted from memory that were not written to the disk tier,
+// as the disk was slower than the evictions
+func (c *Cache) DroppedDemotions() uint64 {
+	return c.tiered.droppedDemotions()
+}
+
+// runDemoter writes to disk the entries evicted from memory, until the cache is closed
+func (c *Cache) runDemoter() {
+	for {
+		select {
+		case d := <-c.tiered.demotions:
+			if err := c.tiered.writeDemotion(d); err != nil && err != ErrEntryTooLarge {
+				c.log.Errorf("Could not demote the entry of key '%s' to disk: %v", d.key, err)
+			}
+
+		case <-c.done:
+			return
+		}
+	}
 }
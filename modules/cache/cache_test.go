@@ -1,8 +1,11 @@
 package cache
 
 import (
+	"fmt"
 	"os"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -44,6 +47,12 @@ func Test_bigcacheConfig(t *testing.T) {
 		t.Errorf("bigcacheConfig() Shards == '%d', want '%d'", bcConfig.Shards, defaultBigcacheShards)
 	}
 
+	cfg.Shards = 16
+	if shards := bigcacheConfig(cfg).Shards; shards != cfg.Shards {
+		t.Errorf("bigcacheConfig() Shards == '%d', want '%d'", shards, cfg.Shards)
+	}
+	cfg.Shards = 0
+
 	lifeWindoow := time.Duration(cfg.TTL) * time.Minute
 	if bcConfig.LifeWindow != lifeWindoow {
 		t.Errorf("bigcacheConfig() LifeWindow == '%d', want '%d'", bcConfig.LifeWindow, lifeWindoow)
@@ -144,13 +153,316 @@ func TestNew(t *testing.T) {
 				t.Errorf("New() fileConfig == '%v', want '%v'", c.fileConfig, tt.args.cfg.FileConfig)
 			}
 
-			if c.bc == nil {
+			if c.store == nil {
 				t.Errorf("New() bc is '%v'", nil)
 			}
 		})
 	}
 }
 
+func Test_validateConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     func(cfg *config.Cache)
+		wantErr bool
+	}{
+		{name: "Ok", cfg: func(cfg *config.Cache) {}, wantErr: false},
+		{name: "UnlimitedSize", cfg: func(cfg *config.Cache) { cfg.HardMaxCacheSize = 0 }, wantErr: false},
+		{name: "InvalidTTL", cfg: func(cfg *config.Cache) { cfg.TTL = 0 }, wantErr: true},
+		{name: "InvalidCleanFrequency", cfg: func(cfg *config.Cache) { cfg.CleanFrequency = -1 }, wantErr: true},
+		{name: "InvalidMaxEntries", cfg: func(cfg *config.Cache) { cfg.MaxEntries = 0 }, wantErr: true},
+		{name: "InvalidMaxEntrySize", cfg: func(cfg *config.Cache) { cfg.MaxEntrySize = 0 }, wantErr: true},
+		{name: "InvalidMaxAge", cfg: func(cfg *config.Cache) { cfg.MaxAge = -1 }, wantErr: true},
+		{name: "InvalidTTLJitter", cfg: func(cfg *config.Cache) { cfg.TTLJitter = 100 }, wantErr: true},
+		{name: "NegativeTTLJitter", cfg: func(cfg *config.Cache) { cfg.TTLJitter = -1 }, wantErr: true},
+		{name: "InvalidHardMaxCacheSize", cfg: func(cfg *config.Cache) { cfg.HardMaxCacheSize = -1 }, wantErr: true},
+		{
+			name:    "InvalidTTLByContentType",
+			cfg:     func(cfg *config.Cache) { cfg.TTLByContentType = []config.ContentTypeTTL{{ContentType: "image/*"}} },
+			wantErr: true,
+		},
+		{
+			name: "MemoryPressure",
+			cfg: func(cfg *config.Cache) {
+				cfg.MemoryPressure = config.MemoryPressure{HighWatermark: 200, LowWatermark: 100}
+			},
+			wantErr: false,
+		},
+		{
+			name: "InvalidMemoryPressureLowWatermark",
+			cfg: func(cfg *config.Cache) {
+				cfg.MemoryPressure = config.MemoryPressure{HighWatermark: 200, LowWatermark: 200}
+			},
+			wantErr: true,
+		},
+		{
+			name:    "InvalidMemoryPressureWithoutLowWatermark",
+			cfg:     func(cfg *config.Cache) { cfg.MemoryPressure = config.MemoryPressure{HighWatermark: 200} },
+			wantErr: true,
+		},
+		{
+			name:    "DiskTier",
+			cfg:     func(cfg *config.Cache) { cfg.Tiers.Disk = config.DiskTier{Path: "/tmp/kratgo", MaxSize: 100} },
+			wantErr: false,
+		},
+		{
+			name:    "InvalidDiskTierMaxSize",
+			cfg:     func(cfg *config.Cache) { cfg.Tiers.Disk = config.DiskTier{Path: "/tmp/kratgo"} },
+			wantErr: true,
+		},
+		{
+			name: "InvalidDiskTierUnlimitedSize",
+			cfg: func(cfg *config.Cache) {
+				cfg.HardMaxCacheSize = 0
+				cfg.Tiers.Disk = config.DiskTier{Path: "/tmp/kratgo", MaxSize: 100}
+			},
+			wantErr: true,
+		},
+		{name: "Shards", cfg: func(cfg *config.Cache) { cfg.Shards = 64 }, wantErr: false},
+		{name: "InvalidShards", cfg: func(cfg *config.Cache) { cfg.Shards = 3 }, wantErr: true},
+		{name: "NegativeShards", cfg: func(cfg *config.Cache) { cfg.Shards = -2 }, wantErr: true},
+		{
+			name: "MaxEntrySizeInFewerShards",
+			cfg: func(cfg *config.Cache) {
+				cfg.HardMaxCacheSize = 1
+				cfg.Shards = 16
+				cfg.MaxEntrySize = megabyte / 16
+			},
+			wantErr: false,
+		},
+		{
+			name: "MaxEntrySizeGreaterThanShard",
+			cfg: func(cfg *config.Cache) {
+				cfg.HardMaxCacheSize = 1
+				cfg.MaxEntrySize = megabyte/defaultBigcacheShards + 1
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := fileConfigCache()
+			tt.cfg(&cfg)
+
+			if err := validateConfig(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateConfig() error = '%v', want '%v'", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCache_Fresh(t *testing.T) {
+	cfg := fileConfigCache()
+	cfg.MaxAge = 60
+
+	c, err := New(Config{
+		FileConfig: cfg,
+		LogLevel:   logger.ERROR,
+		LogOutput:  os.Stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		storedAt  int64
+		expiresAt int64
+		want      bool
+	}{
+		{name: "Fresh", storedAt: 1000, want: true},
+		{name: "MaxAge", storedAt: 1000 - 60, want: true},
+		{name: "ExceedsMaxAge", storedAt: 1000 - 61, want: false},
+		{name: "ExceedsMaxAgeBeforeExpiration", storedAt: 1000 - 120, expiresAt: 1000 + 3600, want: false},
+		{name: "Expired", storedAt: 1000 - 10, expiresAt: 1000, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Response{StoredAt: tt.storedAt, ExpiresAt: tt.expiresAt}
+
+			if got := c.Fresh(r, 1000); got != tt.want {
+				t.Errorf("Cache.Fresh() == '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+
+	if !testCache.Fresh(&Response{StoredAt: 0}, 1000) {
+		t.Errorf("Cache.Fresh() without max age == '%v', want '%v'", false, true)
+	}
+}
+
+func TestCache_Stale(t *testing.T) {
+	cfg := fileConfigCache()
+	cfg.MaxAge = 60
+
+	c, err := New(Config{
+		FileConfig: cfg,
+		LogLevel:   logger.ERROR,
+		LogOutput:  os.Stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		storedAt  int64
+		expiresAt int64
+		want      bool
+	}{
+		{name: "Fresh", storedAt: 1000, want: false},
+		{name: "ExpiredInGrace", storedAt: 1000 - 20, expiresAt: 1000 - 10, want: true},
+		{name: "ExpiredAfterGrace", storedAt: 1000 - 40, expiresAt: 1000 - 31, want: false},
+		{name: "MaxAgeInGrace", storedAt: 1000 - 90, want: true},
+		{name: "MaxAgeAfterGrace", storedAt: 1000 - 91, expiresAt: 1000 + 3600, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Response{StoredAt: tt.storedAt, ExpiresAt: tt.expiresAt}
+
+			if got := c.Stale(r, 1000, 30); got != tt.want {
+				t.Errorf("Cache.Stale() == '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCache_TTL(t *testing.T) {
+	cfg := fileConfigCache()
+	cfg.TTLByContentType = []config.ContentTypeTTL{
+		{ContentType: "application/json", TTL: 1},
+		{ContentType: "image/*", TTL: 60},
+		{ContentType: "image/svg+xml", TTL: 5},
+	}
+
+	c, err := New(Config{
+		FileConfig: cfg,
+		LogLevel:   logger.ERROR,
+		LogOutput:  os.Stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		mediaType string
+		want      int
+	}{
+		{mediaType: "application/json", want: 1},
+		{mediaType: "Application/JSON", want: 1},
+		{mediaType: "image/png", want: 60},
+		{mediaType: "image/svg+xml", want: 60},
+		{mediaType: "image/", want: cfg.TTL},
+		{mediaType: "text/html", want: cfg.TTL},
+		{mediaType: "", want: cfg.TTL},
+	}
+
+	for _, tt := range tests {
+		if got := c.TTL(tt.mediaType); got != tt.want {
+			t.Errorf("Cache.TTL('%s') == '%d', want '%d'", tt.mediaType, got, tt.want)
+		}
+	}
+
+	if bcLifeWindow := bigcacheConfig(cfg).LifeWindow; bcLifeWindow != 60*time.Minute {
+		t.Errorf("bigcacheConfig() LifeWindow with TTL by content type == '%v', want '%v'", bcLifeWindow, 60*time.Minute)
+	}
+
+	// The responses with a shorter TTL than the cache one have their own expiration
+	if expiresAt := c.ExpiresAt(1000, cfg.TTL); expiresAt != 1000+int64(cfg.TTL)*60 {
+		t.Errorf("Cache.ExpiresAt() == '%d', want '%d'", expiresAt, 1000+int64(cfg.TTL)*60)
+	}
+
+	if expiresAt := c.ExpiresAt(1000, 60); expiresAt != 0 {
+		t.Errorf("Cache.ExpiresAt() with the cache TTL == '%d', want '%d'", expiresAt, 0)
+	}
+}
+
+func TestCache_ExpiresAt(t *testing.T) {
+	if expiresAt := testCache.ExpiresAt(1000, fileConfigCache().TTL); expiresAt != 0 {
+		t.Errorf("Cache.ExpiresAt() without jitter == '%d', want '%d'", expiresAt, 0)
+	}
+
+	cfg := fileConfigCache()
+	cfg.TTL = 10
+	cfg.TTLJitter = 20
+
+	c, err := New(Config{
+		FileConfig: cfg,
+		LogLevel:   logger.ERROR,
+		LogOutput:  os.Stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lifeWindow := 12 * time.Minute
+	if bcLifeWindow := bigcacheConfig(cfg).LifeWindow; bcLifeWindow != lifeWindow {
+		t.Errorf("bigcacheConfig() LifeWindow with jitter == '%v', want '%v'", bcLifeWindow, lifeWindow)
+	}
+
+	min, max := int64(1000+480), int64(1000+720)
+	distinct := make(map[int64]bool)
+
+	for i := 0; i < 100; i++ {
+		expiresAt := c.ExpiresAt(1000, cfg.TTL)
+		if expiresAt < min || expiresAt > max {
+			t.Fatalf("Cache.ExpiresAt() == '%d', want between '%d' and '%d'", expiresAt, min, max)
+		}
+
+		distinct[expiresAt] = true
+	}
+
+	if len(distinct) < 2 {
+		t.Errorf("Cache.ExpiresAt() is not randomized")
+	}
+}
+
+func TestCache_FailOpen(t *testing.T) {
+	enabled, disabled := true, false
+
+	tests := []struct {
+		name     string
+		failOpen *bool
+		want     bool
+	}{
+		{name: "Default", want: true},
+		{name: "Enabled", failOpen: &enabled, want: true},
+		{name: "Disabled", failOpen: &disabled, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := fileConfigCache()
+			cfg.FailOpen = tt.failOpen
+
+			c := &Cache{fileConfig: cfg}
+
+			if got := c.FailOpen(); got != tt.want {
+				t.Errorf("Cache.FailOpen() == '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCache_Get_CorruptedEntry(t *testing.T) {
+	testCache.Reset()
+
+	k := "www.kratgo.com"
+	if err := testCache.store.Set(testCache.StoredKey(k), []byte("corrupted")); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := AcquireEntry()
+	defer ReleaseEntry(entry)
+
+	if err := testCache.Get(k, entry); err == nil {
+		t.Errorf("Cache.Get() of a corrupted entry, want error")
+	}
+}
+
 func TestCache_SetAndGetAndDel(t *testing.T) {
 	e := getEntryTest()
 	entry := AcquireEntry()
@@ -225,19 +537,247 @@ func TestCache_SetAndGetAndDel_Bytes(t *testing.T) {
 	}
 }
 
-func TestCache_Iterator(t *testing.T) {
+func TestCache_ForEach(t *testing.T) {
+	testCache.Reset()
+	defer testCache.Reset()
+
+	hosts := map[string]int{"www.kratgo.com": 1, "www.example.com": 2, "www.golang.org": 3}
+
+	for host, responses := range hosts {
+		entry := Entry{}
+		for i := 0; i < responses; i++ {
+			entry.SetResponse(Response{Path: []byte(fmt.Sprintf("/%d/", i)), Body: []byte("Kratgo")})
+		}
+
+		if err := testCache.Set(host, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []int
+
+	err := testCache.ForEach(func(key []byte, entry *Entry) bool {
+		got = append(got, entry.Len())
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Cache.ForEach() unexpected error: %v", err)
+	}
+
+	sort.Ints(got)
+
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Cache.ForEach() responses by entry == '%v', want '%v'", got, want)
+	}
+
+	calls := 0
+	testCache.ForEach(func(key []byte, entry *Entry) bool {
+		calls++
+		return false
+	})
+
+	if calls != 1 {
+		t.Errorf("Cache.ForEach() calls == '%d' after returning false, want '%d'", calls, 1)
+	}
+}
+
+func TestCache_HashKeys(t *testing.T) {
+	cfg := fileConfigCache()
+	cfg.HashKeys = true
+
+	c, err := New(Config{
+		FileConfig: cfg,
+		LogLevel:   logger.ERROR,
+		LogOutput:  os.Stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	e := getEntryTest()
+	entry := AcquireEntry()
 
 	k := "www.kratgo.com"
+	longKey := strings.Repeat("a", 1000) + ".kratgo.com"
 
-	err := testCache.Set(k, e)
+	storedKey := c.StoredKey(k)
+	if len(storedKey) != HashKeyBits/4 || strings.Contains(storedKey, k) {
+		t.Errorf("Cache.StoredKey() == '%s', want a hex hash of '%d' bits", storedKey, HashKeyBits)
+	}
+
+	if longStoredKey := c.StoredKey(longKey); len(longStoredKey) != len(storedKey) || longStoredKey == storedKey {
+		t.Errorf("Cache.StoredKey() of long key == '%s', want a different hash of '%d' bits", longStoredKey, HashKeyBits)
+	}
+
+	if err := c.Set(k, e); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if v, _ := c.store.Get(k); v != nil {
+		t.Errorf("The key '%s' has been save in cache without hash", k)
+	}
+
+	err = c.store.Iterate(func(key string, value []byte) bool {
+		if key != storedKey {
+			t.Errorf("Stored key == '%s', want '%s'", key, storedKey)
+		}
+
+		return true
+	})
 	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Get(k, entry); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(e, *entry) {
+		t.Errorf("The key '%s' has not been save in cache", k)
+	}
+
+	if err := c.DelStored(storedKey); err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	iter := testCache.Iterator()
-	if iter == nil {
-		t.Errorf("Could not get iterator from cache")
+	if c.Len() != 0 {
+		t.Errorf("Cache.DelStored() has not deleted the key '%s'", storedKey)
+	}
+}
+
+func TestCache_Namespace(t *testing.T) {
+	cfg := fileConfigCache()
+	cfg.Namespace = "blue"
+
+	c, err := New(Config{
+		FileConfig: cfg,
+		LogLevel:   logger.ERROR,
+		LogOutput:  os.Stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := getEntryTest()
+	entry := AcquireEntry()
+
+	k := "www.kratgo.com"
+
+	if err := c.Set(k, e); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if v, _ := c.store.Get(k); v != nil {
+		t.Errorf("The key '%s' has been save in cache without namespace", k)
+	}
+
+	if v, err := c.store.Get("blue:" + k); v == nil {
+		t.Errorf("The key '%s' has not been save in cache with namespace: %v", k, err)
+	}
+
+	if err := c.Get(k, entry); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(e, *entry) {
+		t.Errorf("The key '%s' has not been save in cache", k)
+	}
+
+	if key, ok := c.TrimNamespace("blue:" + k); !ok || key != k {
+		t.Errorf("Cache.TrimNamespace() == '%s, %v', want '%s, %v'", key, ok, k, true)
+	}
+
+	if key, ok := c.TrimNamespace("green:" + k); ok {
+		t.Errorf("Cache.TrimNamespace() == '%s, %v', want '%s, %v'", key, ok, "", false)
+	}
+
+	if err := c.Del(k); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if c.Len() != 0 {
+		t.Errorf("The key '%s' has not been delete from cache", k)
+	}
+}
+
+func TestCache_Purge(t *testing.T) {
+	e := getEntryTest()
+	k := "www.purge.com"
+
+	if err := testCache.Set(k, e); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	n, err := testCache.Purge(k)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if n != len(e.Responses) {
+		t.Errorf("Cache.Purge() == '%d', want '%d'", n, len(e.Responses))
+	}
+
+	entry := AcquireEntry()
+	if err := testCache.Get(k, entry); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(entry.Responses) != 0 {
+		t.Errorf("The key '%s' has not been purged from cache", k)
+	}
+
+	n, err = testCache.Purge(k)
+	if err != nil {
+		t.Fatalf("Cache.Purge() not found key unexpected error: %v", err)
+	}
+
+	if n != 0 {
+		t.Errorf("Cache.Purge() not found key == '%d', want '%d'", n, 0)
+	}
+}
+
+func TestCache_ForEachStored(t *testing.T) {
+	cfg := fileConfigCache()
+	cfg.Namespace = "blue"
+
+	store := newMockStore()
+
+	c, err := New(Config{
+		FileConfig: cfg,
+		Store:      store,
+		LogLevel:   logger.ERROR,
+		LogOutput:  os.Stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := "www.kratgo.com"
+
+	if err := c.Set(k, getEntryTest()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Other namespaces are never iterated
+	store.data["green:"+k] = []byte("corrupted")
+
+	calls := 0
+
+	err = c.ForEachStored(func(storedKey string, entry *Entry) bool {
+		calls++
+
+		if storedKey != "blue:"+k {
+			t.Errorf("Cache.ForEachStored() key == '%s', want '%s'", storedKey, "blue:"+k)
+		}
+
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Cache.ForEachStored() unexpected error: %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("Cache.ForEachStored() calls == '%d', want '%d'", calls, 1)
 	}
 }
 
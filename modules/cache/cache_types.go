@@ -10,9 +10,17 @@ type ResponseHeader struct {
 
 // Response ...
 type Response struct {
-	Path    []byte
-	Body    []byte
-	Headers []ResponseHeader
+	Path      []byte
+	Variant   []byte
+	Body      []byte
+	Headers   []ResponseHeader
+	Tags      [][]byte
+	StoredAt  int64
+	ExpiresAt int64
+
+	// Validators of the backend response, to revalidate it with a conditional request
+	ETag         []byte
+	LastModified []byte
 }
 
 //Entry ...
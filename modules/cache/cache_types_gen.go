@@ -176,6 +176,12 @@ func (z *Response) DecodeMsg(dc *msgp.Reader) (err error) {
 				err = msgp.WrapError(err, "Path")
 				return
 			}
+		case "Variant":
+			z.Variant, err = dc.ReadBytes(z.Variant)
+			if err != nil {
+				err = msgp.WrapError(err, "Variant")
+				return
+			}
 		case "Body":
 			z.Body, err = dc.ReadBytes(z.Body)
 			if err != nil {
@@ -230,6 +236,49 @@ func (z *Response) DecodeMsg(dc *msgp.Reader) (err error) {
 					}
 				}
 			}
+		case "Tags":
+			var zb0004 uint32
+			zb0004, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Tags")
+				return
+			}
+			if cap(z.Tags) >= int(zb0004) {
+				z.Tags = (z.Tags)[:zb0004]
+			} else {
+				z.Tags = make([][]byte, zb0004)
+			}
+			for za0002 := range z.Tags {
+				z.Tags[za0002], err = dc.ReadBytes(z.Tags[za0002])
+				if err != nil {
+					err = msgp.WrapError(err, "Tags", za0002)
+					return
+				}
+			}
+		case "StoredAt":
+			z.StoredAt, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "StoredAt")
+				return
+			}
+		case "ExpiresAt":
+			z.ExpiresAt, err = dc.ReadInt64()
+			if err != nil {
+				err = msgp.WrapError(err, "ExpiresAt")
+				return
+			}
+		case "ETag":
+			z.ETag, err = dc.ReadBytes(z.ETag)
+			if err != nil {
+				err = msgp.WrapError(err, "ETag")
+				return
+			}
+		case "LastModified":
+			z.LastModified, err = dc.ReadBytes(z.LastModified)
+			if err != nil {
+				err = msgp.WrapError(err, "LastModified")
+				return
+			}
 		default:
 			err = dc.Skip()
 			if err != nil {
@@ -243,9 +292,9 @@ func (z *Response) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *Response) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 3
+	// map header, size 9
 	// write "Path"
-	err = en.Append(0x83, 0xa4, 0x50, 0x61, 0x74, 0x68)
+	err = en.Append(0x89, 0xa4, 0x50, 0x61, 0x74, 0x68)
 	if err != nil {
 		return
 	}
@@ -254,6 +303,16 @@ func (z *Response) EncodeMsg(en *msgp.Writer) (err error) {
 		err = msgp.WrapError(err, "Path")
 		return
 	}
+	// write "Variant"
+	err = en.Append(0xa7, 0x56, 0x61, 0x72, 0x69, 0x61, 0x6e, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteBytes(z.Variant)
+	if err != nil {
+		err = msgp.WrapError(err, "Variant")
+		return
+	}
 	// write "Body"
 	err = en.Append(0xa4, 0x42, 0x6f, 0x64, 0x79)
 	if err != nil {
@@ -297,16 +356,76 @@ func (z *Response) EncodeMsg(en *msgp.Writer) (err error) {
 			return
 		}
 	}
+	// write "Tags"
+	err = en.Append(0xa4, 0x54, 0x61, 0x67, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Tags)))
+	if err != nil {
+		err = msgp.WrapError(err, "Tags")
+		return
+	}
+	for za0002 := range z.Tags {
+		err = en.WriteBytes(z.Tags[za0002])
+		if err != nil {
+			err = msgp.WrapError(err, "Tags", za0002)
+			return
+		}
+	}
+	// write "StoredAt"
+	err = en.Append(0xa8, 0x53, 0x74, 0x6f, 0x72, 0x65, 0x64, 0x41, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.StoredAt)
+	if err != nil {
+		err = msgp.WrapError(err, "StoredAt")
+		return
+	}
+	// write "ExpiresAt"
+	err = en.Append(0xa9, 0x45, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt64(z.ExpiresAt)
+	if err != nil {
+		err = msgp.WrapError(err, "ExpiresAt")
+		return
+	}
+	// write "ETag"
+	err = en.Append(0xa4, 0x45, 0x54, 0x61, 0x67)
+	if err != nil {
+		return
+	}
+	err = en.WriteBytes(z.ETag)
+	if err != nil {
+		err = msgp.WrapError(err, "ETag")
+		return
+	}
+	// write "LastModified"
+	err = en.Append(0xac, 0x4c, 0x61, 0x73, 0x74, 0x4d, 0x6f, 0x64, 0x69, 0x66, 0x69, 0x65, 0x64)
+	if err != nil {
+		return
+	}
+	err = en.WriteBytes(z.LastModified)
+	if err != nil {
+		err = msgp.WrapError(err, "LastModified")
+		return
+	}
 	return
 }
 
 // MarshalMsg implements msgp.Marshaler
 func (z *Response) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 3
+	// map header, size 9
 	// string "Path"
-	o = append(o, 0x83, 0xa4, 0x50, 0x61, 0x74, 0x68)
+	o = append(o, 0x89, 0xa4, 0x50, 0x61, 0x74, 0x68)
 	o = msgp.AppendBytes(o, z.Path)
+	// string "Variant"
+	o = append(o, 0xa7, 0x56, 0x61, 0x72, 0x69, 0x61, 0x6e, 0x74)
+	o = msgp.AppendBytes(o, z.Variant)
 	// string "Body"
 	o = append(o, 0xa4, 0x42, 0x6f, 0x64, 0x79)
 	o = msgp.AppendBytes(o, z.Body)
@@ -322,6 +441,24 @@ func (z *Response) MarshalMsg(b []byte) (o []byte, err error) {
 		o = append(o, 0xa5, 0x56, 0x61, 0x6c, 0x75, 0x65)
 		o = msgp.AppendBytes(o, z.Headers[za0001].Value)
 	}
+	// string "Tags"
+	o = append(o, 0xa4, 0x54, 0x61, 0x67, 0x73)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Tags)))
+	for za0002 := range z.Tags {
+		o = msgp.AppendBytes(o, z.Tags[za0002])
+	}
+	// string "StoredAt"
+	o = append(o, 0xa8, 0x53, 0x74, 0x6f, 0x72, 0x65, 0x64, 0x41, 0x74)
+	o = msgp.AppendInt64(o, z.StoredAt)
+	// string "ExpiresAt"
+	o = append(o, 0xa9, 0x45, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74)
+	o = msgp.AppendInt64(o, z.ExpiresAt)
+	// string "ETag"
+	o = append(o, 0xa4, 0x45, 0x54, 0x61, 0x67)
+	o = msgp.AppendBytes(o, z.ETag)
+	// string "LastModified"
+	o = append(o, 0xac, 0x4c, 0x61, 0x73, 0x74, 0x4d, 0x6f, 0x64, 0x69, 0x66, 0x69, 0x65, 0x64)
+	o = msgp.AppendBytes(o, z.LastModified)
 	return
 }
 
@@ -349,6 +486,12 @@ func (z *Response) UnmarshalMsg(bts []byte) (o []byte, err error) {
 				err = msgp.WrapError(err, "Path")
 				return
 			}
+		case "Variant":
+			z.Variant, bts, err = msgp.ReadBytesBytes(bts, z.Variant)
+			if err != nil {
+				err = msgp.WrapError(err, "Variant")
+				return
+			}
 		case "Body":
 			z.Body, bts, err = msgp.ReadBytesBytes(bts, z.Body)
 			if err != nil {
@@ -403,6 +546,49 @@ func (z *Response) UnmarshalMsg(bts []byte) (o []byte, err error) {
 					}
 				}
 			}
+		case "Tags":
+			var zb0004 uint32
+			zb0004, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Tags")
+				return
+			}
+			if cap(z.Tags) >= int(zb0004) {
+				z.Tags = (z.Tags)[:zb0004]
+			} else {
+				z.Tags = make([][]byte, zb0004)
+			}
+			for za0002 := range z.Tags {
+				z.Tags[za0002], bts, err = msgp.ReadBytesBytes(bts, z.Tags[za0002])
+				if err != nil {
+					err = msgp.WrapError(err, "Tags", za0002)
+					return
+				}
+			}
+		case "StoredAt":
+			z.StoredAt, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "StoredAt")
+				return
+			}
+		case "ExpiresAt":
+			z.ExpiresAt, bts, err = msgp.ReadInt64Bytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "ExpiresAt")
+				return
+			}
+		case "ETag":
+			z.ETag, bts, err = msgp.ReadBytesBytes(bts, z.ETag)
+			if err != nil {
+				err = msgp.WrapError(err, "ETag")
+				return
+			}
+		case "LastModified":
+			z.LastModified, bts, err = msgp.ReadBytesBytes(bts, z.LastModified)
+			if err != nil {
+				err = msgp.WrapError(err, "LastModified")
+				return
+			}
 		default:
 			bts, err = msgp.Skip(bts)
 			if err != nil {
@@ -417,10 +603,15 @@ func (z *Response) UnmarshalMsg(bts []byte) (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *Response) Msgsize() (s int) {
-	s = 1 + 5 + msgp.BytesPrefixSize + len(z.Path) + 5 + msgp.BytesPrefixSize + len(z.Body) + 8 + msgp.ArrayHeaderSize
+	s = 1 + 5 + msgp.BytesPrefixSize + len(z.Path) + 8 + msgp.BytesPrefixSize + len(z.Variant) + 5 + msgp.BytesPrefixSize + len(z.Body) + 8 + msgp.ArrayHeaderSize
 	for za0001 := range z.Headers {
 		s += 1 + 4 + msgp.BytesPrefixSize + len(z.Headers[za0001].Key) + 6 + msgp.BytesPrefixSize + len(z.Headers[za0001].Value)
 	}
+	s += 5 + msgp.ArrayHeaderSize
+	for za0002 := range z.Tags {
+		s += msgp.BytesPrefixSize + len(z.Tags[za0002])
+	}
+	s += 9 + msgp.Int64Size + 10 + msgp.Int64Size + 5 + msgp.BytesPrefixSize + len(z.ETag) + 13 + msgp.BytesPrefixSize + len(z.LastModified)
 	return
 }
 
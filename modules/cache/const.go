@@ -1,3 +1,38 @@
 package cache
 
+import (
+	"crypto/sha256"
+	"time"
+)
+
 const defaultBigcacheShards = 1024 // power of two
+
+const megabyte = 1024 * 1024
+
+// bigcacheEntryOverhead is the size of the headers of each entry in the bigcache shards:
+// the timestamp, the hash and the key length, and the size prefix in the queue (max 5 bytes)
+const bigcacheEntryOverhead = 8 + 8 + 2 + 5
+
+const bigcacheErrTooLarge = "entry is bigger than max shard size"
+
+// diskEntryExt is the extension of the entry files of the disk tier
+const diskEntryExt = ".entry"
+
+// demotionQueueSize is the max entries evicted from memory pending to be written to disk,
+// the rest are dropped so the evictions never wait for the disk
+const demotionQueueSize = 1024
+
+const memoryCheckInterval = time.Second
+
+const namespaceSeparator = ":"
+
+// QueryVariantPrefix separates the query params of the cache key in the variants from the cookies,
+// as the cookie names never have ':'
+const QueryVariantPrefix = "query:"
+
+// snapshotHeader is the first value of the snapshots, with the version of their format
+const snapshotHeader = "kratgo-cache-snapshot/1"
+
+// HashKeyBits is the width of the hashed keys (SHA-256), so the probability of any collision
+// between n keys is lower than n² / 2^257
+const HashKeyBits = sha256.Size * 8
@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/savsgio/kratgo/modules/config"
+)
+
+// newDiskStore returns the disk tier of the cache, with the entries evicted from memory.
+// The entries of a previous run are removed, as the tier is an overflow of the memory, not a persistence
+func newDiskStore(cfg config.DiskTier) (*diskStore, error) {
+	if err := os.MkdirAll(cfg.Path, 0755); err != nil {
+		return nil, fmt.Errorf("Could not create the disk tier directory '%s': %v", cfg.Path, err)
+	}
+
+	s := &diskStore{
+		dir:     cfg.Path,
+		maxSize: int64(cfg.MaxSize) * megabyte,
+		items:   make(map[string]*list.Element),
+		order:   list.New(),
+	}
+
+	if err := s.removeFiles(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *diskStore) filePath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+diskEntryExt)
+}
+
+// removeFiles removes all the entry files of the directory, even the ones that are not indexed
+func (s *diskStore) removeFiles() error {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+diskEntryExt))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Could not remove the disk tier file '%s': %v", file, err)
+		}
+	}
+
+	return nil
+}
+
+// Get returns nil if the key is not stored
+func (s *diskStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.items[key]
+	if !ok {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(elem.Value.(*diskItem).file)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read the disk tier entry of key '%s': %v", key, err)
+	}
+
+	// The key is stored before the value, to not return the value of another key with the same file
+	keyLen, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < keyLen || string(data[n:n+int(keyLen)]) != key {
+		return nil, fmt.Errorf("Invalid disk tier entry of key '%s'", key)
+	}
+
+	return data[n+int(keyLen):], nil
+}
+
+// Set returns ErrEntryTooLarge if the entry is bigger than the tier, and otherwise it evicts
+// the oldest entries until the new one fits
+func (s *diskStore) Set(key string, value []byte) error {
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(key)))
+
+	size := int64(n + len(key) + len(value))
+	if size > s.maxSize {
+		return ErrEntryTooLarge
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file := s.filePath(key)
+
+	// Written to a temporary file and renamed, so a read never gets a partial entry
+	tmp, err := ioutil.TempFile(s.dir, "tmp-")
+	if err != nil {
+		return fmt.Errorf("Could not create the disk tier entry of key '%s': %v", key, err)
+	}
+
+	_, err = tmp.Write(prefix[:n])
+	if err == nil {
+		_, err = tmp.WriteString(key)
+	}
+	if err == nil {
+		_, err = tmp.Write(value)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Could not write the disk tier entry of key '%s': %v", key, err)
+	}
+
+	if elem, ok := s.items[key]; ok {
+		item := elem.Value.(*diskItem)
+		s.size += size - item.size
+		item.size = size
+		s.order.MoveToBack(elem)
+	} else {
+		s.items[key] = s.order.PushBack(&diskItem{key: key, file: file, size: size})
+		s.size += size
+	}
+
+	for s.size > s.maxSize {
+		if err := s.remove(s.order.Front().Value.(*diskItem).key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// remove deletes the entry of the key, it must be called with the lock held
+func (s *diskStore) remove(key string) error {
+	elem, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+
+	item := elem.Value.(*diskItem)
+
+	if err := os.Remove(item.file); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Could not remove the disk tier entry of key '%s': %v", key, err)
+	}
+
+	s.order.Remove(elem)
+	delete(s.items, key)
+	s.size -= item.size
+
+	return nil
+}
+
+// Delete does not fail if the key is not stored
+func (s *diskStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.remove(key)
+}
+
+// Iterate calls fn with the entries stored when it's called, from the oldest one,
+// without holding the lock between calls
+func (s *diskStore) Iterate(fn func(key string, value []byte) bool) error {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.items))
+	for elem := s.order.Front(); elem != nil; elem = elem.Next() {
+		keys = append(keys, elem.Value.(*diskItem).key)
+	}
+	s.mu.Unlock()
+
+	for _, key := range keys {
+		value, err := s.Get(key)
+		if err != nil {
+			return err
+		} else if value == nil {
+			// Deleted meanwhile
+			continue
+		}
+
+		if !fn(key, value) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Len ...
+func (s *diskStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.items)
+}
+
+// Reset ...
+func (s *diskStore) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items = make(map[string]*list.Element)
+	s.order.Init()
+	s.size = 0
+
+	return s.removeFiles()
+}
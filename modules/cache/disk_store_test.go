@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/savsgio/kratgo/modules/config"
+)
+
+func newTestDiskStore(t *testing.T, maxSize int) *diskStore {
+	dir, err := ioutil.TempDir("", "kratgo-disk-tier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := newDiskStore(config.DiskTier{Path: dir, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.maxSize = int64(maxSize)
+
+	return s
+}
+
+func Test_newDiskStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kratgo-disk-tier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stale := filepath.Join(dir, "stale"+diskEntryExt)
+	other := filepath.Join(dir, "other.txt")
+
+	for _, file := range []string{stale, other} {
+		if err := ioutil.WriteFile(file, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := newDiskStore(config.DiskTier{Path: dir, MaxSize: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("newDiskStore() has not removed the entry of a previous run")
+	}
+
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("newDiskStore() has removed a file that is not an entry: %v", err)
+	}
+}
+
+func Test_diskStore(t *testing.T) {
+	s := newTestDiskStore(t, 1024)
+	defer os.RemoveAll(s.dir)
+
+	if value, err := s.Get("missing"); err != nil || value != nil {
+		t.Fatalf("diskStore.Get() == '%s' with error '%v', want nil", value, err)
+	}
+
+	data := map[string][]byte{
+		"www.kratgo.com":  []byte("kratgo"),
+		"www.example.com": []byte("example"),
+	}
+
+	for k, v := range data {
+		if err := s.Set(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for k, v := range data {
+		value, err := s.Get(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(value, v) {
+			t.Errorf("diskStore.Get() == '%s', want '%s'", value, v)
+		}
+	}
+
+	if err := s.Set("www.kratgo.com", []byte("updated")); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _ := s.Get("www.kratgo.com"); string(value) != "updated" {
+		t.Errorf("diskStore.Get() == '%s', want '%s'", value, "updated")
+	}
+
+	iterated := 0
+	if err := s.Iterate(func(key string, value []byte) bool {
+		iterated++
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if iterated != len(data) || s.Len() != len(data) {
+		t.Errorf("diskStore.Iterate() entries == '%d' and Len() == '%d', want '%d'", iterated, s.Len(), len(data))
+	}
+
+	if err := s.Delete("www.kratgo.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _ := s.Get("www.kratgo.com"); value != nil {
+		t.Errorf("diskStore.Delete() has not deleted the entry")
+	}
+
+	if err := s.Delete("missing"); err != nil {
+		t.Errorf("diskStore.Delete() of a missing key returns err: %v", err)
+	}
+
+	if err := s.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(s.dir, "*"))
+	if s.Len() != 0 || s.size != 0 || len(files) != 0 {
+		t.Errorf("diskStore.Reset() Len() == '%d' with size '%d' and '%d' files, want 0", s.Len(), s.size, len(files))
+	}
+}
+
+func Test_diskStore_Evict(t *testing.T) {
+	value := bytes.Repeat([]byte("a"), 90)
+	s := newTestDiskStore(t, 250)
+	defer os.RemoveAll(s.dir)
+
+	for _, k := range []string{"k1", "k2", "k3"} {
+		if err := s.Set(k, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if v, _ := s.Get("k1"); v != nil {
+		t.Errorf("diskStore.Set() the oldest entry has not been evicted")
+	}
+
+	for _, k := range []string{"k2", "k3"} {
+		if v, _ := s.Get(k); v == nil {
+			t.Errorf("diskStore.Set() the entry '%s' has been evicted", k)
+		}
+	}
+
+	if s.size > s.maxSize {
+		t.Errorf("diskStore size == '%d', want less than or equal to '%d'", s.size, s.maxSize)
+	}
+
+	if err := s.Set("k4", bytes.Repeat([]byte("a"), 300)); err != ErrEntryTooLarge {
+		t.Errorf("diskStore.Set() error == '%v', want '%v'", err, ErrEntryTooLarge)
+	}
+}
@@ -50,8 +50,14 @@ func (e *Entry) appendResponse(data []Response, resp Response) []Response {
 	data, r := e.allocResponse(data)
 
 	r.Path = append(r.Path[:0], resp.Path...)
+	r.Variant = append(r.Variant[:0], resp.Variant...)
 	r.Body = append(r.Body[:0], resp.Body...)
 	r.Headers = resp.Headers
+	r.Tags = resp.Tags
+	r.StoredAt = resp.StoredAt
+	r.ExpiresAt = resp.ExpiresAt
+	r.ETag = append(r.ETag[:0], resp.ETag...)
+	r.LastModified = append(r.LastModified[:0], resp.LastModified...)
 
 	return data
 }
@@ -91,12 +97,30 @@ func (e Entry) GetResponse(path []byte) *Response {
 	return nil
 }
 
+// GetVariantResponse ...
+func (e Entry) GetVariantResponse(path, variant []byte) *Response {
+	n := len(e.Responses)
+	for i := 0; i < n; i++ {
+		resp := &e.Responses[i]
+		if bytes.Equal(path, resp.Path) && bytes.Equal(variant, resp.Variant) {
+			return resp
+		}
+	}
+
+	return nil
+}
+
 // SetResponse ...
 func (e *Entry) SetResponse(resp Response) {
-	r := e.GetResponse(resp.Path)
+	r := e.GetVariantResponse(resp.Path, resp.Variant)
 	if r != nil {
 		r.Body = append(r.Body[:0], resp.Body...)
 		r.Headers = resp.Headers
+		r.Tags = resp.Tags
+		r.StoredAt = resp.StoredAt
+		r.ExpiresAt = resp.ExpiresAt
+		r.ETag = append(r.ETag[:0], resp.ETag...)
+		r.LastModified = append(r.LastModified[:0], resp.LastModified...)
 
 		return
 	}
@@ -123,6 +147,50 @@ func (e *Entry) DelResponse(path []byte) {
 	e.Responses = responses
 }
 
+// DelVariantResponse deletes the response of the path with the variant
+func (e *Entry) DelVariantResponse(path, variant []byte) {
+	responses := e.GetAllResponses()
+
+	for i, n := 0, len(responses); i < n; i++ {
+		resp := &responses[i]
+		if bytes.Equal(path, resp.Path) && bytes.Equal(variant, resp.Variant) {
+			n--
+			if i != n {
+				e.swap(responses, i, n)
+			}
+			responses = responses[:n] // Remove last position
+
+			break
+		}
+	}
+
+	e.Responses = responses
+}
+
+// DelTaggedResponses deletes all responses with the given tag,
+// and returns the number of deleted responses
+func (e *Entry) DelTaggedResponses(tag []byte) int {
+	responses := e.GetAllResponses()
+	deleted := 0
+
+	for i, n := 0, len(responses); i < n; i++ {
+		resp := &responses[i]
+		if resp.HasTag(tag) {
+			n--
+			if i != n {
+				e.swap(responses, i, n)
+				i--
+			}
+			responses = responses[:n] // Remove last position
+			deleted++
+		}
+	}
+
+	e.Responses = responses
+
+	return deleted
+}
+
 // Marshal ...
 func Marshal(src Entry) ([]byte, error) {
 	b, _ := src.MarshalMsg(nil)
@@ -169,6 +169,37 @@ func TestEntry_GetResponse(t *testing.T) {
 	}
 }
 
+func TestEntry_GetVariantResponse(t *testing.T) {
+	e := getEntryTest()
+	r1 := e.Responses[0]
+
+	variant := []byte("lang=es;")
+
+	r2 := AcquireResponse()
+	r2.Path = r1.Path
+	r2.Variant = variant
+	r2.Body = []byte("Cuerpo de la respuesta")
+	e.SetResponse(*r2)
+
+	if r := e.GetVariantResponse(r1.Path, nil); !reflect.DeepEqual(*r, r1) {
+		t.Errorf("Entry.GetVariantResponse() path '%s' == '%v', want '%v'", r1.Path, *r, r1)
+	}
+
+	if r := e.GetVariantResponse(r1.Path, variant); r == nil || !bytes.Equal(r.Body, r2.Body) {
+		t.Errorf("Entry.GetVariantResponse() path '%s' and variant '%s' == '%v', want '%v'", r1.Path, variant, r, *r2)
+	}
+
+	if r := e.GetVariantResponse(r1.Path, []byte("lang=en;")); r != nil {
+		t.Errorf("Entry.GetVariantResponse() path '%s' == '%v', want '%v'", r1.Path, *r, nil)
+	}
+
+	e.DelResponse(r1.Path)
+
+	if e.HasResponse(r1.Path) {
+		t.Errorf("Entry.DelResponse() has not been delete all variants of the response")
+	}
+}
+
 func TestEntry_SetResponse(t *testing.T) {
 	e := getEntryTest()
 
@@ -208,6 +239,43 @@ func TestEntry_DelResponse(t *testing.T) {
 	}
 }
 
+func TestEntry_DelVariantResponse(t *testing.T) {
+	e := AcquireEntry()
+	e.SetResponse(Response{Path: []byte("/search"), Variant: []byte("query:q=foo;")})
+	e.SetResponse(Response{Path: []byte("/search"), Variant: []byte("query:q=bar;")})
+
+	e.DelVariantResponse([]byte("/search"), []byte("query:q=foo;"))
+
+	if e.GetVariantResponse([]byte("/search"), []byte("query:q=foo;")) != nil {
+		t.Errorf("Entry.DelVariantResponse() has not been delete the response")
+	}
+
+	if e.GetVariantResponse([]byte("/search"), []byte("query:q=bar;")) == nil {
+		t.Errorf("Entry.DelVariantResponse() has been delete other variant of the path")
+	}
+}
+
+func TestEntry_DelTaggedResponses(t *testing.T) {
+	e := getEntryTest()
+	r1 := e.Responses[0]
+	r2 := e.Responses[1]
+
+	tag := []byte("product-1")
+	e.Responses[0].AddTag(tag)
+
+	if n := e.DelTaggedResponses(tag); n != 1 {
+		t.Errorf("Entry.DelTaggedResponses() == '%d', want '%d'", n, 1)
+	}
+
+	if e.HasResponse(r1.Path) {
+		t.Errorf("Entry.DelTaggedResponses() has not been delete the tagged response")
+	}
+
+	if !e.HasResponse(r2.Path) {
+		t.Errorf("Entry.DelTaggedResponses() has been delete a not tagged response")
+	}
+}
+
 func TestMarshal(t *testing.T) {
 	e := getEntryTest()
 
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/config"
+)
+
+func newMemoryWatchdog(cfg config.MemoryPressure) *memoryWatchdog {
+	return &memoryWatchdog{
+		high:  uint64(cfg.HighWatermark) * megabyte,
+		low:   uint64(cfg.LowWatermark) * megabyte,
+		evict: cfg.Evict,
+	}
+}
+
+func (w *memoryWatchdog) underPressure() bool {
+	if w == nil {
+		return false
+	}
+
+	return atomic.LoadInt32(&w.pressure) == 1
+}
+
+// UnderMemoryPressure returns true if the heap has exceeded the high watermark,
+// and it's not under the low watermark yet, so the responses must not be cached
+func (c *Cache) UnderMemoryPressure() bool {
+	return c.memory.underPressure()
+}
+
+// checkMemory updates the memory pressure state with the heap size in bytes
+func (c *Cache) checkMemory(heapAlloc uint64) {
+	w := c.memory
+
+	switch {
+	case heapAlloc > w.high && atomic.CompareAndSwapInt32(&w.pressure, 0, 1):
+		c.log.Warningf(
+			"Memory pressure, heap of %d MB over the high watermark: caching disabled", heapAlloc/megabyte,
+		)
+
+		if w.evict {
+			if err := c.Reset(); err != nil {
+				c.log.Errorf("Could not evict the cached responses: %v", err)
+			}
+		}
+
+	case heapAlloc < w.low && atomic.CompareAndSwapInt32(&w.pressure, 1, 0):
+		c.log.Infof("Memory recovered, heap of %d MB under the low watermark: caching enabled", heapAlloc/megabyte)
+	}
+}
+
+// runMemoryWatchdog checks the heap size periodically, until the cache is closed
+func (c *Cache) runMemoryWatchdog() {
+	ticker := time.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+
+	var stats runtime.MemStats
+
+	for {
+		select {
+		case <-ticker.C:
+			runtime.ReadMemStats(&stats)
+			c.checkMemory(stats.HeapAlloc)
+		case <-c.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	logger "github.com/savsgio/go-logger/v2"
+)
+
+func TestCache_checkMemory(t *testing.T) {
+	type want struct {
+		pressure bool
+		length   int
+	}
+
+	tests := []struct {
+		name      string
+		evict     bool
+		pressure  bool
+		heapAlloc uint64
+		want      want
+	}{
+		{
+			name:      "UnderHighWatermark",
+			heapAlloc: 150 * megabyte,
+			want:      want{pressure: false, length: 1},
+		},
+		{
+			name:      "OverHighWatermark",
+			heapAlloc: 201 * megabyte,
+			want:      want{pressure: true, length: 1},
+		},
+		{
+			name:      "OverHighWatermarkEvict",
+			evict:     true,
+			heapAlloc: 201 * megabyte,
+			want:      want{pressure: true, length: 0},
+		},
+		{
+			name:      "OverLowWatermark",
+			pressure:  true,
+			heapAlloc: 150 * megabyte,
+			want:      want{pressure: true, length: 1},
+		},
+		{
+			name:      "UnderLowWatermark",
+			pressure:  true,
+			heapAlloc: 99 * megabyte,
+			want:      want{pressure: false, length: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testCache.Reset()
+			if err := testCache.Set("www.kratgo.com", getEntryTest()); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			testCache.memory = newMemoryWatchdog(config.MemoryPressure{
+				HighWatermark: 200,
+				LowWatermark:  100,
+				Evict:         tt.evict,
+			})
+			defer func() { testCache.memory = nil }()
+
+			if tt.pressure {
+				testCache.memory.pressure = 1
+			}
+
+			testCache.checkMemory(tt.heapAlloc)
+
+			if pressure := testCache.UnderMemoryPressure(); pressure != tt.want.pressure {
+				t.Errorf("Cache.UnderMemoryPressure() == '%v', want '%v'", pressure, tt.want.pressure)
+			}
+
+			if length := testCache.Len(); length != tt.want.length {
+				t.Errorf("Cache.Len() == '%d', want '%d'", length, tt.want.length)
+			}
+		})
+	}
+}
+
+func TestCache_UnderMemoryPressure_Disabled(t *testing.T) {
+	if testCache.UnderMemoryPressure() {
+		t.Error("Cache.UnderMemoryPressure() == 'true', want 'false'")
+	}
+}
+
+func TestCache_runMemoryWatchdog_Close(t *testing.T) {
+	cfg := fileConfigCache()
+	cfg.MemoryPressure = config.MemoryPressure{HighWatermark: 200, LowWatermark: 100}
+
+	c, err := New(Config{
+		FileConfig: cfg,
+		LogLevel:   logger.ERROR,
+		LogOutput:  os.Stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		c.runMemoryWatchdog()
+		close(stopped)
+	}()
+
+	c.Close()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("Cache.Close() has not stopped the memory watchdog")
+	}
+}
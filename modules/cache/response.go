@@ -55,14 +55,125 @@ func (r *Response) HasHeader(k, v []byte) bool {
 	return false
 }
 
+// Header returns the value of the header, case insensitive, or nil if the response hasn't it
+func (r *Response) Header(k []byte) []byte {
+	for i, n := 0, len(r.Headers); i < n; i++ {
+		h := &r.Headers[i]
+		if bytes.EqualFold(h.Key, k) {
+			return h.Value
+		}
+	}
+
+	return nil
+}
+
 // SetHeader ...
 func (r *Response) SetHeader(k, v []byte) {
 	r.Headers = r.appendHeader(r.Headers, k, v)
 }
 
+// AddTag ...
+func (r *Response) AddTag(tag []byte) {
+	r.Tags = append(r.Tags, append([]byte(nil), tag...))
+}
+
+// HasTag ...
+func (r *Response) HasTag(tag []byte) bool {
+	for i, n := 0, len(r.Tags); i < n; i++ {
+		if bytes.Equal(r.Tags[i], tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AppendQueryVariant appends the query param to the variant of the cache key, with the separators
+// of the variants escaped in the key and the value ('%', '=' and ';'), so different query strings
+// never have the same variant, nor a param could mimic the others
+func AppendQueryVariant(dst, k, v []byte) []byte {
+	dst = append(dst, QueryVariantPrefix...)
+	dst = appendVariantEscaped(dst, k)
+	dst = append(dst, '=')
+	dst = appendVariantEscaped(dst, v)
+
+	return append(dst, ';')
+}
+
+func appendVariantEscaped(dst, src []byte) []byte {
+	const hex = "0123456789ABCDEF"
+
+	for _, c := range src {
+		switch c {
+		case '%', '=', ';':
+			dst = append(dst, '%', hex[c>>4], hex[c&0xf])
+		default:
+			dst = append(dst, c)
+		}
+	}
+
+	return dst
+}
+
+// HasQueryParam returns if the variant of the response has the query param with the value,
+// as they are part of the cache key
+func (r *Response) HasQueryParam(k, v []byte) bool {
+	param := AppendQueryVariant(nil, k, v)
+	param = param[:len(param)-1] // Without the separator
+
+	variant := r.Variant
+
+	for len(variant) > 0 {
+		segment := variant
+		if n := bytes.IndexByte(variant, ';'); n >= 0 {
+			segment, variant = variant[:n], variant[n+1:]
+		} else {
+			variant = nil
+		}
+
+		if bytes.Equal(segment, param) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Expired returns if the response has an expiration time and it has been reached
+func (r *Response) Expired(now int64) bool {
+	return r.ExpiresAt > 0 && now >= r.ExpiresAt
+}
+
+// Expire sets the expiration of the response to the given time, if it's not already expired
+func (r *Response) Expire(now int64) {
+	if !r.Expired(now) {
+		r.ExpiresAt = now
+	}
+}
+
+// HasValidators reports if the response could be revalidated with a conditional request
+func (r *Response) HasValidators() bool {
+	return len(r.ETag) > 0 || len(r.LastModified) > 0
+}
+
+// Age returns the seconds elapsed since the response was stored
+func (r *Response) Age(now int64) int64 {
+	if age := now - r.StoredAt; age > 0 {
+		return age
+	}
+
+	return 0
+}
+
 // Reset reset response
 func (r *Response) Reset() {
 	r.Path = r.Path[:0]
+	r.Variant = r.Variant[:0]
 	r.Body = r.Body[:0]
 	r.Headers = r.Headers[:0]
+	r.Tags = r.Tags[:0]
+	r.StoredAt = 0
+	r.ExpiresAt = 0
+	r.ETag = r.ETag[:0]
+	r.LastModified = r.LastModified[:0]
 }
@@ -96,6 +96,19 @@ func TestResponse_SetHeader(t *testing.T) {
 	}
 }
 
+func TestResponse_Header(t *testing.T) {
+	r := getResponseTest()
+	r.SetHeader([]byte("Content-Type"), []byte("application/json"))
+
+	if v := r.Header([]byte("content-type")); string(v) != "application/json" {
+		t.Errorf("Response.Header() == '%s', want '%s'", v, "application/json")
+	}
+
+	if v := r.Header([]byte("X-Missing")); v != nil {
+		t.Errorf("Response.Header() == '%s', want '%v'", v, nil)
+	}
+}
+
 func TestResponse_HasHeader(t *testing.T) {
 	r := getResponseTest()
 
@@ -113,8 +126,112 @@ func TestResponse_HasHeader(t *testing.T) {
 	}
 }
 
+func TestResponse_HasTag(t *testing.T) {
+	r := getResponseTest()
+	r.AddTag([]byte("product-1"))
+
+	if !r.HasTag([]byte("product-1")) {
+		t.Errorf("Response.HasTag() == '%v', want '%v'", false, true)
+	}
+
+	if r.HasTag([]byte("product-2")) {
+		t.Errorf("Response.HasTag() == '%v', want '%v'", true, false)
+	}
+}
+
+func TestAppendQueryVariant(t *testing.T) {
+	if got := string(AppendQueryVariant(nil, []byte("a"), []byte("x;query:b=y%"))); got != "query:a=x%3Bquery:b%3Dy%25;" {
+		t.Errorf("AppendQueryVariant() == '%s', want '%s'", got, "query:a=x%3Bquery:b%3Dy%25;")
+	}
+
+	if got := string(AppendQueryVariant([]byte("query:a=1;"), []byte("b="), nil)); got != "query:a=1;query:b%3D=;" {
+		t.Errorf("AppendQueryVariant() == '%s', want '%s'", got, "query:a=1;query:b%3D=;")
+	}
+}
+
+func TestResponse_HasQueryParam(t *testing.T) {
+	r := getResponseTest()
+	r.Variant = []byte("query:q=foo;query:page=2;session=query:q=bar;")
+
+	if !r.HasQueryParam([]byte("q"), []byte("foo")) {
+		t.Errorf("Response.HasQueryParam() == '%v', want '%v'", false, true)
+	}
+
+	if !r.HasQueryParam([]byte("page"), []byte("2")) {
+		t.Errorf("Response.HasQueryParam() second param == '%v', want '%v'", false, true)
+	}
+
+	if r.HasQueryParam([]byte("q"), []byte("bar")) {
+		t.Errorf("Response.HasQueryParam() in a cookie value == '%v', want '%v'", true, false)
+	}
+
+	if r.HasQueryParam([]byte("q"), []byte("fo")) {
+		t.Errorf("Response.HasQueryParam() value prefix == '%v', want '%v'", true, false)
+	}
+
+	r.Variant = AppendQueryVariant(nil, []byte("q"), []byte("a;b"))
+
+	if !r.HasQueryParam([]byte("q"), []byte("a;b")) {
+		t.Errorf("Response.HasQueryParam() escaped value == '%v', want '%v'", false, true)
+	}
+
+	if r.HasQueryParam([]byte("q"), []byte("a")) {
+		t.Errorf("Response.HasQueryParam() escaped value prefix == '%v', want '%v'", true, false)
+	}
+}
+
+func TestResponse_Expired(t *testing.T) {
+	r := getResponseTest()
+
+	if r.Expired(1000) {
+		t.Errorf("Response.Expired() without expiration == '%v', want '%v'", true, false)
+	}
+
+	r.ExpiresAt = 1000
+
+	if r.Expired(999) {
+		t.Errorf("Response.Expired() == '%v', want '%v'", true, false)
+	}
+
+	if !r.Expired(1000) {
+		t.Errorf("Response.Expired() == '%v', want '%v'", false, true)
+	}
+}
+
+func TestResponse_Expire(t *testing.T) {
+	r := getResponseTest()
+
+	r.Expire(1000)
+	if r.ExpiresAt != 1000 {
+		t.Errorf("Response.ExpiresAt == '%d', want '%d'", r.ExpiresAt, 1000)
+	}
+
+	r.Expire(2000)
+	if r.ExpiresAt != 1000 {
+		t.Errorf("Response.Expire() has been changed an expired response, ExpiresAt == '%d', want '%d'", r.ExpiresAt, 1000)
+	}
+}
+
+func TestResponse_Age(t *testing.T) {
+	r := getResponseTest()
+	r.StoredAt = 1000
+
+	if age := r.Age(1030); age != 30 {
+		t.Errorf("Response.Age() == '%d', want '%d'", age, 30)
+	}
+
+	if age := r.Age(900); age != 0 {
+		t.Errorf("Response.Age() == '%d', want '%d'", age, 0)
+	}
+}
+
 func TestResponse_Reset(t *testing.T) {
 	r := getResponseTest()
+	r.AddTag([]byte("product-1"))
+	r.StoredAt = 1000
+	r.ExpiresAt = 1060
+	r.ETag = []byte(`"v1"`)
+	r.LastModified = []byte("Wed, 21 Oct 2015 07:28:00 GMT")
 
 	r.Reset()
 
@@ -129,4 +246,20 @@ func TestResponse_Reset(t *testing.T) {
 	if len(r.Headers) > 0 {
 		t.Errorf("Response.Headers has not been reset")
 	}
+
+	if len(r.Tags) > 0 {
+		t.Errorf("Response.Tags has not been reset")
+	}
+
+	if r.StoredAt > 0 {
+		t.Errorf("Response.StoredAt has not been reset")
+	}
+
+	if r.ExpiresAt > 0 {
+		t.Errorf("Response.ExpiresAt has not been reset")
+	}
+
+	if r.HasValidators() {
+		t.Errorf("Response.ETag and Response.LastModified have not been reset")
+	}
 }
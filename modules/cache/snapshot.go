@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Export writes a snapshot of all the entries of the cache namespace, returning the number of entries.
+// The snapshot is streamed, in msgpack: a header, and the key and the encoded entry of each host
+// (the key is the hash if the hash of the keys is enabled, without the namespace)
+func (c *Cache) Export(w io.Writer) (int, error) {
+	mw := msgp.NewWriter(w)
+
+	if err := mw.WriteString(snapshotHeader); err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	var err error
+
+	iterErr := c.store.Iterate(func(storedKey string, value []byte) bool {
+		key, ok := c.TrimNamespace(storedKey)
+		if !ok {
+			return true
+		}
+
+		if err = mw.WriteString(key); err == nil {
+			err = mw.WriteBytes(value)
+		}
+
+		count++
+
+		return err == nil
+	})
+	if iterErr != nil {
+		return count, iterErr
+	} else if err != nil {
+		return count, err
+	}
+
+	return count, mw.Flush()
+}
+
+// Import loads a snapshot written by Export, merging it into the cache, and returns the number of imported responses.
+// The expired responses are discarded, and the cached ones are only replaced by newer ones of the snapshot.
+// The entries that are too large for the store are skipped
+func (c *Cache) Import(r io.Reader, now int64) (int, error) {
+	mr := msgp.NewReader(r)
+
+	header, err := mr.ReadString()
+	if err != nil || header != snapshotHeader {
+		return 0, fmt.Errorf("Invalid cache snapshot header")
+	}
+
+	snapshot := AcquireEntry()
+	defer ReleaseEntry(snapshot)
+
+	entry := AcquireEntry()
+	defer ReleaseEntry(entry)
+
+	var data []byte
+
+	imported := 0
+
+	for {
+		key, err := mr.ReadString()
+		if err == io.EOF {
+			return imported, nil
+		} else if err != nil {
+			return imported, fmt.Errorf("Could not read cache snapshot key: %v", err)
+		}
+
+		if data, err = mr.ReadBytes(data[:0]); err != nil {
+			return imported, fmt.Errorf("Could not read cache snapshot entry of key '%s': %v", key, err)
+		}
+
+		snapshot.Reset()
+		if err := Unmarshal(snapshot, data); err != nil {
+			return imported, fmt.Errorf("Could not decode cache snapshot entry of key '%s': %v", key, err)
+		}
+
+		n, err := c.importEntry(c.namespacePrefix+key, snapshot, entry, now)
+		if err == ErrEntryTooLarge {
+			continue
+		} else if err != nil {
+			return imported, err
+		}
+
+		imported += n
+	}
+}
+
+// importEntry merges the fresh responses of the snapshot into the stored entry
+func (c *Cache) importEntry(storedKey string, snapshot, entry *Entry, now int64) (int, error) {
+	entry.Reset()
+
+	data, err := c.store.Get(storedKey)
+	if err != nil {
+		return 0, err
+	} else if err := Unmarshal(entry, data); err != nil {
+		return 0, err
+	}
+
+	imported := 0
+
+	for i := range snapshot.Responses {
+		r := &snapshot.Responses[i]
+
+		// Without expiration the store expires it, so the TTL is kept from when it was stored
+		if r.ExpiresAt == 0 {
+			r.ExpiresAt = r.StoredAt + int64(maxTTL(c.fileConfig))*60
+		}
+
+		if !c.Fresh(r, now) {
+			continue
+		}
+
+		if cached := entry.GetVariantResponse(r.Path, r.Variant); cached != nil && cached.StoredAt >= r.StoredAt {
+			continue
+		}
+
+		entry.SetResponse(*r)
+		imported++
+	}
+
+	if imported == 0 {
+		return 0, nil
+	}
+
+	return imported, c.SetStored(storedKey, *entry)
+}
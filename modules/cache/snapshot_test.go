@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	logger "github.com/savsgio/go-logger/v2"
+)
+
+func newSnapshotCacheTest(t *testing.T, namespace string) (*Cache, *mockStore) {
+	cfg := fileConfigCache()
+	cfg.Namespace = namespace
+
+	store := newMockStore()
+
+	c, err := New(Config{
+		FileConfig: cfg,
+		Store:      store,
+		LogLevel:   logger.ERROR,
+		LogOutput:  os.Stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c, store
+}
+
+func TestCache_Export_Import(t *testing.T) {
+	now := time.Now().Unix()
+	k := "www.kratgo.com"
+
+	newResponse := func(path, body string, storedAt, expiresAt int64) Response {
+		return Response{Path: []byte(path), Body: []byte(body), StoredAt: storedAt, ExpiresAt: expiresAt}
+	}
+
+	src, srcStore := newSnapshotCacheTest(t, "blue")
+
+	entry := Entry{}
+	entry.SetResponse(newResponse("/fresh/", "fresh", now-10, now+60))
+	entry.SetResponse(newResponse("/expired/", "expired", now-120, now-60))
+	entry.SetResponse(newResponse("/older/", "snapshot", now-10, now+60))
+	entry.SetResponse(newResponse("/newer/", "snapshot", now-10, now+60))
+
+	if err := src.Set(k, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	// Other namespaces are never exported
+	srcStore.data["green:"+k] = []byte("corrupted")
+
+	snapshot := new(bytes.Buffer)
+
+	exported, err := src.Export(snapshot)
+	if err != nil {
+		t.Fatalf("Cache.Export() unexpected error: %v", err)
+	}
+
+	if exported != 1 {
+		t.Errorf("Cache.Export() entries == '%d', want '%d'", exported, 1)
+	}
+
+	dst, _ := newSnapshotCacheTest(t, "green")
+
+	cached := Entry{}
+	cached.SetResponse(newResponse("/older/", "cached", now-20, now+60))
+	cached.SetResponse(newResponse("/newer/", "cached", now-5, now+60))
+
+	if err := dst.Set(k, cached); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := dst.Import(snapshot, now)
+	if err != nil {
+		t.Fatalf("Cache.Import() unexpected error: %v", err)
+	}
+
+	if imported != 2 {
+		t.Errorf("Cache.Import() responses == '%d', want '%d'", imported, 2)
+	}
+
+	result := AcquireEntry()
+	defer ReleaseEntry(result)
+
+	if err := dst.Get(k, result); err != nil {
+		t.Fatal(err)
+	}
+
+	wantBodies := map[string]string{"/fresh/": "fresh", "/expired/": "", "/older/": "snapshot", "/newer/": "cached"}
+
+	for path, want := range wantBodies {
+		body := ""
+		if r := result.GetResponse([]byte(path)); r != nil {
+			body = string(r.Body)
+		}
+
+		if body != want {
+			t.Errorf("Cache.Import() body of '%s' == '%s', want '%s'", path, body, want)
+		}
+	}
+}
+
+func TestCache_Import_Invalid(t *testing.T) {
+	c, _ := newSnapshotCacheTest(t, "")
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Empty", data: nil},
+		{name: "InvalidHeader", data: []byte("kratgo")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := c.Import(bytes.NewReader(tt.data), time.Now().Unix()); err == nil {
+				t.Error("Cache.Import() invalid snapshot, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/allegro/bigcache/v2"
+)
+
+// ErrEntryTooLarge is returned by Set if the entry could never be stored, as it's bigger than the store allows.
+// The custom stores could return it too, so the responses are served without caching them
+var ErrEntryTooLarge = errors.New("Entry is bigger than the max size of the cache")
+
+// newBigcacheStore returns the default store of the cache, in memory
+func newBigcacheStore(cfg bigcache.Config) (*bigcacheStore, error) {
+	bc, err := bigcache.NewBigCache(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &bigcacheStore{bc: bc}
+
+	// Each entry must fit in one shard, even if all its other entries are evicted
+	if cfg.HardMaxCacheSize > 0 {
+		s.maxEntrySize = cfg.HardMaxCacheSize*megabyte/cfg.Shards - bigcacheEntryOverhead
+	}
+
+	return s, nil
+}
+
+// Get returns nil if the key is not stored
+func (s *bigcacheStore) Get(key string) ([]byte, error) {
+	value, err := s.bc.Get(key)
+	if err == bigcache.ErrEntryNotFound {
+		return nil, nil
+	}
+
+	return value, err
+}
+
+// Set returns ErrEntryTooLarge if the entry doesn't fit in a shard
+func (s *bigcacheStore) Set(key string, value []byte) error {
+	// Checked before, as bigcache evicts all the entries of the shard before failing
+	if s.maxEntrySize > 0 && len(key)+len(value) >= s.maxEntrySize {
+		return ErrEntryTooLarge
+	}
+
+	err := s.bc.Set(key, value)
+
+	// The shard could be full even after evicting all its entries, without reaching the max size,
+	// as its memory grows by steps. bigcache has no sentinel error for it
+	if err != nil && err.Error() == bigcacheErrTooLarge {
+		return ErrEntryTooLarge
+	}
+
+	return err
+}
+
+// Delete does not fail if the key is not stored
+func (s *bigcacheStore) Delete(key string) error {
+	if err := s.bc.Delete(key); err != nil && err != bigcache.ErrEntryNotFound {
+		return err
+	}
+
+	return nil
+}
+
+// Iterate ...
+func (s *bigcacheStore) Iterate(fn func(key string, value []byte) bool) error {
+	iter := s.bc.Iterator()
+
+	for iter.SetNext() {
+		v, err := iter.Value()
+		if err != nil {
+			return fmt.Errorf("Could not get value from iterator: %v", err)
+		}
+
+		if !fn(v.Key(), v.Value()) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Len ...
+func (s *bigcacheStore) Len() int {
+	return s.bc.Len()
+}
+
+// Reset ...
+func (s *bigcacheStore) Reset() error {
+	return s.bc.Reset()
+}
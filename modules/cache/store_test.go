@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	logger "github.com/savsgio/go-logger/v2"
+)
+
+type mockStore struct {
+	data map[string][]byte
+	mu   sync.Mutex
+}
+
+func newMockStore() *mockStore {
+	return &mockStore{data: make(map[string][]byte)}
+}
+
+func (s *mockStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data[key], nil
+}
+
+func (s *mockStore) Set(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data[key] = append([]byte(nil), value...)
+
+	return nil
+}
+
+func (s *mockStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.data, key)
+
+	return nil
+}
+
+func (s *mockStore) Iterate(fn func(key string, value []byte) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, v := range s.data {
+		if !fn(k, v) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (s *mockStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.data)
+}
+
+func (s *mockStore) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data = make(map[string][]byte)
+
+	return nil
+}
+
+func TestCache_Store(t *testing.T) {
+	store := newMockStore()
+
+	c, err := New(Config{
+		FileConfig: fileConfigCache(),
+		Store:      store,
+		LogLevel:   logger.ERROR,
+		LogOutput:  os.Stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.store != store {
+		t.Fatalf("New() store == '%v', want the custom store", c.store)
+	}
+
+	// The custom stores don't expire the entries, so the responses always have expiration
+	ttl := fileConfigCache().TTL
+	if expiresAt := c.ExpiresAt(1000, ttl); expiresAt != 1000+int64(ttl)*60 {
+		t.Errorf("Cache.ExpiresAt() with custom store == '%d', want '%d'", expiresAt, 1000+int64(ttl)*60)
+	}
+
+	e := getEntryTest()
+	k := "www.kratgo.com"
+
+	if err := c.Set(k, e); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, ok := store.data[k]; !ok {
+		t.Errorf("The key '%s' has not been save in the custom store", k)
+	}
+
+	entry := AcquireEntry()
+	defer ReleaseEntry(entry)
+
+	if err := c.Get(k, entry); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(e, *entry) {
+		t.Errorf("Cache.Get() == '%v', want '%v'", *entry, e)
+	}
+
+	if length := c.Len(); length != 1 {
+		t.Errorf("Cache.Len() == '%d', want '%d'", length, 1)
+	}
+
+	if n, err := c.Purge(k); err != nil || n != len(e.Responses) {
+		t.Errorf("Cache.Purge() == '%d' with error '%v', want '%d'", n, err, len(e.Responses))
+	}
+
+	entry.Reset()
+	if err := c.Get(k, entry); err != nil || entry.Len() != 0 {
+		t.Errorf("Cache.Get() of purged key == '%v' with error '%v', want empty", *entry, err)
+	}
+
+	if n, err := c.Purge(k); err != nil || n != 0 {
+		t.Errorf("Cache.Purge() of missing key == '%d' with error '%v', want '%d'", n, err, 0)
+	}
+
+	c.Set(k, e)
+	if err := c.Reset(); err != nil || c.Len() != 0 {
+		t.Errorf("Cache.Reset() remains '%d' entries with error '%v'", c.Len(), err)
+	}
+}
+
+func Test_bigcacheStore(t *testing.T) {
+	store, err := newBigcacheStore(bigcacheConfig(fileConfigCache()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value, err := store.Get("missing"); value != nil || err != nil {
+		t.Errorf("bigcacheStore.Get() of missing key == '%s' with error '%v', want nil", value, err)
+	}
+
+	if err := store.Delete("missing"); err != nil {
+		t.Errorf("bigcacheStore.Delete() of missing key unexpected error: %v", err)
+	}
+
+	if err := store.Set("key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, err := store.Get("key"); string(value) != "value" || err != nil {
+		t.Errorf("bigcacheStore.Get() == '%s' with error '%v', want '%s'", value, err, "value")
+	}
+
+	calls := 0
+	store.Iterate(func(key string, value []byte) bool {
+		calls++
+		return false
+	})
+
+	if calls != 1 {
+		t.Errorf("bigcacheStore.Iterate() calls == '%d', want '%d'", calls, 1)
+	}
+}
+
+func Test_bigcacheStore_SetTooLarge(t *testing.T) {
+	cfg := fileConfigCache()
+	cfg.HardMaxCacheSize = 1
+	cfg.Shards = 1
+
+	store, err := newBigcacheStore(bigcacheConfig(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maxValueSize := store.maxEntrySize - len("key") - 1
+
+	tests := []struct {
+		name string
+		size int
+		err  error
+	}{
+		{name: "Fits", size: 1024},
+		{name: "FullShard", size: maxValueSize, err: ErrEntryTooLarge},
+		{name: "TooLarge", size: maxValueSize + 1, err: ErrEntryTooLarge},
+		{name: "BiggerThanCache", size: 2 * megabyte, err: ErrEntryTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.Set("key", make([]byte, tt.size)); err != tt.err {
+				t.Errorf("bigcacheStore.Set() of '%d' bytes error == '%v', want '%v'", tt.size, err, tt.err)
+			}
+		})
+	}
+}
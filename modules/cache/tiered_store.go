@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"sync/atomic"
+
+	"github.com/savsgio/kratgo/modules/config"
+)
+
+// newTieredStore returns the store with the hot entries in memory and the colder ones on disk,
+// the entries evicted from memory must be demoted to disk with demote
+func newTieredStore(memory config.CacheStore, disk *diskStore) *tieredStore {
+	return &tieredStore{
+		memory:    memory,
+		disk:      disk,
+		demotions: make(chan demotion, demotionQueueSize),
+		pending:   make(map[string]uint64),
+	}
+}
+
+// demote queues an entry evicted from memory to be written to disk, instead of dropping it.
+// It never waits, the entry is dropped if the queue is full
+func (s *tieredStore) demote(key string, value []byte) {
+	// The key and the value of the bigcache callback point to its shard memory, which is reused after the eviction
+	d := demotion{key: string([]byte(key)), value: append([]byte(nil), value...)}
+
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	s.lastPending++
+	d.id = s.lastPending
+
+	select {
+	case s.demotions <- d:
+		s.pending[d.key] = d.id
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// forget discards the pending demotion of the key, as it's outdated by a write or a deletion
+func (s *tieredStore) forget(key string) {
+	s.pendingMu.Lock()
+	delete(s.pending, key)
+	s.pendingMu.Unlock()
+}
+
+// writeDemotion writes the demoted entry to disk, unless the key has been written or deleted
+// since it was evicted, so a newer entry is not shadowed, nor a purged one restored, by the outdated copy
+func (s *tieredStore) writeDemotion(d demotion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pendingMu.Lock()
+	id, ok := s.pending[d.key]
+	if ok && id == d.id {
+		delete(s.pending, d.key)
+	}
+	s.pendingMu.Unlock()
+
+	if !ok || id != d.id {
+		return nil
+	}
+
+	return s.disk.Set(d.key, d.value)
+}
+
+// droppedDemotions returns the entries evicted from memory that were dropped, as the queue was full
+func (s *tieredStore) droppedDemotions() uint64 {
+	if s == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Get looks up the memory and then the disk, and the entries found on disk
+// are promoted to memory, as they are hot again
+func (s *tieredStore) Get(key string) ([]byte, error) {
+	value, err := s.memory.Get(key)
+	if err != nil || value != nil {
+		return value, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Looked up again with the lock, as it could have been promoted or written meanwhile
+	value, err = s.memory.Get(key)
+	if err != nil || value != nil {
+		return value, err
+	}
+
+	value, err = s.disk.Get(key)
+	if err != nil || value == nil {
+		return value, err
+	}
+
+	// Kept on disk if it could not be promoted (ex: bigger than the memory entries)
+	s.forget(key)
+	if err := s.memory.Set(key, value); err == nil {
+		if err := s.disk.Delete(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return value, nil
+}
+
+// Peek is like Get, but the entries found on disk are not promoted to memory,
+// for the lookups that are not requests of the entries (ex: the admin api or the invalidator)
+func (s *tieredStore) Peek(key string) ([]byte, error) {
+	value, err := s.memory.Get(key)
+	if err != nil || value != nil {
+		return value, err
+	}
+
+	value, err = s.disk.Get(key)
+	if err != nil || value != nil {
+		return value, err
+	}
+
+	// It could have been promoted meanwhile
+	return s.memory.Get(key)
+}
+
+// Set stores the entry in memory, or on disk if it's bigger than the memory entries
+func (s *tieredStore) Set(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.forget(key)
+
+	err := s.memory.Set(key, value)
+	if err == ErrEntryTooLarge {
+		if err := s.disk.Set(key, value); err != nil {
+			return err
+		}
+
+		return s.memory.Delete(key)
+	} else if err != nil {
+		return err
+	}
+
+	// Each entry is only in one tier, so the demoted copy is outdated
+	return s.disk.Delete(key)
+}
+
+// Delete deletes the entry from both tiers, and discards its pending demotion
+func (s *tieredStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.forget(key)
+
+	if err := s.memory.Delete(key); err != nil {
+		return err
+	}
+
+	return s.disk.Delete(key)
+}
+
+// Iterate calls fn with the entries of the memory and then the ones of the disk
+func (s *tieredStore) Iterate(fn func(key string, value []byte) bool) error {
+	stopped := false
+
+	err := s.memory.Iterate(func(key string, value []byte) bool {
+		stopped = !fn(key, value)
+
+		return !stopped
+	})
+	if err != nil || stopped {
+		return err
+	}
+
+	return s.disk.Iterate(fn)
+}
+
+// Len ...
+func (s *tieredStore) Len() int {
+	return s.memory.Len() + s.disk.Len()
+}
+
+// Reset resets both tiers, and discards the pending demotions
+func (s *tieredStore) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pendingMu.Lock()
+	s.pending = make(map[string]uint64)
+	s.pendingMu.Unlock()
+
+	if err := s.memory.Reset(); err != nil {
+		return err
+	}
+
+	return s.disk.Reset()
+}
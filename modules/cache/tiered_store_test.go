@@ -0,0 +1,288 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	logger "github.com/savsgio/go-logger/v2"
+)
+
+func newTestTieredCache(t *testing.T) (*Cache, *tieredStore) {
+	dir, err := ioutil.TempDir("", "kratgo-disk-tier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := fileConfigCache()
+	cfg.HardMaxCacheSize = 1
+	cfg.Shards = 1
+	cfg.Tiers.Disk = config.DiskTier{Path: dir, MaxSize: 10}
+
+	c, err := New(Config{FileConfig: cfg, LogLevel: logger.ERROR, LogOutput: os.Stderr})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, ok := c.store.(*tieredStore)
+	if !ok {
+		t.Fatalf("New() store is '%T', want '%T'", c.store, s)
+	}
+
+	return c, s
+}
+
+// waitTieredLen waits until the store has n entries, as the evicted ones are demoted to disk in background
+func waitTieredLen(t *testing.T, s *tieredStore, n int) {
+	deadline := time.Now().Add(2 * time.Second)
+
+	for s.Len() != n || len(s.demotions) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("tieredStore.Len() == '%d', want '%d'", s.Len(), n)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNew_Tiers(t *testing.T) {
+	cfg := fileConfigCache()
+	cfg.Tiers.Disk = config.DiskTier{Path: "/tmp/kratgo", MaxSize: 10}
+
+	if _, err := New(Config{FileConfig: cfg, Store: newMockStore(), LogLevel: logger.ERROR, LogOutput: os.Stderr}); err == nil {
+		t.Errorf("New() with a custom store and tiers has not returned an error")
+	}
+
+	c, s := newTestTieredCache(t)
+	defer c.Close()
+	defer os.RemoveAll(s.disk.dir)
+
+	if c.storeExpiration {
+		t.Errorf("New() storeExpiration == '%v' with tiers, want '%v'", c.storeExpiration, false)
+	}
+}
+
+func Test_tieredStore(t *testing.T) {
+	c, s := newTestTieredCache(t)
+	defer c.Close()
+	defer os.RemoveAll(s.disk.dir)
+
+	value := bytes.Repeat([]byte("a"), 100*1024)
+	total := 30
+
+	for i := 0; i < total; i++ {
+		if err := s.Set(fmt.Sprintf("key-%d", i), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitTieredLen(t, s, total)
+
+	if s.disk.Len() == 0 {
+		t.Fatalf("tieredStore.Set() has not demoted the evicted entries to disk")
+	}
+
+	// The oldest entries have been evicted from memory first
+	key := "key-0"
+
+	if v, _ := s.disk.Get(key); v == nil {
+		t.Fatalf("tieredStore.Set() the oldest entry is not on disk")
+	}
+
+	v, err := s.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(v, value) {
+		t.Errorf("tieredStore.Get() has not returned the entry of disk")
+	}
+
+	if v, _ := s.disk.Get(key); v != nil {
+		t.Errorf("tieredStore.Get() the entry has not been promoted to memory")
+	}
+
+	// The promoted entry has evicted other one from memory
+	waitTieredLen(t, s, total)
+
+	// Bigger than the memory entries, so it's only stored on disk
+	large := bytes.Repeat([]byte("a"), 2*1024*1024)
+	if err := s.Set("large", large); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := s.Get("large"); !bytes.Equal(v, large) {
+		t.Errorf("tieredStore.Get() has not returned the large entry")
+	}
+
+	if v, _ := s.disk.Get("large"); v == nil {
+		t.Errorf("tieredStore.Set() the large entry is not on disk")
+	}
+
+	for _, k := range []string{key, "key-1", "large"} {
+		if err := s.Delete(k); err != nil {
+			t.Fatal(err)
+		}
+
+		if v, _ := s.Get(k); v != nil {
+			t.Errorf("tieredStore.Delete() has not deleted the entry '%s'", k)
+		}
+	}
+
+	if err := s.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := s.Len(); n != 0 {
+		t.Errorf("tieredStore.Reset() Len() == '%d', want '%d'", n, 0)
+	}
+}
+
+func Test_tieredStore_demote(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kratgo-disk-tier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	disk, err := newDiskStore(config.DiskTier{Path: dir, MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memory := newMockStore()
+	s := newTieredStore(memory, disk)
+	s.demotions = make(chan demotion, 1)
+
+	key := []byte("key")
+	value := []byte("value")
+
+	s.demote(string(key), value)
+	s.demote("other", value)
+
+	// The queued demotion is a copy, as bigcache reuses the memory of the evicted entries
+	key[0], value[0] = 'x', 'x'
+
+	if dropped := s.droppedDemotions(); dropped != 1 {
+		t.Errorf("tieredStore.demote() dropped == '%d', want '%d'", dropped, 1)
+	}
+
+	d := <-s.demotions
+	if d.key != "key" || string(d.value) != "value" {
+		t.Fatalf("tieredStore.demote() queued '%s=%s', want '%s=%s'", d.key, d.value, "key", "value")
+	}
+
+	// Stored again since it was evicted, so the outdated copy is not written
+	if err := s.Set(d.key, []byte("newer")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.writeDemotion(d); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := disk.Get(d.key); v != nil {
+		t.Errorf("tieredStore.writeDemotion() wrote the entry stored again")
+	}
+
+	// Deleted since it was evicted, so the purged entry is not restored
+	s.demote(d.key, value)
+	d = <-s.demotions
+
+	if err := s.Delete(d.key); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.writeDemotion(d); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := disk.Get(d.key); v != nil {
+		t.Errorf("tieredStore.writeDemotion() wrote the entry deleted")
+	}
+
+	// Only the last demotion of the key is written
+	s.demote(d.key, []byte("old"))
+	old := <-s.demotions
+	s.demote(d.key, []byte("last"))
+	d = <-s.demotions
+
+	for _, demoted := range []demotion{old, d} {
+		if err := s.writeDemotion(demoted); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if v, _ := disk.Get(d.key); string(v) != "last" {
+		t.Errorf("tieredStore.writeDemotion() disk entry == '%s', want '%s'", v, "last")
+	}
+}
+
+func Test_tieredStore_Peek(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kratgo-disk-tier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	disk, err := newDiskStore(config.DiskTier{Path: dir, MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memory := newMockStore()
+	s := newTieredStore(memory, disk)
+
+	if err := disk.Set("key", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := s.Peek("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(v) != "value" {
+		t.Errorf("tieredStore.Peek() == '%s', want '%s'", v, "value")
+	}
+
+	if v, _ := memory.Get("key"); v != nil {
+		t.Errorf("tieredStore.Peek() has promoted the entry to memory")
+	}
+
+	if v, _ := disk.Get("key"); v == nil {
+		t.Errorf("tieredStore.Peek() has deleted the entry of disk")
+	}
+}
+
+func TestCache_Peek(t *testing.T) {
+	c, s := newTestTieredCache(t)
+	defer c.Close()
+	defer os.RemoveAll(s.disk.dir)
+
+	key := "www.kratgo.com"
+	entry := getEntryTest()
+	data, _ := Marshal(entry)
+
+	if err := s.disk.Set(c.StoredKey(key), data); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := AcquireEntry()
+	if err := c.Peek(key, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if !dst.HasResponse(entry.Responses[0].Path) {
+		t.Errorf("Cache.Peek() has not returned the entry of disk")
+	}
+
+	if v, _ := s.memory.Get(c.StoredKey(key)); v != nil {
+		t.Errorf("Cache.Peek() has promoted the entry to memory")
+	}
+}
@@ -1,17 +1,23 @@
 package cache
 
 import (
+	"container/list"
 	"io"
+	"sync"
 
 	"github.com/savsgio/kratgo/modules/config"
 
 	"github.com/allegro/bigcache/v2"
+	logger "github.com/savsgio/go-logger/v2"
 )
 
 // Config ...
 type Config struct {
 	FileConfig config.Cache
 
+	// Store is the storage of the entries, bigcache in memory by default
+	Store config.CacheStore
+
 	LogLevel  string
 	LogOutput io.Writer
 }
@@ -20,5 +26,84 @@ type Config struct {
 type Cache struct {
 	fileConfig config.Cache
 
+	namespacePrefix string
+
+	// memory is only set if the memory pressure watermarks are configured
+	memory *memoryWatchdog
+
+	store config.CacheStore
+
+	// storeExpiration is true if the store expires the entries with the TTL (the default one)
+	storeExpiration bool
+
+	// tiered is only set if the disk tier is configured
+	tiered *tieredStore
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	log *logger.Logger
+}
+
+// bigcacheStore is the default store of the cache
+type bigcacheStore struct {
 	bc *bigcache.BigCache
+
+	// maxEntrySize is the max size of the key and the value, only set if the cache size is limited
+	maxEntrySize int
+}
+
+// tieredStore is the default store with a disk tier, for the entries evicted from memory
+type tieredStore struct {
+	memory config.CacheStore
+	disk   *diskStore
+
+	// mu serializes the writes, the deletions, the demotions and the promotions of the entries,
+	// so an outdated copy never replaces a newer write or a deletion of the same key
+	mu sync.Mutex
+
+	// demotions are the entries evicted from memory, written to disk by runDemoter out of
+	// the eviction callback of bigcache, which holds the lock of the shard
+	demotions chan demotion
+	dropped   uint64
+
+	// pending has the id of the last queued demotion by key, removed by the writes and the deletions
+	// of the key so the outdated demotions are discarded. It has its own lock, as the demotions
+	// are queued by the eviction callback while mu is held by the write that evicts them
+	pending     map[string]uint64
+	pendingMu   sync.Mutex
+	lastPending uint64
+}
+
+type demotion struct {
+	id    uint64
+	key   string
+	value []byte
+}
+
+// diskStore is the disk tier of the cache, with a file by entry
+type diskStore struct {
+	dir     string
+	maxSize int64
+
+	// items are the entries by key, and order has them from the oldest one, to evict them by size
+	items map[string]*list.Element
+	order *list.List
+	size  int64
+
+	mu sync.Mutex
+}
+
+type diskItem struct {
+	key  string
+	file string
+	size int64
+}
+
+type memoryWatchdog struct {
+	high  uint64
+	low   uint64
+	evict bool
+
+	pressure int32
 }
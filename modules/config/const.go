@@ -8,10 +8,27 @@ const configStatusCodeVar = "$(statusCode)"
 const configReqHeaderVar = "$(req.header::<NAME>)"
 const configRespHeaderVar = "$(resp.header::<NAME>)"
 const configCookieVar = "$(cookie::<NAME>)"
+const configRespCookieVar = "$(resp.cookie::<NAME>)"
+const configClientIPVar = "$(clientIP)"
+const configHasBodyVar = "$(hasBody)"
+const configContentLengthVar = "$(contentLength)"
+
+const (
+	envLogLevel          = "KRATGO_LOG_LEVEL"
+	envLogOutput         = "KRATGO_LOG_OUTPUT"
+	envCacheTTL          = "KRATGO_CACHE_TTL"
+	envProxyAddr         = "KRATGO_PROXY_ADDR"
+	envProxyBackendAddrs = "KRATGO_PROXY_BACKEND_ADDRS"
+	envAdminAddr         = "KRATGO_ADMIN_ADDR"
+)
 
 // EvalVarPrefix ...
 const EvalVarPrefix = "Krat"
 
+// EvalNumericSuffix is appended to the evaluation variable of the numeric comparisons, like "$(statusCode) >= 500",
+// so they have their own parameter and the other occurrences of the variable are compared as strings
+const EvalNumericSuffix = "NUMERIC"
+
 // EvalMethodVar ...
 const EvalMethodVar = EvalVarPrefix + "METHOD"
 
@@ -35,3 +52,18 @@ const EvalRespHeaderVar = EvalVarPrefix + "RESPHEADER"
 
 // EvalCookieVar ...
 const EvalCookieVar = EvalVarPrefix + "COOKIE"
+
+// EvalRespCookieVar ...
+const EvalRespCookieVar = EvalVarPrefix + "RESPCOOKIE"
+
+// EvalClientIPVar ...
+const EvalClientIPVar = EvalVarPrefix + "CLIENTIP"
+
+// EvalHasBodyVar ...
+const EvalHasBodyVar = EvalVarPrefix + "HASBODY"
+
+// EvalContentLengthVar ...
+const EvalContentLengthVar = EvalVarPrefix + "CONTENTLENGTH"
+
+// EvalCustomVar ...
+const EvalCustomVar = EvalVarPrefix + "CUSTOM"
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// envVarRegex matches the references to environment variables in the config values, like ${KRATGO_TTL}
+var envVarRegex = regexp.MustCompile("\\$\\{([a-zA-Z_][a-zA-Z0-9_]*)\\}")
+
+type envOverride struct {
+	name  string
+	apply func(cfg *Config, value string) error
+}
+
+// envOverrides are the config fields that could be overridden with an environment variable,
+// beating the value of the config file
+var envOverrides = []envOverride{
+	{name: envLogLevel, apply: func(cfg *Config, value string) error {
+		cfg.LogLevel = value
+		return nil
+	}},
+	{name: envLogOutput, apply: func(cfg *Config, value string) error {
+		cfg.LogOutput = value
+		return nil
+	}},
+	{name: envCacheTTL, apply: func(cfg *Config, value string) error {
+		ttl, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+
+		cfg.Cache.TTL = ttl
+		return nil
+	}},
+	{name: envProxyAddr, apply: func(cfg *Config, value string) error {
+		cfg.Proxy.Addr = value
+		return nil
+	}},
+	{name: envProxyBackendAddrs, apply: func(cfg *Config, value string) error {
+		cfg.Proxy.BackendAddrs = cfg.Proxy.BackendAddrs[:0]
+
+		for _, addr := range strings.Split(value, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				cfg.Proxy.BackendAddrs = append(cfg.Proxy.BackendAddrs, addr)
+			}
+		}
+
+		return nil
+	}},
+	{name: envAdminAddr, apply: func(cfg *Config, value string) error {
+		cfg.Admin.Addr = value
+		return nil
+	}},
+}
+
+// expandEnv replaces the references to environment variables in the scalar values of the node,
+// so the comments are not expanded. It fails if a referenced variable is not set
+func expandEnv(n *yaml.Node, lookupEnv func(string) (string, bool)) error {
+	if n.Kind == yaml.ScalarNode && strings.Contains(n.Value, "${") {
+		var err error
+
+		value := envVarRegex.ReplaceAllStringFunc(n.Value, func(ref string) string {
+			name := envVarRegex.FindStringSubmatch(ref)[1]
+
+			v, ok := lookupEnv(name)
+			if !ok && err == nil {
+				err = fmt.Errorf("Environment variable '%s' is not set, referenced in line %d", name, n.Line)
+			}
+
+			return v
+		})
+		if err != nil {
+			return err
+		}
+
+		if value != n.Value {
+			n.Value = value
+
+			if n.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) == 0 {
+				// Resolved again with the expanded value, ex: as number
+				n.Tag = ""
+			}
+		}
+	}
+
+	for _, child := range n.Content {
+		if err := expandEnv(child, lookupEnv); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyEnvOverrides sets the config fields of the environment variables that are set
+func applyEnvOverrides(cfg *Config, lookupEnv func(string) (string, bool)) error {
+	for _, o := range envOverrides {
+		value, ok := lookupEnv(o.name)
+		if !ok {
+			continue
+		}
+
+		if err := o.apply(cfg, value); err != nil {
+			return fmt.Errorf("Invalid environment variable '%s': %v", o.name, err)
+		}
+	}
+
+	return nil
+}
+
+// parseWithEnv decodes the config data, expanding the environment variables and applying the overrides
+func parseWithEnv(data []byte, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := new(Config)
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	if err := expandEnv(&root, lookupEnv); err != nil {
+		return nil, err
+	}
+
+	if len(root.Content) > 0 {
+		if err := root.Decode(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyEnvOverrides(cfg, lookupEnv); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
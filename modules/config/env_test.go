@@ -0,0 +1,90 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testLookupEnv(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+}
+
+func Test_parseWithEnv(t *testing.T) {
+	data := []byte(`
+# The comments are not expanded: ${NOT_SET}
+logLevel: ${LOG_LEVEL}
+cache:
+  ttl: ${CACHE_TTL}
+proxy:
+  addr: "${HOST}:6081"
+  backendAddrs:
+    - ${BACKEND}
+admin:
+  addr: 0.0.0.0:6082
+`)
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want Config
+		err  bool
+	}{
+		{
+			name: "Expanded",
+			env:  map[string]string{"LOG_LEVEL": "debug", "CACHE_TTL": "10", "HOST": "0.0.0.0", "BACKEND": "localhost:5000"},
+			want: Config{
+				LogLevel: "debug",
+				Cache:    Cache{TTL: 10},
+				Proxy:    Proxy{Addr: "0.0.0.0:6081", BackendAddrs: []string{"localhost:5000"}},
+				Admin:    Admin{Addr: "0.0.0.0:6082"},
+			},
+		},
+		{
+			name: "Overrides",
+			env: map[string]string{
+				"LOG_LEVEL": "debug", "CACHE_TTL": "10", "HOST": "0.0.0.0", "BACKEND": "localhost:5000",
+				envLogLevel:          "error",
+				envCacheTTL:          "20",
+				envProxyAddr:         "127.0.0.1:80",
+				envProxyBackendAddrs: "10.0.0.1:80, 10.0.0.2:80",
+				envAdminAddr:         "127.0.0.1:81",
+			},
+			want: Config{
+				LogLevel: "error",
+				Cache:    Cache{TTL: 20},
+				Proxy:    Proxy{Addr: "127.0.0.1:80", BackendAddrs: []string{"10.0.0.1:80", "10.0.0.2:80"}},
+				Admin:    Admin{Addr: "127.0.0.1:81"},
+			},
+		},
+		{
+			name: "MissingVar",
+			env:  map[string]string{"LOG_LEVEL": "debug", "CACHE_TTL": "10", "HOST": "0.0.0.0"},
+			err:  true,
+		},
+		{
+			name: "InvalidOverride",
+			env:  map[string]string{"LOG_LEVEL": "debug", "CACHE_TTL": "10", "HOST": "0.0.0.0", "BACKEND": "a", envCacheTTL: "ten"},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseWithEnv(data, testLookupEnv(tt.env))
+			if (err != nil) != tt.err {
+				t.Fatalf("parseWithEnv() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if tt.err {
+				return
+			}
+
+			if !reflect.DeepEqual(*cfg, tt.want) {
+				t.Errorf("parseWithEnv() == '%+v', want '%+v'", *cfg, tt.want)
+			}
+		})
+	}
+}
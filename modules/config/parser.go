@@ -4,9 +4,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"os"
 	"regexp"
-
-	yaml "gopkg.in/yaml.v3"
+	"strings"
 )
 
 var configEvaluationVars = map[string]string{
@@ -18,6 +18,16 @@ var configEvaluationVars = map[string]string{
 	configReqHeaderVar:   EvalReqHeaderVar,
 	configRespHeaderVar:  EvalRespHeaderVar,
 	configCookieVar:      EvalCookieVar,
+	configRespCookieVar:  EvalRespCookieVar,
+	configClientIPVar:    EvalClientIPVar,
+
+	configHasBodyVar:       EvalHasBodyVar,
+	configContentLengthVar: EvalContentLengthVar,
+}
+
+var configNumericVars = []string{
+	configStatusCodeVar,
+	configContentLengthVar,
 }
 
 // ConfigVarRegex ...
@@ -32,6 +42,12 @@ var ConfigRespHeaderVarRegex = regexp.MustCompile("\\$\\(resp\\.header::([a-zA-Z
 // ConfigCookieVarRegex ...
 var ConfigCookieVarRegex = regexp.MustCompile("\\$\\(cookie::([a-zA-Z0-9\\-\\_]+)\\)")
 
+// ConfigRespCookieVarRegex ...
+var ConfigRespCookieVarRegex = regexp.MustCompile("\\$\\(resp\\.cookie::([a-zA-Z0-9\\-\\_]+)\\)")
+
+// ConfigCustomVarRegex ...
+var ConfigCustomVarRegex = regexp.MustCompile("\\$\\(([a-zA-Z0-9\\-\\.\\_]+)(?:::([a-zA-Z0-9\\-\\_]+))?\\)")
+
 // Parse ...
 func Parse(path string) (*Config, error) {
 	data, err := ioutil.ReadFile(path)
@@ -39,11 +55,11 @@ func Parse(path string) (*Config, error) {
 		return nil, err
 	}
 
-	cfg := new(Config)
-	err = yaml.Unmarshal(data, cfg)
+	cfg, err := parseWithEnv(data, os.LookupEnv)
 	if err != nil {
 		return nil, err
 	}
+	cfg.FilePath = path
 
 	return cfg, nil
 }
@@ -53,7 +69,7 @@ func GetEvalParamName(k string) string {
 	if k == configReqHeaderVar || k == configRespHeaderVar {
 		return fmt.Sprintf("%s%d", configEvaluationVars[k], rand.Int31n(100))
 
-	} else if k == configCookieVar {
+	} else if k == configCookieVar || k == configRespCookieVar {
 		return fmt.Sprintf("%s%d", configEvaluationVars[k], rand.Int31n(100))
 	}
 
@@ -64,6 +80,51 @@ func GetEvalParamName(k string) string {
 	return k
 }
 
+// ParseCustomVarKeys returns the first variable in s, its custom variable name and sub key
+func ParseCustomVarKeys(s string) (string, string, string) {
+	data := ConfigCustomVarRegex.FindStringSubmatch(s)
+	if len(data) < 3 {
+		return "", "", ""
+	}
+
+	return data[0], data[1], data[2]
+}
+
+// IsNumericVar ...
+func IsNumericVar(k string) bool {
+	for _, v := range configNumericVars {
+		if v == k {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReplaceNumericComparisons replaces the variable k with numericKey only where it's compared against
+// an unquoted numeric constant in the rule, like "$(statusCode) >= 500", and reports if any has been replaced.
+// The rest of occurrences are kept, as they are compared as strings, like "$(statusCode) == '404'"
+func ReplaceNumericComparisons(rule, k, numericKey string) (string, bool) {
+	if !IsNumericVar(k) {
+		return rule, false
+	}
+
+	quotedKey := regexp.QuoteMeta(k)
+	numericComparison := regexp.MustCompile(
+		"(" + quotedKey + "\\s*(==|!=|>=|<=|>|<)\\s*-?[0-9.]+)|([0-9.]+\\s*(==|!=|>=|<=|>|<)\\s*" + quotedKey + ")",
+	)
+
+	replaced := false
+
+	rule = numericComparison.ReplaceAllStringFunc(rule, func(comparison string) string {
+		replaced = true
+
+		return strings.Replace(comparison, k, numericKey, 1)
+	})
+
+	return rule, replaced
+}
+
 // ParseConfigKeys ...
 func ParseConfigKeys(s string) (string, string, string) {
 	for k := range configEvaluationVars {
@@ -84,6 +145,12 @@ func ParseConfigKeys(s string) (string, string, string) {
 				return data[0], GetEvalParamName(k), data[1]
 			}
 
+		} else if k == configRespCookieVar {
+			data := ConfigRespCookieVarRegex.FindStringSubmatch(s)
+			if len(data) > 1 {
+				return data[0], GetEvalParamName(k), data[1]
+			}
+
 		} else {
 			data := ConfigVarRegex.FindStringSubmatch(s)
 			if len(data) > 0 && data[0] == k {
@@ -113,6 +113,10 @@ func TestParse(t *testing.T) {
 				return
 			}
 
+			if cfg.FilePath != tt.args.filePath {
+				t.Errorf("Parse() FilePath == '%s', want '%s'", cfg.FilePath, tt.args.filePath)
+			}
+
 			logLevel := "debug"
 			if cfg.LogLevel != logLevel {
 				t.Fatalf("Parse() LogLevel == '%s', want '%s'", cfg.LogLevel, logLevel)
@@ -247,6 +251,33 @@ func TestGetEvalParamName(t *testing.T) {
 				evalKey: EvalStatusCodeVar,
 			},
 		},
+		{
+			name: "client-ip",
+			args: args{
+				key: configClientIPVar,
+			},
+			want: want{
+				evalKey: EvalClientIPVar,
+			},
+		},
+		{
+			name: "has-body",
+			args: args{
+				key: configHasBodyVar,
+			},
+			want: want{
+				evalKey: EvalHasBodyVar,
+			},
+		},
+		{
+			name: "content-length",
+			args: args{
+				key: configContentLengthVar,
+			},
+			want: want{
+				evalKey: EvalContentLengthVar,
+			},
+		},
 		{
 			name: "$(req.header::<NAME>)",
 			args: args{
@@ -274,6 +305,15 @@ func TestGetEvalParamName(t *testing.T) {
 				regexEvalKey: regexp.MustCompile(fmt.Sprintf("%s([0-9]{1,2})", EvalCookieVar)),
 			},
 		},
+		{
+			name: "$(resp.cookie::<NAME>)",
+			args: args{
+				key: configRespCookieVar,
+			},
+			want: want{
+				regexEvalKey: regexp.MustCompile(fmt.Sprintf("%s([0-9]{1,2})", EvalRespCookieVar)),
+			},
+		},
 		{
 			name: "unknown",
 			args: args{
@@ -402,6 +442,17 @@ func TestParseConfigKeys(t *testing.T) {
 				regexEvalKey: regexp.MustCompile(fmt.Sprintf("%s([0-9]{1,2})", EvalCookieVar)),
 			},
 		},
+		{
+			name: "$(resp.cookie::<NAME>)",
+			args: args{
+				key: "$(resp.cookie::Kratgo)",
+			},
+			want: want{
+				configKey:    "$(resp.cookie::Kratgo)",
+				evalSubKey:   "Kratgo",
+				regexEvalKey: regexp.MustCompile(fmt.Sprintf("%s([0-9]{1,2})", EvalRespCookieVar)),
+			},
+		},
 		{
 			name: "unknown",
 			args: args{
@@ -439,3 +490,67 @@ func TestParseConfigKeys(t *testing.T) {
 		})
 	}
 }
+
+func TestReplaceNumericComparisons(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     string
+		key      string
+		want     string
+		replaced bool
+	}{
+		{name: "GreaterOrEqual", rule: "$(statusCode) >= 500", key: configStatusCodeVar, want: "NUM >= 500", replaced: true},
+		{name: "Reversed", rule: "500 <= $(statusCode)", key: configStatusCodeVar, want: "500 <= NUM", replaced: true},
+		{
+			name: "Range", rule: "$(statusCode) >= 400 && $(statusCode) < 500", key: configStatusCodeVar,
+			want: "NUM >= 400 && NUM < 500", replaced: true,
+		},
+		{
+			name: "Mixed", rule: "$(statusCode) >= 500 || $(statusCode) == '404'", key: configStatusCodeVar,
+			want: "NUM >= 500 || $(statusCode) == '404'", replaced: true,
+		},
+		{name: "Quoted", rule: "$(statusCode) == '200'", key: configStatusCodeVar, want: "$(statusCode) == '200'", replaced: false},
+		{name: "NotNumericVar", rule: "$(path) == 1", key: configPathVar, want: "$(path) == 1", replaced: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, replaced := ReplaceNumericComparisons(tt.rule, tt.key, "NUM")
+			if got != tt.want || replaced != tt.replaced {
+				t.Errorf("ReplaceNumericComparisons() = '%s', '%v', want '%s', '%v'", got, replaced, tt.want, tt.replaced)
+			}
+		})
+	}
+}
+
+func TestParseCustomVarKeys(t *testing.T) {
+	tests := []struct {
+		name       string
+		s          string
+		configKey  string
+		customName string
+		subKey     string
+	}{
+		{name: "Simple", s: "$(tenant) == 'acme'", configKey: "$(tenant)", customName: "tenant"},
+		{name: "SubKey", s: "$(geo::country) == 'ES'", configKey: "$(geo::country)", customName: "geo", subKey: "country"},
+		{name: "NoVar", s: "'acme' == 'acme'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configKey, name, subKey := ParseCustomVarKeys(tt.s)
+
+			if configKey != tt.configKey {
+				t.Errorf("ParseCustomVarKeys()[0] = '%s', want '%s'", configKey, tt.configKey)
+			}
+
+			if name != tt.customName {
+				t.Errorf("ParseCustomVarKeys()[1] = '%s', want '%s'", name, tt.customName)
+			}
+
+			if subKey != tt.subKey {
+				t.Errorf("ParseCustomVarKeys()[2] = '%s', want '%s'", subKey, tt.subKey)
+			}
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package config
 
+import "github.com/valyala/fasthttp"
+
 // Config ...
 type Config struct {
 	Cache       Cache       `yaml:"cache"`
@@ -9,14 +11,295 @@ type Config struct {
 
 	LogLevel  string `yaml:"logLevel"`
 	LogOutput string `yaml:"logOutput"`
+
+	// EvalVars are custom rule variables registered by name,
+	// used as $(<name>) or $(<name>::<subKey>) in the rules
+	EvalVars map[string]EvalVarResolver `yaml:"-"`
+
+	// CacheStore replaces the default store of the cache (in memory), ex: to share it between instances
+	CacheStore CacheStore `yaml:"-"`
+
+	// FilePath is the path of the configuration file, if it has been parsed from a file
+	FilePath string `yaml:"-"`
+}
+
+// EvalVarResolver returns the value of a custom rule variable
+type EvalVarResolver func(ctx *fasthttp.RequestCtx, resp *fasthttp.Response, subKey string) string
+
+// CacheStore is the storage of the encoded cache entries, by their stored keys.
+// Get must return nil without error if the key is not stored, and Delete must not fail for it.
+// It's used concurrently, so it must be safe for concurrent use
+type CacheStore interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte) error
+	Delete(key string) error
+	Iterate(fn func(key string, value []byte) bool) error
+	Len() int
+	Reset() error
 }
 
 // Proxy ...
 type Proxy struct {
-	Addr         string        `yaml:"addr"`
-	BackendAddrs []string      `yaml:"backendAddrs"`
-	Response     ProxyResponse `yaml:"response"`
-	Nocache      []string      `yaml:"nocache"`
+	Addr                    string                     `yaml:"addr"`
+	BackendAddrs            []string                   `yaml:"backendAddrs"`
+	BackendPools            []BackendPool              `yaml:"backendPools"`
+	NoMatchBehavior         NoMatchBehavior            `yaml:"noMatchBehavior"`
+	RequireHost             RequireHost                `yaml:"requireHost"`
+	Request                 ProxyRequest               `yaml:"request"`
+	Response                ProxyResponse              `yaml:"response"`
+	Nocache                 []string                   `yaml:"nocache"`
+	CacheOnlyWhen           string                     `yaml:"cacheOnlyWhen"`
+	CacheKeyCookies         []string                   `yaml:"cacheKeyCookies"`
+	CacheKeyQueryParams     []string                   `yaml:"cacheKeyQueryParams"`
+	IgnoreQueryParams       []string                   `yaml:"ignoreQueryParams"`
+	URINormalization        string                     `yaml:"uriNormalization"`
+	PrivateCacheKeyHeaders  []string                   `yaml:"privateCacheKeyHeaders"`
+	CacheableContentTypes   ProxyCacheableContentTypes `yaml:"cacheableContentTypes"`
+	ConditionalRevalidation bool                       `yaml:"conditionalRevalidation"`
+	StripRequestCookies     []string                   `yaml:"stripRequestCookies"`
+	BackendKeepAlive        *bool                      `yaml:"backendKeepAlive"`
+	BackendTLS              BackendTLS                 `yaml:"backendTLS"`
+	BackendHeaders          BackendHeaders             `yaml:"backendHeaders"`
+	DialTimeout             int                        `yaml:"dialTimeout"`
+	MaxIdleConnDuration     int                        `yaml:"maxIdleConnDuration"`
+	MaxConnDuration         int                        `yaml:"maxConnDuration"`
+	MaxResponseBodySize     int                        `yaml:"maxResponseBodySize"`
+	TrustedProxies          []string                   `yaml:"trustedProxies"`
+	BackendRetries          int                        `yaml:"backendRetries"`
+	RetryableStatusCodes    []int                      `yaml:"retryableStatusCodes"`
+	RetryBudget             RetryBudget                `yaml:"retryBudget"`
+	RetryPolicy             RetryPolicy                `yaml:"retryPolicy"`
+	PurgeOnStatus           []int                      `yaml:"purgeOnStatus"`
+	RouteLabels             []RouteLabel               `yaml:"routeLabels"`
+	CacheKeyHostRewrite     []HostRewrite              `yaml:"cacheKeyHostRewrite"`
+	RequestIDHeader         string                     `yaml:"requestIDHeader"`
+	TTLHeader               string                     `yaml:"ttlHeader"`
+	ErrorFormat             string                     `yaml:"errorFormat"`
+	ProxyProtocol           bool                       `yaml:"proxyProtocol"`
+	MaxConnsPerIP           int                        `yaml:"maxConnsPerIP"`
+	MaxConnsPerIPAllowIPs   []string                   `yaml:"maxConnsPerIPAllowIPs"`
+	ClientTimeoutHeader     string                     `yaml:"clientTimeoutHeader"`
+	MaxClientTimeout        int                        `yaml:"maxClientTimeout"`
+	Tracing                 Tracing                    `yaml:"tracing"`
+	Canary                  Canary                     `yaml:"canary"`
+	RuleMetrics             bool                       `yaml:"ruleMetrics"`
+	SizeMetrics             SizeMetrics                `yaml:"sizeMetrics"`
+	SlowRequestThreshold    int                        `yaml:"slowRequestThreshold"`
+	BodyRewrite             BodyRewrite                `yaml:"bodyRewrite"`
+	Compression             Compression                `yaml:"compression"`
+	Pool                    ProxyPool                  `yaml:"pool"`
+	Maintenance             Maintenance                `yaml:"maintenance"`
+	Deny                    Deny                       `yaml:"deny"`
+	RateLimitRules          []RateLimitRule            `yaml:"rateLimitRules"`
+	StaleGrace              StaleGrace                 `yaml:"staleGrace"`
+	StaticResponses         []StaticResponse           `yaml:"staticResponses"`
+	Prefetch                Prefetch                   `yaml:"prefetch"`
+	DeviceDetection         DeviceDetection            `yaml:"deviceDetection"`
+	BodyHashCache           []BodyHashCache            `yaml:"bodyHashCache"`
+	StatusRewrite           []StatusRewrite            `yaml:"statusRewrite"`
+	CacheRewrittenStatus    bool                       `yaml:"cacheRewrittenStatus"`
+
+	MaxConcurrentBackendRequests int `yaml:"maxConcurrentBackendRequests"`
+	BackendQueueTimeout          int `yaml:"backendQueueTimeout"`
+}
+
+// BackendPool ...
+type BackendPool struct {
+	Name         string   `yaml:"name"`
+	BackendAddrs []string `yaml:"backendAddrs"`
+	When         string   `yaml:"if"`
+}
+
+// BackendTLS ...
+type BackendTLS struct {
+	ServerName  string            `yaml:"serverName"`
+	ServerNames map[string]string `yaml:"serverNames"`
+}
+
+// BackendHeaders are the headers by name of each backend address
+type BackendHeaders map[string]map[string]string
+
+// RetryPolicy are the retries of each request method
+type RetryPolicy map[string]MethodRetry
+
+// MethodRetry ...
+type MethodRetry struct {
+	Retries       int    `yaml:"retries"`
+	RequireHeader string `yaml:"requireHeader"`
+}
+
+// NoMatchBehavior ...
+type NoMatchBehavior struct {
+	StatusCode int    `yaml:"statusCode"`
+	Pool       string `yaml:"pool"`
+}
+
+// StaticResponse ...
+type StaticResponse struct {
+	Pattern     string            `yaml:"pattern"`
+	StatusCode  int               `yaml:"statusCode"`
+	ContentType string            `yaml:"contentType"`
+	Headers     map[string]string `yaml:"headers"`
+	Body        string            `yaml:"body"`
+	BodyFile    string            `yaml:"bodyFile"`
+}
+
+// RequireHost ...
+type RequireHost struct {
+	StatusCode  int    `yaml:"statusCode"`
+	DefaultHost string `yaml:"defaultHost"`
+}
+
+// Maintenance ...
+type Maintenance struct {
+	Enabled     bool     `yaml:"enabled"`
+	StatusCode  int      `yaml:"statusCode"`
+	BodyFile    string   `yaml:"bodyFile"`
+	ContentType string   `yaml:"contentType"`
+	RetryAfter  int      `yaml:"retryAfter"`
+	AllowPaths  []string `yaml:"allowPaths"`
+	AllowIPs    []string `yaml:"allowIPs"`
+}
+
+// RateLimitRule ...
+type RateLimitRule struct {
+	When  string  `yaml:"if"`
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// Deny ...
+type Deny struct {
+	Rules       []string `yaml:"rules"`
+	Allow       []string `yaml:"allow"`
+	StatusCode  int      `yaml:"statusCode"`
+	Body        string   `yaml:"body"`
+	ContentType string   `yaml:"contentType"`
+}
+
+// StaleGrace ...
+type StaleGrace struct {
+	When  string `yaml:"if"`
+	Grace int    `yaml:"grace"`
+}
+
+// BodyHashCache ...
+type BodyHashCache struct {
+	When        string `yaml:"if"`
+	MaxBodySize int    `yaml:"maxBodySize"`
+}
+
+// StatusRewrite ...
+type StatusRewrite struct {
+	When string `yaml:"if"`
+	From int    `yaml:"from"`
+	To   int    `yaml:"to"`
+}
+
+// DeviceDetection ...
+type DeviceDetection struct {
+	Devices []Device `yaml:"devices"`
+	Default string   `yaml:"default"`
+	Header  string   `yaml:"header"`
+}
+
+// Device ...
+type Device struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+}
+
+// Prefetch ...
+type Prefetch struct {
+	Enabled       bool   `yaml:"enabled"`
+	Header        string `yaml:"header"`
+	Workers       int    `yaml:"workers"`
+	QueueSize     int    `yaml:"queueSize"`
+	MaxPerRequest int    `yaml:"maxPerRequest"`
+}
+
+// ProxyPool ...
+type ProxyPool struct {
+	MaxEvalParams int  `yaml:"maxEvalParams"`
+	MaxBufferSize int  `yaml:"maxBufferSize"`
+	Stats         bool `yaml:"stats"`
+}
+
+// BodyRewrite ...
+type BodyRewrite struct {
+	ContentTypes []string          `yaml:"contentTypes"`
+	MaxBodySize  int               `yaml:"maxBodySize"`
+	Rules        []BodyRewriteRule `yaml:"rules"`
+}
+
+// Compression ...
+type Compression struct {
+	Algorithm string `yaml:"algorithm"`
+	Level     int    `yaml:"level"`
+}
+
+// BodyRewriteRule ...
+type BodyRewriteRule struct {
+	Match   string `yaml:"match"`
+	Replace string `yaml:"replace"`
+	Regex   bool   `yaml:"regex"`
+}
+
+// Canary ...
+type Canary struct {
+	BackendAddrs []string   `yaml:"backendAddrs"`
+	Percent      float64    `yaml:"percent"`
+	BucketBy     string     `yaml:"bucketBy"`
+	Ramp         CanaryRamp `yaml:"ramp"`
+}
+
+// CanaryRamp ...
+type CanaryRamp struct {
+	StartPercent float64 `yaml:"startPercent"`
+	EndPercent   float64 `yaml:"endPercent"`
+	Duration     int     `yaml:"duration"`
+}
+
+// Tracing ...
+type Tracing struct {
+	Endpoint    string `yaml:"endpoint"`
+	ServiceName string `yaml:"serviceName"`
+}
+
+// HostRewrite ...
+type HostRewrite struct {
+	Pattern string `yaml:"pattern"`
+	Host    string `yaml:"host"`
+}
+
+// RouteLabel ...
+type RouteLabel struct {
+	Pattern string `yaml:"pattern"`
+	Label   string `yaml:"label"`
+}
+
+// SizeMetrics ...
+type SizeMetrics struct {
+	Enabled bool  `yaml:"enabled"`
+	Buckets []int `yaml:"buckets"`
+}
+
+// RetryBudget ...
+type RetryBudget struct {
+	Ratio  float64 `yaml:"ratio"`
+	Window int     `yaml:"window"`
+}
+
+// ProxyRequest ...
+type ProxyRequest struct {
+	Headers ProxyRequestHeaders `yaml:"headers"`
+}
+
+// ProxyRequestHeaders ...
+type ProxyRequestHeaders struct {
+	Set    []Header `yaml:"set"`
+	Unset  []Header `yaml:"unset"`
+	Append []Header `yaml:"append"`
 }
 
 // ProxyResponse ...
@@ -26,8 +309,23 @@ type ProxyResponse struct {
 
 // ProxyResponseHeaders ...
 type ProxyResponseHeaders struct {
-	Set   []Header `yaml:"set"`
-	Unset []Header `yaml:"unset"`
+	Set    []Header          `yaml:"set"`
+	Unset  []Header          `yaml:"unset"`
+	Append []Header          `yaml:"append"`
+	Always []Header          `yaml:"always"`
+	Cache  ProxyCacheHeaders `yaml:"cache"`
+}
+
+// ProxyCacheableContentTypes ...
+type ProxyCacheableContentTypes struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// ProxyCacheHeaders ...
+type ProxyCacheHeaders struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
 }
 
 // Header ...
@@ -39,19 +337,70 @@ type Header struct {
 
 // Cache ...
 type Cache struct {
-	TTL              int `yaml:"ttl"`
-	CleanFrequency   int `yaml:"cleanFrequency"`
-	MaxEntries       int `yaml:"maxEntries"`
-	MaxEntrySize     int `yaml:"maxEntrySize"`
-	HardMaxCacheSize int `yaml:"hardMaxCacheSize"`
+	TTL              int    `yaml:"ttl"`
+	CleanFrequency   int    `yaml:"cleanFrequency"`
+	MaxEntries       int    `yaml:"maxEntries"`
+	MaxEntrySize     int    `yaml:"maxEntrySize"`
+	HardMaxCacheSize int    `yaml:"hardMaxCacheSize"`
+	Shards           int    `yaml:"shards"`
+	Namespace        string `yaml:"namespace"`
+	MaxAge           int    `yaml:"maxAge"`
+	TTLJitter        int    `yaml:"ttlJitter"`
+	HashKeys         bool   `yaml:"hashKeys"`
+	FailOpen         *bool  `yaml:"failOpen"`
+
+	TTLByContentType []ContentTypeTTL `yaml:"ttlByContentType"`
+	MemoryPressure   MemoryPressure   `yaml:"memoryPressure"`
+	Tiers            CacheTiers       `yaml:"tiers"`
+}
+
+// CacheTiers ...
+type CacheTiers struct {
+	Disk DiskTier `yaml:"disk"`
+}
+
+// DiskTier ...
+type DiskTier struct {
+	Path    string `yaml:"path"`
+	MaxSize int    `yaml:"maxSize"`
+}
+
+// MemoryPressure ...
+type MemoryPressure struct {
+	HighWatermark int  `yaml:"highWatermark"`
+	LowWatermark  int  `yaml:"lowWatermark"`
+	Evict         bool `yaml:"evict"`
+}
+
+// ContentTypeTTL ...
+type ContentTypeTTL struct {
+	ContentType string `yaml:"contentType"`
+	TTL         int    `yaml:"ttl"`
 }
 
 // Invalidator ...
 type Invalidator struct {
-	MaxWorkers int32 `yaml:"maxWorkers"`
+	MaxWorkers       int32  `yaml:"maxWorkers"`
+	PersistQueuePath string `yaml:"persistQueuePath"`
+	MaxRetries       int    `yaml:"maxRetries"`
+	RetryBackoff     int    `yaml:"retryBackoff"`
 }
 
 // Admin ...
 type Admin struct {
-	Addr string `yaml:"addr"`
+	Addr               string             `yaml:"addr"`
+	Addrs              []string           `yaml:"addrs"`
+	Token              string             `yaml:"token"`
+	SignedInvalidation SignedInvalidation `yaml:"signedInvalidation"`
+	BenchEcho          bool               `yaml:"benchEcho"`
+	Snapshot           bool               `yaml:"snapshot"`
+	ReadTimeout        int                `yaml:"readTimeout"`
+	WriteTimeout       int                `yaml:"writeTimeout"`
+	MaxRequestBodySize int                `yaml:"maxRequestBodySize"`
+}
+
+// SignedInvalidation ...
+type SignedInvalidation struct {
+	Secret string `yaml:"secret"`
+	MaxAge int    `yaml:"maxAge"`
 }
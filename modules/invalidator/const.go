@@ -1,9 +1,19 @@
 package invalidator
 
+import "time"
+
+const defaultRetryBackoff = 100 * time.Millisecond
+const maxRetryBackoff = time.Minute
+
+// stopTimeout is the max time that Stop waits for the running invalidations,
+// the unfinished ones are persisted to replay them
+const stopTimeout = 10 * time.Second
+
 const (
 	invTypeHost invType = iota
 	invTypePath
 	invTypeHeader
 	invTypePathHeader
+	invTypeSurrogateKey
 	invTypeInvalid
 )
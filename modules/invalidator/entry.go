@@ -25,10 +25,24 @@ func (h *EntryHeader) Reset() {
 	h.Value = ""
 }
 
+// sendResult notifies the invalidation result, if someone is waiting for it
+func (e Entry) sendResult(err error) {
+	if e.result != nil {
+		e.result <- err
+	}
+}
+
 // Reset ...
 func (e *Entry) Reset() {
 	e.Host = ""
 	e.Path = ""
+	e.SurrogateKey = ""
+	e.Query = nil
+	e.Soft = false
+	e.Refresh = false
+	e.id = 0
+	e.attempts = 0
+	e.result = nil
 
 	e.Header.Reset()
 }
@@ -28,6 +28,7 @@ func TestReleaseEntry(t *testing.T) {
 	e.Path = "/fast"
 	e.Header.Key = "X-Data"
 	e.Header.Value = "1"
+	e.SurrogateKey = "product-1"
 
 	ReleaseEntry(e)
 
@@ -43,6 +44,9 @@ func TestReleaseEntry(t *testing.T) {
 	if e.Header.Value != "" {
 		t.Errorf("ReleaseEntry() entry has not been reset")
 	}
+	if e.SurrogateKey != "" {
+		t.Errorf("ReleaseEntry() entry has not been reset")
+	}
 }
 
 func TestHeader_Reset(t *testing.T) {
@@ -5,5 +5,17 @@ import "errors"
 // ErrEmptyFields ...
 var ErrEmptyFields = errors.New("Minimum one mandatory field")
 
+// ErrRefreshWithoutHost ...
+var ErrRefreshWithoutHost = errors.New("The refresh needs the host")
+
+// ErrQueryWithoutPath ...
+var ErrQueryWithoutPath = errors.New("The query needs the path")
+
+// ErrWaitTimeout ...
+var ErrWaitTimeout = errors.New("Timeout waiting for the invalidation, it will be finished in background")
+
+// ErrStopped ...
+var ErrStopped = errors.New("The invalidator is stopped")
+
 // ErrMaxWorkersZero ...
 var ErrMaxWorkersZero = errors.New("MaxWorkers must be greater than 0")
@@ -1,23 +1,87 @@
 package invalidator
 
 import (
+	"bytes"
 	"fmt"
+	"time"
 
 	"github.com/savsgio/kratgo/modules/cache"
 
-	"github.com/allegro/bigcache/v2"
 	"github.com/savsgio/gotils"
 )
 
 func (i *Invalidator) deleteCacheKey(cacheKey string) error {
-	if err := i.cache.Del(cacheKey); err != nil && err != bigcache.ErrEntryNotFound {
-		return err
+	return i.cache.DelStored(cacheKey)
+}
+
+// expireResponses marks as expired the responses that match, and saves the entry if any has been expired
+func (i *Invalidator) expireResponses(cacheKey string, cacheEntry cache.Entry, match func(resp *cache.Response) bool) error {
+	now := time.Now().Unix()
+	expired := 0
+
+	responses := cacheEntry.GetAllResponses()
+	for n := range responses {
+		resp := &responses[n]
+		if match(resp) {
+			resp.Expire(now)
+			expired++
+		}
 	}
 
-	return nil
+	if expired == 0 {
+		return nil
+	}
+
+	return i.cache.SetStored(cacheKey, cacheEntry)
+}
+
+// deleteResponses deletes the responses that match, and the cache data of the key if none remains, to free memory
+func (i *Invalidator) deleteResponses(cacheKey string, cacheEntry cache.Entry, match func(resp *cache.Response) bool) error {
+	var matched []cache.Response
+
+	responses := cacheEntry.GetAllResponses()
+	for n := range responses {
+		if match(&responses[n]) {
+			matched = append(matched, responses[n])
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil
+	} else if len(matched) == cacheEntry.Len() {
+		return i.deleteCacheKey(cacheKey)
+	}
+
+	for n := range matched {
+		cacheEntry.DelVariantResponse(matched[n].Path, matched[n].Variant)
+	}
+
+	return i.cache.SetStored(cacheKey, cacheEntry)
 }
 
-func (i *Invalidator) invalidateByHost(cacheKey string) error {
+// hasQuery returns if the response has all the query params of the invalidation
+func hasQuery(resp *cache.Response, query map[string]string) bool {
+	for k, v := range query {
+		if !resp.HasQueryParam(gotils.S2B(k), gotils.S2B(v)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (i *Invalidator) invalidateByHost(cacheKey string, cacheEntry cache.Entry, e Entry) error {
+	if e.Soft {
+		err := i.expireResponses(cacheKey, cacheEntry, func(resp *cache.Response) bool {
+			return true
+		})
+		if err != nil {
+			return fmt.Errorf("Could not invalidate cache by host '%s': %v", cacheKey, err)
+		}
+
+		return nil
+	}
+
 	if err := i.deleteCacheKey(cacheKey); err != nil {
 		return fmt.Errorf("Could not invalidate cache by host '%s': %v", cacheKey, err)
 	}
@@ -32,6 +96,26 @@ func (i *Invalidator) invalidateByPath(cacheKey string, cacheEntry cache.Entry,
 		return nil
 	}
 
+	match := func(resp *cache.Response) bool {
+		return bytes.Equal(resp.Path, path) && hasQuery(resp, e.Query)
+	}
+
+	if e.Soft {
+		if err := i.expireResponses(cacheKey, cacheEntry, match); err != nil {
+			return fmt.Errorf("Could not invalidate cache by path '%s': %v", e.Path, err)
+		}
+
+		return nil
+	}
+
+	if len(e.Query) > 0 {
+		if err := i.deleteResponses(cacheKey, cacheEntry, match); err != nil {
+			return fmt.Errorf("Could not invalidate cache by path '%s' and query '%v': %v", e.Path, e.Query, err)
+		}
+
+		return nil
+	}
+
 	if cacheEntry.Len() == 1 {
 		// Only delete the cache data for current key if remaining 1 response, to free memory
 		if err := i.deleteCacheKey(cacheKey); err != nil {
@@ -43,7 +127,7 @@ func (i *Invalidator) invalidateByPath(cacheKey string, cacheEntry cache.Entry,
 
 	cacheEntry.DelResponse(path)
 
-	if err := i.cache.Set(cacheKey, cacheEntry); err != nil {
+	if err := i.cache.SetStored(cacheKey, cacheEntry); err != nil {
 		return fmt.Errorf("Could not invalidate cache by path '%s': %v", e.Path, err)
 	}
 
@@ -51,6 +135,17 @@ func (i *Invalidator) invalidateByPath(cacheKey string, cacheEntry cache.Entry,
 }
 
 func (i *Invalidator) invalidateByHeader(cacheKey string, cacheEntry cache.Entry, e Entry) error {
+	if e.Soft {
+		err := i.expireResponses(cacheKey, cacheEntry, func(resp *cache.Response) bool {
+			return resp.HasHeader(gotils.S2B(e.Header.Key), gotils.S2B(e.Header.Value))
+		})
+		if err != nil {
+			return fmt.Errorf("Could not invalidate cache by header '%s = %s': %v", e.Header.Key, e.Header.Value, err)
+		}
+
+		return nil
+	}
+
 	responses := cacheEntry.GetAllResponses()
 
 	for _, resp := range responses {
@@ -70,7 +165,7 @@ func (i *Invalidator) invalidateByHeader(cacheKey string, cacheEntry cache.Entry
 		cacheEntry.DelResponse(resp.Path)
 	}
 
-	if err := i.cache.Set(cacheKey, cacheEntry); err != nil {
+	if err := i.cache.SetStored(cacheKey, cacheEntry); err != nil {
 		return fmt.Errorf("Could not invalidate cache by header '%s = %s': %v", e.Header.Key, e.Header.Value, err)
 	}
 
@@ -89,6 +184,26 @@ func (i *Invalidator) invalidateByPathHeader(cacheKey string, cacheEntry cache.E
 		return nil
 	}
 
+	match := func(resp *cache.Response) bool {
+		return bytes.Equal(resp.Path, path) && resp.HasHeader(gotils.S2B(e.Header.Key), gotils.S2B(e.Header.Value)) && hasQuery(resp, e.Query)
+	}
+
+	if e.Soft {
+		if err := i.expireResponses(cacheKey, cacheEntry, match); err != nil {
+			return fmt.Errorf("Could not invalidate cache by path '%s' and header '%s = %s': %v", e.Path, e.Header.Key, e.Header.Value, err)
+		}
+
+		return nil
+	}
+
+	if len(e.Query) > 0 {
+		if err := i.deleteResponses(cacheKey, cacheEntry, match); err != nil {
+			return fmt.Errorf("Could not invalidate cache by path '%s', header '%s = %s' and query '%v': %v", e.Path, e.Header.Key, e.Header.Value, e.Query, err)
+		}
+
+		return nil
+	}
+
 	if cacheEntry.Len() == 1 {
 		// Only delete the cache data for current key if remaining 1 response, to free memory
 		if err := i.deleteCacheKey(cacheKey); err != nil {
@@ -100,9 +215,41 @@ func (i *Invalidator) invalidateByPathHeader(cacheKey string, cacheEntry cache.E
 
 	cacheEntry.DelResponse(path)
 
-	if err := i.cache.Set(cacheKey, cacheEntry); err != nil {
+	if err := i.cache.SetStored(cacheKey, cacheEntry); err != nil {
 		return fmt.Errorf("Could not invalidate cache by path '%s' and header '%s = %s': %v", e.Path, e.Header.Key, e.Header.Value, err)
 	}
 
 	return nil
 }
+
+func (i *Invalidator) invalidateBySurrogateKey(cacheKey string, cacheEntry cache.Entry, e Entry) error {
+	if e.Soft {
+		err := i.expireResponses(cacheKey, cacheEntry, func(resp *cache.Response) bool {
+			return resp.HasTag(gotils.S2B(e.SurrogateKey))
+		})
+		if err != nil {
+			return fmt.Errorf("Could not invalidate cache by surrogate key '%s': %v", e.SurrogateKey, err)
+		}
+
+		return nil
+	}
+
+	if cacheEntry.DelTaggedResponses(gotils.S2B(e.SurrogateKey)) == 0 {
+		return nil
+	}
+
+	if cacheEntry.Len() == 0 {
+		// Delete the cache data for current key if not remaining responses, to free memory
+		if err := i.deleteCacheKey(cacheKey); err != nil {
+			return fmt.Errorf("Could not invalidate cache by surrogate key '%s': %v", e.SurrogateKey, err)
+		}
+
+		return nil
+	}
+
+	if err := i.cache.SetStored(cacheKey, cacheEntry); err != nil {
+		return fmt.Errorf("Could not invalidate cache by surrogate key '%s': %v", e.SurrogateKey, err)
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package invalidator
 
 import (
 	"testing"
+	"time"
 
 	"github.com/savsgio/kratgo/modules/cache"
 )
@@ -22,7 +23,7 @@ func TestInvalidator_invalidateByHost(t *testing.T) {
 
 	i.cache.Set(key, *entry)
 
-	i.invalidateByHost(key)
+	i.invalidateByHost(key, *entry, Entry{Host: key})
 
 	entry.Reset()
 
@@ -72,6 +73,60 @@ func TestInvalidator_invalidateByPath(t *testing.T) {
 	}
 }
 
+func TestInvalidator_invalidateByPath_Query(t *testing.T) {
+	i, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "www.kratgo.com"
+	path := []byte("/search")
+	foo := []byte("query:q=foo;")
+	bar := []byte("query:q=bar;")
+
+	cacheEntry := cache.AcquireEntry()
+	cacheEntry.SetResponse(cache.Response{Path: path, Variant: foo})
+	cacheEntry.SetResponse(cache.Response{Path: path, Variant: bar})
+
+	i.cache.Set(key, *cacheEntry)
+
+	e := Entry{Path: string(path), Query: map[string]string{"q": "foo"}}
+
+	if err := i.invalidateByPath(key, *cacheEntry, e); err != nil {
+		t.Fatal(err)
+	}
+
+	cacheEntry.Reset()
+
+	if err := i.cache.Get(key, cacheEntry); err != nil {
+		t.Fatal(err)
+	}
+
+	if cacheEntry.GetVariantResponse(path, foo) != nil {
+		t.Error("The cache has not been invalidate by path and query")
+	}
+
+	if cacheEntry.GetVariantResponse(path, bar) == nil {
+		t.Error("The cache has been invalidate other query of the path")
+	}
+
+	e.Query = map[string]string{"q": "bar"}
+
+	if err := i.invalidateByPath(key, *cacheEntry, e); err != nil {
+		t.Fatal(err)
+	}
+
+	cacheEntry.Reset()
+
+	if err := i.cache.Get(key, cacheEntry); err != nil {
+		t.Fatal(err)
+	}
+
+	if cacheEntry.Len() != 0 {
+		t.Errorf("The cache has '%d' responses after invalidate the last query, want '%d'", cacheEntry.Len(), 0)
+	}
+}
+
 func TestInvalidator_invalidateByHeader(t *testing.T) {
 	i, err := New(testConfig())
 	if err != nil {
@@ -158,3 +213,111 @@ func TestInvalidator_invalidateByPathHeader(t *testing.T) {
 		t.Error("The cache has not been invalidate by path and header")
 	}
 }
+
+func TestInvalidator_invalidateBySurrogateKey(t *testing.T) {
+	i, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := Entry{
+		SurrogateKey: "product-1",
+	}
+
+	key := "www.kratgo.com"
+
+	resp1 := cache.AcquireResponse()
+	resp1.Path = []byte("/fast")
+	resp1.AddTag([]byte("product-1"))
+
+	resp2 := cache.AcquireResponse()
+	resp2.Path = []byte("/faster")
+	resp2.AddTag([]byte("product-2"))
+
+	cacheEntry := cache.AcquireEntry()
+	cacheEntry.SetResponse(*resp1)
+	cacheEntry.SetResponse(*resp2)
+
+	i.cache.Set(key, *cacheEntry)
+
+	if err := i.invalidateBySurrogateKey(key, *cacheEntry, e); err != nil {
+		t.Fatal(err)
+	}
+
+	cacheEntry.Reset()
+
+	if err := i.cache.Get(key, cacheEntry); err != nil {
+		t.Fatal(err)
+	}
+
+	if cacheEntry.HasResponse(resp1.Path) {
+		t.Error("The cache has not been invalidate by surrogate key")
+	}
+
+	if !cacheEntry.HasResponse(resp2.Path) {
+		t.Error("The cache has been invalidate a response without the surrogate key")
+	}
+}
+
+func TestInvalidator_invalidateSoft(t *testing.T) {
+	i, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "www.kratgo.com"
+
+	tests := []struct {
+		name string
+		e    Entry
+	}{
+		{name: "host", e: Entry{Host: key, Soft: true}},
+		{name: "path", e: Entry{Path: "/fast", Soft: true}},
+		{name: "header", e: Entry{Header: EntryHeader{Key: "X-Data", Value: "1"}, Soft: true}},
+		{name: "path-header", e: Entry{Path: "/fast", Header: EntryHeader{Key: "X-Data", Value: "1"}, Soft: true}},
+		{name: "surrogate-key", e: Entry{SurrogateKey: "product-1", Soft: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp1 := cache.AcquireResponse()
+			resp1.Path = []byte("/fast")
+			resp1.SetHeader([]byte("X-Data"), []byte("1"))
+			resp1.AddTag([]byte("product-1"))
+
+			resp2 := cache.AcquireResponse()
+			resp2.Path = []byte("/faster")
+
+			cacheEntry := cache.AcquireEntry()
+			cacheEntry.SetResponse(*resp1)
+			cacheEntry.SetResponse(*resp2)
+
+			i.cache.Set(key, *cacheEntry)
+
+			if err := i.invalidate(i.invalidationType(tt.e), i.cache.StoredKey(key), *cacheEntry, tt.e); err != nil {
+				t.Fatal(err)
+			}
+
+			cacheEntry.Reset()
+
+			if err := i.cache.Get(key, cacheEntry); err != nil {
+				t.Fatal(err)
+			}
+
+			if cacheEntry.Len() != 2 {
+				t.Fatalf("The soft invalidation has been deleted responses, remaining '%d', want '%d'", cacheEntry.Len(), 2)
+			}
+
+			now := time.Now().Unix()
+
+			if !cacheEntry.GetResponse(resp1.Path).Expired(now) {
+				t.Error("The response has not been expired by the soft invalidation")
+			}
+
+			wantExpired := tt.name == "host"
+			if expired := cacheEntry.GetResponse(resp2.Path).Expired(now); expired != wantExpired {
+				t.Errorf("Response expired == '%v', want '%v'", expired, wantExpired)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/savsgio/kratgo/modules/cache"
 
 	logger "github.com/savsgio/go-logger/v2"
+	"github.com/savsgio/gotils"
 )
 
 // New ...
@@ -20,18 +21,34 @@ func New(cfg Config) (*Invalidator, error) {
 	i := &Invalidator{
 		fileConfig: cfg.FileConfig,
 		cache:      cfg.Cache,
+		refresher:  cfg.Refresher,
 		chEntries:  make(chan Entry),
+		done:       make(chan struct{}),
+		pending:    make(map[uint64]Entry),
 		log:        log,
 	}
 
+	i.retryBackoff = time.Duration(cfg.FileConfig.RetryBackoff) * time.Millisecond
+	if i.retryBackoff <= 0 {
+		i.retryBackoff = defaultRetryBackoff
+	}
+
+	if err := i.loadQueue(); err != nil {
+		return nil, err
+	}
+
 	return i, nil
 }
 
 func (i *Invalidator) invalidationType(e Entry) invType {
-	if e.Host == "" && e.Path == "" && e.Header.Key == "" {
+	if e.Host == "" && e.Path == "" && e.Header.Key == "" && e.SurrogateKey == "" {
 		return invTypeInvalid
 	}
 
+	if e.SurrogateKey != "" {
+		return invTypeSurrogateKey
+	}
+
 	if e.Path != "" {
 		if e.Header.Key != "" {
 			return invTypePathHeader
@@ -50,13 +67,15 @@ func (i *Invalidator) invalidationType(e Entry) invType {
 func (i *Invalidator) invalidate(invalidationType invType, key string, entry cache.Entry, e Entry) error {
 	switch invalidationType {
 	case invTypeHost:
-		return i.invalidateByHost(key)
+		return i.invalidateByHost(key, entry, e)
 	case invTypePath:
 		return i.invalidateByPath(key, entry, e)
 	case invTypeHeader:
 		return i.invalidateByHeader(key, entry, e)
 	case invTypePathHeader:
 		return i.invalidateByPathHeader(key, entry, e)
+	case invTypeSurrogateKey:
+		return i.invalidateBySurrogateKey(key, entry, e)
 	}
 
 	return nil
@@ -66,81 +85,260 @@ func (i *Invalidator) invalidateAll(invalidationType invType, e Entry) {
 	atomic.AddInt32(&i.activeWorkers, 1)
 	defer atomic.AddInt32(&i.activeWorkers, -1)
 
-	entry := cache.AcquireEntry()
-	iter := i.cache.Iterator()
-
-	for iter.SetNext() {
-		v, err := iter.Value()
-		if err != nil {
-			i.log.Errorf("Could not get value from iterator: %v", err)
-			continue
-		}
-
-		if err = cache.Unmarshal(entry, v.Value()); err != nil {
-			i.log.Errorf("Could not decode cache value: %v", err)
-			continue
-		}
+	var lastErr error
+	defer func() { i.finish(e, lastErr) }()
 
-		if err = i.invalidate(invalidationType, v.Key(), *entry, e); err != nil {
+	err := i.cache.ForEachStored(func(storedKey string, entry *cache.Entry) bool {
+		if err := i.invalidate(invalidationType, storedKey, *entry, e); err != nil {
 			i.log.Errorf("Could not invalidate '%v': %v", *entry, err)
+			lastErr = err
 		}
 
-		entry.Reset()
+		return true
+	})
+	if err != nil {
+		i.log.Errorf("Could not iterate the cache: %v", err)
+		lastErr = err
 	}
-
-	cache.ReleaseEntry(entry)
 }
 
 func (i *Invalidator) invalidateHost(invalidationType invType, e Entry) {
 	atomic.AddInt32(&i.activeWorkers, 1)
 	defer atomic.AddInt32(&i.activeWorkers, -1)
 
-	key := e.Host
+	var err error
+	defer func() { i.finish(e, err) }()
+
 	entry := cache.AcquireEntry()
 
-	err := i.cache.Get(key, entry)
+	err = i.cache.Peek(e.Host, entry)
 	if err != nil {
-		i.log.Errorf("Could not get responses from cache by key '%s': %v", key, err)
+		i.log.Errorf("Could not get responses from cache by key '%s': %v", e.Host, err)
 	} else if entry.Len() == 0 {
 		return
 	}
 
-	if err = i.invalidate(invalidationType, key, *entry, e); err != nil {
+	// The entry could be modified by the invalidation
+	var paths []string
+	if e.Refresh {
+		paths = responsePaths(*entry)
+	}
+
+	if err = i.invalidate(invalidationType, i.cache.StoredKey(e.Host), *entry, e); err != nil {
 		i.log.Error(err)
+	} else if e.Refresh {
+		i.refresh(e.Host, paths)
 	}
 
 	cache.ReleaseEntry(entry)
 }
 
+// responsePaths returns the distinct paths of the responses
+func responsePaths(entry cache.Entry) []string {
+	paths := make([]string, 0, entry.Len())
+	seen := make(map[string]bool, entry.Len())
+
+	for _, resp := range entry.GetAllResponses() {
+		path := string(resp.Path)
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
+
+// refresh fetches again the paths without responses in cache, after their invalidation.
+// The invalidation is done anyway, so the errors are only logged
+func (i *Invalidator) refresh(host string, paths []string) {
+	if i.refresher == nil {
+		i.log.Warningf("Could not refresh the responses of '%s': refresh not available", host)
+		return
+	}
+
+	entry := cache.AcquireEntry()
+	defer cache.ReleaseEntry(entry)
+
+	if err := i.cache.Peek(host, entry); err != nil {
+		i.log.Errorf("Could not get responses from cache by key '%s': %v", host, err)
+		return
+	}
+
+	for _, path := range paths {
+		if entry.HasResponse(gotils.S2B(path)) {
+			continue
+		}
+
+		if err := i.refresher.Refresh(host, path); err != nil {
+			i.log.Errorf("Could not refresh '%s%s': %v", host, path, err)
+		}
+	}
+}
+
+func (i *Invalidator) finish(e Entry, err error) {
+	if err != nil && i.retry(e, err) {
+		return
+	}
+
+	i.delPending(e)
+	i.processedEntry(err)
+	e.sendResult(err)
+}
+
+// retry enqueues again the failed entry after an exponential backoff,
+// and reports false if it has reached the max retries
+func (i *Invalidator) retry(e Entry, err error) bool {
+	if e.attempts >= i.fileConfig.MaxRetries {
+		if i.fileConfig.MaxRetries > 0 {
+			i.log.Errorf("Could not invalidate '%+v' after %d retries: %v", e, e.attempts, err)
+		}
+
+		return false
+	}
+
+	backoff := i.retryBackoff << uint(e.attempts)
+	if backoff <= 0 || backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+
+	e.attempts++
+	i.log.Warningf("Retrying invalidation '%+v' in %v (%d of %d): %v", e, backoff, e.attempts, i.fileConfig.MaxRetries, err)
+
+	// It's still pending with its attempts, so it's persisted if the invalidator is stopped meanwhile
+	i.setPending(e)
+
+	time.AfterFunc(backoff, func() {
+		select {
+		case i.chEntries <- e:
+		case <-i.done:
+		}
+	})
+
+	return true
+}
+
 func (i *Invalidator) waitAvailableWorkers() {
 	for atomic.LoadInt32(&i.activeWorkers) > i.fileConfig.MaxWorkers {
 		time.Sleep(100 * time.Millisecond)
 	}
 }
 
-// Add ..
-func (i *Invalidator) Add(e Entry) error {
+func (i *Invalidator) validate(e Entry) error {
 	if t := i.invalidationType(e); t == invTypeInvalid {
 		return ErrEmptyFields
 	}
 
-	i.chEntries <- e
+	if e.Refresh && e.Host == "" {
+		return ErrRefreshWithoutHost
+	}
+
+	if len(e.Query) > 0 && e.Path == "" {
+		return ErrQueryWithoutPath
+	}
 
 	return nil
 }
 
+// Add ..
+func (i *Invalidator) Add(e Entry) error {
+	if err := i.validate(e); err != nil {
+		return err
+	}
+
+	if !i.addPending(&e) {
+		return ErrStopped
+	}
+
+	// If the invalidator is stopped meanwhile, it remains pending to be persisted
+	select {
+	case i.chEntries <- e:
+	case <-i.done:
+	}
+
+	return nil
+}
+
+// AddAndWait adds the entry and waits until the invalidation is finished,
+// or returns ErrWaitTimeout when the timeout is reached
+func (i *Invalidator) AddAndWait(e Entry, timeout time.Duration) error {
+	if err := i.validate(e); err != nil {
+		return err
+	}
+
+	e.result = make(chan error, 1)
+	if !i.addPending(&e) {
+		return ErrStopped
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case i.chEntries <- e:
+	case <-timer.C:
+		i.delPending(e)
+		return ErrWaitTimeout
+	case <-i.done:
+		i.delPending(e)
+		return ErrStopped
+	}
+
+	select {
+	case err := <-e.result:
+		return err
+	case <-timer.C:
+		return ErrWaitTimeout
+	}
+}
+
 // Start ...
 func (i *Invalidator) Start() {
-	for e := range i.chEntries {
-		invalidationType := i.invalidationType(e)
+	i.setRunning(true)
+	defer i.stopped()
+
+	go i.replayQueue()
+
+	for {
+		select {
+		case e := <-i.chEntries:
+			i.waitAvailableWorkers()
 
-		i.waitAvailableWorkers()
+			// Stopped meanwhile, so the entry remains pending to be persisted
+			if !i.startWorker() {
+				return
+			}
 
-		if e.Host != "" {
-			go i.invalidateHost(invalidationType, e)
-		} else {
-			go i.invalidateAll(invalidationType, e)
+			go i.work(e)
+
+		case <-i.done:
+			return
 		}
+	}
+}
+
+// startWorker counts a new worker, so Stop waits for it, or reports false if it's stopped
+func (i *Invalidator) startWorker() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.closed {
+		return false
+	}
+
+	i.workers.Add(1)
+
+	return true
+}
+
+func (i *Invalidator) work(e Entry) {
+	defer i.workers.Done()
+
+	invalidationType := i.invalidationType(e)
 
+	if e.Host != "" {
+		i.invalidateHost(invalidationType, e)
+	} else {
+		i.invalidateAll(invalidationType, e)
 	}
 }
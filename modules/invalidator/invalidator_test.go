@@ -1,6 +1,7 @@
 package invalidator
 
 import (
+	"errors"
 	"os"
 	"reflect"
 	"testing"
@@ -196,6 +197,18 @@ func TestInvalidator_invalidationType(t *testing.T) {
 				t: invTypePathHeader,
 			},
 		},
+		{
+			name: "SurrogateKey",
+			args: args{
+				e: Entry{
+					Host:         "www.kratgo.com",
+					SurrogateKey: "product-1",
+				},
+			},
+			want: want{
+				t: invTypeSurrogateKey,
+			},
+		},
 		{
 			name: "Invalid",
 			args: args{
@@ -478,6 +491,267 @@ func TestInvalidator_invalidateHost(t *testing.T) {
 	}
 }
 
+type mockRefresher struct {
+	refreshed []string
+	err       error
+}
+
+func (mock *mockRefresher) Refresh(host, path string) error {
+	mock.refreshed = append(mock.refreshed, host+path)
+
+	return mock.err
+}
+
+func TestInvalidator_invalidateHost_Refresh(t *testing.T) {
+	host := "www.kratgo.com"
+	responses := []cache.Response{
+		{Path: []byte("/fast"), Headers: []cache.ResponseHeader{{Key: []byte("X-Data"), Value: []byte("1")}}},
+		{Path: []byte("/fast"), Variant: []byte("v2"), Headers: []cache.ResponseHeader{{Key: []byte("X-Data"), Value: []byte("1")}}},
+		{Path: []byte("/slow"), Headers: []cache.ResponseHeader{{Key: []byte("X-Data"), Value: []byte("2")}}},
+	}
+
+	tests := []struct {
+		name          string
+		entry         Entry
+		refresherErr  error
+		wantRefreshed []string
+	}{
+		{
+			name:          "Path",
+			entry:         Entry{Host: host, Path: "/fast", Refresh: true},
+			wantRefreshed: []string{host + "/fast"},
+		},
+		{
+			name:          "Header",
+			entry:         Entry{Host: host, Header: EntryHeader{Key: "X-Data", Value: "2"}, Refresh: true},
+			wantRefreshed: []string{host + "/slow"},
+		},
+		{
+			name:          "Host",
+			entry:         Entry{Host: host, Refresh: true},
+			wantRefreshed: []string{host + "/fast", host + "/slow"},
+		},
+		{
+			name:          "Soft",
+			entry:         Entry{Host: host, Soft: true, Refresh: true},
+			wantRefreshed: nil,
+		},
+		{
+			name:          "WithoutRefresh",
+			entry:         Entry{Host: host, Path: "/fast"},
+			wantRefreshed: nil,
+		},
+		{
+			name:          "RefresherError",
+			entry:         Entry{Host: host, Path: "/fast", Refresh: true},
+			refresherErr:  errors.New("Bad Gateway"),
+			wantRefreshed: []string{host + "/fast"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refresher := &mockRefresher{err: tt.refresherErr}
+
+			cfg := testConfig()
+			cfg.Refresher = refresher
+
+			i, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Copied, as the invalidations modify the responses
+			i.cache.Set(host, cache.Entry{Responses: append([]cache.Response{}, responses...)})
+
+			e := tt.entry
+			e.result = make(chan error, 1)
+
+			i.invalidateHost(i.invalidationType(e), e)
+
+			if err := <-e.result; err != nil {
+				t.Errorf("Invalidator.invalidateHost() unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(refresher.refreshed, tt.wantRefreshed) {
+				t.Errorf("Invalidator.invalidateHost() refreshed == '%v', want '%v'", refresher.refreshed, tt.wantRefreshed)
+			}
+		})
+	}
+}
+
+func TestInvalidator_HashKeys(t *testing.T) {
+	cacheCfg := fileConfigCache()
+	cacheCfg.HashKeys = true
+	cacheCfg.Namespace = "blue"
+
+	c, err := cache.New(cache.Config{
+		FileConfig: cacheCfg,
+		LogLevel:   logger.ERROR,
+		LogOutput:  os.Stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig()
+	cfg.Cache = c
+
+	i, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host1 := "www.kratgo.com"
+	host2 := "www.cache-fast.com"
+	responses := []cache.Response{
+		{Path: []byte("/fast"), Body: []byte("Kratgo is not slow")},
+		{Path: []byte("/kratgo"), Body: []byte("Kratgo is not slow")},
+	}
+
+	c.Set(host1, cache.Entry{Responses: responses})
+	c.Set(host2, cache.Entry{Responses: responses})
+
+	i.invalidateHost(invTypePath, Entry{Host: host1, Path: "/fast"})
+	i.invalidateAll(invTypePath, Entry{Path: "/kratgo"})
+
+	entry := cache.AcquireEntry()
+	defer cache.ReleaseEntry(entry)
+
+	wantPaths := map[string][]string{
+		host1: {},
+		host2: {"/fast"},
+	}
+
+	for host, paths := range wantPaths {
+		entry.Reset()
+		if err := c.Get(host, entry); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, r := range entry.GetAllResponses() {
+			got = append(got, string(r.Path))
+		}
+
+		if len(got) != len(paths) || (len(paths) > 0 && !reflect.DeepEqual(got, paths)) {
+			t.Errorf("Invalidator with hashed keys, host '%s' paths == '%v', want '%v'", host, got, paths)
+		}
+	}
+
+	if length := c.Len(); length != 1 {
+		t.Errorf("Invalidator with hashed keys, cache length == '%d', want '%d'", length, 1)
+	}
+}
+
+func TestInvalidator_Status(t *testing.T) {
+	i, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := i.Status(); s.Running {
+		t.Errorf("Invalidator.Status() running == '%v' before start, want '%v'", s.Running, false)
+	}
+
+	go i.Start()
+
+	if err := i.AddAndWait(Entry{Host: "www.kratgo.com"}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := i.Status(); !s.Running || s.Processed != 1 || s.Pending != 0 || s.LastError != "" {
+		t.Errorf("Invalidator.Status() == '%+v', want running with '%d' processed", s, 1)
+	}
+
+	// Like the loop of Start when it dies
+	func() {
+		defer i.stopped()
+		panic("error")
+	}()
+
+	if s := i.Status(); s.Running || s.LastError != "Invalidator has died: error" {
+		t.Errorf("Invalidator.Status() == '%+v', want not running with the error", s)
+	}
+}
+
+func TestInvalidator_retry(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.MaxRetries = 2
+	cfg.FileConfig.RetryBackoff = 1
+	cfg.LogLevel = logger.FATAL
+
+	i, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := Entry{Host: "www.kratgo.com", result: make(chan error, 1)}
+	i.addPending(&e)
+
+	errCache := errors.New("cache error")
+
+	for attempt := 1; attempt <= cfg.FileConfig.MaxRetries; attempt++ {
+		i.finish(e, errCache)
+
+		select {
+		case e = <-i.chEntries:
+		case <-time.After(time.Second):
+			t.Fatalf("Invalidator.finish() has not retried the entry")
+		}
+
+		if e.attempts != attempt {
+			t.Errorf("Invalidator.finish() retried attempts == '%d', want '%d'", e.attempts, attempt)
+		}
+
+		if s := i.Status(); s.Pending != 1 || s.Processed != 0 {
+			t.Errorf("Invalidator.Status() while retrying == '%+v', want pending and not processed", s)
+		}
+	}
+
+	i.finish(e, errCache)
+
+	if err := <-e.result; err != errCache {
+		t.Errorf("Invalidator.finish() result == '%v', want '%v'", err, errCache)
+	}
+
+	if s := i.Status(); s.Pending != 0 || s.Processed != 1 || s.Failed != 1 {
+		t.Errorf("Invalidator.Status() == '%+v', want '%d' processed and failed", s, 1)
+	}
+}
+
+func TestInvalidator_retry_Stop(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.MaxRetries = 2
+	cfg.FileConfig.RetryBackoff = 50
+	cfg.LogLevel = logger.FATAL
+
+	i, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := Entry{Host: "www.kratgo.com"}
+	i.addPending(&e)
+
+	i.finish(e, errors.New("cache error"))
+
+	if err := i.Stop(); err != nil {
+		t.Fatalf("Invalidator.Stop() unexpected error: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	entries := i.pendingEntries()
+	if len(entries) != 1 {
+		t.Fatalf("Invalidator.Stop() pending entries == '%d', want '%d'", len(entries), 1)
+	}
+
+	if entries[0].attempts != 1 {
+		t.Errorf("Invalidator.Stop() pending entry attempts == '%d', want '%d'", entries[0].attempts, 1)
+	}
+}
+
 // func TestInvalidator_waitAvailableWorkers(t *testing.T) {
 // }
 
@@ -515,6 +789,30 @@ func TestInvalidator_Add(t *testing.T) {
 				err: ErrEmptyFields,
 			},
 		},
+		{
+			name: "RefreshWithoutHost",
+			args: args{
+				entry: Entry{
+					Path:    "/fast",
+					Refresh: true,
+				},
+			},
+			want: want{
+				err: ErrRefreshWithoutHost,
+			},
+		},
+		{
+			name: "QueryWithoutPath",
+			args: args{
+				entry: Entry{
+					Host:  "www.kratgo.com",
+					Query: map[string]string{"q": "foo"},
+				},
+			},
+			want: want{
+				err: ErrQueryWithoutPath,
+			},
+		},
 	}
 
 	i, err := New(testConfig())
@@ -535,6 +833,48 @@ func TestInvalidator_Add(t *testing.T) {
 	}
 }
 
+func TestInvalidator_AddAndWait(t *testing.T) {
+	key := "www.kratgo.com"
+	path := "/fast"
+
+	i, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.AddAndWait(Entry{}, time.Second); err != ErrEmptyFields {
+		t.Errorf("Invalidator.AddAndWait() error == '%v', want '%v'", err, ErrEmptyFields)
+	}
+
+	// Not started, so nobody receives the entry
+	if err := i.AddAndWait(Entry{Host: key}, 10*time.Millisecond); err != ErrWaitTimeout {
+		t.Errorf("Invalidator.AddAndWait() error == '%v', want '%v'", err, ErrWaitTimeout)
+	}
+
+	cacheEntry := cache.AcquireEntry()
+	cacheEntry.SetResponse(cache.Response{Path: []byte(path)})
+
+	if err := i.cache.Set(key, *cacheEntry); err != nil {
+		t.Fatal(err)
+	}
+
+	go i.Start()
+
+	if err := i.AddAndWait(Entry{Host: key, Path: path}, time.Second); err != nil {
+		t.Fatalf("Invalidator.AddAndWait() unexpected error: %v", err)
+	}
+
+	cacheEntry.Reset()
+
+	if err := i.cache.Get(key, cacheEntry); err != nil {
+		t.Fatal(err)
+	}
+
+	if cacheEntry.HasResponse([]byte(path)) {
+		t.Error("Invalidator.AddAndWait() returns before the invalidation is finished")
+	}
+}
+
 func TestInvalidator_Start(t *testing.T) {
 	key := "www.kratgo.com"
 	path := "/fast"
@@ -0,0 +1,219 @@
+package invalidator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/cache"
+)
+
+// addPending adds the entry to the pending ones, or reports false if the invalidator is stopped
+func (i *Invalidator) addPending(e *Entry) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.closed {
+		return false
+	}
+
+	e.id = atomic.AddUint64(&i.lastID, 1)
+	i.pending[e.id] = *e
+
+	return true
+}
+
+// setPending updates the pending entry, ex: with the attempts of its retries
+func (i *Invalidator) setPending(e Entry) {
+	i.mu.Lock()
+	i.pending[e.id] = e
+	i.mu.Unlock()
+}
+
+func (i *Invalidator) delPending(e Entry) {
+	i.mu.Lock()
+	delete(i.pending, e.id)
+	i.mu.Unlock()
+}
+
+func (i *Invalidator) pendingEntries() []Entry {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	entries := make([]Entry, 0, len(i.pending)+len(i.replayEntries))
+	entries = append(entries, i.replayEntries...)
+
+	for _, e := range i.pending {
+		entries = append(entries, e)
+	}
+
+	return entries
+}
+
+// dedupEntries removes the repeated entries, compared by their encoding as they're persisted,
+// as the entries with query are not comparable
+func dedupEntries(entries []Entry) []Entry {
+	seen := make(map[string]struct{}, len(entries))
+	result := entries[:0]
+
+	for _, e := range entries {
+		e.id = 0
+		e.result = nil
+
+		key, _ := json.Marshal(e)
+		if _, ok := seen[string(key)]; ok {
+			continue
+		}
+
+		seen[string(key)] = struct{}{}
+		result = append(result, e)
+	}
+
+	return result
+}
+
+// isCached reports if there is something in cache to invalidate by the entry
+func (i *Invalidator) isCached(e Entry) bool {
+	if e.Host == "" {
+		return i.cache.Len() > 0
+	}
+
+	entry := cache.AcquireEntry()
+	defer cache.ReleaseEntry(entry)
+
+	if err := i.cache.Peek(e.Host, entry); err != nil {
+		// Could not be checked, so better to replay it
+		return true
+	}
+
+	return entry.Len() > 0
+}
+
+func (i *Invalidator) loadQueue() error {
+	path := i.fileConfig.PersistQueuePath
+	if path == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Could not read the invalidation queue from '%s': %v", path, err)
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("Could not decode the invalidation queue from '%s': %v", path, err)
+	}
+
+	i.replayEntries = dedupEntries(entries)
+
+	return nil
+}
+
+func (i *Invalidator) replayQueue() {
+	i.mu.Lock()
+	entries := i.replayEntries
+	i.mu.Unlock()
+
+	if len(entries) == 0 {
+		return
+	}
+
+	i.log.Infof("Replaying %d pending invalidations", len(entries))
+
+	for len(entries) > 0 {
+		e := entries[0]
+
+		if i.isCached(e) {
+			if err := i.Add(e); err == ErrStopped {
+				// The rest are persisted again by Stop
+				return
+			} else if err != nil {
+				i.log.Errorf("Could not replay the invalidation '%v': %v", e, err)
+			}
+		}
+
+		i.mu.Lock()
+		entries = entries[1:]
+		i.replayEntries = entries
+		i.mu.Unlock()
+	}
+
+	// Locked, so it's not removed after Stop has persisted the pending ones
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.closed {
+		return
+	}
+
+	if err := os.Remove(i.fileConfig.PersistQueuePath); err != nil && !os.IsNotExist(err) {
+		i.log.Errorf("Could not remove the invalidation queue '%s': %v", i.fileConfig.PersistQueuePath, err)
+	}
+}
+
+// waitWorkers waits for the running invalidations until the timeout, and reports false if it's reached
+func (i *Invalidator) waitWorkers(timeout time.Duration) bool {
+	finished := make(chan struct{})
+
+	go func() {
+		i.workers.Wait()
+		close(finished)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-finished:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Stop stops taking new invalidations, waits for the running ones until stopTimeout,
+// and persists the pending invalidations, to replay them on the next start
+func (i *Invalidator) Stop() error {
+	i.mu.Lock()
+	if i.closed {
+		i.mu.Unlock()
+		return nil
+	}
+	i.closed = true
+	i.mu.Unlock()
+
+	close(i.done)
+
+	if !i.waitWorkers(stopTimeout) {
+		i.log.Warningf("Stopped with running invalidations after %v, they remain pending", stopTimeout)
+	}
+
+	path := i.fileConfig.PersistQueuePath
+	if path == "" {
+		return nil
+	}
+
+	entries := dedupEntries(i.pendingEntries())
+	if len(entries) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("Could not encode the invalidation queue: %v", err)
+	}
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("Could not write the invalidation queue to '%s': %v", path, err)
+	}
+
+	i.log.Infof("Persisted %d pending invalidations in '%s'", len(entries), path)
+
+	return nil
+}
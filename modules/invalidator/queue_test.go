@@ -0,0 +1,243 @@
+package invalidator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/cache"
+)
+
+func Test_dedupEntries(t *testing.T) {
+	entries := []Entry{
+		{Host: "www.kratgo.com", id: 1},
+		{Host: "www.kratgo.com", id: 2},
+		{Path: "/fast", id: 3},
+		{Path: "/search", Query: map[string]string{"q": "foo"}, id: 4},
+		{Path: "/search", Query: map[string]string{"q": "foo"}, id: 5},
+		{Path: "/search", Query: map[string]string{"q": "bar"}, id: 6},
+	}
+
+	want := []Entry{
+		{Host: "www.kratgo.com"},
+		{Path: "/fast"},
+		{Path: "/search", Query: map[string]string{"q": "foo"}},
+		{Path: "/search", Query: map[string]string{"q": "bar"}},
+	}
+
+	if got := dedupEntries(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("dedupEntries() = '%v', want '%v'", got, want)
+	}
+}
+
+func TestInvalidator_isCached(t *testing.T) {
+	i, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i.isCached(Entry{Path: "/fast"}) {
+		t.Errorf("Invalidator.isCached() with empty cache == '%v', want '%v'", true, false)
+	}
+
+	cacheEntry := cache.AcquireEntry()
+	cacheEntry.SetResponse(cache.Response{Path: []byte("/fast")})
+
+	if err := i.cache.Set("www.kratgo.com", *cacheEntry); err != nil {
+		t.Fatal(err)
+	}
+
+	if !i.isCached(Entry{Host: "www.kratgo.com"}) {
+		t.Errorf("Invalidator.isCached() == '%v', want '%v'", false, true)
+	}
+
+	if i.isCached(Entry{Host: "www.kratgo.es"}) {
+		t.Errorf("Invalidator.isCached() not cached host == '%v', want '%v'", true, false)
+	}
+
+	if !i.isCached(Entry{Path: "/fast"}) {
+		t.Errorf("Invalidator.isCached() without host == '%v', want '%v'", false, true)
+	}
+}
+
+func TestInvalidator_StopAndReplay(t *testing.T) {
+	key := "www.kratgo.com"
+	path := "/fast"
+
+	dir, err := ioutil.TempDir("", "kratgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := testConfig()
+	cfg.FileConfig.PersistQueuePath = filepath.Join(dir, "queue.json")
+
+	i, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Not started, so the entries remain pending
+	go i.Add(Entry{Host: key, Path: path})
+	go i.Add(Entry{Host: "www.kratgo.es"})
+
+	time.Sleep(50 * time.Millisecond)
+
+	if err := i.Stop(); err != nil {
+		t.Fatalf("Invalidator.Stop() unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(cfg.FileConfig.PersistQueuePath); err != nil {
+		t.Fatalf("Invalidator.Stop() the queue has not been persisted: %v", err)
+	}
+
+	cacheEntry := cache.AcquireEntry()
+	cacheEntry.SetResponse(cache.Response{Path: []byte(path)})
+
+	if err := cfg.Cache.Set(key, *cacheEntry); err != nil {
+		t.Fatal(err)
+	}
+
+	i2, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(i2.replayEntries) != 2 {
+		t.Fatalf("New() replay entries == '%d', want '%d'", len(i2.replayEntries), 2)
+	}
+
+	go i2.Start()
+
+	time.Sleep(200 * time.Millisecond)
+
+	cacheEntry.Reset()
+	if err := i2.cache.Get(key, cacheEntry); err != nil {
+		t.Fatal(err)
+	}
+
+	if cacheEntry.HasResponse([]byte(path)) {
+		t.Error("Invalidator.Start() the persisted invalidation has not been replayed")
+	}
+
+	if _, err := os.Stat(cfg.FileConfig.PersistQueuePath); !os.IsNotExist(err) {
+		t.Errorf("Invalidator.Start() the persisted queue has not been removed after replay")
+	}
+}
+
+// blockingRefresher blocks the refreshes until release is closed
+type blockingRefresher struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingRefresher) Refresh(host, path string) error {
+	r.started <- struct{}{}
+	<-r.release
+
+	return nil
+}
+
+func TestInvalidator_Stop_Drain(t *testing.T) {
+	key := "www.kratgo.com"
+
+	dir, err := ioutil.TempDir("", "kratgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	refresher := &blockingRefresher{started: make(chan struct{}, 1), release: make(chan struct{})}
+
+	cfg := testConfig()
+	cfg.Refresher = refresher
+	cfg.FileConfig.PersistQueuePath = filepath.Join(dir, "queue.json")
+
+	i, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cacheEntry := cache.AcquireEntry()
+	cacheEntry.SetResponse(cache.Response{Path: []byte("/fast")})
+
+	if err := i.cache.Set(key, *cacheEntry); err != nil {
+		t.Fatal(err)
+	}
+
+	go i.Start()
+
+	if err := i.Add(Entry{Host: key, Refresh: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-refresher.started:
+	case <-time.After(time.Second):
+		t.Fatal("Invalidator.Start() has not processed the entry")
+	}
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- i.Stop()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	select {
+	case <-stopped:
+		t.Fatal("Invalidator.Stop() has not waited for the running invalidation")
+	default:
+	}
+
+	if err := i.Add(Entry{Host: key}); err != ErrStopped {
+		t.Errorf("Invalidator.Add() after Stop() error == '%v', want '%v'", err, ErrStopped)
+	}
+
+	close(refresher.release)
+
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("Invalidator.Stop() unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Invalidator.Stop() has not returned after the running invalidation")
+	}
+
+	if s := i.Status(); s.Pending != 0 || s.Processed != 1 {
+		t.Errorf("Invalidator.Status() == '%+v', want '%d' processed and none pending", s, 1)
+	}
+
+	// Nothing pending, so nothing is persisted
+	if _, err := os.Stat(cfg.FileConfig.PersistQueuePath); !os.IsNotExist(err) {
+		t.Errorf("Invalidator.Stop() has persisted the finished invalidation")
+	}
+
+	if err := i.Stop(); err != nil {
+		t.Errorf("Invalidator.Stop() again unexpected error: %v", err)
+	}
+}
+
+func TestInvalidator_loadQueue_Invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kratgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := testConfig()
+	cfg.FileConfig.PersistQueuePath = filepath.Join(dir, "queue.json")
+
+	if err := ioutil.WriteFile(cfg.FileConfig.PersistQueuePath, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(cfg); err == nil {
+		t.Errorf("New() with invalid persisted queue, want error")
+	}
+}
@@ -0,0 +1,61 @@
+package invalidator
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Status returns the state of the invalidator, the workers and the processed invalidations
+func (i *Invalidator) Status() Status {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	s := Status{
+		Running:       atomic.LoadInt32(&i.running) == 1,
+		ActiveWorkers: atomic.LoadInt32(&i.activeWorkers),
+		Pending:       len(i.pending) + len(i.replayEntries),
+		Processed:     i.processed,
+		Failed:        i.failed,
+	}
+
+	if i.lastErr != nil {
+		s.LastError = i.lastErr.Error()
+	}
+
+	return s
+}
+
+// setRunning marks if the loop of Start is running
+func (i *Invalidator) setRunning(running bool) {
+	var v int32
+	if running {
+		v = 1
+	}
+
+	atomic.StoreInt32(&i.running, v)
+}
+
+// stopped marks the loop of Start as not running, recording the panic if it has died
+func (i *Invalidator) stopped() {
+	i.setRunning(false)
+
+	if r := recover(); r != nil {
+		err := fmt.Errorf("Invalidator has died: %v", r)
+		i.log.Error(err)
+
+		i.mu.Lock()
+		i.lastErr = err
+		i.mu.Unlock()
+	}
+}
+
+// processedEntry counts the finished invalidation, and its error if any
+func (i *Invalidator) processedEntry(err error) {
+	i.mu.Lock()
+	i.processed++
+	if err != nil {
+		i.failed++
+		i.lastErr = err
+	}
+	i.mu.Unlock()
+}
@@ -2,6 +2,8 @@ package invalidator
 
 import (
 	"io"
+	"sync"
+	"time"
 
 	"github.com/savsgio/kratgo/modules/cache"
 	"github.com/savsgio/kratgo/modules/config"
@@ -14,6 +16,9 @@ type Config struct {
 	FileConfig config.Invalidator
 	Cache      *cache.Cache
 
+	// Refresher fetches again the invalidated responses with "refresh" (Optional)
+	Refresher Refresher
+
 	LogLevel  string
 	LogOutput io.Writer
 }
@@ -22,12 +27,44 @@ type Config struct {
 type Invalidator struct {
 	fileConfig config.Invalidator
 
-	cache *cache.Cache
+	cache     *cache.Cache
+	refresher Refresher
 
 	activeWorkers int32
+	running       int32
 
 	chEntries chan Entry
-	log       *logger.Logger
+
+	// done is closed by Stop, and closed is set before it, so no more entries nor workers are started
+	done    chan struct{}
+	closed  bool
+	workers sync.WaitGroup
+
+	// pending are the entries added and not finished yet, to persist them on stop
+	pending       map[uint64]Entry
+	lastID        uint64
+	replayEntries []Entry
+
+	// processed and lastErr are the finished invalidations, and the last error of them
+	processed uint64
+	failed    uint64
+	lastErr   error
+
+	retryBackoff time.Duration
+
+	mu sync.Mutex
+
+	log *logger.Logger
+}
+
+// Status ...
+type Status struct {
+	Running       bool   `json:"running"`
+	ActiveWorkers int32  `json:"activeWorkers"`
+	Pending       int    `json:"pending"`
+	Processed     uint64 `json:"processed"`
+	Failed        uint64 `json:"failed"`
+	LastError     string `json:"lastError,omitempty"`
 }
 
 // EntryHeader ...
@@ -38,9 +75,32 @@ type EntryHeader struct {
 
 // Entry ...
 type Entry struct {
-	Host   string      `json:"host"`
-	Path   string      `json:"path"`
-	Header EntryHeader `json:"header"`
+	Host         string      `json:"host"`
+	Path         string      `json:"path"`
+	Header       EntryHeader `json:"header"`
+	SurrogateKey string      `json:"surrogateKey"`
+
+	// Query invalidates only the responses of the path with these query params,
+	// if they are part of the cache key. Without it, all the responses of the path are invalidated
+	Query map[string]string `json:"query"`
+
+	// Soft marks the responses as expired instead of deleting them,
+	// so they could be revalidated with the backend
+	Soft bool `json:"soft"`
+
+	// Refresh fetches again the deleted responses of the host, to keep them in cache
+	Refresh bool `json:"refresh"`
+
+	id       uint64
+	attempts int
+	result   chan error
 }
 
 type invType int
+
+// ###### INTERFACES ######
+
+// Refresher ...
+type Refresher interface {
+	Refresh(host, path string) error
+}
@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var errNoBackends = errors.New("No backends to serve the request")
+
+// newBackend returns the client of the backend address, which could be "host:port",
+// or an URL with its own scheme and path prefix, like "https://10.0.0.5:8443/internal".
+// The options set to 0 are the fasthttp defaults
+func newBackend(addr string, opts backendOptions) (fetcher, error) {
+	if !strings.Contains(addr, "://") {
+		return opts.hostClient(addr, false), nil
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid backend address '%s': %v", addr, err)
+	}
+
+	if u.Scheme != schemeHTTP && u.Scheme != schemeHTTPS {
+		return nil, fmt.Errorf("Invalid backend address '%s': unsupported scheme '%s'", addr, u.Scheme)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("Invalid backend address '%s': missing host", addr)
+	}
+
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("Invalid backend address '%s': query and fragment are not allowed", addr)
+	}
+
+	isTLS := u.Scheme == schemeHTTPS
+
+	host := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if isTLS {
+			port = "443"
+		}
+		host += ":" + port
+	}
+
+	client := opts.hostClient(host, isTLS)
+	if serverName := opts.tlsServerName(addr); isTLS && serverName != "" {
+		client.TLSConfig = &tls.Config{ServerName: serverName}
+	}
+
+	return &urlBackend{
+		client:     client,
+		scheme:     []byte(u.Scheme),
+		pathPrefix: []byte(strings.TrimRight(u.EscapedPath(), "/")),
+	}, nil
+}
+
+// newBackendHeaders returns the headers injected in the requests of each backend address
+func newBackendHeaders(cfg map[string]map[string]string) map[string][][2]string {
+	if len(cfg) == 0 {
+		return nil
+	}
+
+	backendHeaders := make(map[string][][2]string, len(cfg))
+	for addr, headers := range cfg {
+		backendHeaders[addr] = sortedHeaders(headers)
+	}
+
+	return backendHeaders
+}
+
+// setBackendHeaders sets the injected headers of the backend in the request
+func setBackendHeaders(req *fasthttp.Request, headers [][2]string) {
+	for _, h := range headers {
+		req.Header.Set(h[0], h[1])
+	}
+}
+
+// delBackendHeaders deletes the injected headers of the backend after its request, so they are never sent
+// to other backends in the retries, and from the response, so they are never returned to the clients
+func delBackendHeaders(req *fasthttp.Request, resp *fasthttp.Response, headers [][2]string) {
+	for _, h := range headers {
+		req.Header.Del(h[0])
+		resp.Header.Del(h[0])
+	}
+}
+
+// backendErrorStatusCode classifies the error of a backend request:
+// 504 for the dial and request timeouts, 503 when there are no free connections,
+// and 502 for the rest (ex: connection refused or closed by the backend, or a too large body)
+func backendErrorStatusCode(err error) int {
+	switch err {
+	case fasthttp.ErrDialTimeout, fasthttp.ErrTimeout:
+		return fasthttp.StatusGatewayTimeout
+	case fasthttp.ErrNoFreeConns:
+		return fasthttp.StatusServiceUnavailable
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return fasthttp.StatusGatewayTimeout
+	}
+
+	return fasthttp.StatusBadGateway
+}
+
+func (e *backendError) Error() string {
+	return e.err.Error()
+}
+
+// hostClient returns the client of the "host:port" address with the options
+func (o backendOptions) hostClient(addr string, isTLS bool) *fasthttp.HostClient {
+	return &fasthttp.HostClient{
+		Addr:                addr,
+		IsTLS:               isTLS,
+		Dial:                dialFunc(o.dialTimeout),
+		MaxIdleConnDuration: o.maxIdleConnDuration,
+		MaxConnDuration:     o.maxConnDuration,
+		MaxResponseBodySize: o.maxResponseBodySize,
+	}
+}
+
+// tlsServerName returns the server name (SNI) to validate the certificate of the backend address,
+// its own one or the global one
+func (o backendOptions) tlsServerName(addr string) string {
+	if serverName, ok := o.tls.ServerNames[addr]; ok {
+		return serverName
+	}
+
+	return o.tls.ServerName
+}
+
+func dialFunc(timeout time.Duration) fasthttp.DialFunc {
+	if timeout <= 0 {
+		return nil
+	}
+
+	return func(addr string) (net.Conn, error) {
+		return fasthttp.DialTimeout(addr, timeout)
+	}
+}
+
+// doDeadline sends the request to the backend with the deadline,
+// if it's not zero and the backend supports it
+func doDeadline(f fetcher, req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
+	if !deadline.IsZero() {
+		if df, ok := f.(deadlineFetcher); ok {
+			return df.DoDeadline(req, resp, deadline)
+		}
+	}
+
+	return f.Do(req, resp)
+}
+
+// Do sends the request with the scheme and the path prefix of the backend,
+// restoring the original ones after that, since the request could be retried to other backend
+func (b *urlBackend) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	return b.DoDeadline(req, resp, time.Time{})
+}
+
+// DoDeadline is like Do, but bounding the request with the deadline if it's not zero
+func (b *urlBackend) DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
+	uri := req.URI()
+
+	scheme := append([]byte(nil), uri.Scheme()...)
+	path := append([]byte(nil), uri.PathOriginal()...)
+
+	uri.SetSchemeBytes(b.scheme)
+
+	if len(b.pathPrefix) > 0 {
+		prefixed := make([]byte, 0, len(b.pathPrefix)+len(path))
+		prefixed = append(prefixed, b.pathPrefix...)
+		if !bytes.HasPrefix(path, []byte("/")) {
+			prefixed = append(prefixed, '/')
+		}
+		prefixed = append(prefixed, path...)
+
+		uri.SetPathBytes(prefixed)
+	}
+
+	err := doDeadline(b.client, req, resp, deadline)
+
+	uri.SetSchemeBytes(scheme)
+	uri.SetPathBytes(path)
+
+	return err
+}
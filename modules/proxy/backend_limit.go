@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var errBackendLimit = errors.New("Too many concurrent backend requests")
+
+// newBackendLimiter returns the limiter of the in-flight backend requests (bulkhead), or nil if it's disabled.
+// The requests over the limit wait up to the queue timeout in milliseconds for a slot, or they are rejected at once
+func newBackendLimiter(maxRequests, queueTimeout int) (*backendLimiter, error) {
+	if maxRequests < 0 {
+		return nil, fmt.Errorf("Proxy.MaxConcurrentBackendRequests must be greater than or equal to 0")
+	}
+
+	if queueTimeout < 0 {
+		return nil, fmt.Errorf("Proxy.BackendQueueTimeout must be greater than or equal to 0")
+	}
+
+	if maxRequests == 0 {
+		return nil, nil
+	}
+
+	return &backendLimiter{
+		slots:   make(chan struct{}, maxRequests),
+		timeout: time.Duration(queueTimeout) * time.Millisecond,
+	}, nil
+}
+
+// acquire takes a slot for a backend request, it's false if there is no free slot within the timeout
+func (l *backendLimiter) acquire() bool {
+	if l == nil {
+		return true
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if l.timeout > 0 {
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+
+		select {
+		case l.slots <- struct{}{}:
+			return true
+		case <-timer.C:
+		}
+	}
+
+	atomic.AddUint64(&l.rejected, 1)
+
+	return false
+}
+
+func (l *backendLimiter) release() {
+	if l == nil {
+		return
+	}
+
+	<-l.slots
+}
+
+func (l *backendLimiter) rejectedRequests() uint64 {
+	if l == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&l.rejected)
+}
@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func Test_newBackendLimiter(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxRequests  int
+		queueTimeout int
+		wantNil      bool
+		err          bool
+	}{
+		{name: "Disabled", wantNil: true},
+		{name: "Enabled", maxRequests: 10, queueTimeout: 100},
+		{name: "InvalidMaxRequests", maxRequests: -1, err: true},
+		{name: "InvalidQueueTimeout", maxRequests: 10, queueTimeout: -1, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := newBackendLimiter(tt.maxRequests, tt.queueTimeout)
+			if (err != nil) != tt.err {
+				t.Fatalf("newBackendLimiter() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if !tt.err && (l == nil) != tt.wantNil {
+				t.Errorf("newBackendLimiter() is nil == '%v', want '%v'", l == nil, tt.wantNil)
+			}
+		})
+	}
+}
+
+func Test_backendLimiter_acquire(t *testing.T) {
+	l, err := newBackendLimiter(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !l.acquire() {
+		t.Fatal("backendLimiter.acquire() == 'false', want 'true'")
+	}
+
+	if l.acquire() {
+		t.Error("backendLimiter.acquire() over the limit == 'true', want 'false'")
+	}
+
+	l.release()
+
+	if !l.acquire() {
+		t.Error("backendLimiter.acquire() after release == 'false', want 'true'")
+	}
+
+	// Waits for the slot within the timeout
+	l.timeout = time.Second
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		l.release()
+	}()
+
+	if !l.acquire() {
+		t.Error("backendLimiter.acquire() with timeout == 'false', want 'true'")
+	}
+
+	l.timeout = 10 * time.Millisecond
+	if l.acquire() {
+		t.Error("backendLimiter.acquire() after timeout == 'true', want 'false'")
+	}
+
+	if rejected := l.rejectedRequests(); rejected != 2 {
+		t.Errorf("backendLimiter.rejectedRequests() == '%d', want '%d'", rejected, 2)
+	}
+
+	var disabled *backendLimiter
+	if !disabled.acquire() {
+		t.Error("backendLimiter.acquire() disabled == 'false', want 'true'")
+	}
+	disabled.release()
+}
+
+func TestProxy_handler_BackendLimit(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.MaxConcurrentBackendRequests = 1
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{body: []byte("Body"), statusCode: fasthttp.StatusOK}
+	p.backends = []fetcher{backend}
+	p.totalBackends = 1
+
+	do := func(path string) int {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(path)
+		ctx.Request.Header.SetHost("www.kratgo.com")
+
+		p.handler(ctx)
+
+		return ctx.Response.StatusCode()
+	}
+
+	if statusCode := do("/cached/"); statusCode != fasthttp.StatusOK {
+		t.Fatalf("Proxy.handler() status code == '%d', want '%d'", statusCode, fasthttp.StatusOK)
+	}
+
+	// The only slot is taken by another request
+	p.backendLimiter.acquire()
+
+	if statusCode := do("/other/"); statusCode != fasthttp.StatusServiceUnavailable {
+		t.Errorf("Proxy.handler() over the limit status code == '%d', want '%d'",
+			statusCode, fasthttp.StatusServiceUnavailable)
+	}
+
+	if statusCode := do("/cached/"); statusCode != fasthttp.StatusOK || backend.calls != 1 {
+		t.Errorf("Proxy.handler() cache hit status code == '%d' with '%d' backend calls, want '%d' with '%d'",
+			statusCode, backend.calls, fasthttp.StatusOK, 1)
+	}
+
+	p.backendLimiter.release()
+
+	if statusCode := do("/other/"); statusCode != fasthttp.StatusOK {
+		t.Errorf("Proxy.handler() after release status code == '%d', want '%d'", statusCode, fasthttp.StatusOK)
+	}
+
+	if rejected := p.Stats().BackendRequestsRejected; rejected != 1 {
+		t.Errorf("Proxy.Stats() BackendRequestsRejected == '%d', want '%d'", rejected, 1)
+	}
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/valyala/fasthttp"
+)
+
+// newBackendPools returns the named backend pools, in the order of the configuration
+func (p *Proxy) newBackendPools() ([]*backendPool, error) {
+	pools := make([]*backendPool, 0, len(p.fileConfig.BackendPools))
+	names := make(map[string]bool, len(p.fileConfig.BackendPools))
+
+	for i, cfg := range p.fileConfig.BackendPools {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("Proxy.BackendPools[%d].Name is empty", i)
+		}
+
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("Duplicated backend pool '%s'", cfg.Name)
+		}
+		names[cfg.Name] = true
+
+		if len(cfg.BackendAddrs) == 0 {
+			return nil, fmt.Errorf("Backend pool '%s' has not backend addresses", cfg.Name)
+		}
+
+		if cfg.When == "" {
+			return nil, fmt.Errorf("Backend pool '%s' has not condition", cfg.Name)
+		}
+
+		pool := &backendPool{name: cfg.Name, addrs: cfg.BackendAddrs}
+
+		expr, params, err := p.newEvaluableExpression(cfg.When)
+		if err != nil {
+			return nil, fmt.Errorf("Could not get the evaluable expression for backend pool '%s': %v", cfg.Name, err)
+		}
+		pool.expr = expr
+		pool.params = params
+
+		for _, addr := range cfg.BackendAddrs {
+			backend, err := newBackend(addr, p.backendOptions)
+			if err != nil {
+				return nil, err
+			}
+
+			pool.backends = append(pool.backends, backend)
+			pool.latencies = append(pool.latencies, newLatencyHistogram(addr))
+		}
+
+		pools = append(pools, pool)
+	}
+
+	return pools, nil
+}
+
+// setNoMatchBehavior sets how the requests without matching backend pool are served:
+// by the configured pool, with the configured status code, or by the default backends.
+// Without default backends, they are responded with a 502
+func (p *Proxy) setNoMatchBehavior() error {
+	cfg := p.fileConfig.NoMatchBehavior
+
+	if cfg.Pool != "" && cfg.StatusCode != 0 {
+		return fmt.Errorf("Proxy.NoMatchBehavior could not have a pool and a status code at the same time")
+	}
+
+	if cfg.Pool != "" {
+		for _, pool := range p.backendPools {
+			if pool.name == cfg.Pool {
+				p.noMatchPool = pool
+				return nil
+			}
+		}
+
+		return fmt.Errorf("Unknown backend pool '%s' in Proxy.NoMatchBehavior", cfg.Pool)
+	}
+
+	switch {
+	case cfg.StatusCode != 0:
+		if cfg.StatusCode < fasthttp.StatusContinue || cfg.StatusCode > 599 {
+			return fmt.Errorf("Invalid status code '%d' in Proxy.NoMatchBehavior", cfg.StatusCode)
+		}
+		p.noMatchStatus = cfg.StatusCode
+	case p.totalBackends == 0:
+		p.noMatchStatus = fasthttp.StatusBadGateway
+	}
+
+	return nil
+}
+
+// backendPool returns the first backend pool whose condition matches the request,
+// or the pool of the requests without match (nil for the default backends)
+func (p *Proxy) backendPool(ctx *fasthttp.RequestCtx, params *evalParams) (*backendPool, error) {
+	for _, pool := range p.backendPools {
+		ok, err := evalRule(ctx, pool.rule, params)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid condition of backend pool '%s': %v", pool.name, err)
+		}
+
+		if ok {
+			return pool, nil
+		}
+	}
+
+	return p.noMatchPool, nil
+}
+
+func (bp *backendPool) next() int {
+	if len(bp.backends) == 1 {
+		return 0
+	}
+
+	bp.mu.Lock()
+
+	bp.current = (bp.current + 1) % len(bp.backends)
+	i := bp.current
+
+	bp.mu.Unlock()
+
+	return i
+}
@@ -0,0 +1,234 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxy_newBackendPools(t *testing.T) {
+	apiPool := config.BackendPool{
+		Name:         "api",
+		BackendAddrs: []string{"localhost:9993", "localhost:9994"},
+		When:         "$(path) =~ '^/api/'",
+	}
+
+	tests := []struct {
+		name  string
+		pools []config.BackendPool
+		err   bool
+	}{
+		{name: "Ok", pools: []config.BackendPool{apiPool}},
+		{name: "Empty"},
+		{
+			name:  "WithoutName",
+			pools: []config.BackendPool{{BackendAddrs: apiPool.BackendAddrs, When: apiPool.When}},
+			err:   true,
+		},
+		{name: "Duplicated", pools: []config.BackendPool{apiPool, apiPool}, err: true},
+		{
+			name:  "WithoutBackends",
+			pools: []config.BackendPool{{Name: "api", When: apiPool.When}},
+			err:   true,
+		},
+		{
+			name:  "WithoutCondition",
+			pools: []config.BackendPool{{Name: "api", BackendAddrs: apiPool.BackendAddrs}},
+			err:   true,
+		},
+		{
+			name:  "InvalidBackend",
+			pools: []config.BackendPool{{Name: "api", BackendAddrs: []string{"ftp://localhost"}, When: apiPool.When}},
+			err:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.BackendPools = tt.pools
+
+			p, err := New(cfg)
+			if (err != nil) != tt.err {
+				t.Fatalf("New() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if tt.err {
+				return
+			}
+
+			if len(p.backendPools) != len(tt.pools) {
+				t.Fatalf("New() backend pools == '%d', want '%d'", len(p.backendPools), len(tt.pools))
+			}
+
+			for i, pool := range p.backendPools {
+				if pool.name != tt.pools[i].Name || len(pool.backends) != len(tt.pools[i].BackendAddrs) {
+					t.Errorf("New() backend pool '%s' with '%d' backends, want '%s' with '%d'",
+						pool.name, len(pool.backends), tt.pools[i].Name, len(tt.pools[i].BackendAddrs))
+				}
+			}
+		})
+	}
+}
+
+func TestProxy_handler_BackendPools(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.BackendPools = []config.BackendPool{
+		{Name: "api", BackendAddrs: []string{"localhost:9993", "localhost:9994"}, When: "$(path) =~ '^/api/'"},
+		{Name: "beta", BackendAddrs: []string{"localhost:9995"}, When: "$(req.header::X-Beta) == 'true'"},
+	}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	web := &mockBackend{body: []byte("web"), statusCode: fasthttp.StatusOK}
+	p.backends = []fetcher{web}
+	p.totalBackends = 1
+
+	api1 := &mockBackend{body: []byte("api"), statusCode: fasthttp.StatusOK}
+	api2 := &mockBackend{body: []byte("api"), statusCode: fasthttp.StatusOK}
+	p.backendPools[0].backends = []fetcher{api1, api2}
+
+	beta := &mockBackend{body: []byte("beta"), statusCode: fasthttp.StatusOK}
+	p.backendPools[1].backends = []fetcher{beta}
+
+	do := func(path string, isBeta bool) string {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(path)
+		ctx.Request.Header.SetHost("www.kratgo.com")
+		if isBeta {
+			ctx.Request.Header.Set("X-Beta", "true")
+		}
+
+		p.handler(ctx)
+
+		return string(ctx.Response.Body())
+	}
+
+	tests := []struct {
+		path   string
+		isBeta bool
+		want   string
+	}{
+		{path: "/api/users/", want: "api"},
+		{path: "/api/orders/", want: "api"},
+		{path: "/home/", want: "web"},
+		{path: "/home/", isBeta: true, want: "beta"},
+	}
+
+	// The responses of each pool must not be mixed in cache
+	for i := 0; i < 2; i++ {
+		for _, tt := range tests {
+			if body := do(tt.path, tt.isBeta); body != tt.want {
+				t.Errorf("Proxy.handler() path '%s' (beta '%v') body == '%s', want '%s'", tt.path, tt.isBeta, body, tt.want)
+			}
+		}
+	}
+
+	if api1.calls != 1 || api2.calls != 1 {
+		t.Errorf("Proxy.handler() api backend calls == '%d' and '%d', want '%d' for each one", api1.calls, api2.calls, 1)
+	}
+
+	if web.calls != 1 || beta.calls != 1 {
+		t.Errorf("Proxy.handler() backend calls == '%d' web and '%d' beta, want '%d' for each one", web.calls, beta.calls, 1)
+	}
+
+	if backends, want := len(p.Stats().Backends), len(p.backendLatencies)+3; backends != want {
+		t.Errorf("Proxy.Stats() backends == '%d', want '%d'", backends, want)
+	}
+}
+
+func TestProxy_handler_NoMatchBehavior(t *testing.T) {
+	apiPool := config.BackendPool{Name: "api", BackendAddrs: []string{"localhost:9993"}, When: "$(path) =~ '^/api/'"}
+	fallbackPool := config.BackendPool{Name: "fallback", BackendAddrs: []string{"localhost:9994"}, When: "false"}
+
+	tests := []struct {
+		name         string
+		backendAddrs []string
+		noMatch      config.NoMatchBehavior
+		wantStatus   int
+		wantBody     string
+		err          bool
+	}{
+		{name: "DefaultBackends", backendAddrs: []string{"localhost:9990"}, wantStatus: fasthttp.StatusOK, wantBody: "web"},
+		{name: "WithoutBackends", wantStatus: fasthttp.StatusBadGateway},
+		{
+			name:         "StatusCode",
+			backendAddrs: []string{"localhost:9990"},
+			noMatch:      config.NoMatchBehavior{StatusCode: fasthttp.StatusNotFound},
+			wantStatus:   fasthttp.StatusNotFound,
+		},
+		{
+			name:       "Pool",
+			noMatch:    config.NoMatchBehavior{Pool: "fallback"},
+			wantStatus: fasthttp.StatusOK,
+			wantBody:   "fallback",
+		},
+		{name: "UnknownPool", noMatch: config.NoMatchBehavior{Pool: "unknown"}, err: true},
+		{name: "InvalidStatusCode", noMatch: config.NoMatchBehavior{StatusCode: 1000}, err: true},
+		{name: "PoolAndStatusCode", noMatch: config.NoMatchBehavior{Pool: "fallback", StatusCode: 404}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.BackendAddrs = tt.backendAddrs
+			cfg.FileConfig.BackendPools = []config.BackendPool{apiPool, fallbackPool}
+			cfg.FileConfig.NoMatchBehavior = tt.noMatch
+
+			p, err := New(cfg)
+			if (err != nil) != tt.err {
+				t.Fatalf("New() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if tt.err {
+				return
+			}
+
+			if p.totalBackends > 0 {
+				p.backends = []fetcher{&mockBackend{body: []byte("web"), statusCode: fasthttp.StatusOK}}
+				p.totalBackends = 1
+			}
+			p.backendPools[0].backends = []fetcher{&mockBackend{body: []byte("api"), statusCode: fasthttp.StatusOK}}
+			p.backendPools[1].backends = []fetcher{&mockBackend{body: []byte("fallback"), statusCode: fasthttp.StatusOK}}
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.SetRequestURI("/home/")
+			ctx.Request.Header.SetHost("www.kratgo.com")
+
+			p.handler(ctx)
+
+			if statusCode := ctx.Response.StatusCode(); statusCode != tt.wantStatus {
+				t.Errorf("Proxy.handler() status code == '%d', want '%d'", statusCode, tt.wantStatus)
+			}
+
+			if tt.wantStatus == fasthttp.StatusOK && string(ctx.Response.Body()) != tt.wantBody {
+				t.Errorf("Proxy.handler() body == '%s', want '%s'", ctx.Response.Body(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestProxy_doBackend_EmptyBackends(t *testing.T) {
+	p, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.backends = nil
+	p.totalBackends = 0
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/")
+
+	pt := p.acquireTools()
+	defer p.releaseTools(pt)
+
+	if err := p.doBackend(ctx, pt, nil); err != errNoBackends {
+		t.Errorf("Proxy.doBackend() error == '%v', want '%v'", err, errNoBackends)
+	}
+}
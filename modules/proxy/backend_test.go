@@ -0,0 +1,399 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+type mockURLClient struct {
+	scheme string
+	path   string
+}
+
+func (mock *mockURLClient) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	mock.scheme = string(req.URI().Scheme())
+	mock.path = string(req.URI().PathOriginal())
+
+	return nil
+}
+
+// mockHeaderBackend records the api key of the requests, and returns it like an echo service
+type mockHeaderBackend struct {
+	apiKey string
+}
+
+func (mock *mockHeaderBackend) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	mock.apiKey = string(req.Header.Peek("X-Api-Key"))
+
+	resp.Header.Set("X-Api-Key", mock.apiKey)
+	resp.SetBodyString("Kratgo")
+
+	return nil
+}
+
+type mockNetError struct {
+	timeout bool
+}
+
+func (e mockNetError) Error() string   { return "net error" }
+func (e mockNetError) Timeout() bool   { return e.timeout }
+func (e mockNetError) Temporary() bool { return false }
+
+func Test_backendErrorStatusCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "DialTimeout", err: fasthttp.ErrDialTimeout, want: fasthttp.StatusGatewayTimeout},
+		{name: "Timeout", err: fasthttp.ErrTimeout, want: fasthttp.StatusGatewayTimeout},
+		{name: "ReadTimeout", err: mockNetError{timeout: true}, want: fasthttp.StatusGatewayTimeout},
+		{name: "NoFreeConns", err: fasthttp.ErrNoFreeConns, want: fasthttp.StatusServiceUnavailable},
+		{name: "ConnectionClosed", err: fasthttp.ErrConnectionClosed, want: fasthttp.StatusBadGateway},
+		{name: "BodyTooLarge", err: fasthttp.ErrBodyTooLarge, want: fasthttp.StatusBadGateway},
+		{name: "NetError", err: mockNetError{}, want: fasthttp.StatusBadGateway},
+		{name: "Other", err: errors.New("error"), want: fasthttp.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backendErrorStatusCode(tt.err); got != tt.want {
+				t.Errorf("backendErrorStatusCode() == '%d', want '%d'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxy_handler_BackendConnectionRefused(t *testing.T) {
+	// Listen and close, to get an address without listener
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	cfg := testConfig()
+	cfg.FileConfig.BackendAddrs = []string{addr}
+	cfg.FileConfig.DialTimeout = 1000
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hc := p.backends[0].(*fasthttp.HostClient); hc.Dial == nil {
+		t.Errorf("Proxy.New() backend dial func is nil, want a dial with timeout")
+	}
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/")
+	ctx.Request.Header.SetHost("www.kratgo.com")
+
+	start := time.Now()
+	p.handler(ctx)
+
+	if statusCode := ctx.Response.StatusCode(); statusCode != fasthttp.StatusBadGateway {
+		t.Errorf("Proxy.handler() status code == '%d', want '%d'", statusCode, fasthttp.StatusBadGateway)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Proxy.handler() elapsed == '%v', want less than '%v'", elapsed, time.Second)
+	}
+}
+
+func TestProxy_New_BackendConnDurations(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.BackendAddrs = []string{"localhost:8080", "https://10.0.0.5:8443"}
+	cfg.FileConfig.MaxIdleConnDuration = 5
+	cfg.FileConfig.MaxConnDuration = 60
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clients := []*fasthttp.HostClient{
+		p.backends[0].(*fasthttp.HostClient),
+		p.backends[1].(*urlBackend).client.(*fasthttp.HostClient),
+	}
+
+	for _, hc := range clients {
+		if hc.MaxIdleConnDuration != 5*time.Second {
+			t.Errorf("Proxy.New() backend '%s' max idle conn duration == '%v', want '%v'", hc.Addr, hc.MaxIdleConnDuration, 5*time.Second)
+		}
+
+		if hc.MaxConnDuration != 60*time.Second {
+			t.Errorf("Proxy.New() backend '%s' max conn duration == '%v', want '%v'", hc.Addr, hc.MaxConnDuration, 60*time.Second)
+		}
+	}
+}
+
+func TestProxy_handler_ClientTimeout(t *testing.T) {
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+
+	go fasthttp.Serve(ln, func(ctx *fasthttp.RequestCtx) {
+		time.Sleep(200 * time.Millisecond)
+		ctx.SetBodyString("slow")
+	})
+
+	cfg := testConfig()
+	cfg.FileConfig.ClientTimeoutHeader = "X-Request-Timeout"
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hc := &fasthttp.HostClient{Addr: "kratgo", Dial: func(addr string) (net.Conn, error) { return ln.Dial() }}
+	p.backends = []fetcher{&urlBackend{client: hc, scheme: []byte("http")}}
+	p.totalBackends = 1
+
+	tests := []struct {
+		name       string
+		timeout    string
+		wantStatus int
+	}{
+		{name: "Timeout", timeout: "50ms", wantStatus: fasthttp.StatusGatewayTimeout},
+		{name: "InTime", timeout: "2s", wantStatus: fasthttp.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.SetRequestURI("/" + tt.name)
+			ctx.Request.Header.SetHost("www.kratgo.com")
+			ctx.Request.Header.Set("X-Request-Timeout", tt.timeout)
+
+			p.handler(ctx)
+
+			if statusCode := ctx.Response.StatusCode(); statusCode != tt.wantStatus {
+				t.Errorf("Proxy.handler() status code == '%d', want '%d'", statusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestProxy_handler_MaxResponseBodySize(t *testing.T) {
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+
+	go fasthttp.Serve(ln, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBody(make([]byte, 10))
+	})
+
+	tests := []struct {
+		name       string
+		maxSize    int
+		wantStatus int
+	}{
+		{name: "Unlimited", maxSize: 0, wantStatus: fasthttp.StatusOK},
+		{name: "Allowed", maxSize: 10, wantStatus: fasthttp.StatusOK},
+		{name: "Exceeded", maxSize: 9, wantStatus: fasthttp.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.MaxResponseBodySize = tt.maxSize
+			cfg.FileConfig.BackendRetries = 2
+
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hc := p.backendOptions.hostClient("kratgo", false)
+			hc.Dial = func(addr string) (net.Conn, error) { return ln.Dial() }
+
+			p.backends = []fetcher{hc}
+			p.totalBackends = 1
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.SetRequestURI("/" + tt.name)
+			ctx.Request.Header.SetHost("www.kratgo.com")
+
+			p.handler(ctx)
+
+			if statusCode := ctx.Response.StatusCode(); statusCode != tt.wantStatus {
+				t.Errorf("Proxy.handler() status code == '%d', want '%d'", statusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func Test_newBackend(t *testing.T) {
+	tests := []struct {
+		name       string
+		addr       string
+		hostAddr   string
+		isTLS      bool
+		pathPrefix string
+		plain      bool
+		err        bool
+	}{
+		{name: "Plain", addr: "localhost:8080", hostAddr: "localhost:8080", plain: true},
+		{name: "HTTPS", addr: "https://10.0.0.5:8443/internal", hostAddr: "10.0.0.5:8443", isTLS: true, pathPrefix: "/internal"},
+		{name: "HTTPDefaultPort", addr: "http://10.0.0.5/", hostAddr: "10.0.0.5:80"},
+		{name: "HTTPSDefaultPort", addr: "https://10.0.0.5", hostAddr: "10.0.0.5:443", isTLS: true},
+		{name: "InvalidScheme", addr: "ftp://10.0.0.5", err: true},
+		{name: "MissingHost", addr: "http:///internal", err: true},
+		{name: "Query", addr: "http://10.0.0.5/?a=1", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, err := newBackend(tt.addr, backendOptions{})
+			if (err != nil) != tt.err {
+				t.Fatalf("newBackend() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if tt.err {
+				return
+			}
+
+			if tt.plain {
+				hc, ok := backend.(*fasthttp.HostClient)
+				if !ok || hc.Addr != tt.hostAddr || hc.IsTLS {
+					t.Errorf("newBackend() == '%v', want a plain host client of '%s'", backend, tt.hostAddr)
+				}
+
+				return
+			}
+
+			b, ok := backend.(*urlBackend)
+			if !ok {
+				t.Fatalf("newBackend() == '%T', want '%T'", backend, b)
+			}
+
+			hc := b.client.(*fasthttp.HostClient)
+			if hc.Addr != tt.hostAddr || hc.IsTLS != tt.isTLS {
+				t.Errorf("newBackend() client addr == '%s' and tls '%v', want '%s' and '%v'", hc.Addr, hc.IsTLS, tt.hostAddr, tt.isTLS)
+			}
+
+			if string(b.pathPrefix) != tt.pathPrefix {
+				t.Errorf("newBackend() path prefix == '%s', want '%s'", b.pathPrefix, tt.pathPrefix)
+			}
+		})
+	}
+}
+
+func Test_newBackend_TLSServerName(t *testing.T) {
+	opts := backendOptions{
+		tls: config.BackendTLS{
+			ServerName:  "www.kratgo.com",
+			ServerNames: map[string]string{"https://10.0.0.6": "internal.kratgo.com"},
+		},
+	}
+
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{addr: "https://10.0.0.5", want: "www.kratgo.com"},
+		{addr: "https://10.0.0.6", want: "internal.kratgo.com"},
+		{addr: "http://10.0.0.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			backend, err := newBackend(tt.addr, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hc := backend.(*urlBackend).client.(*fasthttp.HostClient)
+
+			serverName := ""
+			if hc.TLSConfig != nil {
+				serverName = hc.TLSConfig.ServerName
+			}
+
+			if serverName != tt.want {
+				t.Errorf("newBackend() TLS server name == '%s', want '%s'", serverName, tt.want)
+			}
+		})
+	}
+}
+
+func TestURLBackend_Do(t *testing.T) {
+	client := new(mockURLClient)
+	b := &urlBackend{client: client, scheme: []byte("https"), pathPrefix: []byte("/internal")}
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer func() {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+	}()
+
+	req.SetRequestURI("http://www.kratgo.com/fast/?q=1")
+	path := req.URI().PathOriginal()
+
+	if err := b.Do(req, resp); err != nil {
+		t.Fatalf("urlBackend.Do() unexpected error: %v", err)
+	}
+
+	if client.scheme != "https" || client.path != "/internal/fast/" {
+		t.Errorf("urlBackend.Do() sent scheme '%s' and path '%s', want '%s' and '%s'",
+			client.scheme, client.path, "https", "/internal/fast/")
+	}
+
+	if scheme := string(req.URI().Scheme()); scheme != "http" {
+		t.Errorf("urlBackend.Do() scheme has not been restored: '%s'", scheme)
+	}
+
+	if string(path) != "/fast/" || string(req.URI().PathOriginal()) != "/fast/" {
+		t.Errorf("urlBackend.Do() path has not been restored: '%s'", req.URI().PathOriginal())
+	}
+
+	if args := string(req.URI().QueryString()); args != "q=1" {
+		t.Errorf("urlBackend.Do() query string == '%s', want '%s'", args, "q=1")
+	}
+}
+
+func TestProxy_handler_BackendHeaders(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.BackendAddrs = []string{"localhost:9990", "localhost:9991"}
+	cfg.FileConfig.BackendHeaders = config.BackendHeaders{
+		"localhost:9990": {"X-Api-Key": "key-a"},
+		"localhost:9991": {"X-Api-Key": "key-b"},
+	}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backendA, backendB := &mockHeaderBackend{}, &mockHeaderBackend{}
+	p.backends = []fetcher{backendA, backendB}
+
+	for _, path := range []string{"/a/", "/b/"} {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(path)
+		ctx.Request.SetHost("headers.kratgo.com")
+
+		p.handler(ctx)
+
+		if apiKey := ctx.Response.Header.Peek("X-Api-Key"); len(apiKey) > 0 {
+			t.Errorf("Proxy.handler() path '%s' returns the injected header to the client: '%s'", path, apiKey)
+		}
+
+		if apiKey := ctx.Request.Header.Peek("X-Api-Key"); len(apiKey) > 0 {
+			t.Errorf("Proxy.handler() path '%s' keeps the injected header in the request: '%s'", path, apiKey)
+		}
+	}
+
+	if backendA.apiKey != "key-a" || backendB.apiKey != "key-b" {
+		t.Errorf("Proxy.handler() backend api keys == '%s' and '%s', want '%s' and '%s'",
+			backendA.apiKey, backendB.apiKey, "key-a", "key-b")
+	}
+}
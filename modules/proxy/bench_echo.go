@@ -0,0 +1,16 @@
+package proxy
+
+import "github.com/valyala/fasthttp"
+
+// BenchEcho serves the request through the whole pipeline (rules, cache, etc), but with a canned
+// response instead of the backends, to measure the overhead of the proxy. It's cached apart from the others
+func (p *Proxy) BenchEcho(ctx *fasthttp.RequestCtx) {
+	ctx.SetUserValue(benchEchoUserValueKey, true)
+	p.handler(ctx)
+}
+
+func benchEchoResponse(resp *fasthttp.Response) {
+	resp.SetStatusCode(fasthttp.StatusOK)
+	resp.Header.SetContentType("text/plain; charset=utf-8")
+	resp.SetBodyString(benchEchoBody)
+}
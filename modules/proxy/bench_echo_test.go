@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/savsgio/kratgo/modules/cache"
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxy_BenchEcho(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.Response.Headers.Set = []config.Header{{Name: "X-Kratgo", Value: "true"}}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{body: []byte("Kratgo"), statusCode: fasthttp.StatusOK}
+	p.backends = []fetcher{backend}
+	p.totalBackends = len(p.backends)
+
+	for i := 0; i < 2; i++ {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI("/bench-echo")
+		ctx.Request.SetHost("www.kratgo.com")
+
+		p.BenchEcho(ctx)
+
+		if body := string(ctx.Response.Body()); body != benchEchoBody {
+			t.Errorf("Proxy.BenchEcho() body == '%s', want '%s'", body, benchEchoBody)
+		}
+
+		if v := string(ctx.Response.Header.Peek("X-Kratgo")); v != "true" {
+			t.Errorf("Proxy.BenchEcho() header 'X-Kratgo' == '%s', want '%s'", v, "true")
+		}
+	}
+
+	if backend.called {
+		t.Error("Proxy.BenchEcho() has called the backend")
+	}
+
+	entry := cache.AcquireEntry()
+	defer cache.ReleaseEntry(entry)
+
+	if err := p.cache.Get("www.kratgo.com", entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := entry.GetVariantResponse([]byte("/bench-echo"), []byte(benchEchoVariantPrefix)); r == nil {
+		t.Error("Proxy.BenchEcho() response not cached apart from the others")
+	}
+
+	if r := entry.GetVariantResponse([]byte("/bench-echo"), nil); r != nil {
+		t.Error("Proxy.BenchEcho() response cached as a backend response")
+	}
+}
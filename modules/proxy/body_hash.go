@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/valyala/fasthttp"
+)
+
+// newBodyHashRules returns the rules of the requests cached by a hash of their body, in the order of the configuration
+func (p *Proxy) newBodyHashRules() ([]bodyHashRule, error) {
+	rules := make([]bodyHashRule, 0, len(p.fileConfig.BodyHashCache))
+
+	for i, cfg := range p.fileConfig.BodyHashCache {
+		if cfg.When == "" {
+			return nil, fmt.Errorf("Proxy.BodyHashCache[%d] has not condition", i)
+		}
+
+		if cfg.MaxBodySize < 0 {
+			return nil, fmt.Errorf("Proxy.BodyHashCache[%d].MaxBodySize must be 0 (default) or greater", i)
+		}
+
+		expr, params, err := p.newEvaluableExpression(cfg.When)
+		if err != nil {
+			return nil, fmt.Errorf("Could not get the evaluable expression for body hash cache: %v", err)
+		}
+
+		r := bodyHashRule{maxBodySize: cfg.MaxBodySize}
+		r.expr = expr
+		r.params = params
+
+		if r.maxBodySize == 0 {
+			r.maxBodySize = defaultBodyHashMaxBodySize
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// bodyHashVariant appends the method and the hash of the body to the cache variant, if the request matches
+// any of the rules, so the reads with a body (ex: GraphQL over POST) are cached apart by their query.
+// It returns false if the body is bigger than the max size of the rule, as the request could not be cached
+func (p *Proxy) bodyHashVariant(ctx *fasthttp.RequestCtx, pt *proxyTools, dst []byte) ([]byte, bool, error) {
+	for _, r := range p.bodyHashRules {
+		ok, err := evalRule(ctx, r.rule, pt.params)
+		if err != nil {
+			return dst, false, fmt.Errorf("Invalid body hash cache rule: %v", err)
+		} else if !ok {
+			continue
+		}
+
+		body := ctx.Request.Body()
+		if len(body) > r.maxBodySize {
+			return dst, false, nil
+		}
+
+		sum := sha256.Sum256(body)
+
+		dst = append(dst, bodyHashVariantPrefix...)
+		dst = append(dst, ctx.Method()...)
+		dst = append(dst, ':')
+		dst = append(dst, hex.EncodeToString(sum[:])...)
+
+		return append(dst, ';'), true, nil
+	}
+
+	return dst, true, nil
+}
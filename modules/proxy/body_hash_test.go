@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxy_newBodyHashRules(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  []config.BodyHashCache
+		err  bool
+	}{
+		{name: "Ok", cfg: []config.BodyHashCache{{When: "$(path) == '/graphql'"}}},
+		{name: "WithoutCondition", cfg: []config.BodyHashCache{{MaxBodySize: 1024}}, err: true},
+		{name: "InvalidMaxBodySize", cfg: []config.BodyHashCache{{When: "$(path) == '/graphql'", MaxBodySize: -1}}, err: true},
+		{name: "InvalidRule", cfg: []config.BodyHashCache{{When: "$(path) =="}}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.BodyHashCache = tt.cfg
+
+			p, err := New(cfg)
+			if (err != nil) != tt.err {
+				t.Fatalf("New() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if !tt.err && p.bodyHashRules[0].maxBodySize != defaultBodyHashMaxBodySize {
+				t.Errorf("Proxy.newBodyHashRules() max body size == '%d', want '%d'",
+					p.bodyHashRules[0].maxBodySize, defaultBodyHashMaxBodySize)
+			}
+		})
+	}
+}
+
+func TestProxy_handler_BodyHashCache(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.BodyHashCache = []config.BodyHashCache{{When: "$(path) == '/graphql'", MaxBodySize: 32}}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{statusCode: fasthttp.StatusOK}
+	p.backends = []fetcher{backend}
+	p.totalBackends = len(p.backends)
+
+	requests := []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		wantCalls int
+	}{
+		{name: "Query", method: "POST", path: "/graphql", body: `{"query": "{a}"}`, wantCalls: 1},
+		{name: "SameQuery", method: "POST", path: "/graphql", body: `{"query": "{a}"}`, wantCalls: 1},
+		{name: "OtherQuery", method: "POST", path: "/graphql", body: `{"query": "{b}"}`, wantCalls: 2},
+		{name: "OtherMethod", method: "PUT", path: "/graphql", body: `{"query": "{a}"}`, wantCalls: 3},
+		{name: "TooLarge", method: "POST", path: "/graphql", body: `{"query": "{a b c d e f g h i j}"}`, wantCalls: 4},
+		{name: "TooLargeAgain", method: "POST", path: "/graphql", body: `{"query": "{a b c d e f g h i j}"}`, wantCalls: 5},
+		{name: "OtherPath", method: "POST", path: "/other", body: `{"query": "{a}"}`, wantCalls: 6},
+		{name: "OtherPathOtherBody", method: "POST", path: "/other", body: `{"query": "{b}"}`, wantCalls: 6},
+	}
+
+	for _, r := range requests {
+		t.Run(r.name, func(t *testing.T) {
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.Header.SetMethod(r.method)
+			ctx.Request.SetRequestURI(r.path)
+			ctx.Request.Header.SetHost("www.kratgo.com")
+			ctx.Request.SetBodyString(r.body)
+
+			backend.body = []byte(r.body)
+
+			p.handler(ctx)
+
+			if backend.calls != r.wantCalls {
+				t.Errorf("Proxy.handler() backend calls == '%d', want '%d'", backend.calls, r.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+// newBodyRewrite returns nil if there are no rules, so the bodies are never rewritten
+func newBodyRewrite(cfg config.BodyRewrite, compression compression) (*bodyRewrite, error) {
+	if len(cfg.Rules) == 0 {
+		return nil, nil
+	}
+
+	if len(cfg.ContentTypes) == 0 {
+		return nil, fmt.Errorf("Proxy.BodyRewrite.ContentTypes is mandatory with rules")
+	}
+
+	b := &bodyRewrite{maxBodySize: cfg.MaxBodySize, compression: compression}
+
+	if b.maxBodySize <= 0 {
+		b.maxBodySize = defaultBodyRewriteMaxBodySize
+	}
+
+	for _, contentType := range cfg.ContentTypes {
+		b.contentTypes = append(b.contentTypes, strings.ToLower(contentType))
+	}
+
+	for _, rule := range cfg.Rules {
+		if rule.Match == "" {
+			return nil, fmt.Errorf("Proxy.BodyRewrite.Rules match is mandatory")
+		}
+
+		r := bodyRewriteRule{match: []byte(rule.Match), replace: []byte(rule.Replace)}
+
+		if rule.Regex {
+			regex, err := regexp.Compile(rule.Match)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid body rewrite regex '%s': %v", rule.Match, err)
+			}
+
+			r.regex = regex
+		}
+
+		b.rules = append(b.rules, r)
+	}
+
+	return b, nil
+}
+
+// matchContentType reports if the media type, without parameters, is one of the configured
+func (b *bodyRewrite) matchContentType(contentType []byte) bool {
+	return stringSliceInclude(b.contentTypes, mediaType(contentType))
+}
+
+// apply rewrites the body of the response, if its content type is configured and it isn't
+// bigger than the max body size. The encoded bodies (gzip, deflate or br) are decoded to rewrite them,
+// up to the max body size, and encoded again with the configured compression level
+func (b *bodyRewrite) apply(resp *fasthttp.Response) {
+	if b == nil {
+		return
+	}
+
+	body := resp.Body()
+
+	if len(body) == 0 || !b.matchContentType(resp.Header.ContentType()) {
+		return
+	}
+
+	encoding := string(resp.Header.Peek(headerContentEncoding))
+	if encoding == "" {
+		if len(body) <= b.maxBodySize {
+			resp.SetBody(b.rewrite(body))
+		}
+
+		return
+	}
+
+	decoded, err := decodeBody(encoding, body, b.maxBodySize)
+	if err != nil {
+		// Unknown encodings, invalid and too large bodies are never rewritten
+		return
+	}
+
+	resp.SetBody(b.compression.encode(encoding, b.rewrite(decoded)))
+}
+
+// rewrite returns the body with the rules applied
+func (b *bodyRewrite) rewrite(body []byte) []byte {
+	for _, r := range b.rules {
+		if r.regex != nil {
+			body = r.regex.ReplaceAll(body, r.replace)
+		} else {
+			body = bytes.Replace(body, r.match, r.replace, -1)
+		}
+	}
+
+	return body
+}
+
+// decodeBody returns the body decoded with the content encoding, or fasthttp.ErrBodyTooLarge
+// as soon as the decoded body is bigger than the max size, to not decode a zip bomb entirely
+func decodeBody(encoding string, body []byte, maxSize int) ([]byte, error) {
+	w := &limitedBuffer{max: maxSize}
+
+	var err error
+
+	switch strings.ToLower(encoding) {
+	case encodingGzip:
+		_, err = fasthttp.WriteGunzip(w, body)
+	case encodingDeflate:
+		_, err = fasthttp.WriteInflate(w, body)
+	case encodingBrotli:
+		_, err = fasthttp.WriteUnbrotli(w, body)
+	default:
+		return nil, fmt.Errorf("Unsupported content encoding '%s'", encoding)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return w.b, nil
+}
+
+// Write appends p to the buffer, or fails if the buffer would exceed its max size
+func (w *limitedBuffer) Write(p []byte) (int, error) {
+	if len(w.b)+len(p) > w.max {
+		return 0, fasthttp.ErrBodyTooLarge
+	}
+
+	w.b = append(w.b, p...)
+
+	return len(p), nil
+}
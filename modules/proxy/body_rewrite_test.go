@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+func Test_newBodyRewrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.BodyRewrite
+		disabled bool
+		err      bool
+	}{
+		{
+			name: "Ok",
+			cfg: config.BodyRewrite{
+				ContentTypes: []string{"text/html"},
+				Rules:        []config.BodyRewriteRule{{Match: "</body>", Replace: "<script></script></body>"}},
+			},
+		},
+		{
+			name:     "Disabled",
+			cfg:      config.BodyRewrite{ContentTypes: []string{"text/html"}},
+			disabled: true,
+		},
+		{
+			name: "NoContentTypes",
+			cfg:  config.BodyRewrite{Rules: []config.BodyRewriteRule{{Match: "a", Replace: "b"}}},
+			err:  true,
+		},
+		{
+			name: "EmptyMatch",
+			cfg: config.BodyRewrite{
+				ContentTypes: []string{"text/html"},
+				Rules:        []config.BodyRewriteRule{{Match: "", Replace: "b"}},
+			},
+			err: true,
+		},
+		{
+			name: "InvalidRegex",
+			cfg: config.BodyRewrite{
+				ContentTypes: []string{"text/html"},
+				Rules:        []config.BodyRewriteRule{{Match: "(", Regex: true}},
+			},
+			err: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := newBodyRewrite(tt.cfg, testCompression(t))
+			if (err != nil) != tt.err {
+				t.Fatalf("newBodyRewrite() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if !tt.err && (b == nil) != tt.disabled {
+				t.Errorf("newBodyRewrite() == '%v', want nil '%v'", b, tt.disabled)
+			}
+
+			if b != nil && b.maxBodySize != defaultBodyRewriteMaxBodySize {
+				t.Errorf("newBodyRewrite() maxBodySize == '%d', want '%d'", b.maxBodySize, defaultBodyRewriteMaxBodySize)
+			}
+		})
+	}
+}
+
+func TestBodyRewrite_apply(t *testing.T) {
+	b, err := newBodyRewrite(config.BodyRewrite{
+		ContentTypes: []string{"Text/HTML"},
+		MaxBodySize:  64,
+		Rules: []config.BodyRewriteRule{
+			{Match: "</body>", Replace: "<script></script></body>"},
+			{Match: "v[0-9]+", Replace: "vX", Regex: true},
+		},
+	}, testCompression(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := "<body>v1 v22</body>"
+
+	tests := []struct {
+		name            string
+		contentType     string
+		contentEncoding string
+		body            string
+		want            string
+	}{
+		{
+			name:        "Rewritten",
+			contentType: "text/html; charset=utf-8",
+			body:        body,
+			want:        "<body>vX vX<script></script></body>",
+		},
+		{
+			name:        "OtherContentType",
+			contentType: "application/json",
+			body:        body,
+			want:        body,
+		},
+		{
+			name:            "InvalidEncoded",
+			contentType:     "text/html",
+			contentEncoding: "gzip",
+			body:            body,
+			want:            body,
+		},
+		{
+			name:        "TooBig",
+			contentType: "text/html",
+			body:        body + string(make([]byte, 64)),
+			want:        body + string(make([]byte, 64)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := fasthttp.AcquireResponse()
+			defer fasthttp.ReleaseResponse(resp)
+
+			resp.Header.SetContentType(tt.contentType)
+			if tt.contentEncoding != "" {
+				resp.Header.Set(headerContentEncoding, tt.contentEncoding)
+			}
+			resp.SetBodyString(tt.body)
+
+			b.apply(resp)
+
+			if got := string(resp.Body()); got != tt.want {
+				t.Errorf("bodyRewrite.apply() body == '%s', want '%s'", got, tt.want)
+			}
+		})
+	}
+
+	var disabled *bodyRewrite
+
+	resp := fasthttp.AcquireResponse()
+	resp.SetBodyString(body)
+	disabled.apply(resp)
+
+	if got := string(resp.Body()); got != body {
+		t.Errorf("bodyRewrite.apply() disabled body == '%s', want '%s'", got, body)
+	}
+}
+
+func TestBodyRewrite_apply_Encoded(t *testing.T) {
+	b, err := newBodyRewrite(config.BodyRewrite{
+		ContentTypes: []string{"text/html"},
+		MaxBodySize:  64,
+		Rules:        []config.BodyRewriteRule{{Match: "</body>", Replace: "<script></script></body>"}},
+	}, testCompression(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := "<body>Kratgo</body>"
+	want := "<body>Kratgo<script></script></body>"
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     string
+		want     string
+		err      bool
+	}{
+		{name: "Gzip", encoding: "gzip", body: body, want: want},
+		{name: "Deflate", encoding: "deflate", body: body, want: want},
+		{name: "Brotli", encoding: "br", body: body, want: want},
+		{name: "UpperCase", encoding: "GZIP", body: body, want: want},
+		{name: "TooBigDecoded", encoding: "gzip", body: body + strings.Repeat(" ", 64), err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := fasthttp.AcquireResponse()
+			defer fasthttp.ReleaseResponse(resp)
+
+			encoded := b.compression.encode(tt.encoding, []byte(tt.body))
+
+			resp.Header.SetContentType("text/html")
+			resp.Header.Set(headerContentEncoding, tt.encoding)
+			resp.SetBody(encoded)
+
+			b.apply(resp)
+
+			if tt.err {
+				if !bytes.Equal(resp.Body(), encoded) {
+					t.Errorf("bodyRewrite.apply() has been rewritten the too big decoded body")
+				}
+
+				return
+			}
+
+			decoded, err := decodeBody(tt.encoding, resp.Body(), 1024)
+			if err != nil {
+				t.Fatalf("bodyRewrite.apply() body is not encoded with '%s': %v", tt.encoding, err)
+			}
+
+			if string(decoded) != tt.want {
+				t.Errorf("bodyRewrite.apply() body == '%s', want '%s'", decoded, tt.want)
+			}
+		})
+	}
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	resp.Header.SetContentType("text/html")
+	resp.Header.Set(headerContentEncoding, "zstd")
+	resp.SetBodyString(body)
+
+	b.apply(resp)
+
+	if got := string(resp.Body()); got != body {
+		t.Errorf("bodyRewrite.apply() with unknown encoding body == '%s', want '%s'", got, body)
+	}
+}
+
+func Test_decodeBody(t *testing.T) {
+	// A big body of zeros is compressed to a few bytes
+	bomb := fasthttp.AppendGzipBytes(nil, make([]byte, 10*1024*1024))
+
+	if _, err := decodeBody(encodingGzip, bomb, 1024); err != fasthttp.ErrBodyTooLarge {
+		t.Errorf("decodeBody() error == '%v', want '%v'", err, fasthttp.ErrBodyTooLarge)
+	}
+
+	if _, err := decodeBody("zstd", bomb, 1024); err == nil {
+		t.Errorf("decodeBody() with unknown encoding, want error")
+	}
+}
@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/savsgio/gotils"
+	"github.com/valyala/fasthttp"
+)
+
+// newCanary returns nil if there are no canary backends, so all requests go to the stable ones
+func (p *Proxy) newCanary() (*canary, error) {
+	cfg := p.fileConfig.Canary
+	if len(cfg.BackendAddrs) == 0 {
+		return nil, nil
+	}
+
+	if cfg.Percent < 0 || cfg.Percent > 100 {
+		return nil, fmt.Errorf("Proxy.Canary.Percent must be between 0 and 100, got %v", cfg.Percent)
+	}
+
+	c := &canary{
+		addrs:     cfg.BackendAddrs,
+		threshold: uint32(cfg.Percent * canaryBuckets / 100),
+	}
+
+	for _, addr := range cfg.BackendAddrs {
+		backend, err := newBackend(addr, p.backendOptions)
+		if err != nil {
+			return nil, err
+		}
+
+		c.backends = append(c.backends, backend)
+		c.latencies = append(c.latencies, newLatencyHistogram(addr))
+	}
+
+	if cfg.Ramp.Duration != 0 {
+		ramp, err := newCanaryRamp(cfg.Ramp)
+		if err != nil {
+			return nil, err
+		}
+
+		c.ramp = ramp
+	}
+
+	if cfg.BucketBy != "" {
+		configKey, evalKey, evalSubKey, resolver := p.parseEvalKeys(cfg.BucketBy, 0)
+		if configKey != cfg.BucketBy {
+			return nil, fmt.Errorf("Invalid Proxy.Canary.BucketBy variable: %s", cfg.BucketBy)
+		}
+
+		c.bucketBy = &headerValue{value: evalKey, subKey: evalSubKey, resolver: resolver}
+	}
+
+	return c, nil
+}
+
+// bucket returns the bucket of the request, hashing the bucketBy value so the same one
+// is always in the same bucket, or a random bucket if bucketBy is not configured.
+// Requests without value are never in the canary
+func (c *canary) bucket(ctx *fasthttp.RequestCtx) (uint32, bool) {
+	if c.bucketBy == nil {
+		return uint32(rand.Intn(canaryBuckets)), true
+	}
+
+	value := getHeaderValue(ctx, *c.bucketBy)
+	if value == "" {
+		return 0, false
+	}
+
+	h := fnv.New32a()
+	h.Write(gotils.S2B(value))
+
+	return h.Sum32() % canaryBuckets, true
+}
+
+// match reports if the request must be sent to the canary backends
+func (c *canary) match(ctx *fasthttp.RequestCtx) bool {
+	if c == nil {
+		return false
+	}
+
+	bucket, ok := c.bucket(ctx)
+
+	return ok && bucket < c.currentThreshold(time.Now())
+}
+
+// currentThreshold returns the threshold of the ramp at the given time, or the fixed one without ramp
+func (c *canary) currentThreshold(now time.Time) uint32 {
+	if c.ramp == nil {
+		return c.threshold
+	}
+
+	return c.ramp.threshold(now)
+}
+
+func (c *canary) next() int {
+	if len(c.backends) == 1 {
+		return 0
+	}
+
+	c.mu.Lock()
+
+	c.current = (c.current + 1) % len(c.backends)
+	i := c.current
+
+	c.mu.Unlock()
+
+	return i
+}
+
+// newCanaryRamp returns the ramp of the canary, started now.
+// The end percent is 100 if it's not configured
+func newCanaryRamp(cfg config.CanaryRamp) (*canaryRamp, error) {
+	if cfg.Duration < 0 {
+		return nil, fmt.Errorf("Proxy.Canary.Ramp.Duration must be greater than 0, got %d", cfg.Duration)
+	}
+
+	if cfg.EndPercent == 0 {
+		cfg.EndPercent = 100
+	}
+
+	for _, percent := range []float64{cfg.StartPercent, cfg.EndPercent} {
+		if percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("Proxy.Canary.Ramp percents must be between 0 and 100, got %v", percent)
+		}
+	}
+
+	return &canaryRamp{
+		start:     uint32(cfg.StartPercent * canaryBuckets / 100),
+		end:       uint32(cfg.EndPercent * canaryBuckets / 100),
+		duration:  int64(cfg.Duration) * int64(time.Second),
+		startedAt: time.Now().UnixNano(),
+	}, nil
+}
+
+// threshold returns the threshold interpolated by the elapsed time since the start of the ramp,
+// so the buckets under the start threshold stay in the canary during all the ramp (if it increases)
+func (r *canaryRamp) threshold(now time.Time) uint32 {
+	elapsed := now.UnixNano() - atomic.LoadInt64(&r.startedAt)
+
+	switch {
+	case elapsed <= 0:
+		return r.start
+	case elapsed >= r.duration:
+		return r.end
+	}
+
+	progress := float64(elapsed) / float64(r.duration)
+
+	return uint32(float64(r.start) + (float64(r.end)-float64(r.start))*progress)
+}
+
+func (r *canaryRamp) restart(now time.Time) {
+	atomic.StoreInt64(&r.startedAt, now.UnixNano())
+}
+
+// RestartCanaryRamp starts again the ramp of the canary from its start percent,
+// it returns false if the canary ramp is not configured
+func (p *Proxy) RestartCanaryRamp() bool {
+	if p.canary == nil || p.canary.ramp == nil {
+		return false
+	}
+
+	p.canary.ramp.restart(time.Now())
+
+	p.log.Infof("Canary ramp restarted")
+
+	return true
+}
+
+// CanaryPercent returns the current percent of the requests sent to the canary backends
+func (p *Proxy) CanaryPercent() float64 {
+	if p.canary == nil {
+		return 0
+	}
+
+	return float64(p.canary.currentThreshold(time.Now())) * 100 / canaryBuckets
+}
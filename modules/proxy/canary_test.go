@@ -0,0 +1,278 @@
+package proxy
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxy_newCanary(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.Canary
+		disabled bool
+		err      bool
+	}{
+		{
+			name: "Ok",
+			cfg:  config.Canary{BackendAddrs: []string{"localhost:9995"}, Percent: 10, BucketBy: "$(cookie::user)"},
+		},
+		{
+			name: "Random",
+			cfg:  config.Canary{BackendAddrs: []string{"localhost:9995"}, Percent: 10},
+		},
+		{
+			name:     "Disabled",
+			cfg:      config.Canary{Percent: 10},
+			disabled: true,
+		},
+		{
+			name: "InvalidPercent",
+			cfg:  config.Canary{BackendAddrs: []string{"localhost:9995"}, Percent: 101},
+			err:  true,
+		},
+		{
+			name: "Ramp",
+			cfg: config.Canary{
+				BackendAddrs: []string{"localhost:9995"},
+				Ramp:         config.CanaryRamp{StartPercent: 1, Duration: 3600},
+			},
+		},
+		{
+			name: "InvalidRampPercent",
+			cfg: config.Canary{
+				BackendAddrs: []string{"localhost:9995"},
+				Ramp:         config.CanaryRamp{StartPercent: 1, EndPercent: 120, Duration: 3600},
+			},
+			err: true,
+		},
+		{
+			name: "InvalidRampDuration",
+			cfg: config.Canary{
+				BackendAddrs: []string{"localhost:9995"},
+				Ramp:         config.CanaryRamp{StartPercent: 1, Duration: -1},
+			},
+			err: true,
+		},
+		{
+			name: "InvalidBucketBy",
+			cfg:  config.Canary{BackendAddrs: []string{"localhost:9995"}, Percent: 10, BucketBy: "user"},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.Canary = tt.cfg
+
+			p, err := New(cfg)
+			if (err != nil) != tt.err {
+				t.Fatalf("New() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if tt.err {
+				return
+			}
+
+			if (p.canary == nil) != tt.disabled {
+				t.Fatalf("New() canary == '%v', want nil '%v'", p.canary, tt.disabled)
+			}
+
+			if p.canary != nil && len(p.canary.backends) != len(tt.cfg.BackendAddrs) {
+				t.Errorf("New() canary backends == '%d', want '%d'", len(p.canary.backends), len(tt.cfg.BackendAddrs))
+			}
+		})
+	}
+}
+
+func TestCanary_match(t *testing.T) {
+	newCanary := func(percent float64) *canary {
+		cfg := testConfig()
+		cfg.FileConfig.Canary = config.Canary{
+			BackendAddrs: []string{"localhost:9995"},
+			Percent:      percent,
+			BucketBy:     "$(cookie::user)",
+		}
+
+		p, err := New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return p.canary
+	}
+
+	newCtx := func(user string) *fasthttp.RequestCtx {
+		ctx := new(fasthttp.RequestCtx)
+		if user != "" {
+			ctx.Request.Header.SetCookie("user", user)
+		}
+
+		return ctx
+	}
+
+	if c := (*canary)(nil); c.match(newCtx("1")) {
+		t.Error("canary.match() nil canary matches")
+	}
+
+	none, all, half := newCanary(0), newCanary(100), newCanary(50)
+
+	if all.match(newCtx("")) {
+		t.Error("canary.match() request without bucket value matches")
+	}
+
+	matches := 0
+	for i := 0; i < 1000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+
+		if none.match(newCtx(user)) {
+			t.Fatalf("canary.match() user '%s' matches with 0 percent", user)
+		}
+
+		if !all.match(newCtx(user)) {
+			t.Fatalf("canary.match() user '%s' doesn't match with 100 percent", user)
+		}
+
+		match := half.match(newCtx(user))
+		for j := 0; j < 3; j++ {
+			if half.match(newCtx(user)) != match {
+				t.Fatalf("canary.match() user '%s' is not deterministic", user)
+			}
+		}
+
+		if match {
+			matches++
+		}
+	}
+
+	if matches < 400 || matches > 600 {
+		t.Errorf("canary.match() matches == '%d' of '%d', want about the half", matches, 1000)
+	}
+}
+
+func TestCanaryRamp_threshold(t *testing.T) {
+	ramp, err := newCanaryRamp(config.CanaryRamp{StartPercent: 1, Duration: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(0, ramp.startedAt)
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		want    uint32
+	}{
+		{name: "Before", elapsed: -time.Second, want: 100},
+		{name: "Start", elapsed: 0, want: 100},
+		{name: "Half", elapsed: 50 * time.Second, want: 5050},
+		{name: "End", elapsed: 100 * time.Second, want: canaryBuckets},
+		{name: "After", elapsed: time.Hour, want: canaryBuckets},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if threshold := ramp.threshold(start.Add(tt.elapsed)); threshold != tt.want {
+				t.Errorf("canaryRamp.threshold() == '%d', want '%d'", threshold, tt.want)
+			}
+		})
+	}
+
+	ramp.restart(start.Add(time.Hour))
+	if threshold := ramp.threshold(start.Add(time.Hour)); threshold != 100 {
+		t.Errorf("canaryRamp.threshold() after restart == '%d', want '%d'", threshold, 100)
+	}
+}
+
+func TestProxy_RestartCanaryRamp(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.Canary = config.Canary{BackendAddrs: []string{"localhost:9995"}, Percent: 10}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.RestartCanaryRamp() {
+		t.Error("Proxy.RestartCanaryRamp() without ramp == 'true', want 'false'")
+	}
+
+	if percent := p.CanaryPercent(); percent != 10 {
+		t.Errorf("Proxy.CanaryPercent() == '%v', want '%v'", percent, 10)
+	}
+
+	cfg.FileConfig.Canary.Ramp = config.CanaryRamp{StartPercent: 2, EndPercent: 50, Duration: 3600}
+
+	if p, err = New(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulates that the ramp ended, to restart it
+	p.canary.ramp.startedAt -= int64(2 * time.Hour)
+	if percent := p.CanaryPercent(); percent != 50 {
+		t.Errorf("Proxy.CanaryPercent() at the end of the ramp == '%v', want '%v'", percent, 50)
+	}
+
+	if !p.RestartCanaryRamp() {
+		t.Error("Proxy.RestartCanaryRamp() == 'false', want 'true'")
+	}
+
+	if percent := p.CanaryPercent(); percent < 2 || percent > 2.1 {
+		t.Errorf("Proxy.CanaryPercent() after restart == '%v', want about '%v'", percent, 2)
+	}
+}
+
+func TestProxy_handler_Canary(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.Canary = config.Canary{
+		BackendAddrs: []string{"localhost:9995"},
+		Percent:      100,
+		BucketBy:     "$(req.header::X-User)",
+	}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stable := &mockBackend{body: []byte("stable"), statusCode: fasthttp.StatusOK}
+	p.backends = []fetcher{stable}
+	p.totalBackends = 1
+
+	canaryBackend := &mockBackend{body: []byte("canary"), statusCode: fasthttp.StatusOK}
+	p.canary.backends = []fetcher{canaryBackend}
+
+	do := func(user string) string {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI("/canary/")
+		ctx.Request.Header.SetHost("www.kratgo.com")
+		if user != "" {
+			ctx.Request.Header.Set("X-User", user)
+		}
+
+		p.handler(ctx)
+
+		return string(ctx.Response.Body())
+	}
+
+	// The stable and canary responses must not be mixed in cache
+	for i := 0; i < 2; i++ {
+		if body := do("user-1"); body != "canary" {
+			t.Errorf("Proxy.handler() canary body == '%s', want '%s'", body, "canary")
+		}
+
+		if body := do(""); body != "stable" {
+			t.Errorf("Proxy.handler() stable body == '%s', want '%s'", body, "stable")
+		}
+	}
+
+	if canaryBackend.calls != 1 || stable.calls != 1 {
+		t.Errorf("Proxy.handler() backend calls == '%d' canary and '%d' stable, want '%d' for each one",
+			canaryBackend.calls, stable.calls, 1)
+	}
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+// newCompression returns the default levels of fasthttp, except for the configured algorithm
+func newCompression(cfg config.Compression) (compression, error) {
+	c := compression{
+		gzipLevel:    fasthttp.CompressDefaultCompression,
+		deflateLevel: fasthttp.CompressDefaultCompression,
+		brotliLevel:  fasthttp.CompressBrotliDefaultCompression,
+	}
+
+	if cfg.Algorithm == "" {
+		if cfg.Level != 0 {
+			return c, fmt.Errorf("Proxy.Compression.Algorithm is mandatory with level")
+		}
+
+		return c, nil
+	}
+
+	var level *int
+	minLevel, maxLevel := fasthttp.CompressBestSpeed, fasthttp.CompressBestCompression
+
+	switch strings.ToLower(cfg.Algorithm) {
+	case encodingGzip:
+		level = &c.gzipLevel
+	case encodingDeflate:
+		level = &c.deflateLevel
+	case encodingBrotli:
+		level = &c.brotliLevel
+		minLevel, maxLevel = fasthttp.CompressBrotliBestSpeed, fasthttp.CompressBrotliBestCompression
+	default:
+		return c, fmt.Errorf("Invalid Proxy.Compression.Algorithm '%s', it must be gzip, deflate or br", cfg.Algorithm)
+	}
+
+	if cfg.Level == 0 {
+		return c, nil
+	}
+
+	if cfg.Level < minLevel || cfg.Level > maxLevel {
+		return c, fmt.Errorf(
+			"Invalid Proxy.Compression.Level %d for '%s', it must be between %d and %d",
+			cfg.Level, cfg.Algorithm, minLevel, maxLevel,
+		)
+	}
+
+	*level = cfg.Level
+
+	return c, nil
+}
+
+// encode returns the body encoded with the content encoding and its level,
+// the encoding must be supported by decodeBody
+func (c compression) encode(encoding string, body []byte) []byte {
+	switch strings.ToLower(encoding) {
+	case encodingGzip:
+		return fasthttp.AppendGzipBytesLevel(nil, body, c.gzipLevel)
+	case encodingDeflate:
+		return fasthttp.AppendDeflateBytesLevel(nil, body, c.deflateLevel)
+	case encodingBrotli:
+		return fasthttp.AppendBrotliBytesLevel(nil, body, c.brotliLevel)
+	}
+
+	return body
+}
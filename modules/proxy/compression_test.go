@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+func testCompression(t *testing.T) compression {
+	c, err := newCompression(config.Compression{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func Test_newCompression(t *testing.T) {
+	defaults := compression{
+		gzipLevel:    fasthttp.CompressDefaultCompression,
+		deflateLevel: fasthttp.CompressDefaultCompression,
+		brotliLevel:  fasthttp.CompressBrotliDefaultCompression,
+	}
+
+	tests := []struct {
+		name string
+		cfg  config.Compression
+		want compression
+		err  bool
+	}{
+		{
+			name: "Default",
+			cfg:  config.Compression{},
+			want: defaults,
+		},
+		{
+			name: "Gzip",
+			cfg:  config.Compression{Algorithm: "gzip", Level: 9},
+			want: compression{gzipLevel: 9, deflateLevel: defaults.deflateLevel, brotliLevel: defaults.brotliLevel},
+		},
+		{
+			name: "Deflate",
+			cfg:  config.Compression{Algorithm: "deflate", Level: 1},
+			want: compression{gzipLevel: defaults.gzipLevel, deflateLevel: 1, brotliLevel: defaults.brotliLevel},
+		},
+		{
+			name: "Brotli",
+			cfg:  config.Compression{Algorithm: "BR", Level: 11},
+			want: compression{gzipLevel: defaults.gzipLevel, deflateLevel: defaults.deflateLevel, brotliLevel: 11},
+		},
+		{
+			name: "AlgorithmWithoutLevel",
+			cfg:  config.Compression{Algorithm: "br"},
+			want: defaults,
+		},
+		{
+			name: "LevelWithoutAlgorithm",
+			cfg:  config.Compression{Level: 5},
+			err:  true,
+		},
+		{
+			name: "InvalidAlgorithm",
+			cfg:  config.Compression{Algorithm: "zstd", Level: 5},
+			err:  true,
+		},
+		{
+			name: "GzipLevelTooHigh",
+			cfg:  config.Compression{Algorithm: "gzip", Level: 11},
+			err:  true,
+		},
+		{
+			name: "NegativeLevel",
+			cfg:  config.Compression{Algorithm: "br", Level: -1},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newCompression(tt.cfg)
+			if (err != nil) != tt.err {
+				t.Fatalf("newCompression() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if !tt.err && c != tt.want {
+				t.Errorf("newCompression() == '%+v', want '%+v'", c, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompression_encode(t *testing.T) {
+	body := []byte("<html><body>Kratgo Kratgo Kratgo Kratgo Kratgo Kratgo</body></html>")
+
+	for _, encoding := range []string{"gzip", "deflate", "br"} {
+		t.Run(encoding, func(t *testing.T) {
+			fast, err := newCompression(config.Compression{Algorithm: encoding, Level: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			encoded := fast.encode(encoding, body)
+
+			decoded, err := decodeBody(encoding, encoded, 1024)
+			if err != nil {
+				t.Fatalf("compression.encode() body is not encoded with '%s': %v", encoding, err)
+			}
+
+			if string(decoded) != string(body) {
+				t.Errorf("compression.encode() decoded body == '%s', want '%s'", decoded, body)
+			}
+		})
+	}
+
+	c := testCompression(t)
+
+	if encoded := c.encode("identity", body); string(encoded) != string(body) {
+		t.Errorf("compression.encode() unknown encoding body == '%s', want '%s'", encoded, body)
+	}
+}
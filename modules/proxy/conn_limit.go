@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+)
+
+var errConnLimit = errors.New("Too many connections from the client IP")
+
+// newConnLimiter returns the limiter of the simultaneous connections of each client IP,
+// or nil if it's disabled
+func newConnLimiter(maxConns int, allowIPs []string) (*connLimiter, error) {
+	if maxConns < 0 {
+		return nil, fmt.Errorf("Proxy.MaxConnsPerIP must be greater than or equal to 0")
+	}
+
+	if maxConns == 0 {
+		return nil, nil
+	}
+
+	l := &connLimiter{
+		maxConns: maxConns,
+		conns:    make(map[string]int),
+	}
+
+	nets, err := parseIPNets(allowIPs, "max connections per IP allowed IP")
+	if err != nil {
+		return nil, err
+	}
+	l.allowIPs = nets
+
+	return l, nil
+}
+
+// acquire counts a new connection of the IP, it's false if the IP is over the limit
+func (l *connLimiter) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conns[ip] >= l.maxConns {
+		return false
+	}
+
+	l.conns[ip]++
+
+	return true
+}
+
+func (l *connLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conns[ip] <= 1 {
+		delete(l.conns, ip)
+	} else {
+		l.conns[ip]--
+	}
+}
+
+func (l *connLimiter) allowed(ip net.IP) bool {
+	return ipNetsContain(l.allowIPs, ip)
+}
+
+func (l *connLimiter) rejectedConns() uint64 {
+	if l == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&l.rejected)
+}
+
+// newConnLimitListener returns the listener that limits the simultaneous connections of each client IP
+func newConnLimitListener(ln net.Listener, limiter *connLimiter) net.Listener {
+	return &connLimitListener{Listener: ln, limiter: limiter}
+}
+
+// Accept ...
+func (ln *connLimitListener) Accept() (net.Conn, error) {
+	c, err := ln.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	// The connection is counted on the first use, as the client IP could be in the PROXY protocol header,
+	// that must not be read in the accept loop
+	return &connLimitConn{Conn: c, limiter: ln.limiter}, nil
+}
+
+func (c *connLimitConn) acquire() {
+	c.once.Do(func() {
+		ip := remoteIP(c.Conn.RemoteAddr())
+		if ip == nil || c.limiter.allowed(ip) {
+			return
+		}
+
+		c.ip = ip.String()
+		if !c.limiter.acquire(c.ip) {
+			atomic.AddUint64(&c.limiter.rejected, 1)
+			c.ip = ""
+			c.err = fmt.Errorf("%v: %s", errConnLimit, ip)
+		}
+	})
+}
+
+// Read ...
+func (c *connLimitConn) Read(b []byte) (int, error) {
+	c.acquire()
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	return c.Conn.Read(b)
+}
+
+// Close ...
+func (c *connLimitConn) Close() error {
+	// Never counted after closing it
+	c.once.Do(func() {})
+
+	c.closeOnce.Do(func() {
+		if c.ip != "" {
+			c.limiter.release(c.ip)
+		}
+	})
+
+	return c.Conn.Close()
+}
+
+// remoteIP returns the IP of the address, or nil if it hasn't it (ex: unix sockets)
+func remoteIP(addr net.Addr) net.IP {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+
+	return net.ParseIP(host)
+}
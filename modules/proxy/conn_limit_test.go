@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func Test_newConnLimiter(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxConns int
+		allowIPs []string
+		wantNil  bool
+		err      bool
+	}{
+		{name: "Disabled", maxConns: 0, wantNil: true},
+		{name: "Enabled", maxConns: 10, allowIPs: []string{"10.0.0.0/8", "192.168.1.1"}},
+		{name: "Negative", maxConns: -1, err: true},
+		{name: "InvalidAllowIP", maxConns: 10, allowIPs: []string{"10.0.0"}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := newConnLimiter(tt.maxConns, tt.allowIPs)
+			if (err != nil) != tt.err {
+				t.Fatalf("newConnLimiter() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if !tt.err && (l == nil) != tt.wantNil {
+				t.Errorf("newConnLimiter() is nil == '%v', want '%v'", l == nil, tt.wantNil)
+			}
+		})
+	}
+}
+
+func Test_connLimitListener(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowIPs []string
+		wantErr  bool
+	}{
+		{name: "Limited", wantErr: true},
+		{name: "Allowed", allowIPs: []string{"127.0.0.0/8"}, wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, err := newConnLimiter(2, tt.allowIPs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rawLn, err := net.Listen("tcp4", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ln := newConnLimitListener(rawLn, limiter)
+			defer ln.Close()
+
+			accept := func() (net.Conn, error) {
+				client, err := net.Dial("tcp4", rawLn.Addr().String())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer client.Close()
+
+				if _, err := client.Write([]byte("x")); err != nil {
+					t.Fatal(err)
+				}
+
+				c, err := ln.Accept()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				_, err = c.Read(make([]byte, 1))
+
+				return c, err
+			}
+
+			var conns []net.Conn
+			for i := 0; i < 2; i++ {
+				c, err := accept()
+				if err != nil {
+					t.Fatalf("connLimitListener.Accept() connection %d error: %v", i, err)
+				}
+
+				conns = append(conns, c)
+			}
+
+			c, err := accept()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("connLimitListener.Accept() over the limit error == '%v', want '%v'", err, tt.wantErr)
+			}
+			c.Close()
+
+			if tt.wantErr && !strings.Contains(err.Error(), errConnLimit.Error()) {
+				t.Errorf("connLimitListener.Accept() over the limit error == '%v', want '%v'", err, errConnLimit)
+			}
+
+			var wantRejected uint64
+			if tt.wantErr {
+				wantRejected = 1
+			}
+
+			if rejected := limiter.rejectedConns(); rejected != wantRejected {
+				t.Errorf("connLimiter.rejectedConns() == '%d', want '%d'", rejected, wantRejected)
+			}
+
+			// Released on close, so a new connection is allowed
+			conns[0].Close()
+			conns[0].Close()
+
+			c, err = accept()
+			if err != nil {
+				t.Errorf("connLimitListener.Accept() after close error: %v", err)
+			}
+			c.Close()
+
+			conns[1].Close()
+
+			if n := len(limiter.conns); n != 0 {
+				t.Errorf("connLimiter.conns == '%d', want '%d'", n, 0)
+			}
+		})
+	}
+}
@@ -1,12 +1,202 @@
 package proxy
 
+import "time"
+
 const proxyReqHeaderKey = "X-Kratgo-Cache"
 const proxyReqHeaderValue = "true"
 
 const headerLocation = "Location"
 const headerContentEncoding = "Content-Encoding"
+const headerAge = "Age"
+const headerContentLength = "Content-Length"
+const headerTransferEncoding = "Transfer-Encoding"
+const headerTrailer = "Trailer"
+const headerRange = "Range"
+const headerIfRange = "If-Range"
+const headerContentRange = "Content-Range"
+const headerAcceptRanges = "Accept-Ranges"
+const headerETag = "ETag"
+const headerLastModified = "Last-Modified"
+const headerIfNoneMatch = "If-None-Match"
+const headerIfModifiedSince = "If-Modified-Since"
+const headerXForwardedFor = "X-Forwarded-For"
+const headerSurrogateControl = "Surrogate-Control"
+const headerSurrogateKey = "Surrogate-Key"
+const headerLink = "Link"
+
+const clientIPUserValueKey = "kratgoClientIP"
+const requestIDUserValueKey = "kratgoRequestID"
+const benchEchoUserValueKey = "kratgoBenchEcho"
+const staleRefreshUserValueKey = "kratgoStaleRefresh"
+
+// headerWarning is set in the responses served in the stale grace, see RFC 7234, section 5.5.1
+const headerWarning = "Warning"
+const warningStale = `110 - "Response is Stale"`
+const prefetchUserValueKey = "kratgoPrefetch"
+
+// traceLogPrefix is the prefix of the debug logs with the decision trail of the requests, to grep them
+const traceLogPrefix = "kratgo-trace:"
+
+// Cache lookups of the decision trail
+const (
+	traceLookupSkipped = "skip"
+	traceLookupHit     = "hit"
+	traceLookupStale   = "stale"
+	traceLookupExpired = "expired"
+	traceLookupMiss    = "miss"
+	traceLookupError   = "error"
+)
+
+// Reasons of the decision trail to store or not the backend responses
+const (
+	traceStoreSaved            = "stored"
+	traceStoreNocache          = "nocache"
+	traceStoreCacheOnlyWhen    = "cacheOnlyWhen"
+	traceStoreStatusCode       = "status"
+	traceStoreContentType      = "contentType"
+	traceStoreMemoryPressure   = "memoryPressure"
+	traceStoreSurrogateControl = "surrogateControl"
+	traceStoreTooLarge         = "tooLarge"
+	traceStoreUncacheable      = "uncacheable"
+	traceStorePurged           = "purged"
+	traceStoreRedirect         = "redirect"
+	traceStoreRevalidated      = "revalidated"
+	traceStoreError            = "error"
+)
+
+const (
+	spanNameRequest     = "kratgo.request"
+	spanNameCacheLookup = "kratgo.cache.lookup"
+	spanNameBackend     = "kratgo.backend"
+)
+
+// canaryBuckets is the number of buckets of the canary, to support percents with two decimals
+const canaryBuckets = 10000
+
+const canaryVariantPrefix = "canary;"
+
+const poolVariantPrefix = "pool="
+
+const privateVariantPrefix = "private="
+
+const deviceVariantPrefix = "device="
+
+const bodyHashVariantPrefix = "body:"
+const defaultBodyHashMaxBodySize = 64 * 1024
+
+const benchEchoVariantPrefix = "bench-echo;"
+const benchEchoBody = "Kratgo bench echo"
+
+const defaultBodyRewriteMaxBodySize = 1024 * 1024
+
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+	encodingBrotli  = "br"
+)
+
+const defaultMaxPooledEvalParams = 64
+const defaultMaxPooledBufferSize = 4096
+
+// PROXY protocol headers, see https://www.haproxy.org/download/2.0/doc/proxy-protocol.txt
+var proxyProtocolV1Prefix = []byte("PROXY ")
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const proxyProtocolV1MaxLength = 107
+const proxyProtocolHeaderTimeout = 10 * time.Second
+
+const (
+	proxyProtocolV2CmdLocal = 0x0
+	proxyProtocolV2CmdProxy = 0x1
+
+	proxyProtocolV2FamilyInet  = 0x1
+	proxyProtocolV2FamilyInet6 = 0x2
+)
+
+const schemeHTTP = "http"
+const schemeHTTPS = "https"
+
+const defaultMaintenanceContentType = "text/html; charset=utf-8"
+const defaultMaintenanceBody = "Service under maintenance"
+
+const headerRetryAfter = "Retry-After"
+
+// maxRetryAfter is the max time that a backend is skipped by the "Retry-After" of its responses
+const maxRetryAfter = 5 * time.Minute
+
+const defaultDenyContentType = "text/plain; charset=utf-8"
+
+// rateLimitSweepInterval is the interval to delete the idle buckets of the rate limits
+const rateLimitSweepInterval = time.Minute
+
+const (
+	defaultPrefetchWorkers       = 4
+	defaultPrefetchQueueSize     = 100
+	defaultPrefetchMaxPerRequest = 5
+)
+
+// prefetchRequestHeaders are removed from the copies of the requests, as they are for the original URL
+var prefetchRequestHeaders = []string{headerRange, headerIfRange, headerIfNoneMatch, headerIfModifiedSince}
+
+const defaultStaticContentType = "text/plain; charset=utf-8"
+const staticFilesCheckInterval = time.Second
+
+const (
+	errorFormatText = "text"
+	errorFormatJSON = "json"
+)
+
+const contentTypeJSON = "application/json"
+
+const (
+	uriNormalizationRaw       = "raw"
+	uriNormalizationDecode    = "decode"
+	uriNormalizationNormalize = "normalize"
+)
+
+const defaultRequestIDHeader = "X-Request-ID"
+const maxRequestIDLength = 128
+
+const defaultRetryBudgetWindow = 10 * time.Second
+
+const defaultMaxClientTimeout = 30 * time.Second
+
+// headerGRPCTimeout is the timeout header of gRPC, with its own units (ex: 100m is 100 milliseconds)
+const headerGRPCTimeout = "grpc-timeout"
+
+// Latency histogram with 8 sub-buckets per power of two (12.5% of precision),
+// enough for values until 2^40 microseconds
+const histogramSubBucketBits = 3
+const histogramSubBuckets = 1 << histogramSubBucketBits
+const histogramBuckets = 40 * histogramSubBuckets
+
+// Upper bounds in bytes of the body size buckets: 1KB, 10KB, 100KB, 1MB and 10MB
+var defaultSizeBuckets = []int{1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20}
+
+var rangeUnitPrefix = []byte("bytes=")
+
+// maxByteRanges is the max ranges of a request, the requests with more are served with the full body
+const maxByteRanges = 16
+
+var surrogateMaxAgePrefix = []byte("max-age=")
+var surrogateNoStore = []byte("no-store")
 
 const (
 	setHeaderAction typeHeaderAction = iota
 	unsetHeaderAction
+	appendHeaderAction
+)
+
+const (
+	ruleTypeNocache       = "nocache"
+	ruleTypeCacheOnlyWhen = "cacheOnlyWhen"
+	ruleTypeSet           = "set"
+	ruleTypeUnset         = "unset"
+	ruleTypeRequestSet    = "request.set"
+	ruleTypeRequestUnset  = "request.unset"
+	ruleTypeAppend        = "append"
+	ruleTypeRequestAppend = "request.append"
+	ruleTypeDeny          = "deny"
+	ruleTypeDenyAllow     = "deny.allow"
+	ruleTypeRateLimit     = "rateLimit"
 )
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/valyala/fasthttp"
+)
+
+// newDeny returns the deny rules of the requests, or nil if there are not rules
+func (p *Proxy) newDeny() (*deny, error) {
+	cfg := p.fileConfig.Deny
+	if len(cfg.Rules) == 0 {
+		return nil, nil
+	}
+
+	d := &deny{
+		statusCode:  cfg.StatusCode,
+		body:        []byte(cfg.Body),
+		contentType: cfg.ContentType,
+	}
+
+	if d.statusCode == 0 {
+		d.statusCode = fasthttp.StatusForbidden
+	}
+
+	if len(d.body) == 0 {
+		d.body = []byte(fasthttp.StatusMessage(d.statusCode))
+	}
+
+	if d.contentType == "" {
+		d.contentType = defaultDenyContentType
+	}
+
+	var err error
+
+	if d.rules, err = p.parseRules(cfg.Rules); err != nil {
+		return nil, err
+	}
+
+	if d.allowRules, err = p.parseRules(cfg.Allow); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// serve writes the deny response if the request matches a deny rule and none of the allow rules
+func (d *deny) serve(ctx *fasthttp.RequestCtx, params *evalParams) (bool, error) {
+	if d == nil {
+		return false, nil
+	}
+
+	allowed, err := matchAny(ctx, d.allowRules, params)
+	if err != nil {
+		return false, fmt.Errorf("Invalid deny allow rule: %v", err)
+	} else if allowed {
+		return false, nil
+	}
+
+	denied, err := matchAny(ctx, d.rules, params)
+	if err != nil {
+		return false, fmt.Errorf("Invalid deny rule: %v", err)
+	} else if !denied {
+		return false, nil
+	}
+
+	ctx.SetStatusCode(d.statusCode)
+	ctx.SetContentType(d.contentType)
+	ctx.SetBody(d.body)
+
+	return true, nil
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxy_newDeny(t *testing.T) {
+	p, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.deny != nil {
+		t.Errorf("New() deny == '%+v', want nil without rules", p.deny)
+	}
+
+	p.fileConfig.Deny = config.Deny{Rules: []string{"$(path) == '/admin/'"}}
+
+	d, err := p.newDeny()
+	if err != nil {
+		t.Fatalf("Proxy.newDeny() unexpected error: %v", err)
+	}
+
+	if d.statusCode != fasthttp.StatusForbidden || string(d.body) != "Forbidden" || d.contentType != defaultDenyContentType {
+		t.Errorf("Proxy.newDeny() == '%+v', want the defaults", d)
+	}
+
+	p.fileConfig.Deny = config.Deny{Rules: []string{"$(path) == '/admin/'"}, Allow: []string{"$(unknown) == 'a'"}}
+
+	if _, err := p.newDeny(); err == nil {
+		t.Errorf("Proxy.newDeny() with invalid allow rule, want error")
+	}
+}
+
+func TestProxy_handler_Deny(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.Deny = config.Deny{
+		Rules:      []string{"$(path) =~ '^/admin/'", "$(req.header::User-Agent) == 'BadBot'"},
+		Allow:      []string{"$(req.header::X-Admin-Token) == 'secret'"},
+		StatusCode: fasthttp.StatusNotFound,
+		Body:       "Not here",
+	}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{body: []byte("backend"), statusCode: fasthttp.StatusOK}
+	p.backends = []fetcher{backend}
+	p.totalBackends = 1
+
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		denied  bool
+	}{
+		{name: "Path", path: "/admin/users/", denied: true},
+		{name: "Header", path: "/home/", headers: map[string]string{"User-Agent": "BadBot"}, denied: true},
+		{name: "Allowed", path: "/admin/users/", headers: map[string]string{"X-Admin-Token": "secret"}, denied: false},
+		{name: "NotDenied", path: "/home/", denied: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend.calls = 0
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.SetRequestURI(tt.path)
+			ctx.Request.Header.SetHost("www.kratgo.com")
+			for k, v := range tt.headers {
+				ctx.Request.Header.Set(k, v)
+			}
+
+			p.handler(ctx)
+
+			statusCode, body := fasthttp.StatusOK, "backend"
+			if tt.denied {
+				statusCode, body = fasthttp.StatusNotFound, "Not here"
+			}
+
+			if ctx.Response.StatusCode() != statusCode || string(ctx.Response.Body()) != body {
+				t.Errorf("Proxy.handler() == '%d' '%s', want '%d' '%s'", ctx.Response.StatusCode(), ctx.Response.Body(), statusCode, body)
+			}
+
+			if tt.denied && backend.calls != 0 {
+				t.Errorf("Proxy.handler() backend calls == '%d', want '%d'", backend.calls, 0)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+// newDeviceDetection returns nil if there are no devices, so all devices share the cached responses
+func newDeviceDetection(cfg config.DeviceDetection) (*deviceDetection, error) {
+	if len(cfg.Devices) == 0 {
+		return nil, nil
+	}
+
+	d := &deviceDetection{defaultDevice: cfg.Default, header: cfg.Header}
+
+	for _, dev := range cfg.Devices {
+		if dev.Name == "" {
+			return nil, fmt.Errorf("Proxy.DeviceDetection.Devices must have name, pattern '%s'", dev.Pattern)
+		}
+
+		regex, err := regexp.Compile(dev.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid device detection pattern '%s': %v", dev.Pattern, err)
+		}
+
+		d.devices = append(d.devices, device{name: dev.Name, regex: regex})
+	}
+
+	return d, nil
+}
+
+// device returns the name of the first device whose pattern matches the User-Agent of the request,
+// or the default one if none of them
+func (d *deviceDetection) device(ctx *fasthttp.RequestCtx) string {
+	userAgent := ctx.Request.Header.UserAgent()
+
+	for _, dev := range d.devices {
+		if dev.regex.Match(userAgent) {
+			return dev.name
+		}
+	}
+
+	return d.defaultDevice
+}
+
+// variant appends the device of the request to the cache variant, and sets it in the header
+// of the backend request. The header of the client is always replaced, so it could not choose the device
+func (d *deviceDetection) variant(ctx *fasthttp.RequestCtx, dst []byte) []byte {
+	if d == nil {
+		return dst
+	}
+
+	name := d.device(ctx)
+
+	if d.header != "" {
+		if name != "" {
+			ctx.Request.Header.Set(d.header, name)
+		} else {
+			ctx.Request.Header.Del(d.header)
+		}
+	}
+
+	if name == "" {
+		return dst
+	}
+
+	dst = append(dst, deviceVariantPrefix...)
+	dst = append(dst, name...)
+
+	return append(dst, ';')
+}
@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+// mockDeviceBackend responds the device of the requests, like a responsive site
+type mockDeviceBackend struct {
+	calls int
+}
+
+func (mock *mockDeviceBackend) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	mock.calls++
+
+	resp.SetBody(req.Header.Peek("X-Device"))
+
+	return nil
+}
+
+func testDeviceDetection() config.DeviceDetection {
+	return config.DeviceDetection{
+		Devices: []config.Device{
+			{Name: "tablet", Pattern: "(?i)ipad|tablet"},
+			{Name: "mobile", Pattern: "(?i)mobile|android"},
+		},
+		Default: "desktop",
+		Header:  "X-Device",
+	}
+}
+
+func TestProxy_newDeviceDetection(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.DeviceDetection
+		disabled bool
+		err      bool
+	}{
+		{name: "Ok", cfg: testDeviceDetection()},
+		{name: "Disabled", cfg: config.DeviceDetection{Default: "desktop"}, disabled: true},
+		{
+			name: "WithoutName",
+			cfg:  config.DeviceDetection{Devices: []config.Device{{Pattern: "Mobile"}}},
+			err:  true,
+		},
+		{
+			name: "InvalidPattern",
+			cfg:  config.DeviceDetection{Devices: []config.Device{{Name: "mobile", Pattern: "Mobile("}}},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.DeviceDetection = tt.cfg
+
+			p, err := New(cfg)
+			if (err != nil) != tt.err {
+				t.Fatalf("New() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if !tt.err && (p.deviceDetection == nil) != tt.disabled {
+				t.Errorf("Proxy.newDeviceDetection() == '%v', want nil '%v'", p.deviceDetection, tt.disabled)
+			}
+		})
+	}
+}
+
+func TestDeviceDetection_variant(t *testing.T) {
+	withoutDefault := testDeviceDetection()
+	withoutDefault.Default = ""
+
+	tests := []struct {
+		name       string
+		cfg        config.DeviceDetection
+		userAgent  string
+		header     string
+		want       string
+		wantHeader string
+	}{
+		{
+			name:       "Mobile",
+			cfg:        testDeviceDetection(),
+			userAgent:  "Mozilla/5.0 (Linux; Android 10) Mobile Safari/537.36",
+			want:       "device=mobile;",
+			wantHeader: "mobile",
+		},
+		{
+			name:       "FirstMatch",
+			cfg:        testDeviceDetection(),
+			userAgent:  "Mozilla/5.0 (iPad; CPU OS 13_2 like Mac OS X) Mobile/15E148",
+			want:       "device=tablet;",
+			wantHeader: "tablet",
+		},
+		{
+			name:       "Default",
+			cfg:        testDeviceDetection(),
+			userAgent:  "Mozilla/5.0 (X11; Linux x86_64) Firefox/80.0",
+			header:     "mobile",
+			want:       "device=desktop;",
+			wantHeader: "desktop",
+		},
+		{
+			name:      "WithoutDefault",
+			cfg:       withoutDefault,
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64) Firefox/80.0",
+			header:    "mobile",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newDeviceDetection(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.Header.SetUserAgent(tt.userAgent)
+			if tt.header != "" {
+				ctx.Request.Header.Set("X-Device", tt.header)
+			}
+
+			if variant := string(d.variant(ctx, nil)); variant != tt.want {
+				t.Errorf("deviceDetection.variant() == '%s', want '%s'", variant, tt.want)
+			}
+
+			if header := string(ctx.Request.Header.Peek("X-Device")); header != tt.wantHeader {
+				t.Errorf("deviceDetection.variant() header == '%s', want '%s'", header, tt.wantHeader)
+			}
+		})
+	}
+
+	if variant := (*deviceDetection)(nil).variant(new(fasthttp.RequestCtx), []byte("a=1;")); string(variant) != "a=1;" {
+		t.Errorf("deviceDetection.variant() without devices == '%s', want '%s'", variant, "a=1;")
+	}
+}
+
+func TestProxy_handler_DeviceDetection(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.DeviceDetection = testDeviceDetection()
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockDeviceBackend{}
+	p.backends = []fetcher{backend}
+	p.totalBackends = len(p.backends)
+
+	requests := []struct {
+		userAgent string
+		want      string
+	}{
+		{userAgent: "Mozilla/5.0 (Linux; Android 10) Mobile Safari/537.36", want: "mobile"},
+		{userAgent: "Mozilla/5.0 (X11; Linux x86_64) Firefox/80.0", want: "desktop"},
+		{userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 14_0) Mobile/15E148", want: "mobile"},
+		{userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/85.0", want: "desktop"},
+	}
+
+	for _, r := range requests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI("/responsive/")
+		ctx.Request.Header.SetHost("www.kratgo.com")
+		ctx.Request.Header.SetUserAgent(r.userAgent)
+
+		p.handler(ctx)
+
+		if body := string(ctx.Response.Body()); body != r.want {
+			t.Errorf("Proxy.handler() body with User-Agent '%s' == '%s', want '%s'", r.userAgent, body, r.want)
+		}
+	}
+
+	if backend.calls != 2 {
+		t.Errorf("Proxy.handler() backend calls == '%d', want '%d'", backend.calls, 2)
+	}
+}
@@ -16,11 +16,16 @@ func acquireEvalParams() *evalParams {
 
 func releaseEvalParams(ep *evalParams) {
 	ep.reset()
+	ep.peak = 0
 	evalParamsPool.Put(ep)
 }
 
 func (ep *evalParams) set(k string, v interface{}) {
 	ep.p[k] = v
+
+	if n := len(ep.p); n > ep.peak {
+		ep.peak = n
+	}
 }
 
 func (ep *evalParams) get(k string) (interface{}, bool) {
@@ -18,7 +18,7 @@ func TestReleaseEvalParams(t *testing.T) {
 
 	releaseEvalParams(ep)
 
-	if len(ep.p) > 0 {
+	if len(ep.p) > 0 || ep.peak > 0 {
 		t.Errorf("releaseEvalParams() entry has not been reset")
 	}
 }
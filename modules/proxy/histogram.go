@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+func newLatencyHistogram(name string) *latencyHistogram {
+	return &latencyHistogram{name: name}
+}
+
+// histogramIndex returns the bucket of the value, the first ones are exact
+// and the next ones are split in sub-buckets by each power of two
+func histogramIndex(v uint64) int {
+	if v < 2*histogramSubBuckets {
+		return int(v)
+	}
+
+	exp := bits.Len64(v) - (histogramSubBucketBits + 1)
+	idx := exp*histogramSubBuckets + int(v>>uint(exp))
+
+	if idx >= histogramBuckets {
+		return histogramBuckets - 1
+	}
+
+	return idx
+}
+
+// histogramUpperValue returns the highest value of the bucket
+func histogramUpperValue(idx int) uint64 {
+	if idx < 2*histogramSubBuckets {
+		return uint64(idx)
+	}
+
+	exp := uint(idx/histogramSubBuckets - 1)
+	top := uint64(idx%histogramSubBuckets + histogramSubBuckets)
+
+	return (top+1)<<exp - 1
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	if h == nil {
+		return
+	}
+
+	us := int64(d / time.Microsecond)
+	if us < 0 {
+		us = 0
+	}
+
+	atomic.AddUint64(&h.counts[histogramIndex(uint64(us))], 1)
+	atomic.AddUint64(&h.total, 1)
+}
+
+// percentile returns the value in microseconds under which are the given percent of the values
+func (h *latencyHistogram) percentile(percent float64) uint64 {
+	total := atomic.LoadUint64(&h.total)
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(percent / 100 * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var count uint64
+
+	for i := 0; i < histogramBuckets; i++ {
+		count += atomic.LoadUint64(&h.counts[i])
+
+		if count >= rank {
+			return histogramUpperValue(i)
+		}
+	}
+
+	return histogramUpperValue(histogramBuckets - 1)
+}
+
+func (h *latencyHistogram) summary() LatencySummary {
+	return LatencySummary{
+		Name:  h.name,
+		Count: atomic.LoadUint64(&h.total),
+		P50:   float64(h.percentile(50)) / 1000,
+		P95:   float64(h.percentile(95)) / 1000,
+		P99:   float64(h.percentile(99)) / 1000,
+	}
+}
+
+// sizeBuckets returns the upper bounds of the size buckets, or the default ones if empty.
+// They must be positive and in ascending order
+func sizeBuckets(bounds []int) ([]int, error) {
+	if len(bounds) == 0 {
+		return defaultSizeBuckets, nil
+	}
+
+	for i, b := range bounds {
+		if b <= 0 || (i > 0 && b <= bounds[i-1]) {
+			return nil, fmt.Errorf("Invalid size bucket '%d', the buckets must be positive and in ascending order", b)
+		}
+	}
+
+	return bounds, nil
+}
+
+func newSizeHistogram(bounds []int) *sizeHistogram {
+	return &sizeHistogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *sizeHistogram) record(size int) {
+	if h == nil {
+		return
+	}
+
+	i := sort.SearchInts(h.bounds, size)
+
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.total, 1)
+	atomic.AddUint64(&h.sum, uint64(size))
+}
+
+// summary returns the cumulative counts of the buckets, with the sizes lower or equal than their bound
+func (h *sizeHistogram) summary() *SizeSummary {
+	if h == nil {
+		return nil
+	}
+
+	s := &SizeSummary{
+		Buckets: make([]SizeBucket, len(h.bounds)),
+		Count:   atomic.LoadUint64(&h.total),
+		Sum:     atomic.LoadUint64(&h.sum),
+	}
+
+	var count uint64
+
+	for i, b := range h.bounds {
+		count += atomic.LoadUint64(&h.counts[i])
+		s.Buckets[i] = SizeBucket{LE: b, Count: count}
+	}
+
+	return s
+}
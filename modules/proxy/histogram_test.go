@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_histogramIndex(t *testing.T) {
+	values := []uint64{0, 1, 15, 16, 17, 31, 32, 1000, 123456, 1 << 39}
+
+	for _, v := range values {
+		idx := histogramIndex(v)
+		upper := histogramUpperValue(idx)
+
+		if upper < v {
+			t.Errorf("histogramUpperValue(histogramIndex(%d)) == '%d', want greater or equal", v, upper)
+		}
+
+		// Precision of the sub-buckets
+		if float64(upper-v) > float64(v)/histogramSubBuckets {
+			t.Errorf("histogramUpperValue(histogramIndex(%d)) == '%d', out of precision", v, upper)
+		}
+
+		if idx > 0 && histogramUpperValue(idx-1) >= v {
+			t.Errorf("histogramIndex(%d) == '%d', the previous bucket contains the value", v, idx)
+		}
+	}
+
+	if idx := histogramIndex(1 << 62); idx != histogramBuckets-1 {
+		t.Errorf("histogramIndex() overflow == '%d', want '%d'", idx, histogramBuckets-1)
+	}
+}
+
+func Test_latencyHistogram_percentile(t *testing.T) {
+	h := newLatencyHistogram("test")
+
+	if p := h.percentile(50); p != 0 {
+		t.Errorf("latencyHistogram.percentile() empty == '%d', want '%d'", p, 0)
+	}
+
+	for i := 1; i <= 100; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+
+	tests := []struct {
+		percent float64
+		want    uint64
+	}{
+		{percent: 50, want: 50000},
+		{percent: 95, want: 95000},
+		{percent: 99, want: 99000},
+	}
+
+	for _, tt := range tests {
+		p := h.percentile(tt.percent)
+
+		if p < tt.want || float64(p-tt.want) > float64(tt.want)/histogramSubBuckets {
+			t.Errorf("latencyHistogram.percentile(%v) == '%d', want '%d'", tt.percent, p, tt.want)
+		}
+	}
+
+	summary := h.summary()
+	if summary.Name != "test" || summary.Count != 100 {
+		t.Errorf("latencyHistogram.summary() == '%v'", summary)
+	}
+}
+
+func Test_sizeBuckets(t *testing.T) {
+	tests := []struct {
+		name    string
+		buckets []int
+		want    []int
+		err     bool
+	}{
+		{name: "Default", want: defaultSizeBuckets},
+		{name: "Custom", buckets: []int{100, 1000}, want: []int{100, 1000}},
+		{name: "NotPositive", buckets: []int{0, 1000}, err: true},
+		{name: "NotAscending", buckets: []int{1000, 100}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sizeBuckets(tt.buckets)
+			if (err != nil) != tt.err {
+				t.Fatalf("sizeBuckets() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sizeBuckets() == '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sizeHistogram_summary(t *testing.T) {
+	h := newSizeHistogram([]int{10, 100})
+
+	for _, size := range []int{0, 10, 11, 100, 5000} {
+		h.record(size)
+	}
+
+	want := &SizeSummary{
+		Buckets: []SizeBucket{{LE: 10, Count: 2}, {LE: 100, Count: 4}},
+		Count:   5,
+		Sum:     5121,
+	}
+
+	if summary := h.summary(); !reflect.DeepEqual(summary, want) {
+		t.Errorf("sizeHistogram.summary() == '%v', want '%v'", summary, want)
+	}
+
+	var disabled *sizeHistogram
+	disabled.record(10)
+
+	if summary := disabled.summary(); summary != nil {
+		t.Errorf("sizeHistogram.summary() disabled == '%v', want nil", summary)
+	}
+}
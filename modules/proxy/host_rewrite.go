@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/savsgio/kratgo/modules/config"
+)
+
+func newHostRewrites(cfg []config.HostRewrite) ([]hostRewrite, error) {
+	rewrites := make([]hostRewrite, 0, len(cfg))
+
+	for _, hr := range cfg {
+		if hr.Pattern == "" || hr.Host == "" {
+			return nil, fmt.Errorf("Invalid cache key host rewrite '%s', it must have pattern and host", hr.Pattern)
+		}
+
+		r := hostRewrite{pattern: []byte(strings.ToLower(hr.Pattern)), host: []byte(hr.Host)}
+
+		if strings.HasPrefix(hr.Pattern, "*.") {
+			r.wildcard = true
+			r.pattern = r.pattern[1:]
+		}
+
+		if bytes.IndexByte(r.pattern, '*') >= 0 {
+			return nil, fmt.Errorf("Invalid cache key host rewrite pattern '%s', the wildcard must be the first label", hr.Pattern)
+		}
+
+		rewrites = append(rewrites, r)
+	}
+
+	return rewrites, nil
+}
+
+func (r hostRewrite) match(host []byte) bool {
+	if !r.wildcard {
+		return bytes.EqualFold(host, r.pattern)
+	}
+
+	return len(host) > len(r.pattern) && bytes.EqualFold(host[len(host)-len(r.pattern):], r.pattern)
+}
+
+// rewriteHost returns the canonical host of the first rewrite that matches, or the same host
+func rewriteHost(rewrites []hostRewrite, host []byte) []byte {
+	for _, r := range rewrites {
+		if r.match(host) {
+			return r.host
+		}
+	}
+
+	return host
+}
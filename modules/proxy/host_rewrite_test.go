@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/savsgio/kratgo/modules/config"
+)
+
+func Test_newHostRewrites(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     []config.HostRewrite
+		wantErr bool
+	}{
+		{name: "Ok", cfg: []config.HostRewrite{{Pattern: "*.example.com", Host: "example.com"}}, wantErr: false},
+		{name: "Exact", cfg: []config.HostRewrite{{Pattern: "www.example.com", Host: "example.com"}}, wantErr: false},
+		{name: "WithoutPattern", cfg: []config.HostRewrite{{Host: "example.com"}}, wantErr: true},
+		{name: "WithoutHost", cfg: []config.HostRewrite{{Pattern: "*.example.com"}}, wantErr: true},
+		{name: "InnerWildcard", cfg: []config.HostRewrite{{Pattern: "www.*.com", Host: "example.com"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newHostRewrites(tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("newHostRewrites() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_rewriteHost(t *testing.T) {
+	rewrites, err := newHostRewrites([]config.HostRewrite{
+		{Pattern: "www.example.org", Host: "example.org"},
+		{Pattern: "*.example.com", Host: "example.com"},
+		{Pattern: "*.example.com:8080", Host: "example.com:8080"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "a.example.com", want: "example.com"},
+		{host: "a.b.example.com", want: "example.com"},
+		{host: "B.Example.COM", want: "example.com"},
+		{host: "example.com", want: "example.com"},
+		{host: "notexample.com", want: "notexample.com"},
+		{host: "a.example.com:8080", want: "example.com:8080"},
+		{host: "www.example.org", want: "example.org"},
+		{host: "api.example.org", want: "api.example.org"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := rewriteHost(rewrites, []byte(tt.host)); string(got) != tt.want {
+				t.Errorf("rewriteHost() == '%s', want '%s'", got, tt.want)
+			}
+		})
+	}
+}
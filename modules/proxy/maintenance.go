@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+func newMaintenance(cfg config.Maintenance) (*maintenance, error) {
+	m := &maintenance{
+		statusCode:  cfg.StatusCode,
+		body:        []byte(defaultMaintenanceBody),
+		contentType: cfg.ContentType,
+	}
+
+	if m.statusCode == 0 {
+		m.statusCode = fasthttp.StatusServiceUnavailable
+	}
+
+	if m.contentType == "" {
+		m.contentType = defaultMaintenanceContentType
+	}
+
+	if cfg.BodyFile != "" {
+		body, err := ioutil.ReadFile(cfg.BodyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read the maintenance body file '%s': %v", cfg.BodyFile, err)
+		}
+
+		m.body = body
+	}
+
+	if cfg.RetryAfter > 0 {
+		m.retryAfter = strconv.Itoa(cfg.RetryAfter)
+	}
+
+	for _, path := range cfg.AllowPaths {
+		m.allowPaths = append(m.allowPaths, []byte(path))
+	}
+
+	allowIPs, err := parseIPNets(cfg.AllowIPs, "maintenance allowed IP")
+	if err != nil {
+		return nil, err
+	}
+	m.allowIPs = allowIPs
+
+	m.set(cfg.Enabled)
+
+	return m, nil
+}
+
+func (m *maintenance) set(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+
+	atomic.StoreInt32(&m.enabled, v)
+}
+
+func (m *maintenance) get() bool {
+	return atomic.LoadInt32(&m.enabled) == 1
+}
+
+// allowed reports if the request must be served normally during the maintenance,
+// since its path starts with an allowed one or the client IP is allowed
+func (m *maintenance) allowed(p *Proxy, ctx *fasthttp.RequestCtx) bool {
+	path := ctx.URI().PathOriginal()
+
+	for _, prefix := range m.allowPaths {
+		if bytes.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return len(m.allowIPs) > 0 && ipNetsContain(m.allowIPs, p.clientIP(ctx))
+}
+
+// serve writes the maintenance response if it's enabled and the request is not allowed
+func (m *maintenance) serve(p *Proxy, ctx *fasthttp.RequestCtx) bool {
+	if !m.get() || m.allowed(p, ctx) {
+		return false
+	}
+
+	ctx.SetStatusCode(m.statusCode)
+	ctx.SetContentType(m.contentType)
+	ctx.SetBody(m.body)
+
+	if m.retryAfter != "" {
+		ctx.Response.Header.Set(headerRetryAfter, m.retryAfter)
+	}
+
+	return true
+}
+
+// SetMaintenance enables or disables the maintenance response for all requests
+func (p *Proxy) SetMaintenance(enabled bool) {
+	p.maintenance.set(enabled)
+
+	p.log.Infof("Maintenance mode enabled: %v", enabled)
+}
+
+// Maintenance reports if the maintenance mode is enabled
+func (p *Proxy) Maintenance() bool {
+	return p.maintenance.get()
+}
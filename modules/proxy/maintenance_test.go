@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+func Test_newMaintenance(t *testing.T) {
+	f, err := ioutil.TempFile("", "kratgo-maintenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString("<h1>Maintenance</h1>")
+	f.Close()
+
+	m, err := newMaintenance(config.Maintenance{BodyFile: f.Name(), RetryAfter: 120})
+	if err != nil {
+		t.Fatalf("newMaintenance() unexpected error: %v", err)
+	}
+
+	if string(m.body) != "<h1>Maintenance</h1>" {
+		t.Errorf("newMaintenance() body == '%s', want the body file", m.body)
+	}
+
+	if m.statusCode != fasthttp.StatusServiceUnavailable || m.contentType != defaultMaintenanceContentType || m.retryAfter != "120" {
+		t.Errorf("newMaintenance() == '%+v', want the defaults", m)
+	}
+
+	if m.get() {
+		t.Errorf("newMaintenance() is enabled, want disabled")
+	}
+
+	if _, err := newMaintenance(config.Maintenance{BodyFile: "/not/found"}); err == nil {
+		t.Errorf("newMaintenance() with not found body file, want error")
+	}
+
+	if _, err := newMaintenance(config.Maintenance{AllowIPs: []string{"invalid"}}); err == nil {
+		t.Errorf("newMaintenance() with invalid allowed IP, want error")
+	}
+}
+
+func TestProxy_handler_Maintenance(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.Maintenance = config.Maintenance{
+		Enabled:    true,
+		RetryAfter: 60,
+		AllowPaths: []string{"/health"},
+		AllowIPs:   []string{"10.0.0.0/8"},
+	}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{body: []byte("backend"), statusCode: fasthttp.StatusOK}
+	p.backends = []fetcher{backend}
+	p.totalBackends = 1
+
+	tests := []struct {
+		name        string
+		path        string
+		remoteIP    string
+		maintenance bool
+	}{
+		{name: "Maintenance", path: "/fast/", remoteIP: "1.2.3.4", maintenance: true},
+		{name: "AllowedPath", path: "/health/", remoteIP: "1.2.3.4", maintenance: false},
+		{name: "AllowedIP", path: "/fast/", remoteIP: "10.0.0.1", maintenance: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.cache.Reset()
+			backend.called = false
+
+			req := fasthttp.AcquireRequest()
+			req.SetRequestURI(tt.path)
+			req.Header.SetHost("www.kratgo.com")
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Init(req, &net.TCPAddr{IP: net.ParseIP(tt.remoteIP)}, nil)
+			fasthttp.ReleaseRequest(req)
+
+			p.handler(ctx)
+
+			if backend.called == tt.maintenance {
+				t.Errorf("Proxy.handler() backend called == '%v', want '%v'", backend.called, !tt.maintenance)
+			}
+
+			if !tt.maintenance {
+				return
+			}
+
+			if statusCode := ctx.Response.StatusCode(); statusCode != fasthttp.StatusServiceUnavailable {
+				t.Errorf("Proxy.handler() status code == '%d', want '%d'", statusCode, fasthttp.StatusServiceUnavailable)
+			}
+
+			if v := string(ctx.Response.Header.Peek(headerRetryAfter)); v != "60" {
+				t.Errorf("Proxy.handler() Retry-After == '%s', want '%s'", v, "60")
+			}
+
+			if body := string(ctx.Response.Body()); body != defaultMaintenanceBody {
+				t.Errorf("Proxy.handler() body == '%s', want '%s'", body, defaultMaintenanceBody)
+			}
+		})
+	}
+
+	p.SetMaintenance(false)
+
+	if p.Maintenance() {
+		t.Fatal("Proxy.Maintenance() is enabled, want disabled")
+	}
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/fast/")
+	ctx.Request.Header.SetHost("www.kratgo.com")
+
+	p.handler(ctx)
+
+	if body := string(ctx.Response.Body()); body != "backend" {
+		t.Errorf("Proxy.handler() body == '%s', want '%s'", body, "backend")
+	}
+}
@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+// newPrefetch returns nil if it's not enabled, so the hints of the backend responses are ignored
+func newPrefetch(cfg config.Prefetch) (*prefetch, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	if cfg.Workers < 0 || cfg.QueueSize < 0 || cfg.MaxPerRequest < 0 {
+		return nil, fmt.Errorf("Proxy.Prefetch workers, queueSize and maxPerRequest must be 0 (default) or greater")
+	}
+
+	pf := &prefetch{
+		header:        cfg.Header,
+		workers:       cfg.Workers,
+		maxPerRequest: cfg.MaxPerRequest,
+	}
+
+	if pf.header == "" {
+		pf.header = headerLink
+	}
+	pf.link = strings.EqualFold(pf.header, headerLink)
+
+	if pf.workers == 0 {
+		pf.workers = defaultPrefetchWorkers
+	}
+
+	if pf.maxPerRequest == 0 {
+		pf.maxPerRequest = defaultPrefetchMaxPerRequest
+	}
+
+	queueSize := cfg.QueueSize
+	if queueSize == 0 {
+		queueSize = defaultPrefetchQueueSize
+	}
+	pf.queue = make(chan *fasthttp.RequestCtx, queueSize)
+
+	return pf, nil
+}
+
+// runPrefetchWorkers fetches the queued requests through the handler, so they are cached like the client ones
+func (p *Proxy) runPrefetchWorkers() {
+	for i := 0; i < p.prefetch.workers; i++ {
+		go func() {
+			for ctx := range p.prefetch.queue {
+				p.handler(ctx)
+				p.prefetch.pending.Delete(ctx.UserValue(prefetchUserValueKey))
+			}
+		}()
+	}
+}
+
+// prefetchHints queues the background requests of the URLs hinted by the backend response,
+// with a copy of the request headers, so they are cached with the same variant.
+// The prefetched responses never queue more requests
+func (p *Proxy) prefetchHints(ctx *fasthttp.RequestCtx, pt *proxyTools) {
+	pf := p.prefetch
+	if pf == nil || ctx.UserValue(prefetchUserValueKey) != nil || ctx.Response.StatusCode() != fasthttp.StatusOK {
+		return
+	}
+
+	var hints [][]byte
+
+	ctx.Response.Header.VisitAll(func(k, v []byte) {
+		if strings.EqualFold(string(k), pf.header) {
+			hints = appendPrefetchHints(hints, v, pf.link)
+		}
+	})
+
+	if len(hints) > pf.maxPerRequest {
+		hints = hints[:pf.maxPerRequest]
+	}
+
+	for _, uri := range hints {
+		key := string(ctx.Host()) + string(uri)
+		if _, loaded := pf.pending.LoadOrStore(key, struct{}{}); loaded {
+			continue
+		}
+
+		prefetchCtx := new(fasthttp.RequestCtx)
+		ctx.Request.CopyTo(&prefetchCtx.Request)
+		prefetchCtx.Request.Header.SetMethod(fasthttp.MethodGet)
+		prefetchCtx.Request.SetRequestURIBytes(uri)
+		prefetchCtx.Request.ResetBody()
+
+		for _, header := range prefetchRequestHeaders {
+			prefetchCtx.Request.Header.Del(header)
+		}
+
+		prefetchCtx.SetUserValue(prefetchUserValueKey, key)
+
+		select {
+		case pf.queue <- prefetchCtx:
+		default:
+			pf.pending.Delete(key)
+
+			if p.log.DebugEnabled() {
+				p.log.Debugf("[%s] Prefetch queue is full, '%s' is not prefetched", pt.requestID, uri)
+			}
+		}
+	}
+
+	if !pf.link {
+		// The custom header is only for Kratgo, so it's never sent to the client nor cached.
+		// Deleted at the end, as the hints point to its value
+		ctx.Response.Header.Del(pf.header)
+	}
+}
+
+// appendPrefetchHints appends the paths of the comma separated values of the header,
+// in the Link format (ex: </next>; rel=prefetch) or plain (ex: /next).
+// Only the paths of the same host are prefetched, not the absolute URLs
+func appendPrefetchHints(dst [][]byte, value []byte, link bool) [][]byte {
+	for _, hint := range bytes.Split(value, []byte(",")) {
+		hint = bytes.TrimSpace(hint)
+
+		if link {
+			params := bytes.Split(hint, []byte(";"))
+			target := bytes.TrimSpace(params[0])
+
+			if len(target) < 2 || target[0] != '<' || target[len(target)-1] != '>' || !isPrefetchLink(params[1:]) {
+				continue
+			}
+
+			hint = target[1 : len(target)-1]
+		}
+
+		// "//host/path" is an absolute URL without scheme
+		if len(hint) > 0 && hint[0] == '/' && (len(hint) == 1 || hint[1] != '/') {
+			dst = append(dst, hint)
+		}
+	}
+
+	return dst
+}
+
+// isPrefetchLink reports if the params of the link have rel=prefetch, quoted or not
+func isPrefetchLink(params [][]byte) bool {
+	for _, param := range params {
+		param = bytes.TrimSpace(param)
+
+		i := bytes.IndexByte(param, '=')
+		if i < 0 || !bytes.EqualFold(bytes.TrimSpace(param[:i]), []byte("rel")) {
+			continue
+		}
+
+		// The rel could have several space separated types, ex: rel="prefetch next"
+		for _, rel := range bytes.Fields(bytes.Trim(bytes.TrimSpace(param[i+1:]), `"`)) {
+			if bytes.EqualFold(rel, []byte("prefetch")) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
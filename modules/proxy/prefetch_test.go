@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/cache"
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxy_newPrefetch(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.Prefetch
+		disabled bool
+		link     bool
+		err      bool
+	}{
+		{name: "Link", cfg: config.Prefetch{Enabled: true}, link: true},
+		{name: "CustomHeader", cfg: config.Prefetch{Enabled: true, Header: "X-Prefetch"}},
+		{name: "Disabled", cfg: config.Prefetch{Workers: 2}, disabled: true},
+		{name: "InvalidWorkers", cfg: config.Prefetch{Enabled: true, Workers: -1}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.Prefetch = tt.cfg
+
+			p, err := New(cfg)
+			if (err != nil) != tt.err {
+				t.Fatalf("New() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if tt.err {
+				return
+			}
+
+			if (p.prefetch == nil) != tt.disabled {
+				t.Fatalf("Proxy.newPrefetch() == '%v', want nil '%v'", p.prefetch, tt.disabled)
+			}
+
+			if !tt.disabled && p.prefetch.link != tt.link {
+				t.Errorf("Proxy.newPrefetch() link == '%v', want '%v'", p.prefetch.link, tt.link)
+			}
+		})
+	}
+}
+
+func Test_appendPrefetchHints(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		link  bool
+		want  []string
+	}{
+		{
+			name:  "Link",
+			value: `</next/>; rel=prefetch, </style.css>; rel=preload, </other/?page=2>; rel="prefetch next"`,
+			link:  true,
+			want:  []string{"/next/", "/other/?page=2"},
+		},
+		{
+			name:  "LinkAbsoluteURL",
+			value: `<https://www.kratgo.com/next/>; rel=prefetch, <//www.kratgo.com/next/>; rel=prefetch`,
+			link:  true,
+		},
+		{
+			name:  "LinkWithoutRel",
+			value: `</next/>`,
+			link:  true,
+		},
+		{
+			name:  "Plain",
+			value: "/next/, /other/, https://www.kratgo.com/",
+			want:  []string{"/next/", "/other/"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, hint := range appendPrefetchHints(nil, []byte(tt.value), tt.link) {
+				got = append(got, string(hint))
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("appendPrefetchHints() == '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxy_handler_Prefetch(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.Prefetch = config.Prefetch{Enabled: true, Header: "X-Prefetch", Workers: 1, MaxPerRequest: 1}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{
+		body:       []byte("Kratgo"),
+		statusCode: fasthttp.StatusOK,
+		headers:    map[string][]byte{"X-Prefetch": []byte("/next/, /skipped/")},
+	}
+	p.backends = []fetcher{backend}
+	p.totalBackends = len(p.backends)
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/page/")
+	ctx.Request.Header.SetHost("www.kratgo.com")
+
+	p.handler(ctx)
+
+	if v := ctx.Response.Header.Peek("X-Prefetch"); len(v) > 0 {
+		t.Errorf("Proxy.handler() header '%s' == '%s', want it removed", "X-Prefetch", v)
+	}
+
+	cached := func(path string) bool {
+		entry := cache.AcquireEntry()
+		defer cache.ReleaseEntry(entry)
+
+		if err := p.cache.Get("www.kratgo.com", entry); err != nil {
+			t.Fatal(err)
+		}
+
+		return entry.GetResponse([]byte(path)) != nil
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !cached("/next/") {
+		if time.Now().After(deadline) {
+			t.Fatal("Proxy.handler() hinted URL is not prefetched")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Waits until the worker finishes the request
+	for {
+		if _, pending := p.prefetch.pending.Load("www.kratgo.com/next/"); !pending {
+			break
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if backend.calls != 2 {
+		t.Errorf("Proxy.handler() backend calls == '%d', want '%d'", backend.calls, 2)
+	}
+
+	if cached("/skipped/") {
+		t.Error("Proxy.handler() prefetched more URLs than maxPerRequest")
+	}
+
+	if uri := string(backend.uri); uri != "/next/" {
+		t.Errorf("Proxy.handler() backend request uri == '%s', want '%s'", uri, "/next/")
+	}
+}
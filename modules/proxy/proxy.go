@@ -1,28 +1,40 @@
 package proxy
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/savsgio/kratgo/modules/cache"
 	"github.com/savsgio/kratgo/modules/config"
+	"github.com/savsgio/kratgo/modules/tracing"
 
 	logger "github.com/savsgio/go-logger/v2"
+	"github.com/savsgio/gotils"
 	"github.com/savsgio/govaluate/v3"
 	"github.com/valyala/fasthttp"
 )
 
 // New ...
 func New(cfg Config) (*Proxy, error) {
-	if len(cfg.FileConfig.BackendAddrs) == 0 {
-		return nil, fmt.Errorf("Proxy.BackendAddrs configuration is mandatory")
+	if len(cfg.FileConfig.BackendAddrs) == 0 && len(cfg.FileConfig.BackendPools) == 0 {
+		return nil, fmt.Errorf("Proxy.BackendAddrs or Proxy.BackendPools configuration is mandatory")
 	}
 
 	p := new(Proxy)
 	p.fileConfig = cfg.FileConfig
 
 	log := logger.New("kratgo", cfg.LogLevel, cfg.LogOutput)
+	p.debug = cfg.LogLevel == logger.DEBUG
 
 	p.server = &fasthttp.Server{
 		Handler: p.handler,
@@ -31,32 +43,229 @@ func New(cfg Config) (*Proxy, error) {
 	}
 
 	p.cache = cfg.Cache
+	p.cacheStoreErrors = new(uint64)
+	p.cacheTooLarge = new(uint64)
+	p.cacheReadErrors = new(uint64)
 	p.httpScheme = cfg.HTTPScheme
+	p.evalVars = cfg.EvalVars
+	p.tracer = cfg.Tracer
 	p.log = log
 
+	p.backendOptions = backendOptions{
+		dialTimeout:         time.Duration(p.fileConfig.DialTimeout) * time.Millisecond,
+		maxIdleConnDuration: time.Duration(p.fileConfig.MaxIdleConnDuration) * time.Second,
+		maxConnDuration:     time.Duration(p.fileConfig.MaxConnDuration) * time.Second,
+		maxResponseBodySize: p.fileConfig.MaxResponseBodySize,
+		tls:                 p.fileConfig.BackendTLS,
+	}
+
 	for _, addr := range p.fileConfig.BackendAddrs {
-		p.backends = append(p.backends, &fasthttp.HostClient{Addr: addr})
+		backend, err := newBackend(addr, p.backendOptions)
+		if err != nil {
+			return nil, err
+		}
+
+		p.backends = append(p.backends, backend)
+		p.backendLatencies = append(p.backendLatencies, newLatencyHistogram(addr))
 	}
 	p.totalBackends = len(p.backends)
+	p.backendHeaders = newBackendHeaders(p.fileConfig.BackendHeaders)
+	p.backendKeepAlive = p.fileConfig.BackendKeepAlive == nil || *p.fileConfig.BackendKeepAlive
+
+	trustedProxies, err := parseTrustedProxies(p.fileConfig.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	p.trustedProxies = trustedProxies
+	p.retryBudget = newRetryBudget(p.fileConfig.RetryBudget)
+
+	p.backendLimiter, err = newBackendLimiter(p.fileConfig.MaxConcurrentBackendRequests, p.fileConfig.BackendQueueTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.retryPolicy, err = newRetryPolicy(p.fileConfig.RetryPolicy); err != nil {
+		return nil, err
+	}
+
+	if err := validatePurgeOnStatus(p.fileConfig.PurgeOnStatus); err != nil {
+		return nil, err
+	}
+
+	for _, code := range p.fileConfig.RetryableStatusCodes {
+		if code < fasthttp.StatusContinue || code > 599 {
+			return nil, fmt.Errorf("Invalid retryable status code '%d'", code)
+		}
+	}
+
+	if len(p.fileConfig.CacheKeyQueryParams) > 0 && len(p.fileConfig.IgnoreQueryParams) > 0 {
+		return nil, fmt.Errorf("Proxy.CacheKeyQueryParams and Proxy.IgnoreQueryParams could not be used together")
+	}
+
+	p.slowRequestThreshold = time.Duration(p.fileConfig.SlowRequestThreshold) * time.Millisecond
+
+	p.requestIDHeader = p.fileConfig.RequestIDHeader
+	if p.requestIDHeader == "" {
+		p.requestIDHeader = defaultRequestIDHeader
+	}
+
+	p.clientTimeoutHeader = p.fileConfig.ClientTimeoutHeader
+	p.maxClientTimeout = time.Duration(p.fileConfig.MaxClientTimeout) * time.Millisecond
+	if p.maxClientTimeout <= 0 {
+		p.maxClientTimeout = defaultMaxClientTimeout
+	}
+
+	canary, err := p.newCanary()
+	if err != nil {
+		return nil, err
+	}
+	p.canary = canary
+
+	backendPools, err := p.newBackendPools()
+	if err != nil {
+		return nil, err
+	}
+	p.backendPools = backendPools
+
+	if err := p.setNoMatchBehavior(); err != nil {
+		return nil, err
+	}
+
+	if err := p.setRequireHost(); err != nil {
+		return nil, err
+	}
+
+	if p.fileConfig.SizeMetrics.Enabled {
+		buckets, err := sizeBuckets(p.fileConfig.SizeMetrics.Buckets)
+		if err != nil {
+			return nil, err
+		}
+
+		p.requestSizes = newSizeHistogram(buckets)
+		p.responseSizes = newSizeHistogram(buckets)
+	}
+
+	compression, err := newCompression(p.fileConfig.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	bodyRewrite, err := newBodyRewrite(p.fileConfig.BodyRewrite, compression)
+	if err != nil {
+		return nil, err
+	}
+	p.bodyRewrite = bodyRewrite
+
+	maintenance, err := newMaintenance(p.fileConfig.Maintenance)
+	if err != nil {
+		return nil, err
+	}
+	p.maintenance = maintenance
+
+	if p.connLimiter, err = newConnLimiter(p.fileConfig.MaxConnsPerIP, p.fileConfig.MaxConnsPerIPAllowIPs); err != nil {
+		return nil, err
+	}
+
+	switch p.fileConfig.ErrorFormat {
+	case "", errorFormatText:
+	case errorFormatJSON:
+		p.jsonErrors = true
+	default:
+		return nil, fmt.Errorf("Invalid error format '%s', it must be '%s' or '%s'", p.fileConfig.ErrorFormat, errorFormatText, errorFormatJSON)
+	}
+
+	switch p.uriNormalization = p.fileConfig.URINormalization; p.uriNormalization {
+	case "":
+		p.uriNormalization = uriNormalizationRaw
+	case uriNormalizationRaw, uriNormalizationDecode, uriNormalizationNormalize:
+	default:
+		return nil, fmt.Errorf("Invalid URI normalization '%s', it must be '%s', '%s' or '%s'",
+			p.fileConfig.URINormalization, uriNormalizationRaw, uriNormalizationDecode, uriNormalizationNormalize)
+	}
+
+	for _, rl := range p.fileConfig.RouteLabels {
+		regex, err := regexp.Compile(rl.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid route label pattern '%s': %v", rl.Pattern, err)
+		}
+
+		p.routeLabels = append(p.routeLabels, routeLabel{regex: regex, latency: newLatencyHistogram(rl.Label)})
+	}
+
+	if p.cacheKeyHosts, err = newHostRewrites(p.fileConfig.CacheKeyHostRewrite); err != nil {
+		return nil, err
+	}
+
+	if p.staticResponses, err = newStaticResponses(p.fileConfig.StaticResponses); err != nil {
+		return nil, err
+	}
+
+	for _, s := range p.staticResponses {
+		if s.bodyFile != "" {
+			go p.runStaticFilesWatcher()
+			break
+		}
+	}
+
+	if p.deviceDetection, err = newDeviceDetection(p.fileConfig.DeviceDetection); err != nil {
+		return nil, err
+	}
+
+	if p.prefetch, err = newPrefetch(p.fileConfig.Prefetch); err != nil {
+		return nil, err
+	} else if p.prefetch != nil {
+		p.runPrefetchWorkers()
+	}
+
+	p.maxPooledEvalParams = p.fileConfig.Pool.MaxEvalParams
+	if p.maxPooledEvalParams <= 0 {
+		p.maxPooledEvalParams = defaultMaxPooledEvalParams
+	}
+
+	p.maxPooledBufferSize = p.fileConfig.Pool.MaxBufferSize
+	if p.maxPooledBufferSize <= 0 {
+		p.maxPooledBufferSize = defaultMaxPooledBufferSize
+	}
+
+	if p.fileConfig.Pool.Stats {
+		p.poolStats = new(poolStats)
+	}
 
 	p.tools = sync.Pool{
 		New: func() interface{} {
+			if p.poolStats != nil {
+				atomic.AddUint64(&p.poolStats.news, 1)
+			}
+
 			return &proxyTools{
 				params: acquireEvalParams(),
 				entry:  cache.AcquireEntry(),
+				trace:  requestTrace{noCacheRule: -1},
 			}
 		},
 	}
 
-	if err := p.parseNocacheRules(); err != nil {
+	if p.ruleSet, err = p.parseRuleSet(p.fileConfig); err != nil {
+		return nil, err
+	}
+
+	if p.deny, err = p.newDeny(); err != nil {
 		return nil, err
 	}
 
-	if err := p.parseHeadersRules(setHeaderAction, p.fileConfig.Response.Headers.Set); err != nil {
+	if p.rateLimiter, err = p.newRateLimiter(); err != nil {
 		return nil, err
 	}
 
-	if err := p.parseHeadersRules(unsetHeaderAction, p.fileConfig.Response.Headers.Unset); err != nil {
+	if p.staleGrace, err = p.newStaleGrace(); err != nil {
+		return nil, err
+	}
+
+	if p.bodyHashRules, err = p.newBodyHashRules(); err != nil {
+		return nil, err
+	}
+
+	if p.statusRewrites, err = p.newStatusRewrites(); err != nil {
 		return nil, err
 	}
 
@@ -64,19 +273,59 @@ func New(cfg Config) (*Proxy, error) {
 }
 
 func (p *Proxy) acquireTools() *proxyTools {
+	if p.poolStats != nil {
+		atomic.AddUint64(&p.poolStats.gets, 1)
+	}
+
 	return p.tools.Get().(*proxyTools)
 }
 
+// releaseTools resets the tools to reuse them, discarding what has grown too much
+// to keep the memory of the pool flat
 func (p *Proxy) releaseTools(pt *proxyTools) {
-	pt.params.reset()
+	discarded := false
+
+	if pt.params.peak > p.maxPooledEvalParams {
+		pt.params = &evalParams{p: make(map[string]interface{})}
+		discarded = true
+	} else {
+		pt.params.reset()
+		pt.params.peak = 0
+	}
+
+	if cap(pt.variant) > p.maxPooledBufferSize || cap(pt.requestID) > p.maxPooledBufferSize {
+		pt.variant, pt.requestID = nil, nil
+		discarded = true
+	}
+
+	if p.poolStats != nil {
+		atomic.AddUint64(&p.poolStats.puts, 1)
+		if discarded {
+			atomic.AddUint64(&p.poolStats.discarded, 1)
+		}
+	}
+
 	pt.entry.Reset()
+	pt.variant = pt.variant[:0]
+	pt.requestID = pt.requestID[:0]
+	pt.span = nil
+	pt.trace = requestTrace{noCacheRule: -1}
+	pt.canary = false
+	pt.pool = nil
+	pt.benchEcho = false
+	pt.uncacheable = false
+	pt.stale = nil
+	pt.deadline = time.Time{}
+	pt.cacheTime = 0
+	pt.backendTime = 0
+	pt.backend = ""
 
 	p.tools.Put(pt)
 }
 
-func (p *Proxy) getBackend() fetcher {
+func (p *Proxy) nextBackend() int {
 	if p.totalBackends == 1 {
-		return p.backends[0]
+		return 0
 	}
 
 	p.mu.Lock()
@@ -87,168 +336,1102 @@ func (p *Proxy) getBackend() fetcher {
 		p.currentBackend++
 	}
 
-	backend := p.backends[p.currentBackend]
+	i := p.currentBackend
 
 	p.mu.Unlock()
 
-	return backend
+	return i
+}
+
+func (p *Proxy) getBackend() fetcher {
+	return p.backends[p.nextBackend()]
+}
+
+func (p *Proxy) routeLatency(path []byte) *latencyHistogram {
+	for _, rl := range p.routeLabels {
+		if rl.regex.Match(path) {
+			return rl.latency
+		}
+	}
+
+	return nil
+}
+
+// doBackend fetches the response from the next backend of the selected pool, or the next canary
+// backend if the request is in the canary, recording the latency and the span
+func (p *Proxy) doBackend(ctx *fasthttp.RequestCtx, pt *proxyTools, route *latencyHistogram) error {
+	if pt.benchEcho {
+		benchEchoResponse(&ctx.Response)
+		return nil
+	}
+
+	backends, addrs, latencies := p.backends, p.fileConfig.BackendAddrs, p.backendLatencies
+
+	next := p.nextBackend
+	switch {
+	case pt.pool != nil:
+		backends, addrs, latencies = pt.pool.backends, pt.pool.addrs, pt.pool.latencies
+		next = pt.pool.next
+	case pt.canary:
+		backends, addrs, latencies = p.canary.backends, p.canary.addrs, p.canary.latencies
+		next = p.canary.next
+	}
+
+	i := p.selectBackend(backends, next)
+
+	if i >= len(backends) {
+		return errNoBackends
+	}
+
+	if !pt.deadline.IsZero() && !time.Now().Before(pt.deadline) {
+		// No time left, ex: after the retries
+		return fasthttp.ErrTimeout
+	}
+
+	span := p.tracer.Start(spanNameBackend, tracing.SpanKindClient, pt.span)
+	if i < len(addrs) {
+		span.SetAttribute("net.peer.name", addrs[i])
+	}
+	span.SetBoolAttribute("kratgo.canary", pt.canary)
+	if pt.pool != nil {
+		span.SetAttribute("kratgo.backend_pool", pt.pool.name)
+	}
+	span.Inject(&ctx.Request.Header)
+
+	var headers [][2]string
+	if i < len(addrs) {
+		headers = p.backendHeaders[addrs[i]]
+	}
+	setBackendHeaders(&ctx.Request, headers)
+
+	start := time.Now()
+	err := doDeadline(backends[i], &ctx.Request, &ctx.Response, pt.deadline)
+	elapsed := time.Since(start)
+
+	delBackendHeaders(&ctx.Request, &ctx.Response, headers)
+
+	if i < len(latencies) {
+		latencies[i].record(elapsed)
+	}
+	route.record(elapsed)
+
+	pt.backendTime += elapsed
+	if i < len(addrs) {
+		pt.backend = addrs[i]
+	}
+
+	if err != nil {
+		span.SetError(err)
+	} else {
+		span.SetIntAttribute("http.status_code", ctx.Response.StatusCode())
+
+		if isRetryableStatusCode(ctx.Response.StatusCode(), p.fileConfig.RetryableStatusCodes) {
+			p.setOverloaded(backends[i], &ctx.Response)
+		}
+	}
+	span.End()
+
+	return err
+}
+
+// selectBackend returns the next backend not overloaded, or the next one if all of them are overloaded
+func (p *Proxy) selectBackend(backends []fetcher, next func() int) int {
+	i := next()
+	if i >= len(backends) {
+		return i
+	}
+
+	now := time.Now().UnixNano()
+	for tries := 1; tries < len(backends) && p.overloaded(backends[i], now); tries++ {
+		i = next()
+	}
+
+	return i
+}
+
+// overloaded reports if the backend must be skipped, until the "Retry-After" of its last retryable response
+func (p *Proxy) overloaded(backend fetcher, now int64) bool {
+	until, ok := p.overloads.Load(backend)
+	if !ok {
+		return false
+	}
+
+	if now < until.(int64) {
+		return true
+	}
+
+	p.overloads.Delete(backend)
+
+	return false
+}
+
+// setOverloaded skips the backend in the selection during the "Retry-After" of the response, if it has it
+func (p *Proxy) setOverloaded(backend fetcher, resp *fasthttp.Response) {
+	now := time.Now()
+
+	if d := retryAfter(resp, now); d > 0 {
+		p.overloads.Store(backend, now.Add(d).UnixNano())
+	}
+}
+
+func (p *Proxy) clientIP(ctx *fasthttp.RequestCtx) net.IP {
+	return clientIP(ctx, p.trustedProxies)
+}
+
+// parseEvalKeys is like config.ParseConfigKeys, but also looks up the custom variables.
+// The index makes unique the evaluation key of each custom variable in a rule
+func (p *Proxy) parseEvalKeys(s string, index int) (string, string, string, config.EvalVarResolver) {
+	configKey, evalKey, evalSubKey := config.ParseConfigKeys(s)
+	if configKey != "" {
+		return configKey, evalKey, evalSubKey, nil
+	}
+
+	configKey, name, subKey := config.ParseCustomVarKeys(s)
+
+	resolver, ok := p.evalVars[name]
+	if !ok {
+		return "", "", "", nil
+	}
+
+	return configKey, fmt.Sprintf("%s%d", config.EvalCustomVar, index), subKey, resolver
 }
 
 func (p *Proxy) newEvaluableExpression(rule string) (*govaluate.EvaluableExpression, []ruleParam, error) {
 	params := make([]ruleParam, 0)
 
 	for config.ConfigVarRegex.MatchString(rule) {
-		configKey, evalKey, evalSubKey := config.ParseConfigKeys(rule)
+		configKey, evalKey, evalSubKey, resolver := p.parseEvalKeys(rule, len(params))
 		if configKey == "" && evalKey == "" && evalSubKey == "" {
 			return nil, nil, fmt.Errorf("Invalid condition: %s", rule)
 		}
 
-		rule = strings.Replace(rule, configKey, evalKey, -1)
-		params = append(params, ruleParam{name: evalKey, subKey: evalSubKey})
+		// The numeric comparisons have their own param, as the rest of occurrences are compared as strings
+		numericKey := evalKey + config.EvalNumericSuffix
+
+		var numeric bool
+		if rule, numeric = config.ReplaceNumericComparisons(rule, configKey, numericKey); numeric {
+			params = append(params, ruleParam{name: numericKey, evalName: evalKey, subKey: evalSubKey, numeric: true, resolver: resolver})
+		}
+
+		if strings.Contains(rule, configKey) {
+			rule = strings.Replace(rule, configKey, evalKey, -1)
+			params = append(params, ruleParam{name: evalKey, subKey: evalSubKey, resolver: resolver})
+		}
 	}
 
 	expr, err := govaluate.NewEvaluableExpression(rule)
 	return expr, params, err
 }
 
-func (p *Proxy) parseNocacheRules() error {
-	for _, ncRule := range p.fileConfig.Nocache {
+func (p *Proxy) enableRuleMetrics(r *rule, source string) {
+	if !p.fileConfig.RuleMetrics {
+		return
+	}
+
+	r.source = source
+	r.matches = new(uint64)
+}
+
+// parseRules returns the rules of the conditions
+func (p *Proxy) parseRules(conditions []string) ([]rule, error) {
+	rules := make([]rule, 0, len(conditions))
+
+	for _, condition := range conditions {
 		r := rule{}
 
-		expr, params, err := p.newEvaluableExpression(ncRule)
+		expr, params, err := p.newEvaluableExpression(condition)
 		if err != nil {
-			return fmt.Errorf("Could not get the evaluable expression for rule '%s': %v", ncRule, err)
+			return nil, fmt.Errorf("Could not get the evaluable expression for rule '%s': %v", condition, err)
 		}
 		r.expr = expr
 		r.params = append(r.params, params...)
+		r.condition = condition
+		p.enableRuleMetrics(&r, condition)
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// parseRuleSet returns the nocache and headers rules of the configuration
+func (p *Proxy) parseRuleSet(cfg config.Proxy) (ruleSet, error) {
+	rs := ruleSet{}
+
+	var err error
+
+	if rs.nocacheRules, err = p.parseRules(cfg.Nocache); err != nil {
+		return rs, err
+	}
 
-		p.nocacheRules = append(p.nocacheRules, r)
+	if cfg.CacheOnlyWhen != "" {
+		if rs.cacheOnlyWhen, err = p.parseRules([]string{cfg.CacheOnlyWhen}); err != nil {
+			return rs, err
+		}
 	}
 
+	headers := cfg.Response.Headers
+
+	for _, h := range headers.Always {
+		if h.Name == "" || h.When != "" {
+			return rs, fmt.Errorf("Invalid always response header '%s', it must have name and not condition", h.Name)
+		}
+	}
+	rs.alwaysHeaders = headers.Always
+
+	if rs.headersRules, err = p.parseHeadersRules(rs.headersRules, setHeaderAction, headers.Set); err != nil {
+		return rs, err
+	}
+
+	if rs.headersRules, err = p.parseHeadersRules(rs.headersRules, unsetHeaderAction, headers.Unset); err != nil {
+		return rs, err
+	}
+
+	if rs.headersRules, err = p.parseHeadersRules(rs.headersRules, appendHeaderAction, headers.Append); err != nil {
+		return rs, err
+	}
+
+	reqHeaders := cfg.Request.Headers
+	if rs.requestHeadersRules, err = p.parseHeadersRules(rs.requestHeadersRules, setHeaderAction, reqHeaders.Set); err != nil {
+		return rs, err
+	}
+
+	if rs.requestHeadersRules, err = p.parseHeadersRules(rs.requestHeadersRules, unsetHeaderAction, reqHeaders.Unset); err != nil {
+		return rs, err
+	}
+
+	if rs.requestHeadersRules, err = p.parseHeadersRules(rs.requestHeadersRules, appendHeaderAction, reqHeaders.Append); err != nil {
+		return rs, err
+	}
+
+	return rs, nil
+}
+
+// rules returns the current rules, the replaced ones are still valid for the requests in progress
+func (p *Proxy) rules() ruleSet {
+	p.rulesMu.RLock()
+	rs := p.ruleSet
+	p.rulesMu.RUnlock()
+
+	return rs
+}
+
+// ReloadRules replaces the nocache and headers rules by the ones of the configuration,
+// only if all of them are valid. The rest of the configuration is ignored
+func (p *Proxy) ReloadRules(cfg config.Proxy) error {
+	rs, err := p.parseRuleSet(cfg)
+	if err != nil {
+		return err
+	}
+
+	p.rulesMu.Lock()
+	p.ruleSet = rs
+	p.rulesMu.Unlock()
+
+	p.log.Infof("Reloaded rules: %d nocache, %d response headers and %d request headers",
+		len(rs.nocacheRules), len(rs.headersRules), len(rs.requestHeadersRules))
+
 	return nil
 }
 
-func (p *Proxy) parseHeadersRules(action typeHeaderAction, headers []config.Header) error {
+// parseHeadersRules appends the rules of the headers to dst
+func (p *Proxy) parseHeadersRules(dst []headerRule, action typeHeaderAction, headers []config.Header) ([]headerRule, error) {
 	for _, h := range headers {
 		r := headerRule{action: action, name: h.Name}
 
 		if h.When != "" {
 			expr, params, err := p.newEvaluableExpression(h.When)
 			if err != nil {
-				return fmt.Errorf("Could not get the evaluable expression for rule '%s': %v", h.When, err)
+				return nil, fmt.Errorf("Could not get the evaluable expression for rule '%s': %v", h.When, err)
 			}
 			r.expr = expr
 			r.params = append(r.params, params...)
+			r.condition = h.When
 		}
+		p.enableRuleMetrics(&r.rule, h.When)
 
-		if action == setHeaderAction {
-			_, evalKey, evalSubKey := config.ParseConfigKeys(h.Value)
+		if action != unsetHeaderAction {
+			_, evalKey, evalSubKey, resolver := p.parseEvalKeys(h.Value, 0)
 			if evalKey != "" {
 				r.value.value = evalKey
 				r.value.subKey = evalSubKey
+				r.value.resolver = resolver
 			} else {
 				r.value.value = h.Value
 			}
 		}
 
-		p.headersRules = append(p.headersRules, r)
+		dst = append(dst, r)
 	}
 
-	return nil
+	return dst, nil
+}
+
+func (p *Proxy) cacheVariant(ctx *fasthttp.RequestCtx, dst []byte) []byte {
+	dst = p.queryCacheVariant(ctx, dst)
+
+	for _, name := range p.fileConfig.CacheKeyCookies {
+		dst = append(dst, name...)
+		dst = append(dst, '=')
+		dst = append(dst, ctx.Request.Header.Cookie(name)...)
+		dst = append(dst, ';')
+	}
+
+	return p.privateCacheVariant(ctx, dst)
 }
 
-func (p *Proxy) saveBackendResponse(cacheKey, path []byte, resp *fasthttp.Response, entry *cache.Entry) error {
+// queryCacheVariant appends the query params of the request that are part of the cache key:
+// only the allowed ones in the configured order, or all of them except the ignored ones.
+// Without any of both lists, the query string never is part of the cache key
+func (p *Proxy) queryCacheVariant(ctx *fasthttp.RequestCtx, dst []byte) []byte {
+	if len(p.fileConfig.CacheKeyQueryParams) > 0 {
+		args := ctx.QueryArgs()
+
+		for _, name := range p.fileConfig.CacheKeyQueryParams {
+			if !args.Has(name) {
+				continue
+			}
+
+			dst = cache.AppendQueryVariant(dst, []byte(name), args.Peek(name))
+		}
+
+	} else if len(p.fileConfig.IgnoreQueryParams) > 0 {
+		ctx.QueryArgs().VisitAll(func(key, value []byte) {
+			if !stringSliceInclude(p.fileConfig.IgnoreQueryParams, gotils.B2S(key)) {
+				dst = cache.AppendQueryVariant(dst, key, value)
+			}
+		})
+	}
+
+	return dst
+}
+
+// privateCacheVariant appends a hash of the private headers, if the request has any of them,
+// so each user has its own cached responses. Only the hash is stored, never the credentials
+func (p *Proxy) privateCacheVariant(ctx *fasthttp.RequestCtx, dst []byte) []byte {
+	if len(p.fileConfig.PrivateCacheKeyHeaders) == 0 {
+		return dst
+	}
+
+	private := false
+	h := sha256.New()
+
+	for _, name := range p.fileConfig.PrivateCacheKeyHeaders {
+		value := ctx.Request.Header.Peek(name)
+		if len(value) > 0 {
+			private = true
+		}
+
+		// The separators avoid the collisions between different names and values
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write(value)
+		h.Write([]byte{0})
+	}
+
+	if !private {
+		return dst
+	}
+
+	var sum [sha256.Size]byte
+
+	dst = append(dst, privateVariantPrefix...)
+	dst = append(dst, hex.EncodeToString(h.Sum(sum[:0]))...)
+	dst = append(dst, ';')
+
+	return dst
+}
+
+// delCacheControlHeaders removes the headers of the backend response that are only for Kratgo
+func (p *Proxy) delCacheControlHeaders(resp *fasthttp.Response) {
+	resp.Header.Del(headerSurrogateControl)
+	if p.fileConfig.TTLHeader != "" {
+		resp.Header.Del(p.fileConfig.TTLHeader)
+	}
+}
+
+// expiresAt returns the expiration of a response stored at the given time,
+// by the max-age of the Surrogate-Control header or the TTL header if it's present
+func (p *Proxy) expiresAt(storedAt, maxAge int64, hasMaxAge bool, contentType []byte) int64 {
+	if hasMaxAge {
+		return storedAt + maxAge
+	}
+
+	return p.cache.ExpiresAt(storedAt, p.cache.TTL(mediaType(contentType)))
+}
+
+func (p *Proxy) saveBackendResponse(cacheKey, path, variant []byte, resp *fasthttp.Response, entry *cache.Entry) error {
+	// Surrogate-Control and the TTL header are only for Kratgo, so they're never sent to the client
+	maxAge, hasMaxAge := surrogateMaxAge(resp)
+	ttl, hasTTL := headerTTL(resp, p.fileConfig.TTLHeader)
+	p.delCacheControlHeaders(resp)
+
+	if hasMaxAge && maxAge <= 0 {
+		return nil
+	}
+
+	if hasTTL {
+		maxAge, hasMaxAge = ttl, true
+	}
+
 	r := cache.AcquireResponse()
 	r.Path = append(r.Path, path...)
+	r.Variant = append(r.Variant, variant...)
 	r.Body = append(r.Body, resp.Body()...)
+	r.StoredAt = time.Now().Unix()
+	r.ExpiresAt = p.expiresAt(r.StoredAt, maxAge, hasMaxAge, resp.Header.ContentType())
+	r.ETag = append(r.ETag, resp.Header.Peek(headerETag)...)
+	r.LastModified = append(r.LastModified, resp.Header.Peek(headerLastModified)...)
+
+	for _, tag := range bytes.Fields(resp.Header.Peek(headerSurrogateKey)) {
+		r.AddTag(tag)
+	}
+
+	cacheHeaders := p.fileConfig.Response.Headers.Cache
 
 	resp.Header.VisitAll(func(k, v []byte) {
-		r.SetHeader(k, v)
+		// The request ID is unique for each request, and the framing is set below
+		if isCacheableHeader(cacheHeaders, k) && !strings.EqualFold(gotils.B2S(k), p.requestIDHeader) &&
+			!isFramingHeader(k) {
+			r.SetHeader(k, v)
+		}
 	})
 
+	// The body is fully buffered, so its length is known even if the backend streamed it
+	contentLength := len(r.Body)
+	r.SetHeader([]byte(headerContentLength), []byte(strconv.Itoa(contentLength)))
+	resp.Header.SetContentLength(contentLength)
+
 	entry.SetResponse(*r)
 
-	if err := p.cache.SetBytes(cacheKey, *entry); err != nil {
+	err := p.cache.SetBytes(cacheKey, *entry)
+
+	cache.ReleaseResponse(r)
+
+	if err == cache.ErrEntryTooLarge {
+		// Returned as is, so the response is served without caching it and without logging an error
+		return err
+	} else if err != nil {
 		return fmt.Errorf("Could not save response in cache for key '%s': %v", cacheKey, err)
 	}
 
-	cache.ReleaseResponse(r)
+	resp.Header.Set(headerAge, "0")
 
 	return nil
 }
 
-func (p *Proxy) fetchFromBackend(cacheKey, path []byte, ctx *fasthttp.RequestCtx, pt *proxyTools) error {
+func (p *Proxy) fetchFromBackend(cacheKey, path, variant []byte, ctx *fasthttp.RequestCtx, pt *proxyTools) error {
 	if p.log.DebugEnabled() {
-		p.log.Debugf("%s - %s", ctx.Method(), ctx.Path())
+		p.log.Debugf("[%s] %s - %s", pt.requestID, ctx.Method(), ctx.Path())
 	}
 
 	ctx.Request.Header.Set(proxyReqHeaderKey, proxyReqHeaderValue)
+	ctx.Request.Header.SetBytesV(p.requestIDHeader, pt.requestID)
 	for _, header := range hopHeaders {
 		ctx.Request.Header.Del(header)
 	}
 
-	if err := p.getBackend().Do(&ctx.Request, &ctx.Response); err != nil {
-		return fmt.Errorf("Could not fetch response from backend: %v", err)
+	for _, name := range p.fileConfig.StripRequestCookies {
+		ctx.Request.Header.DelCookie(name)
+	}
+
+	if err := processHeaderRules(ctx, &ctx.Request.Header, p.rules().requestHeadersRules, pt.params); err != nil {
+		p.logRuleError(ctx, pt, fmt.Errorf("Could not process request headers rules: %v", err))
+	}
+
+	if !p.backendKeepAlive {
+		ctx.Request.SetConnectionClose()
+	}
+
+	if pt.stale != nil {
+		// Only the validators of the cached response, so a 304 always means that it's still valid
+		ctx.Request.Header.Del(headerIfNoneMatch)
+		ctx.Request.Header.Del(headerIfModifiedSince)
+
+		if len(pt.stale.ETag) > 0 {
+			ctx.Request.Header.SetBytesV(headerIfNoneMatch, pt.stale.ETag)
+		}
+		if len(pt.stale.LastModified) > 0 {
+			ctx.Request.Header.SetBytesV(headerIfModifiedSince, pt.stale.LastModified)
+		}
+	}
+
+	// The slot is held during the retries, as they are the same request
+	if !p.backendLimiter.acquire() {
+		return &backendError{
+			err:        fmt.Errorf("Could not fetch response from backend: %v", errBackendLimit),
+			statusCode: fasthttp.StatusServiceUnavailable,
+		}
+	}
+
+	p.retryBudget.addRequest(time.Now().UnixNano())
+
+	route := p.routeLatency(path)
+	err := p.doBackend(ctx, pt, route)
+
+	maxRetries := p.maxRetries(ctx)
+
+	for retry := 0; retry < maxRetries && shouldRetry(err, &ctx.Response, p.fileConfig.RetryableStatusCodes); retry++ {
+		if !p.retryBudget.allowRetry(time.Now().UnixNano()) {
+			p.log.Warningf("[%s] Retry budget exhausted, the backend response is not retried", pt.requestID)
+			break
+		}
+
+		ctx.Response.Reset()
+		err = p.doBackend(ctx, pt, route)
+	}
+
+	p.backendLimiter.release()
+
+	if err != nil {
+		return &backendError{
+			err:        fmt.Errorf("Could not fetch response from backend: %v", err),
+			statusCode: backendErrorStatusCode(err),
+		}
+	}
+
+	if !p.backendKeepAlive {
+		// The backend connection is closed, but not the client connection
+		ctx.Response.Header.ResetConnectionClose()
 	}
 
-	if err := processHeaderRules(ctx, p.headersRules, pt.params); err != nil {
-		return fmt.Errorf("Could not process headers rules: %v", err)
+	// The trailers are neither read from the backends nor written to the clients,
+	// so the response must not announce them, cached or not
+	ctx.Response.Header.Del(headerTrailer)
+
+	p.purgeOnStatus(ctx, pt, cacheKey, path)
+
+	if pt.stale != nil && ctx.Response.StatusCode() == fasthttp.StatusNotModified {
+		pt.trace.store = traceStoreRevalidated
+		p.revalidate(cacheKey, ctx, pt)
+		return nil
+	}
+
+	p.responseSizes.record(len(ctx.Response.Body()))
+
+	// Rewritten before the cache checks, so the cache has the rewritten status (ex: a 202 mapped to 200 is cached)
+	if p.fileConfig.CacheRewrittenStatus {
+		if err := p.rewriteStatus(ctx, pt); err != nil {
+			return err
+		}
 	}
 
+	p.prefetchHints(ctx, pt)
+
 	location := ctx.Response.Header.Peek(headerLocation)
 	if len(location) > 0 {
+		pt.trace.store = traceStoreRedirect
+		p.delCacheControlHeaders(&ctx.Response)
 		return nil
 	}
 
-	noCache, err := checkIfNoCache(ctx, p.nocacheRules, pt.params)
+	// Rewritten before caching, so it's done only once for the cached responses
+	p.bodyRewrite.apply(&ctx.Response)
+
+	rs := p.rules()
+
+	noCacheRule, err := checkIfNoCache(ctx, rs.nocacheRules, pt.params)
+	pt.trace.noCacheRule = noCacheRule
+
+	// The nocache rules win, the response is only checked if they allow caching it.
+	// If a rule fails, the response isn't cached, as the rule could match with valid values
+	noCache := true
 	if err != nil {
-		return err
+		p.logRuleError(ctx, pt, err)
+		pt.trace.store = traceStoreError
+	} else if noCacheRule >= 0 {
+		pt.trace.store = traceStoreNocache
+	} else if noCache, err = checkIfNotCacheOnly(ctx, rs.cacheOnlyWhen, pt.params); err != nil {
+		noCache = true
+		p.logRuleError(ctx, pt, err)
+		pt.trace.store = traceStoreError
+	} else if noCache {
+		pt.trace.store = traceStoreCacheOnlyWhen
+	}
+
+	switch {
+	case noCache:
+	case pt.uncacheable:
+		pt.trace.store = traceStoreUncacheable
+	case ctx.Response.StatusCode() != fasthttp.StatusOK:
+		pt.trace.store = traceStoreStatusCode
+	case !isCacheableContentType(p.fileConfig.CacheableContentTypes, ctx.Response.Header.ContentType()):
+		pt.trace.store = traceStoreContentType
+	case p.cache.UnderMemoryPressure():
+		pt.trace.store = traceStoreMemoryPressure
 	}
 
-	if noCache || ctx.Response.StatusCode() != fasthttp.StatusOK {
+	if pt.trace.store != "" {
+		p.delCacheControlHeaders(&ctx.Response)
 		return nil
 	}
 
-	return p.saveBackendResponse(cacheKey, path, &ctx.Response, pt.entry)
+	if p.debug {
+		pt.trace.store = traceStoreSaved
+		if maxAge, ok := surrogateMaxAge(&ctx.Response); ok && maxAge <= 0 {
+			pt.trace.store = traceStoreSurrogateControl
+		}
+	}
+
+	// The backend response is fine, so it's served even if it could not be cached
+	err = p.saveBackendResponse(cacheKey, path, variant, &ctx.Response, pt.entry)
+	if err == cache.ErrEntryTooLarge {
+		pt.trace.store = traceStoreTooLarge
+		atomic.AddUint64(p.cacheTooLarge, 1)
+
+		if p.log.DebugEnabled() {
+			p.log.Debugf("[%s] Response not cached for key '%s' and path '%s', bigger than the max size of the cache entries",
+				pt.requestID, cacheKey, path)
+		}
+
+	} else if err != nil {
+		pt.trace.store = traceStoreError
+		atomic.AddUint64(p.cacheStoreErrors, 1)
+		p.log.Errorf("[%s] %v", pt.requestID, err)
+	}
+
+	return nil
+}
+
+// revalidate refreshes the expiration of the stale response that the backend
+// has validated with a 304, and serves it without fetching the body again
+func (p *Proxy) revalidate(cacheKey []byte, ctx *fasthttp.RequestCtx, pt *proxyTools) {
+	r := pt.stale
+	now := time.Now().Unix()
+
+	maxAge, hasMaxAge := surrogateMaxAge(&ctx.Response)
+	ttl, hasTTL := headerTTL(&ctx.Response, p.fileConfig.TTLHeader)
+	if etag := ctx.Response.Header.Peek(headerETag); len(etag) > 0 {
+		r.ETag = append(r.ETag[:0], etag...)
+	}
+
+	ctx.Response.Reset()
+
+	if hasMaxAge && maxAge <= 0 {
+		// Still valid, but not cached anymore
+		p.serveCached(ctx, r, r.StoredAt)
+		return
+	}
+
+	if hasTTL {
+		maxAge, hasMaxAge = ttl, true
+	}
+
+	r.StoredAt = now
+	r.ExpiresAt = p.expiresAt(now, maxAge, hasMaxAge, r.Header([]byte(fasthttp.HeaderContentType)))
+
+	p.serveCached(ctx, r, now)
+
+	if err := p.cache.SetBytes(cacheKey, *pt.entry); err == cache.ErrEntryTooLarge {
+		atomic.AddUint64(p.cacheTooLarge, 1)
+	} else if err != nil {
+		atomic.AddUint64(p.cacheStoreErrors, 1)
+		p.log.Errorf("[%s] Could not save revalidated response in cache for key '%s': %v", pt.requestID, cacheKey, err)
+	}
+}
+
+// serveCached writes the cached response
+func (p *Proxy) serveCached(ctx *fasthttp.RequestCtx, r *cache.Response, now int64) {
+	for _, h := range r.Headers {
+		addCachedHeader(&ctx.Response.Header, h.Key, h.Value)
+	}
+	ctx.Response.Header.Set(headerAge, strconv.FormatInt(r.Age(now), 10))
+	ctx.Response.Header.Set(headerAcceptRanges, "bytes")
+
+	p.responseSizes.record(len(r.Body))
+
+	if !serveRange(ctx, r.Body) {
+		ctx.SetBody(r.Body)
+	}
+}
+
+// processServedResponse applies the response headers rules and the status rewrites to the response served
+// to the client, from cache or from the backend, so the cache has the backend headers and both are the same
+func (p *Proxy) processServedResponse(ctx *fasthttp.RequestCtx, pt *proxyTools) {
+	if err := processHeaderRules(ctx, &ctx.Response.Header, p.rules().headersRules, pt.params); err != nil {
+		p.logRuleError(ctx, pt, fmt.Errorf("Could not process headers rules: %v", err))
+	}
+
+	p.rewriteServedStatus(ctx, pt)
+}
+
+func (p *Proxy) handleError(ctx *fasthttp.RequestCtx, pt *proxyTools, err error) {
+	statusCode := fasthttp.StatusInternalServerError
+	if e, ok := err.(*backendError); ok {
+		statusCode = e.statusCode
+	}
+
+	p.errorResponse(ctx, pt, err.Error(), statusCode)
+	p.log.Errorf("[%s] %v", pt.requestID, err)
+}
+
+// logRuleError logs the error evaluating a rule with the request, which is served
+// with the safe default of the rule instead of failing
+func (p *Proxy) logRuleError(ctx *fasthttp.RequestCtx, pt *proxyTools, err error) {
+	p.log.Errorf("[%s] %v, in request '%s %s'", pt.requestID, err, ctx.Method(), ctx.RequestURI())
+}
+
+// errorResponse sets the error generated by the proxy in the response, as plain text or json
+func (p *Proxy) errorResponse(ctx *fasthttp.RequestCtx, pt *proxyTools, msg string, statusCode int) {
+	if !p.jsonErrors {
+		ctx.Error(msg, statusCode)
+		return
+	}
+
+	body, _ := json.Marshal(errorBody{Error: msg, Status: statusCode, RequestID: string(pt.requestID)})
+
+	ctx.Response.Reset()
+	ctx.SetStatusCode(statusCode)
+	ctx.SetContentType(contentTypeJSON)
+	ctx.SetBody(body)
+}
+
+// finishRequest sets the always headers and the request ID in the response, and ends the request span
+func (p *Proxy) finishRequest(ctx *fasthttp.RequestCtx, pt *proxyTools, cacheHit bool) {
+	for _, h := range p.rules().alwaysHeaders {
+		ctx.Response.Header.Set(h.Name, h.Value)
+	}
+	ctx.Response.Header.SetBytesV(p.requestIDHeader, pt.requestID)
+
+	statusCode := ctx.Response.StatusCode()
+	pt.span.SetBoolAttribute("kratgo.cache_hit", cacheHit)
+	pt.span.SetIntAttribute("http.status_code", statusCode)
+	if statusCode >= fasthttp.StatusInternalServerError {
+		pt.span.SetError(fmt.Errorf("Status code %d", statusCode))
+	}
+	pt.span.End()
+
+	if p.debug {
+		p.logTrace(ctx, pt)
+	}
+
+	if p.slowRequestThreshold > 0 {
+		if elapsed := time.Since(pt.start); elapsed > p.slowRequestThreshold {
+			p.log.Warningf("[%s] Slow request %s %s: total %v, cache %v, backend %v (%s)",
+				pt.requestID, ctx.Method(), ctx.Path(), elapsed, pt.cacheTime, pt.backendTime, pt.backend)
+		}
+	}
+
+	p.releaseTools(pt)
 }
 
 func (p *Proxy) handler(ctx *fasthttp.RequestCtx) {
 	pt := p.acquireTools()
 
+	if p.slowRequestThreshold > 0 {
+		pt.start = time.Now()
+	}
+
+	pt.requestID = requestID(ctx, p.requestIDHeader, pt.requestID)
+
+	if p.clientTimeoutHeader != "" {
+		if timeout := clientTimeout(ctx, p.clientTimeoutHeader, p.maxClientTimeout); timeout > 0 {
+			pt.deadline = time.Now().Add(timeout)
+		}
+	}
+	ctx.SetUserValue(requestIDUserValueKey, string(pt.requestID))
+
+	pt.span = p.tracer.StartFromRequest(spanNameRequest, tracing.SpanKindServer, &ctx.Request.Header)
+	pt.span.SetBytesAttribute("http.method", ctx.Method())
+	pt.span.SetBytesAttribute("http.host", ctx.Host())
+	pt.span.SetBytesAttribute("http.target", ctx.RequestURI())
+	pt.span.SetBytesAttribute("kratgo.request_id", pt.requestID)
+
+	if len(p.trustedProxies) > 0 {
+		ctx.SetUserValue(clientIPUserValueKey, p.clientIP(ctx).String())
+	}
+
+	p.normalizeURI(ctx)
+
+	if p.maintenance.serve(p, ctx) {
+		p.finishRequest(ctx, pt, false)
+		return
+	}
+
+	p.requestSizes.record(len(ctx.Request.Body()))
+
+	if p.serveMissingHost(ctx, pt) {
+		p.finishRequest(ctx, pt, false)
+		return
+	}
+
+	// Before anything else, the denied requests never reach the cache nor the backends
+	if denied, err := p.deny.serve(ctx, pt.params); err != nil {
+		p.handleError(ctx, pt, err)
+		p.finishRequest(ctx, pt, false)
+		return
+	} else if denied {
+		p.finishRequest(ctx, pt, false)
+		return
+	}
+
+	if limited, err := p.serveRateLimit(ctx, pt); err != nil {
+		p.handleError(ctx, pt, err)
+		p.finishRequest(ctx, pt, false)
+		return
+	} else if limited {
+		p.finishRequest(ctx, pt, false)
+		return
+	}
+
+	if p.serveStatic(ctx) {
+		p.finishRequest(ctx, pt, false)
+		return
+	}
+
+	now := time.Now().Unix()
 	path := ctx.URI().PathOriginal()
-	cacheKey := ctx.Host()
+	cacheKey := rewriteHost(p.cacheKeyHosts, ctx.Host())
+
+	pt.benchEcho = ctx.UserValue(benchEchoUserValueKey) != nil
+
+	pool, err := p.backendPool(ctx, pt.params)
+	if err != nil {
+		p.handleError(ctx, pt, err)
+		p.finishRequest(ctx, pt, false)
+		return
+	}
+	pt.pool = pool
+
+	if pt.pool == nil && p.noMatchStatus != 0 && !pt.benchEcho {
+		p.errorResponse(ctx, pt, fasthttp.StatusMessage(p.noMatchStatus), p.noMatchStatus)
+		p.finishRequest(ctx, pt, false)
+		return
+	}
+
+	// The responses of the canary and the backend pools are cached apart from the default ones.
+	// The canary only applies to the default backends
+	if pt.benchEcho {
+		pt.variant = append(pt.variant, benchEchoVariantPrefix...)
+	} else if pt.pool != nil {
+		pt.variant = append(pt.variant, poolVariantPrefix...)
+		pt.variant = append(pt.variant, pt.pool.name...)
+		pt.variant = append(pt.variant, ';')
+	} else if pt.canary = p.canary.match(ctx); pt.canary {
+		pt.variant = append(pt.variant, canaryVariantPrefix...)
+	}
+	pt.variant = p.deviceDetection.variant(ctx, pt.variant)
+
+	var cacheable bool
+	if pt.variant, cacheable, err = p.bodyHashVariant(ctx, pt, pt.variant); err != nil {
+		p.handleError(ctx, pt, err)
+		p.finishRequest(ctx, pt, false)
+		return
+	}
+	pt.uncacheable = !cacheable
+
+	pt.variant = p.cacheVariant(ctx, pt.variant)
+
+	pt.trace.cacheKey = cacheKey
+
+	if pt.uncacheable {
+		pt.trace.lookup = traceLookupSkipped
+
+	} else if noCacheRule, err := checkIfNoCache(ctx, p.rules().nocacheRules, pt.params); err != nil {
+		// Not looked up nor cached, as the rule could match with valid values
+		p.logRuleError(ctx, pt, err)
+		pt.trace.lookup = traceLookupSkipped
+
+	} else if pt.trace.noCacheRule = noCacheRule; noCacheRule >= 0 {
+		pt.trace.lookup = traceLookupSkipped
+
+	} else {
+		span := p.tracer.Start(spanNameCacheLookup, tracing.SpanKindInternal, pt.span)
+
+		var lookupStart time.Time
+		if p.slowRequestThreshold > 0 {
+			lookupStart = time.Now()
+		}
+
+		err := p.cache.GetBytes(cacheKey, pt.entry)
+		r := pt.entry.GetVariantResponse(path, pt.variant)
+		hit := err == nil && r != nil && p.cache.Fresh(r, now)
 
-	if noCache, err := checkIfNoCache(ctx, p.nocacheRules, pt.params); err != nil {
-		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
-		p.log.Error(err)
+		if p.slowRequestThreshold > 0 {
+			pt.cacheTime = time.Since(lookupStart)
+		}
+
+		span.SetError(err)
+		span.SetBoolAttribute("kratgo.cache_hit", hit)
+		span.End()
 
-	} else if !noCache {
-		if err := p.cache.GetBytes(cacheKey, pt.entry); err != nil {
-			ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
-			p.log.Errorf("Could not get data from cache with key '%s': %v", cacheKey, err)
+		pt.trace.lookup = traceLookupMiss
+
+		if err != nil {
+			pt.trace.lookup = traceLookupError
+			atomic.AddUint64(p.cacheReadErrors, 1)
+			err = fmt.Errorf("Could not get data from cache with key '%s': %v", cacheKey, err)
 
-		} else if r := pt.entry.GetResponse(path); r != nil {
-			ctx.SetBody(r.Body)
-			for _, h := range r.Headers {
-				ctx.Response.Header.SetCanonical(h.Key, h.Value)
+			if !p.cache.FailOpen() {
+				p.handleError(ctx, pt, err)
+				p.finishRequest(ctx, pt, false)
+				return
 			}
 
-			p.releaseTools(pt)
+			// Handled as a miss, the entry is overwritten with the backend response
+			p.log.Errorf("[%s] %v", pt.requestID, err)
+			pt.entry.Reset()
+
+		} else if hit {
+			pt.trace.lookup = traceLookupHit
+			p.serveCached(ctx, r, now)
+			p.processServedResponse(ctx, pt)
+			p.finishRequest(ctx, pt, true)
+			return
+
+		} else if p.serveStale(ctx, pt, cacheKey, path, r, now) {
+			pt.trace.lookup = traceLookupStale
+			p.processServedResponse(ctx, pt)
+			p.finishRequest(ctx, pt, true)
 			return
+
+		} else if r != nil {
+			pt.trace.lookup = traceLookupExpired
+
+			if p.fileConfig.ConditionalRevalidation && r.HasValidators() {
+				pt.stale = r
+			}
 		}
 	}
 
-	if err := p.fetchFromBackend(cacheKey, path, ctx, pt); err != nil {
-		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
-		p.log.Error(err)
+	if err := p.fetchFromBackend(cacheKey, path, pt.variant, ctx, pt); err != nil {
+		p.handleError(ctx, pt, err)
+	} else {
+		p.processServedResponse(ctx, pt)
 	}
 
-	p.releaseTools(pt)
+	p.finishRequest(ctx, pt, false)
+}
+
+func (p *Proxy) ruleStats() []RuleStats {
+	rs := p.rules()
+	stats := make([]RuleStats, 0, len(rs.nocacheRules)+len(rs.headersRules)+len(rs.requestHeadersRules))
+
+	stats = appendRuleStats(stats, rs.nocacheRules, ruleTypeNocache)
+	stats = appendRuleStats(stats, rs.cacheOnlyWhen, ruleTypeCacheOnlyWhen)
+	if p.deny != nil {
+		stats = appendRuleStats(stats, p.deny.rules, ruleTypeDeny)
+		stats = appendRuleStats(stats, p.deny.allowRules, ruleTypeDenyAllow)
+	}
+	if p.rateLimiter != nil {
+		stats = appendRuleStats(stats, p.rateLimiter.rules, ruleTypeRateLimit)
+	}
+
+	stats = appendHeaderRuleStats(stats, rs.headersRules, ruleTypeSet, ruleTypeUnset, ruleTypeAppend)
+	stats = appendHeaderRuleStats(stats, rs.requestHeadersRules, ruleTypeRequestSet, ruleTypeRequestUnset, ruleTypeRequestAppend)
+
+	return stats
+}
+
+func appendRuleStats(stats []RuleStats, rules []rule, ruleType string) []RuleStats {
+	for i, r := range rules {
+		stats = append(stats, RuleStats{Type: ruleType, Index: i, Rule: r.source, Matches: atomic.LoadUint64(r.matches)})
+	}
+
+	return stats
+}
+
+func appendHeaderRuleStats(stats []RuleStats, rules []headerRule, setType, unsetType, appendType string) []RuleStats {
+	// The index is by type, as in the configuration
+	index := map[typeHeaderAction]int{}
+
+	for _, r := range rules {
+		ruleType := setType
+		switch r.action {
+		case unsetHeaderAction:
+			ruleType = unsetType
+		case appendHeaderAction:
+			ruleType = appendType
+		}
+
+		stats = append(stats, RuleStats{
+			Type:    ruleType,
+			Index:   index[r.action],
+			Header:  r.name,
+			Rule:    r.source,
+			Matches: atomic.LoadUint64(r.matches),
+		})
+		index[r.action]++
+	}
+
+	return stats
+}
+
+// Stats returns the latency percentiles of the backends and the labeled routes
+func (p *Proxy) Stats() Stats {
+	stats := Stats{
+		Backends: make([]LatencySummary, 0, len(p.backendLatencies)),
+		Routes:   make([]LatencySummary, 0, len(p.routeLabels)),
+	}
+
+	for _, h := range p.backendLatencies {
+		stats.Backends = append(stats.Backends, h.summary())
+	}
+
+	if p.canary != nil {
+		for _, h := range p.canary.latencies {
+			stats.Backends = append(stats.Backends, h.summary())
+		}
+	}
+
+	for _, pool := range p.backendPools {
+		for _, h := range pool.latencies {
+			stats.Backends = append(stats.Backends, h.summary())
+		}
+	}
+
+	if p.fileConfig.RuleMetrics {
+		stats.Rules = p.ruleStats()
+	}
+
+	stats.CacheStoreErrors = atomic.LoadUint64(p.cacheStoreErrors)
+	stats.CacheTooLarge = atomic.LoadUint64(p.cacheTooLarge)
+	stats.CacheDemotionsDropped = p.cache.DroppedDemotions()
+	stats.RejectedConns = p.connLimiter.rejectedConns()
+	stats.BackendRequestsRejected = p.backendLimiter.rejectedRequests()
+	stats.RateLimited = p.rateLimiter.limitedRequests()
+	stats.CacheReadErrors = atomic.LoadUint64(p.cacheReadErrors)
+	stats.MemoryPressure = p.cache.UnderMemoryPressure()
+	stats.RequestSizes = p.requestSizes.summary()
+	stats.ResponseSizes = p.responseSizes.summary()
+
+	if p.poolStats != nil {
+		stats.Pool = &PoolStats{
+			Gets:      atomic.LoadUint64(&p.poolStats.gets),
+			Puts:      atomic.LoadUint64(&p.poolStats.puts),
+			News:      atomic.LoadUint64(&p.poolStats.news),
+			Discarded: atomic.LoadUint64(&p.poolStats.discarded),
+		}
+	}
+
+	for _, rl := range p.routeLabels {
+		stats.Routes = append(stats.Routes, rl.latency.summary())
+	}
+
+	return stats
 }
 
 // ListenAndServe ...
 func (p *Proxy) ListenAndServe() error {
 	p.log.Infof("Listening on: %s://%s/", p.httpScheme, p.fileConfig.Addr)
 
-	return p.server.ListenAndServe(p.fileConfig.Addr)
+	if !p.fileConfig.ProxyProtocol && p.connLimiter == nil {
+		return p.server.ListenAndServe(p.fileConfig.Addr)
+	}
+
+	ln, err := net.Listen("tcp4", p.fileConfig.Addr)
+	if err != nil {
+		return fmt.Errorf("Could not listen on '%s': %v", p.fileConfig.Addr, err)
+	}
+
+	if p.fileConfig.ProxyProtocol {
+		ln = newProxyProtocolListener(ln)
+	}
+
+	// Over the PROXY protocol listener, to limit by the client IP of its header
+	if p.connLimiter != nil {
+		ln = newConnLimitListener(ln, p.connLimiter)
+	}
+
+	return p.server.Serve(ln)
 }
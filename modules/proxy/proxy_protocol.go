@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+var errProxyProtocolHeader = errors.New("Invalid PROXY protocol header")
+
+// newProxyProtocolListener returns the listener whose connections must start with
+// the PROXY protocol header (v1 or v2), to get the client address from it
+func newProxyProtocolListener(ln net.Listener) net.Listener {
+	return &proxyProtocolListener{Listener: ln}
+}
+
+// Accept ...
+func (ln *proxyProtocolListener) Accept() (net.Conn, error) {
+	c, err := ln.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	// The header is read on the first use of the connection, to not block the accept loop
+	return &proxyProtocolConn{Conn: c, reader: bufio.NewReader(c)}, nil
+}
+
+func (c *proxyProtocolConn) readHeader() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(proxyProtocolHeaderTimeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+
+		c.remoteAddr, c.err = parseProxyProtocolHeader(c.reader)
+		if c.err != nil {
+			c.err = fmt.Errorf("Could not read the PROXY protocol header from '%s': %v", c.Conn.RemoteAddr(), c.err)
+		}
+	})
+}
+
+// Read ...
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client address of the PROXY protocol header,
+// or the address of the connection if the header hasn't it (ex: health checks of the balancer)
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+// parseProxyProtocolHeader reads the PROXY protocol header, and returns the source address of it,
+// or nil if the header is valid but it hasn't the address (UNKNOWN in v1, and LOCAL or unspec in v2)
+func parseProxyProtocolHeader(r *bufio.Reader) (net.Addr, error) {
+	signature, err := r.Peek(len(proxyProtocolV2Signature))
+	if err == nil && bytes.Equal(signature, proxyProtocolV2Signature) {
+		return parseProxyProtocolV2(r)
+	}
+
+	prefix, err := r.Peek(len(proxyProtocolV1Prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(prefix, proxyProtocolV1Prefix) {
+		return nil, errProxyProtocolHeader
+	}
+
+	return parseProxyProtocolV1(r)
+}
+
+// parseProxyProtocolV1 parses the text header, ex: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"
+func parseProxyProtocolV1(r *bufio.Reader) (net.Addr, error) {
+	line := make([]byte, 0, proxyProtocolV1MaxLength)
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+
+		if len(line) == proxyProtocolV1MaxLength {
+			return nil, errProxyProtocolHeader
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errProxyProtocolHeader
+	}
+
+	fields := bytes.Split(line[:len(line)-2], []byte(" "))
+	if len(fields) >= 2 && string(fields[1]) == "UNKNOWN" {
+		return nil, nil
+	}
+
+	if len(fields) != 6 {
+		return nil, errProxyProtocolHeader
+	}
+
+	ip := net.ParseIP(string(fields[2]))
+	if ip == nil {
+		return nil, errProxyProtocolHeader
+	}
+
+	switch string(fields[1]) {
+	case "TCP4":
+		if ip.To4() == nil {
+			return nil, errProxyProtocolHeader
+		}
+	case "TCP6":
+		if ip.To4() != nil {
+			return nil, errProxyProtocolHeader
+		}
+	default:
+		return nil, errProxyProtocolHeader
+	}
+
+	port, err := strconv.ParseUint(string(fields[4]), 10, 16)
+	if err != nil {
+		return nil, errProxyProtocolHeader
+	}
+
+	if net.ParseIP(string(fields[3])) == nil {
+		return nil, errProxyProtocolHeader
+	}
+
+	if _, err := strconv.ParseUint(string(fields[5]), 10, 16); err != nil {
+		return nil, errProxyProtocolHeader
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// parseProxyProtocolV2 parses the binary header: the signature, the version and command,
+// the family and protocol, the length of the addresses, and the addresses
+func parseProxyProtocolV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, len(proxyProtocolV2Signature)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	verCmd := header[12]
+	family := header[13]
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+
+	if verCmd>>4 != 2 {
+		return nil, errProxyProtocolHeader
+	}
+
+	addrs := make([]byte, length)
+	if _, err := io.ReadFull(r, addrs); err != nil {
+		return nil, err
+	}
+
+	switch verCmd & 0x0f {
+	case proxyProtocolV2CmdLocal:
+		return nil, nil
+	case proxyProtocolV2CmdProxy:
+	default:
+		return nil, errProxyProtocolHeader
+	}
+
+	// The transport protocol (TCP or UDP) doesn't matter, only the address family
+	switch family >> 4 {
+	case proxyProtocolV2FamilyInet:
+		if length < 12 {
+			return nil, errProxyProtocolHeader
+		}
+
+		return &net.TCPAddr{IP: net.IP(addrs[:4]), Port: int(binary.BigEndian.Uint16(addrs[8:10]))}, nil
+
+	case proxyProtocolV2FamilyInet6:
+		if length < 36 {
+			return nil, errProxyProtocolHeader
+		}
+
+		return &net.TCPAddr{IP: net.IP(addrs[:16]), Port: int(binary.BigEndian.Uint16(addrs[32:34]))}, nil
+	}
+
+	// Unspec or unix sockets
+	return nil, nil
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+)
+
+func Test_parseProxyProtocolHeader(t *testing.T) {
+	v2 := string(proxyProtocolV2Signature)
+
+	tests := []struct {
+		name     string
+		header   string
+		wantAddr string
+		err      bool
+	}{
+		{name: "V1TCP4", header: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", wantAddr: "192.0.2.1:56324"},
+		{name: "V1TCP6", header: "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", wantAddr: "[2001:db8::1]:56324"},
+		{name: "V1Unknown", header: "PROXY UNKNOWN\r\n"},
+		{name: "V1FamilyMismatch", header: "PROXY TCP6 192.0.2.1 198.51.100.1 56324 443\r\n", err: true},
+		{name: "V1InvalidIP", header: "PROXY TCP4 192.0.2 198.51.100.1 56324 443\r\n", err: true},
+		{name: "V1InvalidPort", header: "PROXY TCP4 192.0.2.1 198.51.100.1 65536 443\r\n", err: true},
+		{name: "V1MissingFields", header: "PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n", err: true},
+		{name: "V1WithoutCRLF", header: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\n", err: true},
+		{name: "V1TooLong", header: "PROXY TCP4 " + strings.Repeat("1", 200) + "\r\n", err: true},
+		{
+			name:     "V2TCP4",
+			header:   v2 + "\x21\x11\x00\x0c" + "\xc0\x00\x02\x01" + "\xc6\x33\x64\x01" + "\xdc\x04" + "\x01\xbb",
+			wantAddr: "192.0.2.1:56324",
+		},
+		{
+			name: "V2TCP6",
+			header: v2 + "\x21\x21\x00\x24" +
+				"\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01" +
+				"\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02" +
+				"\xdc\x04" + "\x01\xbb",
+			wantAddr: "[2001:db8::1]:56324",
+		},
+		{name: "V2Local", header: v2 + "\x20\x00\x00\x00"},
+		{name: "V2InvalidVersion", header: v2 + "\x11\x11\x00\x00", err: true},
+		{name: "V2InvalidCommand", header: v2 + "\x2f\x11\x00\x00", err: true},
+		{name: "V2ShortAddresses", header: v2 + "\x21\x11\x00\x04" + "\xc0\x00\x02\x01", err: true},
+		{name: "V2Truncated", header: v2 + "\x21\x11\x00\x40" + "\xc0\x00", err: true},
+		{name: "WithoutHeader", header: "GET / HTTP/1.1\r\n\r\n", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.header + "GET / HTTP/1.1\r\n"))
+
+			addr, err := parseProxyProtocolHeader(r)
+			if (err != nil) != tt.err {
+				t.Fatalf("parseProxyProtocolHeader() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if tt.err {
+				return
+			}
+
+			gotAddr := ""
+			if addr != nil {
+				gotAddr = addr.String()
+			}
+
+			if gotAddr != tt.wantAddr {
+				t.Errorf("parseProxyProtocolHeader() == '%s', want '%s'", gotAddr, tt.wantAddr)
+			}
+
+			if rest, _ := ioutil.ReadAll(r); string(rest) != "GET / HTTP/1.1\r\n" {
+				t.Errorf("parseProxyProtocolHeader() remaining data == '%q', want '%q'", rest, "GET / HTTP/1.1\r\n")
+			}
+		})
+	}
+}
+
+func Test_proxyProtocolListener(t *testing.T) {
+	tcpLn, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln := newProxyProtocolListener(tcpLn)
+	defer ln.Close()
+
+	tests := []struct {
+		name     string
+		data     string
+		wantAddr string
+		err      bool
+	}{
+		{name: "Header", data: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nKratgo", wantAddr: "192.0.2.1:56324"},
+		{name: "UnknownHeader", data: "PROXY UNKNOWN\r\nKratgo"},
+		{name: "Malformed", data: "Kratgo", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := net.Dial("tcp4", tcpLn.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			if _, err := client.Write([]byte(tt.data)); err != nil {
+				t.Fatal(err)
+			}
+			client.(*net.TCPConn).CloseWrite()
+
+			c, err := ln.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			body, err := ioutil.ReadAll(c)
+			if (err != nil) != tt.err {
+				t.Fatalf("proxyProtocolConn.Read() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if tt.err {
+				return
+			}
+
+			if string(body) != "Kratgo" {
+				t.Errorf("proxyProtocolConn.Read() == '%s', want '%s'", body, "Kratgo")
+			}
+
+			wantAddr := tt.wantAddr
+			if wantAddr == "" {
+				wantAddr = client.LocalAddr().String()
+			}
+
+			if addr := c.RemoteAddr().String(); addr != wantAddr {
+				t.Errorf("proxyProtocolConn.RemoteAddr() == '%s', want '%s'", addr, wantAddr)
+			}
+		})
+	}
+}
@@ -2,11 +2,14 @@ package proxy
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -14,6 +17,7 @@ import (
 
 	"github.com/savsgio/kratgo/modules/cache"
 	"github.com/savsgio/kratgo/modules/config"
+	"github.com/savsgio/kratgo/modules/tracing"
 
 	logger "github.com/savsgio/go-logger/v2"
 	"github.com/savsgio/gotils"
@@ -23,21 +27,40 @@ import (
 type mockServer struct {
 	addr                 string
 	listenAndServeCalled bool
+	listener             net.Listener
 
 	mu sync.RWMutex
 }
 
 type mockBackend struct {
-	called bool
+	called          bool
+	calls           int
+	connectionClose bool
+	requestID       []byte
+	traceparent     []byte
+	host            []byte
+	uri             []byte
 
 	body       []byte
 	headers    map[string][]byte
+	addHeaders [][2]string
 	statusCode int
 	err        error
+	delay      time.Duration
 }
 
 func (mock *mockBackend) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
 	mock.called = true
+	mock.calls++
+
+	if mock.delay > 0 {
+		time.Sleep(mock.delay)
+	}
+	mock.connectionClose = req.ConnectionClose()
+	mock.requestID = append(mock.requestID[:0], req.Header.Peek(defaultRequestIDHeader)...)
+	mock.traceparent = append(mock.traceparent[:0], req.Header.Peek(tracing.HeaderTraceparent)...)
+	mock.host = append(mock.host[:0], req.Host()...)
+	mock.uri = append(mock.uri[:0], req.RequestURI()...)
 
 	resp.SetBody(mock.body)
 	resp.SetStatusCode(mock.statusCode)
@@ -46,6 +69,10 @@ func (mock *mockBackend) Do(req *fasthttp.Request, resp *fasthttp.Response) erro
 		resp.Header.SetCanonical(gotils.S2B(k), v)
 	}
 
+	for _, h := range mock.addHeaders {
+		resp.Header.Add(h[0], h[1])
+	}
+
 	return mock.err
 }
 
@@ -81,6 +108,14 @@ func (mock *mockServer) ListenAndServe(addr string) error {
 	return nil
 }
 
+func (mock *mockServer) Serve(ln net.Listener) error {
+	mock.mu.Lock()
+	mock.listener = ln
+	mock.mu.Unlock()
+
+	return ln.Close()
+}
+
 func testConfig() Config {
 	testCache.Reset()
 
@@ -303,6 +338,55 @@ func TestProxy_New(t *testing.T) {
 	}
 }
 
+func TestProxy_releaseTools(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.Pool = config.ProxyPool{MaxEvalParams: 2, MaxBufferSize: 8, Stats: true}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pt := p.acquireTools()
+	params := pt.params
+
+	pt.params.set("a", 1)
+	pt.params.reset()
+	pt.params.set("b", 2)
+	p.releaseTools(pt)
+
+	if pt.params != params || len(pt.params.p) != 0 || pt.params.peak != 0 {
+		t.Errorf("Proxy.releaseTools() params under the limit have not been reset and reused")
+	}
+
+	pt = p.acquireTools()
+	params = pt.params
+
+	for _, k := range []string{"a", "b", "c"} {
+		pt.params.set(k, k)
+	}
+	pt.params.reset()
+	pt.variant = append(pt.variant, "a-very-long-variant"...)
+	p.releaseTools(pt)
+
+	if pt.params == params || len(pt.params.p) != 0 {
+		t.Errorf("Proxy.releaseTools() params over the limit have not been discarded")
+	}
+
+	if cap(pt.variant) != 0 {
+		t.Errorf("Proxy.releaseTools() variant capacity == '%d', want '%d'", cap(pt.variant), 0)
+	}
+
+	stats := p.Stats().Pool
+	if stats == nil {
+		t.Fatal("Proxy.Stats() pool is nil")
+	}
+
+	if stats.Gets != 2 || stats.Puts != 2 || stats.Discarded != 1 {
+		t.Errorf("Proxy.Stats() pool == '%+v', want '%d' gets, '%d' puts and '%d' discarded", *stats, 2, 2, 1)
+	}
+}
+
 func TestProxy_getBackend(t *testing.T) {
 	p, err := New(testConfig())
 	if err != nil {
@@ -504,7 +588,7 @@ func TestProxy_newEvaluableExpression(t *testing.T) {
 	}
 }
 
-func TestProxy_parseNocacheRules(t *testing.T) {
+func TestProxy_parseRuleSet(t *testing.T) {
 	type args struct {
 		rules []string
 	}
@@ -552,22 +636,74 @@ func TestProxy_parseNocacheRules(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			p.fileConfig.Nocache = tt.args.rules
 
-			err := p.parseNocacheRules()
+			rs, err := p.parseRuleSet(p.fileConfig)
 			if (err != nil) != tt.want.err {
-				t.Errorf("Proxy.parseNocacheRules() Unexpected error: %v", err)
+				t.Errorf("Proxy.parseRuleSet() Unexpected error: %v", err)
 			}
 
 			if tt.want.err {
 				return
 			}
 
-			if len(p.fileConfig.Nocache) != len(p.nocacheRules) {
-				t.Errorf("Proxy.parseNocacheRules() parsed %d rules, want %d", len(p.fileConfig.Nocache), len(p.nocacheRules))
+			if len(p.fileConfig.Nocache) != len(rs.nocacheRules) {
+				t.Errorf("Proxy.parseRuleSet() parsed %d rules, want %d", len(rs.nocacheRules), len(p.fileConfig.Nocache))
 			}
 		})
 	}
 }
 
+func TestProxy_ReloadRules(t *testing.T) {
+	p, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{statusCode: fasthttp.StatusOK, body: []byte("Kratgo")}
+	p.backends = []fetcher{backend}
+	p.totalBackends = 1
+
+	request := func(path string) *fasthttp.RequestCtx {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(path)
+		ctx.Request.Header.SetHost("www.kratgo.com")
+
+		p.handler(ctx)
+
+		return ctx
+	}
+
+	cfg := testConfig().FileConfig
+	cfg.Nocache = []string{"$(path) == '/reload/nocache/'"}
+	cfg.Response.Headers.Set = []config.Header{{Name: "X-Reloaded", Value: "true"}}
+
+	if err := p.ReloadRules(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := request("/reload/nocache/")
+	request("/reload/nocache/")
+
+	if v := string(ctx.Response.Header.Peek("X-Reloaded")); v != "true" {
+		t.Errorf("Proxy.ReloadRules() header 'X-Reloaded' == '%s', want '%s'", v, "true")
+	}
+
+	if backend.calls != 2 {
+		t.Errorf("Proxy.ReloadRules() nocache rule backend calls == '%d', want '%d'", backend.calls, 2)
+	}
+
+	invalid := cfg
+	invalid.Nocache = []string{"$(fake::X-Requested-With) == 'XMLHttpRequest'"}
+	invalid.Response.Headers.Set = nil
+
+	if err := p.ReloadRules(invalid); err == nil {
+		t.Fatal("Proxy.ReloadRules() with invalid rules, want error")
+	}
+
+	if ctx := request("/reload/old/"); string(ctx.Response.Header.Peek("X-Reloaded")) != "true" {
+		t.Error("Proxy.ReloadRules() with invalid rules has been replaced the old ones")
+	}
+}
+
 func TestProxy_parseHeadersRules(t *testing.T) {
 	type args struct {
 		action typeHeaderAction
@@ -650,7 +786,7 @@ func TestProxy_parseHeadersRules(t *testing.T) {
 		p.headersRules = p.headersRules[:0]
 
 		t.Run(tt.name, func(t *testing.T) {
-			err = p.parseHeadersRules(tt.args.action, tt.args.rules)
+			p.headersRules, err = p.parseHeadersRules(p.headersRules, tt.args.action, tt.args.rules)
 			if (err != nil) != tt.want.err {
 				t.Fatalf("Proxy.parseHeadersRules() Unexpected error: %v", err)
 			}
@@ -696,79 +832,14 @@ func TestProxy_parseHeadersRules(t *testing.T) {
 	}
 }
 
-func TestProxy_saveBackendResponse(t *testing.T) {
-	p, err := New(testConfig())
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	cacheKey := []byte("test")
-	path := []byte("/test/")
-	body := []byte("Test Body")
-	headers := map[string][]byte{
-		"X-Data":   []byte("1"),
-		"X-Data-2": []byte("2"),
-		"X-Data-3": []byte("3"),
-	}
-	entry := cache.AcquireEntry()
-
-	resp := fasthttp.AcquireResponse()
-	resp.SetBody(body)
-	for k, v := range headers {
-		resp.Header.SetCanonical([]byte(k), v)
-	}
-
-	err = p.saveBackendResponse(cacheKey, path, resp, entry)
-	if err != nil {
-		t.Fatalf("Proxy.saveBackendResponse() returns err: %v", err)
-	}
-
-	entry.Reset()
-	err = p.cache.GetBytes(cacheKey, entry)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	r := entry.GetResponse(path)
-	if r == nil {
-		t.Fatalf("Proxy.saveBackendResponse() path '%s' not found in cache", path)
-	}
-
-	if !bytes.Equal(r.Body, body) {
-		t.Fatalf("Proxy.saveBackendResponse() cache body == '%s', want '%s'", r.Body, body)
-	}
-
-	for k, v := range headers {
-		for _, h := range r.Headers {
-			if string(h.Key) == k && bytes.Equal(h.Value, v) {
-				goto next
-			}
-		}
-		t.Errorf("Proxy.saveBackendResponse() header '%s=%s' not found in cache", k, v)
-
-	next:
-	}
-}
-
-func TestProxy_fetchFromBackend(t *testing.T) {
+func TestProxy_cacheVariant(t *testing.T) {
 	type args struct {
-		cacheKey     []byte
-		path         []byte
-		body         []byte
-		method       []byte
-		headers      map[string][]byte
-		statusCode   int
-		noCacheRules []string
-		headersRules []config.Header
-
-		httpClientError              error
-		forceProcessHeaderRulesError bool
-		forceCheckIfNoCacheError     bool
+		cacheKeyCookies []string
+		cookies         map[string]string
 	}
 
 	type want struct {
-		saveInCache bool
-		err         bool
+		variant string
 	}
 
 	tests := []struct {
@@ -777,153 +848,1950 @@ func TestProxy_fetchFromBackend(t *testing.T) {
 		want want
 	}{
 		{
-			name: "StatusOk",
+			name: "NoCookiesConfigured",
 			args: args{
-				cacheKey: []byte("test"),
-				path:     []byte("/test/"),
-				body:     []byte("Test Body"),
-				method:   []byte("POST"),
-				headers: map[string][]byte{
-					"X-Data":   []byte("1"),
-					"X-Data-2": []byte("2"),
-					"X-Data-3": []byte("3"),
-				},
-				statusCode: 200,
+				cookies: map[string]string{"lang": "es"},
 			},
 			want: want{
-				saveInCache: true,
-				err:         false,
+				variant: "",
 			},
 		},
 		{
-			name: "StatusRedirect",
+			name: "WhitelistedCookies",
 			args: args{
-				cacheKey: []byte("test"),
-				path:     []byte("/test/"),
-				body:     []byte("Test Body"),
-				method:   []byte("GET"),
-				headers: map[string][]byte{
-					headerLocation: []byte("http://www.kratgo.com"),
-				},
-				statusCode: 301,
+				cacheKeyCookies: []string{"lang", "theme"},
+				cookies:         map[string]string{"lang": "es", "theme": "dark", "_ga": "GA1.2.3"},
 			},
 			want: want{
-				saveInCache: false,
-				err:         false,
+				variant: "lang=es;theme=dark;",
 			},
 		},
 		{
-			name: "NoCacheByRule",
+			name: "MissingCookie",
 			args: args{
-				cacheKey: []byte("test"),
-				path:     []byte("/test/"),
-				body:     []byte("Test Body"),
-				method:   []byte("GET"),
-				headers: map[string][]byte{
-					"X-Data": []byte("1"),
-				},
-				statusCode: 200,
-				noCacheRules: []string{
-					"$(path) == '/test/'",
-				},
+				cacheKeyCookies: []string{"lang", "theme"},
+				cookies:         map[string]string{"theme": "dark"},
 			},
 			want: want{
-				saveInCache: false,
-				err:         false,
+				variant: "lang=;theme=dark;",
 			},
 		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.CacheKeyCookies = tt.args.cacheKeyCookies
+
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := new(fasthttp.RequestCtx)
+			for k, v := range tt.args.cookies {
+				ctx.Request.Header.SetCookie(k, v)
+			}
+
+			variant := p.cacheVariant(ctx, nil)
+			if string(variant) != tt.want.variant {
+				t.Errorf("Proxy.cacheVariant() == '%s', want '%s'", variant, tt.want.variant)
+			}
+		})
+	}
+}
+
+func TestProxy_queryCacheVariant(t *testing.T) {
+	tests := []struct {
+		name                string
+		cacheKeyQueryParams []string
+		ignoreQueryParams   []string
+		uri                 string
+		want                string
+	}{
 		{
-			name: "NoCacheByStatusCode",
-			args: args{
-				cacheKey: []byte("test"),
-				path:     []byte("/test/"),
-				body:     []byte("Test Body"),
-				method:   []byte("GET"),
-				headers: map[string][]byte{
-					"X-Data": []byte("1"),
-				},
-				statusCode: 404,
-			},
-			want: want{
-				saveInCache: false,
-				err:         false,
-			},
+			name: "NoQueryParamsConfigured",
+			uri:  "/?id=1&utm_source=a",
+			want: "",
 		},
 		{
-			name: "ErrorHttpClientDo",
-			args: args{
-				cacheKey: []byte("test"),
-				path:     []byte("/test/"),
-				body:     []byte("Test Body"),
-				method:   []byte("GET"),
-				headers: map[string][]byte{
-					"X-Data": []byte("1"),
-				},
-				statusCode:      404,
-				httpClientError: errors.New("Error"),
-			},
-			want: want{
-				saveInCache: false,
-				err:         true,
-			},
+			name:                "AllowedQueryParams",
+			cacheKeyQueryParams: []string{"page", "id"},
+			uri:                 "/?utm_source=a&id=1&page=2",
+			want:                "query:page=2;query:id=1;",
 		},
 		{
-			name: "ErrorParseHeaderRules",
-			args: args{
-				cacheKey: []byte("test"),
-				path:     []byte("/test/"),
-				body:     []byte("Test Body"),
-				method:   []byte("GET"),
-				headers: map[string][]byte{
-					"X-Data": []byte("1"),
-				},
-				statusCode: 404,
-				headersRules: []config.Header{
-					{Name: "X-Data", Value: "1", When: "$(path) == '/kratgo'"},
-				},
-				forceProcessHeaderRulesError: true,
-			},
-			want: want{
-				saveInCache: false,
-				err:         true,
-			},
+			name:                "MissingAllowedQueryParam",
+			cacheKeyQueryParams: []string{"page", "id"},
+			uri:                 "/?id=1&empty=",
+			want:                "query:id=1;",
 		},
 		{
-			name: "ErrorCheckIfNoCache",
-			args: args{
-				cacheKey: []byte("test"),
-				path:     []byte("/test/"),
-				body:     []byte("Test Body"),
-				method:   []byte("GET"),
-				headers: map[string][]byte{
-					"X-Data": []byte("1"),
-				},
-				statusCode: 404,
-				noCacheRules: []string{
-					"$(path) == '/test/'",
-				},
-				forceCheckIfNoCacheError: true,
-			},
-			want: want{
-				saveInCache: false,
-				err:         true,
-			},
+			name:              "IgnoredQueryParams",
+			ignoreQueryParams: []string{"utm_source", "utm_medium"},
+			uri:               "/?id=1&utm_source=a&page=2&utm_medium=b",
+			want:              "query:id=1;query:page=2;",
+		},
+		{
+			name:              "OnlyIgnoredQueryParams",
+			ignoreQueryParams: []string{"utm_source"},
+			uri:               "/?utm_source=a",
+			want:              "",
+		},
+		{
+			name:              "EscapedSeparators",
+			ignoreQueryParams: []string{"utm_source"},
+			uri:               "/?a=x%3Bquery%3Ab%3Dy&c%3D=%25",
+			want:              "query:a=x%3Bquery:b%3Dy;query:c%3D=%25;",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := testConfig()
-			cfg.FileConfig.Nocache = tt.args.noCacheRules
-			cfg.FileConfig.Response.Headers.Set = tt.args.headersRules
+			cfg.FileConfig.CacheKeyQueryParams = tt.cacheKeyQueryParams
+			cfg.FileConfig.IgnoreQueryParams = tt.ignoreQueryParams
 
 			p, err := New(cfg)
 			if err != nil {
 				t.Fatal(err)
 			}
 
-			if tt.args.forceProcessHeaderRulesError {
-				p.headersRules[0].params = p.headersRules[0].params[:0]
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.SetRequestURI(tt.uri)
+
+			variant := p.queryCacheVariant(ctx, nil)
+			if string(variant) != tt.want {
+				t.Errorf("Proxy.queryCacheVariant() == '%s', want '%s'", variant, tt.want)
+			}
+		})
+	}
+
+	cfg := testConfig()
+	cfg.FileConfig.IgnoreQueryParams = []string{"utm_source"}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The query strings that are different requests for the backend never have the same variant
+	variants := make(map[string]string)
+	for _, uri := range []string{"/?a=x%3Bquery%3Ab%3Dy", "/?a=x&b=y", "/?a=x%3B&b=y", "/?a=x%253B"} {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(uri)
+
+		variant := string(p.queryCacheVariant(ctx, nil))
+		if other, ok := variants[variant]; ok {
+			t.Errorf("Proxy.queryCacheVariant() of '%s' and '%s' == '%s'", uri, other, variant)
+		}
+
+		variants[variant] = uri
+	}
+
+	cfg = testConfig()
+	cfg.FileConfig.CacheKeyQueryParams = []string{"id"}
+	cfg.FileConfig.IgnoreQueryParams = []string{"utm_source"}
+
+	if _, err := New(cfg); err == nil {
+		t.Error("New() with cacheKeyQueryParams and ignoreQueryParams, want error")
+	}
+}
+
+func TestProxy_privateCacheVariant(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.PrivateCacheKeyHeaders = []string{"Authorization", "X-User"}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variant := func(headers map[string]string) string {
+		ctx := new(fasthttp.RequestCtx)
+		for k, v := range headers {
+			ctx.Request.Header.Set(k, v)
+		}
+
+		return string(p.privateCacheVariant(ctx, nil))
+	}
+
+	if v := variant(nil); v != "" {
+		t.Errorf("Proxy.privateCacheVariant() without private headers == '%s', want '%s'", v, "")
+	}
+
+	alice := variant(map[string]string{"Authorization": "Bearer alice"})
+	bob := variant(map[string]string{"Authorization": "Bearer bob"})
+
+	if !strings.HasPrefix(alice, privateVariantPrefix) || alice == bob {
+		t.Errorf("Proxy.privateCacheVariant() alice == '%s' and bob == '%s', want different private variants", alice, bob)
+	}
+
+	if strings.Contains(alice, "alice") {
+		t.Errorf("Proxy.privateCacheVariant() == '%s', contains the credentials", alice)
+	}
+
+	if again := variant(map[string]string{"Authorization": "Bearer alice"}); again != alice {
+		t.Errorf("Proxy.privateCacheVariant() == '%s', want '%s'", again, alice)
+	}
+
+	// The same value in other header must not share the cache
+	if other := variant(map[string]string{"X-User": "Bearer alice"}); other == alice {
+		t.Errorf("Proxy.privateCacheVariant() same value in other header == '%s', want different", other)
+	}
+}
+
+func TestProxy_handler_PrivateCache(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.PrivateCacheKeyHeaders = []string{"Authorization"}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{statusCode: fasthttp.StatusOK}
+	p.backends = []fetcher{backend}
+	p.totalBackends = 1
+
+	do := func(auth string) string {
+		backend.body = []byte("user:" + auth)
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI("/private/")
+		ctx.Request.Header.SetHost("www.kratgo.com")
+		if auth != "" {
+			ctx.Request.Header.Set("Authorization", auth)
+		}
+
+		p.handler(ctx)
+
+		return string(ctx.Response.Body())
+	}
+
+	for i := 0; i < 2; i++ {
+		for _, auth := range []string{"alice", "bob", ""} {
+			if body := do(auth); body != "user:"+auth {
+				t.Errorf("Proxy.handler() body of '%s' == '%s', want '%s'", auth, body, "user:"+auth)
+			}
+		}
+	}
+
+	if backend.calls != 3 {
+		t.Errorf("Proxy.handler() backend calls == '%d', want '%d'", backend.calls, 3)
+	}
+}
+
+func TestProxy_fetchFromBackend_StripRequestCookies(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.StripRequestCookies = []string{"_ga"}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.backends = []fetcher{&mockBackend{statusCode: 200}}
+	p.totalBackends = len(p.backends)
+
+	pt := p.acquireTools()
+	defer p.releaseTools(pt)
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/test/")
+	ctx.Request.Header.SetCookie("_ga", "GA1.2.3")
+	ctx.Request.Header.SetCookie("lang", "es")
+
+	if err := p.fetchFromBackend([]byte("test"), []byte("/test/"), nil, ctx, pt); err != nil {
+		t.Fatalf("Proxy.fetchFromBackend() Unexpected error: %v", err)
+	}
+
+	if v := ctx.Request.Header.Cookie("_ga"); len(v) > 0 {
+		t.Errorf("Proxy.fetchFromBackend() cookie '_ga' == '%s', want stripped", v)
+	}
+
+	if v := ctx.Request.Header.Cookie("lang"); string(v) != "es" {
+		t.Errorf("Proxy.fetchFromBackend() cookie 'lang' == '%s', want '%s'", v, "es")
+	}
+}
+
+func TestProxy_fetchFromBackend_RequestHeaders(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.RuleMetrics = true
+	cfg.FileConfig.Request.Headers.Set = []config.Header{
+		{Name: "X-Api-Token", Value: "secret", When: "$(path) =~ '^/api/'"},
+		{Name: "X-Forwarded-User", Value: "$(cookie::user)"},
+	}
+	cfg.FileConfig.Request.Headers.Unset = []config.Header{
+		{Name: "X-Debug"},
+	}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.backends = []fetcher{&mockBackend{statusCode: fasthttp.StatusOK}}
+	p.totalBackends = len(p.backends)
+
+	tests := []struct {
+		path      string
+		wantToken string
+	}{
+		{path: "/api/users/", wantToken: "secret"},
+		{path: "/home/", wantToken: ""},
+	}
+
+	for _, tt := range tests {
+		pt := p.acquireTools()
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(tt.path)
+		ctx.Request.Header.Set("X-Debug", "1")
+		ctx.Request.Header.SetCookie("user", "alice")
+
+		if err := p.fetchFromBackend([]byte("test"), []byte(tt.path), nil, ctx, pt); err != nil {
+			t.Fatalf("Proxy.fetchFromBackend() Unexpected error: %v", err)
+		}
+
+		if v := ctx.Request.Header.Peek("X-Api-Token"); string(v) != tt.wantToken {
+			t.Errorf("Proxy.fetchFromBackend() path '%s' request header 'X-Api-Token' == '%s', want '%s'", tt.path, v, tt.wantToken)
+		}
+
+		if v := ctx.Request.Header.Peek("X-Forwarded-User"); string(v) != "alice" {
+			t.Errorf("Proxy.fetchFromBackend() request header 'X-Forwarded-User' == '%s', want '%s'", v, "alice")
+		}
+
+		if v := ctx.Request.Header.Peek("X-Debug"); len(v) > 0 {
+			t.Errorf("Proxy.fetchFromBackend() request header 'X-Debug' == '%s', want unset", v)
+		}
+
+		if v := ctx.Response.Header.Peek("X-Api-Token"); len(v) > 0 {
+			t.Errorf("Proxy.fetchFromBackend() response header 'X-Api-Token' == '%s', want unset", v)
+		}
+
+		p.releaseTools(pt)
+	}
+
+	var requestRules []RuleStats
+	for _, r := range p.Stats().Rules {
+		if r.Type == ruleTypeRequestSet || r.Type == ruleTypeRequestUnset {
+			requestRules = append(requestRules, r)
+		}
+	}
+
+	want := []RuleStats{
+		{Type: ruleTypeRequestSet, Index: 0, Header: "X-Api-Token", Rule: "$(path) =~ '^/api/'", Matches: 1},
+		{Type: ruleTypeRequestSet, Index: 1, Header: "X-Forwarded-User", Matches: 2},
+		{Type: ruleTypeRequestUnset, Index: 0, Header: "X-Debug", Matches: 2},
+	}
+
+	if !reflect.DeepEqual(requestRules, want) {
+		t.Errorf("Proxy.Stats() request rules == '%v', want '%v'", requestRules, want)
+	}
+}
+
+func TestProxy_fetchFromBackend_KeepAlive(t *testing.T) {
+	keepAlive := true
+	disableKeepAlive := false
+
+	tests := []struct {
+		name                string
+		keepAlive           *bool
+		wantConnectionClose bool
+	}{
+		{
+			name:                "Default",
+			keepAlive:           nil,
+			wantConnectionClose: false,
+		},
+		{
+			name:                "Enabled",
+			keepAlive:           &keepAlive,
+			wantConnectionClose: false,
+		},
+		{
+			name:                "Disabled",
+			keepAlive:           &disableKeepAlive,
+			wantConnectionClose: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.BackendKeepAlive = tt.keepAlive
+
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			backend := &mockBackend{
+				statusCode: 200,
+				headers:    map[string][]byte{"Connection": []byte("close")},
+			}
+			p.backends = []fetcher{backend}
+			p.totalBackends = len(p.backends)
+
+			pt := p.acquireTools()
+			defer p.releaseTools(pt)
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.SetRequestURI("/test/")
+
+			if err := p.fetchFromBackend([]byte("test"), []byte("/test/"), nil, ctx, pt); err != nil {
+				t.Fatalf("Proxy.fetchFromBackend() Unexpected error: %v", err)
+			}
+
+			if backend.connectionClose != tt.wantConnectionClose {
+				t.Errorf("Proxy.fetchFromBackend() backend request connection close == '%v', want '%v'", backend.connectionClose, tt.wantConnectionClose)
+			}
+
+			if tt.wantConnectionClose && ctx.Response.ConnectionClose() {
+				t.Errorf("Proxy.fetchFromBackend() client connection must not be closed")
+			}
+		})
+	}
+}
+
+func TestProxy_fetchFromBackend_CacheOnlyWhen(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		headers    map[string][]byte
+		wantCached bool
+	}{
+		{
+			name:       "Cacheable",
+			path:       "/test/",
+			headers:    map[string][]byte{"X-Cache-Ok": []byte("1")},
+			wantCached: true,
+		},
+		{
+			name:       "NotCacheable",
+			path:       "/test/",
+			headers:    map[string][]byte{"X-Cache-Ok": []byte("0")},
+			wantCached: false,
+		},
+		{
+			name:       "WithoutHeader",
+			path:       "/test/",
+			wantCached: false,
+		},
+		{
+			name:       "Nocache",
+			path:       "/nocache/",
+			headers:    map[string][]byte{"X-Cache-Ok": []byte("1")},
+			wantCached: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.Nocache = []string{"$(path) == '/nocache/'"}
+			cfg.FileConfig.CacheOnlyWhen = "$(resp.header::X-Cache-OK) == '1'"
+
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p.backends = []fetcher{&mockBackend{body: []byte("Kratgo"), statusCode: 200, headers: tt.headers}}
+			p.totalBackends = len(p.backends)
+
+			pt := p.acquireTools()
+			defer p.releaseTools(pt)
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.SetRequestURI(tt.path)
+
+			if err := p.fetchFromBackend([]byte("test"), []byte(tt.path), nil, ctx, pt); err != nil {
+				t.Fatalf("Proxy.fetchFromBackend() Unexpected error: %v", err)
+			}
+
+			entry := cache.AcquireEntry()
+			defer cache.ReleaseEntry(entry)
+
+			p.cache.Get("test", entry)
+
+			if cached := entry.GetResponse([]byte(tt.path)) != nil; cached != tt.wantCached {
+				t.Errorf("Proxy.fetchFromBackend() cached == '%v', want '%v'", cached, tt.wantCached)
+			}
+		})
+	}
+
+	cfg := testConfig()
+	cfg.FileConfig.CacheOnlyWhen = "$(resp.header::X-Cache-OK) =="
+
+	if _, err := New(cfg); err == nil {
+		t.Error("New() with invalid cacheOnlyWhen rule, want error")
+	}
+}
+
+func TestProxy_fetchFromBackend_Trailer(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "Cached", path: "/test/"},
+		{name: "NoCached", path: "/nocache/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.Nocache = []string{"$(path) == '/nocache/'"}
+
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p.backends = []fetcher{
+				&mockBackend{
+					body:       []byte("Kratgo"),
+					statusCode: 200,
+					headers:    map[string][]byte{headerTrailer: []byte("X-Checksum")},
+				},
+			}
+			p.totalBackends = len(p.backends)
+
+			pt := p.acquireTools()
+			defer p.releaseTools(pt)
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.SetRequestURI(tt.path)
+			ctx.Request.Header.Set("TE", "trailers")
+
+			if err := p.fetchFromBackend([]byte("test"), []byte(tt.path), nil, ctx, pt); err != nil {
+				t.Fatalf("Proxy.fetchFromBackend() Unexpected error: %v", err)
+			}
+
+			if v := ctx.Request.Header.Peek("TE"); len(v) > 0 {
+				t.Errorf("Proxy.fetchFromBackend() backend request header 'TE' == '%s', want empty", v)
+			}
+
+			if v := ctx.Response.Header.Peek(headerTrailer); len(v) > 0 {
+				t.Errorf("Proxy.fetchFromBackend() response header '%s' == '%s', want empty", headerTrailer, v)
+			}
+		})
+	}
+}
+
+func TestProxy_fetchFromBackend_Retries(t *testing.T) {
+	tests := []struct {
+		name        string
+		retries     int
+		budget      config.RetryBudget
+		wantCalls   int
+		wantOkCalls int
+		wantStatus  int
+	}{
+		{
+			name:        "WithoutRetries",
+			retries:     0,
+			wantCalls:   1,
+			wantOkCalls: 0,
+			wantStatus:  fasthttp.StatusServiceUnavailable,
+		},
+		{
+			name:        "Retried",
+			retries:     1,
+			wantCalls:   1,
+			wantOkCalls: 1,
+			wantStatus:  fasthttp.StatusOK,
+		},
+		{
+			name:        "BudgetExhausted",
+			retries:     1,
+			budget:      config.RetryBudget{Ratio: 0.1, Window: 10},
+			wantCalls:   1,
+			wantOkCalls: 0,
+			wantStatus:  fasthttp.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.BackendRetries = tt.retries
+			cfg.FileConfig.RetryBudget = tt.budget
+
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			failBackend := &mockBackend{statusCode: fasthttp.StatusServiceUnavailable}
+			okBackend := &mockBackend{statusCode: fasthttp.StatusOK}
+
+			// The round robin starts with the second backend
+			p.backends = []fetcher{okBackend, failBackend}
+			p.totalBackends = len(p.backends)
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.SetRequestURI("/retry/")
+
+			pt := p.acquireTools()
+			defer p.releaseTools(pt)
+
+			if err := p.fetchFromBackend([]byte("retry"), []byte("/retry/"), nil, ctx, pt); err != nil {
+				t.Fatalf("Proxy.fetchFromBackend() returns err: %v", err)
+			}
+
+			if failBackend.calls != tt.wantCalls {
+				t.Errorf("Proxy.fetchFromBackend() failing backend calls == '%d', want '%d'", failBackend.calls, tt.wantCalls)
+			}
+
+			if okBackend.calls != tt.wantOkCalls {
+				t.Errorf("Proxy.fetchFromBackend() backend calls == '%d', want '%d'", okBackend.calls, tt.wantOkCalls)
+			}
+
+			if status := ctx.Response.StatusCode(); status != tt.wantStatus {
+				t.Errorf("Proxy.fetchFromBackend() status code == '%d', want '%d'", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestProxy_fetchFromBackend_RetryableStatusCodes(t *testing.T) {
+	tests := []struct {
+		name        string
+		codes       []int
+		statusCode  int
+		wantOkCalls int
+	}{
+		{name: "Default5xx", statusCode: fasthttp.StatusBadGateway, wantOkCalls: 1},
+		{name: "Default4xx", statusCode: fasthttp.StatusTooManyRequests, wantOkCalls: 0},
+		{name: "Configured", codes: []int{429, 503}, statusCode: fasthttp.StatusTooManyRequests, wantOkCalls: 1},
+		{name: "NotConfigured", codes: []int{429, 503}, statusCode: fasthttp.StatusBadGateway, wantOkCalls: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.BackendRetries = 1
+			cfg.FileConfig.RetryableStatusCodes = tt.codes
+
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			failBackend := &mockBackend{statusCode: tt.statusCode}
+			okBackend := &mockBackend{statusCode: fasthttp.StatusOK}
+
+			// The round robin starts with the second backend
+			p.backends = []fetcher{okBackend, failBackend}
+			p.totalBackends = len(p.backends)
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.SetRequestURI("/retry/")
+
+			pt := p.acquireTools()
+			defer p.releaseTools(pt)
+
+			if err := p.fetchFromBackend([]byte("retry"), []byte("/retry/"), nil, ctx, pt); err != nil {
+				t.Fatalf("Proxy.fetchFromBackend() returns err: %v", err)
+			}
+
+			if okBackend.calls != tt.wantOkCalls {
+				t.Errorf("Proxy.fetchFromBackend() backend calls == '%d', want '%d'", okBackend.calls, tt.wantOkCalls)
+			}
+		})
+	}
+
+	cfg := testConfig()
+	cfg.FileConfig.RetryableStatusCodes = []int{1000}
+
+	if _, err := New(cfg); err == nil {
+		t.Errorf("New() with invalid retryable status code, want error")
+	}
+}
+
+func TestProxy_handler_RetryAfter(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.BackendRetries = 1
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overloadedBackend := &mockBackend{
+		statusCode: fasthttp.StatusServiceUnavailable,
+		headers:    map[string][]byte{headerRetryAfter: []byte("60")},
+	}
+	okBackend := &mockBackend{statusCode: fasthttp.StatusOK}
+
+	// The round robin starts with the second backend
+	p.backends = []fetcher{okBackend, overloadedBackend}
+	p.totalBackends = len(p.backends)
+
+	for i := 0; i < 4; i++ {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(fmt.Sprintf("/retry-after/%d", i))
+		ctx.Request.Header.SetHost("www.kratgo.com")
+
+		p.handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != fasthttp.StatusOK {
+			t.Errorf("Proxy.handler() status code == '%d', want '%d'", status, fasthttp.StatusOK)
+		}
+	}
+
+	if overloadedBackend.calls != 1 {
+		t.Errorf("Proxy.handler() overloaded backend calls == '%d', want '%d'", overloadedBackend.calls, 1)
+	}
+
+	if okBackend.calls != 4 {
+		t.Errorf("Proxy.handler() backend calls == '%d', want '%d'", okBackend.calls, 4)
+	}
+
+	// If all the backends are overloaded, they are used anyway
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	resp.Header.Set(headerRetryAfter, "60")
+	p.setOverloaded(okBackend, resp)
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/retry-after/all")
+	ctx.Request.Header.SetHost("www.kratgo.com")
+
+	p.handler(ctx)
+
+	if calls := okBackend.calls + overloadedBackend.calls; calls == 5 {
+		t.Error("Proxy.handler() with all the backends overloaded has not been called any backend")
+	}
+}
+
+func TestProxy_Stats(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.RouteLabels = []config.RouteLabel{
+		{Pattern: "^/api/", Label: "api"},
+		{Pattern: "^/static/", Label: "static"},
+	}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.backends = []fetcher{&mockBackend{statusCode: fasthttp.StatusOK}}
+	p.totalBackends = len(p.backends)
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/api/users/")
+
+	pt := p.acquireTools()
+	defer p.releaseTools(pt)
+
+	if err := p.fetchFromBackend([]byte("stats"), []byte("/api/users/"), nil, ctx, pt); err != nil {
+		t.Fatalf("Proxy.fetchFromBackend() returns err: %v", err)
+	}
+
+	stats := p.Stats()
+
+	if len(stats.Backends) != len(cfg.FileConfig.BackendAddrs) {
+		t.Fatalf("Proxy.Stats() backends == '%d', want '%d'", len(stats.Backends), len(cfg.FileConfig.BackendAddrs))
+	}
+
+	if b := stats.Backends[0]; b.Name != cfg.FileConfig.BackendAddrs[0] || b.Count != 1 {
+		t.Errorf("Proxy.Stats() backend == '%v', want name '%s' and count '%d'", b, cfg.FileConfig.BackendAddrs[0], 1)
+	}
+
+	if len(stats.Routes) != 2 {
+		t.Fatalf("Proxy.Stats() routes == '%d', want '%d'", len(stats.Routes), 2)
+	}
+
+	if r := stats.Routes[0]; r.Name != "api" || r.Count != 1 {
+		t.Errorf("Proxy.Stats() route == '%v', want name '%s' and count '%d'", r, "api", 1)
+	}
+
+	if r := stats.Routes[1]; r.Count != 0 {
+		t.Errorf("Proxy.Stats() route '%s' count == '%d', want '%d'", r.Name, r.Count, 0)
+	}
+
+	cfg.FileConfig.RouteLabels = []config.RouteLabel{{Pattern: "(", Label: "invalid"}}
+	if _, err := New(cfg); err == nil {
+		t.Errorf("New() with invalid route label pattern, want error")
+	}
+}
+
+func TestProxy_Stats_Sizes(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.SizeMetrics = config.SizeMetrics{Enabled: true, Buckets: []int{5, 100}}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.backends = []fetcher{&mockBackend{statusCode: fasthttp.StatusOK, body: []byte("Kratgo")}}
+	p.totalBackends = len(p.backends)
+
+	// The second one is served from cache
+	for i := 0; i < 2; i++ {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI("/sizes/")
+		ctx.Request.Header.SetHost("www.kratgo.com")
+		ctx.Request.SetBodyString("data")
+
+		p.handler(ctx)
+	}
+
+	stats := p.Stats()
+
+	wantRequests := &SizeSummary{Buckets: []SizeBucket{{LE: 5, Count: 2}, {LE: 100, Count: 2}}, Count: 2, Sum: 8}
+	if !reflect.DeepEqual(stats.RequestSizes, wantRequests) {
+		t.Errorf("Proxy.Stats() request sizes == '%v', want '%v'", stats.RequestSizes, wantRequests)
+	}
+
+	wantResponses := &SizeSummary{Buckets: []SizeBucket{{LE: 5, Count: 0}, {LE: 100, Count: 2}}, Count: 2, Sum: 12}
+	if !reflect.DeepEqual(stats.ResponseSizes, wantResponses) {
+		t.Errorf("Proxy.Stats() response sizes == '%v', want '%v'", stats.ResponseSizes, wantResponses)
+	}
+
+	cfg.FileConfig.SizeMetrics.Buckets = []int{100, 5}
+	if _, err := New(cfg); err == nil {
+		t.Errorf("New() with invalid size buckets, want error")
+	}
+}
+
+func TestProxy_Stats_Rules(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.Nocache = []string{"$(path) == '/nocache/'", "$(path) == '/never/'"}
+	cfg.FileConfig.Response.Headers.Set = []config.Header{{Name: "X-Kratgo", Value: "true"}}
+	cfg.FileConfig.Response.Headers.Unset = []config.Header{{Name: "X-Data", When: "$(path) == '/never/'"}}
+	cfg.FileConfig.Response.Headers.Append = []config.Header{{Name: "Link", Value: "</app.css>; rel=preload"}}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := p.Stats(); stats.Rules != nil {
+		t.Fatalf("Proxy.Stats() rules == '%v', want nil with rule metrics disabled", stats.Rules)
+	}
+
+	cfg.FileConfig.RuleMetrics = true
+
+	p, err = New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.backends = []fetcher{&mockBackend{statusCode: fasthttp.StatusOK}}
+	p.totalBackends = len(p.backends)
+
+	for _, path := range []string{"/nocache/", "/cache/"} {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(path)
+		ctx.Request.Header.SetHost("www.kratgo.com")
+
+		p.handler(ctx)
+	}
+
+	want := []RuleStats{
+		// Evaluated before the cache lookup and before saving the backend response
+		{Type: ruleTypeNocache, Index: 0, Rule: cfg.FileConfig.Nocache[0], Matches: 2},
+		{Type: ruleTypeNocache, Index: 1, Rule: cfg.FileConfig.Nocache[1], Matches: 0},
+		{Type: ruleTypeSet, Index: 0, Header: "X-Kratgo", Matches: 2},
+		{Type: ruleTypeUnset, Index: 0, Header: "X-Data", Rule: cfg.FileConfig.Response.Headers.Unset[0].When, Matches: 0},
+		{Type: ruleTypeAppend, Index: 0, Header: "Link", Matches: 2},
+	}
+
+	if stats := p.Stats(); !reflect.DeepEqual(stats.Rules, want) {
+		t.Errorf("Proxy.Stats() rules == '%v', want '%v'", stats.Rules, want)
+	}
+}
+
+func TestProxy_saveBackendResponse(t *testing.T) {
+	p, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cacheKey := []byte("test")
+	path := []byte("/test/")
+	body := []byte("Test Body")
+	headers := map[string][]byte{
+		"X-Data":   []byte("1"),
+		"X-Data-2": []byte("2"),
+		"X-Data-3": []byte("3"),
+	}
+	entry := cache.AcquireEntry()
+
+	resp := fasthttp.AcquireResponse()
+	resp.SetBody(body)
+	for k, v := range headers {
+		resp.Header.SetCanonical([]byte(k), v)
+	}
+
+	err = p.saveBackendResponse(cacheKey, path, nil, resp, entry)
+	if err != nil {
+		t.Fatalf("Proxy.saveBackendResponse() returns err: %v", err)
+	}
+
+	entry.Reset()
+	err = p.cache.GetBytes(cacheKey, entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := entry.GetResponse(path)
+	if r == nil {
+		t.Fatalf("Proxy.saveBackendResponse() path '%s' not found in cache", path)
+	}
+
+	if !bytes.Equal(r.Body, body) {
+		t.Fatalf("Proxy.saveBackendResponse() cache body == '%s', want '%s'", r.Body, body)
+	}
+
+	if r.StoredAt == 0 {
+		t.Errorf("Proxy.saveBackendResponse() StoredAt has not been set")
+	}
+
+	if v := resp.Header.Peek(headerAge); string(v) != "0" {
+		t.Errorf("Proxy.saveBackendResponse() header '%s' == '%s', want '%s'", headerAge, v, "0")
+	}
+
+	for k, v := range headers {
+		for _, h := range r.Headers {
+			if string(h.Key) == k && bytes.Equal(h.Value, v) {
+				goto next
+			}
+		}
+		t.Errorf("Proxy.saveBackendResponse() header '%s=%s' not found in cache", k, v)
+
+	next:
+	}
+}
+
+func TestProxy_saveBackendResponse_CacheHeaders(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.Response.Headers.Cache.Deny = []string{"Server", "X-Powered-By"}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cacheKey := []byte("cache-headers")
+	path := []byte("/cache-headers/")
+	entry := cache.AcquireEntry()
+
+	resp := fasthttp.AcquireResponse()
+	resp.Header.Set("Server", "nginx")
+	resp.Header.Set("X-Powered-By", "PHP")
+	resp.Header.Set("X-Data", "1")
+
+	if err := p.saveBackendResponse(cacheKey, path, nil, resp, entry); err != nil {
+		t.Fatalf("Proxy.saveBackendResponse() returns err: %v", err)
+	}
+
+	if v := resp.Header.Peek("X-Powered-By"); string(v) != "PHP" {
+		t.Errorf("Proxy.saveBackendResponse() live response header '%s' == '%s', want '%s'", "X-Powered-By", v, "PHP")
+	}
+
+	entry.Reset()
+	if err := p.cache.GetBytes(cacheKey, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	r := entry.GetResponse(path)
+	if r == nil {
+		t.Fatalf("Proxy.saveBackendResponse() path '%s' not found in cache", path)
+	}
+
+	for _, h := range r.Headers {
+		if k := string(h.Key); k == "Server" || k == "X-Powered-By" {
+			t.Errorf("Proxy.saveBackendResponse() denied header '%s' has been saved in cache", k)
+		}
+	}
+
+	if !r.HasHeader([]byte("X-Data"), []byte("1")) {
+		t.Errorf("Proxy.saveBackendResponse() header '%s' not found in cache", "X-Data")
+	}
+}
+
+func TestProxy_saveBackendResponse_ContentLength(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.Response.Headers.Cache.Allow = []string{"Content-Type"}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cacheKey := []byte("content-length")
+	path := []byte("/content-length/")
+	entry := cache.AcquireEntry()
+
+	// Streamed response, without Content-Length
+	resp := fasthttp.AcquireResponse()
+	resp.Header.Set("Transfer-Encoding", "chunked")
+	resp.SetBodyString("chunked")
+
+	if err := p.saveBackendResponse(cacheKey, path, nil, resp, entry); err != nil {
+		t.Fatalf("Proxy.saveBackendResponse() returns err: %v", err)
+	}
+
+	if cl := resp.Header.ContentLength(); cl != len("chunked") {
+		t.Errorf("Proxy.saveBackendResponse() live response Content-Length == '%d', want '%d'", cl, len("chunked"))
+	}
+
+	entry.Reset()
+	if err := p.cache.GetBytes(cacheKey, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	r := entry.GetResponse(path)
+	if r == nil {
+		t.Fatalf("Proxy.saveBackendResponse() path '%s' not found in cache", path)
+	}
+
+	contentLength := 0
+	for _, h := range r.Headers {
+		switch string(h.Key) {
+		case "Content-Length":
+			contentLength++
+			if string(h.Value) != "7" {
+				t.Errorf("Proxy.saveBackendResponse() Content-Length == '%s', want '%s'", h.Value, "7")
+			}
+		case "Transfer-Encoding":
+			t.Errorf("Proxy.saveBackendResponse() header '%s' has been saved in cache", h.Key)
+		}
+	}
+
+	if contentLength != 1 {
+		t.Errorf("Proxy.saveBackendResponse() Content-Length headers == '%d', want '%d'", contentLength, 1)
+	}
+}
+
+func TestProxy_handler_MultiValueHeaders(t *testing.T) {
+	p, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{
+		statusCode: fasthttp.StatusOK,
+		body:       []byte("multi"),
+		addHeaders: [][2]string{
+			{"Set-Cookie", "a=1; Path=/"},
+			{"Set-Cookie", "b=2; Path=/"},
+			{"Link", "</style.css>; rel=preload"},
+			{"Link", "</script.js>; rel=preload"},
+		},
+	}
+	p.backends = []fetcher{backend}
+	p.totalBackends = 1
+
+	for i, wantHit := range []bool{false, true} {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI("/multi/")
+		ctx.Request.Header.SetHost("www.kratgo.com")
+
+		p.handler(ctx)
+
+		if hit := backend.calls == 1 && i == 1; hit != wantHit {
+			t.Fatalf("Proxy.handler() request %d cache hit == '%v', want '%v'", i, hit, wantHit)
+		}
+
+		var cookies, links []string
+		ctx.Response.Header.VisitAll(func(k, v []byte) {
+			switch string(k) {
+			case "Set-Cookie":
+				cookies = append(cookies, string(v))
+			case "Link":
+				links = append(links, string(v))
+			}
+		})
+
+		wantCookies := []string{"a=1; Path=/", "b=2; Path=/"}
+		if !reflect.DeepEqual(cookies, wantCookies) {
+			t.Errorf("Proxy.handler() request %d Set-Cookie == '%v', want '%v'", i, cookies, wantCookies)
+		}
+
+		wantLinks := []string{"</style.css>; rel=preload", "</script.js>; rel=preload"}
+		if !reflect.DeepEqual(links, wantLinks) {
+			t.Errorf("Proxy.handler() request %d Link == '%v', want '%v'", i, links, wantLinks)
+		}
+	}
+}
+
+func TestProxy_handler_CacheTooLarge(t *testing.T) {
+	p, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bigger than a cache shard, so it's served without caching it
+	body := bytes.Repeat([]byte("a"), 64*1024)
+
+	backend := &mockBackend{statusCode: fasthttp.StatusOK, body: body}
+	p.backends = []fetcher{backend}
+	p.totalBackends = 1
+
+	for i := 1; i <= 2; i++ {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI("/big/")
+		ctx.Request.Header.SetHost("www.kratgo.com")
+
+		p.handler(ctx)
+
+		if statusCode := ctx.Response.StatusCode(); statusCode != fasthttp.StatusOK {
+			t.Errorf("Proxy.handler() status code == '%d', want '%d'", statusCode, fasthttp.StatusOK)
+		}
+
+		if !bytes.Equal(ctx.Response.Body(), body) {
+			t.Errorf("Proxy.handler() body length == '%d', want '%d'", len(ctx.Response.Body()), len(body))
+		}
+
+		stats := p.Stats()
+
+		if tooLarge := stats.CacheTooLarge; tooLarge != uint64(i) {
+			t.Errorf("Proxy.Stats() cache too large == '%d', want '%d'", tooLarge, i)
+		}
+
+		if errs := stats.CacheStoreErrors; errs != 0 {
+			t.Errorf("Proxy.Stats() cache store errors == '%d', want '%d'", errs, 0)
+		}
+	}
+
+	if backend.calls != 2 {
+		t.Errorf("Proxy.handler() backend calls == '%d', want '%d'", backend.calls, 2)
+	}
+}
+
+func TestProxy_handler_CacheableContentTypes(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.CacheableContentTypes.Deny = []string{"application/octet-stream"}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		contentType string
+		wantCalls   int
+	}{
+		{contentType: "text/html; charset=utf-8", wantCalls: 1},
+		{contentType: "application/octet-stream", wantCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			backend := &mockBackend{
+				statusCode: fasthttp.StatusOK,
+				body:       []byte("Kratgo"),
+				headers:    map[string][]byte{"Content-Type": []byte(tt.contentType)},
+			}
+			p.backends = []fetcher{backend}
+			p.totalBackends = 1
+
+			for i := 0; i < 2; i++ {
+				ctx := new(fasthttp.RequestCtx)
+				ctx.Request.SetRequestURI("/" + tt.contentType)
+				ctx.Request.Header.SetHost("www.kratgo.com")
+
+				p.handler(ctx)
+
+				if contentType := string(ctx.Response.Header.ContentType()); contentType != tt.contentType {
+					t.Errorf("Proxy.handler() Content-Type == '%s', want '%s'", contentType, tt.contentType)
+				}
+			}
+
+			if backend.calls != tt.wantCalls {
+				t.Errorf("Proxy.handler() backend calls == '%d', want '%d'", backend.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestProxy_handler_AlwaysHeaders(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.Response.Headers.Unset = []config.Header{{Name: "X-Content-Type-Options"}}
+	cfg.FileConfig.Response.Headers.Always = []config.Header{
+		{Name: "X-Content-Type-Options", Value: "nosniff"},
+		{Name: "Strict-Transport-Security", Value: "max-age=31536000"},
+	}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{statusCode: fasthttp.StatusOK, body: []byte("Kratgo")}
+	p.backends = []fetcher{backend}
+	p.totalBackends = 1
+
+	// The second one is served from cache
+	for i := 0; i < 2; i++ {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI("/always/")
+		ctx.Request.Header.SetHost("www.kratgo.com")
+
+		p.handler(ctx)
+
+		for _, h := range cfg.FileConfig.Response.Headers.Always {
+			if v := string(ctx.Response.Header.Peek(h.Name)); v != h.Value {
+				t.Errorf("Proxy.handler() header '%s' == '%s', want '%s'", h.Name, v, h.Value)
+			}
+		}
+	}
+
+	if backend.calls != 1 {
+		t.Errorf("Proxy.handler() backend calls == '%d', want '%d'", backend.calls, 1)
+	}
+
+	cfg.FileConfig.Response.Headers.Always = []config.Header{{Name: "X-Frame-Options", Value: "DENY", When: "$(path) == '/'"}}
+
+	if _, err := New(cfg); err == nil {
+		t.Errorf("New() with conditional always header, want error")
+	}
+}
+
+func TestProxy_handler_HeadersRules(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.Response.Headers.Set = []config.Header{
+		{Name: "X-Debug-Response", Value: "true", When: "$(req.header::X-Debug) == '1'"},
+	}
+	cfg.FileConfig.Response.Headers.Append = []config.Header{{Name: "X-Via", Value: "kratgo"}}
+	cfg.FileConfig.Response.Headers.Unset = []config.Header{{Name: "X-Powered-By"}}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{
+		statusCode: fasthttp.StatusOK,
+		body:       []byte("Kratgo"),
+		headers:    map[string][]byte{"X-Powered-By": []byte("PHP"), "X-Via": []byte("backend")},
+	}
+	p.backends = []fetcher{backend}
+	p.totalBackends = 1
+
+	do := func(debug string) *fasthttp.RequestCtx {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI("/headers/")
+		ctx.Request.Header.SetHost("www.kratgo.com")
+		ctx.Request.Header.Set("X-Debug", debug)
+
+		p.handler(ctx)
+
+		return ctx
+	}
+
+	// The second one is served from cache, with the rules evaluated for its request
+	for i, debug := range []string{"0", "1"} {
+		ctx := do(debug)
+
+		if v := ctx.Response.Header.Peek("X-Powered-By"); len(v) > 0 {
+			t.Errorf("Proxy.handler() request %d header '%s' == '%s', want unset", i, "X-Powered-By", v)
+		}
+
+		var via []string
+		ctx.Response.Header.VisitAll(func(k, v []byte) {
+			if string(k) == "X-Via" {
+				via = append(via, string(v))
+			}
+		})
+
+		if !reflect.DeepEqual(via, []string{"backend", "kratgo"}) {
+			t.Errorf("Proxy.handler() request %d header '%s' == '%v', want '%v'", i, "X-Via", via, []string{"backend", "kratgo"})
+		}
+
+		wantDebug := ""
+		if debug == "1" {
+			wantDebug = "true"
+		}
+
+		if v := string(ctx.Response.Header.Peek("X-Debug-Response")); v != wantDebug {
+			t.Errorf("Proxy.handler() request %d header '%s' == '%s', want '%s'", i, "X-Debug-Response", v, wantDebug)
+		}
+	}
+
+	if backend.calls != 1 {
+		t.Errorf("Proxy.handler() backend calls == '%d', want '%d'", backend.calls, 1)
+	}
+
+	// The cache has the backend headers, without the rules
+	entry := cache.AcquireEntry()
+	defer cache.ReleaseEntry(entry)
+
+	if err := p.cache.GetBytes([]byte("www.kratgo.com"), entry); err != nil {
+		t.Fatal(err)
+	}
+
+	r := entry.GetResponse([]byte("/headers/"))
+	if r == nil {
+		t.Fatal("Proxy.handler() the response has not been cached")
+	}
+
+	if v := r.Header([]byte("X-Powered-By")); string(v) != "PHP" {
+		t.Errorf("Proxy.handler() cached header '%s' == '%s', want '%s'", "X-Powered-By", v, "PHP")
+	}
+
+	// The rule that fails is skipped, and the rest are applied
+	p.headersRules[0].params = p.headersRules[0].params[:0]
+
+	ctx := do("1")
+	if ctx.Response.StatusCode() != fasthttp.StatusOK {
+		t.Errorf("Proxy.handler() status code with invalid rule == '%d', want '%d'",
+			ctx.Response.StatusCode(), fasthttp.StatusOK)
+	}
+
+	if v := ctx.Response.Header.Peek("X-Debug-Response"); len(v) > 0 {
+		t.Errorf("Proxy.handler() header '%s' with invalid rule == '%s', want unset", "X-Debug-Response", v)
+	}
+
+	if v := ctx.Response.Header.Peek("X-Powered-By"); len(v) > 0 {
+		t.Errorf("Proxy.handler() header '%s' with invalid rule == '%s', want unset", "X-Powered-By", v)
+	}
+}
+
+func TestProxy_handler_CacheKeyHostRewrite(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.CacheKeyHostRewrite = []config.HostRewrite{{Pattern: "*.example.com", Host: "example.com"}}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{body: []byte("Kratgo"), statusCode: fasthttp.StatusOK}
+	p.backends = []fetcher{backend}
+	p.totalBackends = len(p.backends)
+
+	for _, host := range []string{"a.example.com", "b.example.com"} {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI("/test/")
+		ctx.Request.SetHost(host)
+
+		p.handler(ctx)
+
+		if body := string(ctx.Response.Body()); body != "Kratgo" {
+			t.Errorf("Proxy.handler() host '%s' body == '%s', want '%s'", host, body, "Kratgo")
+		}
+	}
+
+	if backend.calls != 1 {
+		t.Errorf("Proxy.handler() backend calls == '%d', want '%d'", backend.calls, 1)
+	}
+
+	if host := string(backend.host); host != "a.example.com" {
+		t.Errorf("Proxy.handler() backend request host == '%s', want '%s'", host, "a.example.com")
+	}
+
+	entry := cache.AcquireEntry()
+	defer cache.ReleaseEntry(entry)
+
+	if err := p.cache.Get("example.com", entry); err != nil || entry.GetResponse([]byte("/test/")) == nil {
+		t.Errorf("Proxy.handler() response not cached with the host 'example.com': %v", err)
+	}
+}
+
+func TestProxy_handler_IgnoreQueryParams(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.IgnoreQueryParams = []string{"utm_source"}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{body: []byte("Kratgo"), statusCode: fasthttp.StatusOK}
+	p.backends = []fetcher{backend}
+	p.totalBackends = len(p.backends)
+
+	tests := []struct {
+		uri       string
+		wantCalls int
+	}{
+		{uri: "/query/?id=1&utm_source=a", wantCalls: 1},
+		{uri: "/query/?id=1&utm_source=b", wantCalls: 1},
+		{uri: "/query/?id=2&utm_source=a", wantCalls: 2},
+	}
+
+	for _, tt := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(tt.uri)
+		ctx.Request.SetHost("query.kratgo.com")
+
+		p.handler(ctx)
+
+		if body := string(ctx.Response.Body()); body != "Kratgo" {
+			t.Errorf("Proxy.handler() uri '%s' body == '%s', want '%s'", tt.uri, body, "Kratgo")
+		}
+
+		if backend.calls != tt.wantCalls {
+			t.Errorf("Proxy.handler() uri '%s' backend calls == '%d', want '%d'", tt.uri, backend.calls, tt.wantCalls)
+		}
+	}
+
+	// The backend always receives the full query string
+	if uri := string(backend.uri); uri != "/query/?id=2&utm_source=a" {
+		t.Errorf("Proxy.handler() backend request uri == '%s', want '%s'", uri, "/query/?id=2&utm_source=a")
+	}
+}
+
+func TestProxy_handler_ErrorFormat(t *testing.T) {
+	tests := []struct {
+		name            string
+		format          string
+		wantContentType string
+		wantJSON        bool
+	}{
+		{name: "Default", format: "", wantContentType: "text/plain; charset=utf-8"},
+		{name: "Text", format: "text", wantContentType: "text/plain; charset=utf-8"},
+		{name: "JSON", format: "json", wantContentType: "application/json", wantJSON: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.ErrorFormat = tt.format
+
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p.backends = []fetcher{&mockBackend{err: fasthttp.ErrConnectionClosed}}
+			p.totalBackends = 1
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.SetRequestURI("/error/")
+			ctx.Request.Header.SetHost("www.kratgo.com")
+
+			p.handler(ctx)
+
+			if statusCode := ctx.Response.StatusCode(); statusCode != fasthttp.StatusBadGateway {
+				t.Errorf("Proxy.handler() status code == '%d', want '%d'", statusCode, fasthttp.StatusBadGateway)
+			}
+
+			if ct := string(ctx.Response.Header.ContentType()); ct != tt.wantContentType {
+				t.Errorf("Proxy.handler() content type == '%s', want '%s'", ct, tt.wantContentType)
+			}
+
+			if !tt.wantJSON {
+				return
+			}
+
+			body := new(errorBody)
+			if err := json.Unmarshal(ctx.Response.Body(), body); err != nil {
+				t.Fatalf("Proxy.handler() invalid json error '%s': %v", ctx.Response.Body(), err)
+			}
+
+			if body.Status != fasthttp.StatusBadGateway {
+				t.Errorf("Proxy.handler() json error status == '%d', want '%d'", body.Status, fasthttp.StatusBadGateway)
+			}
+
+			if body.Error == "" {
+				t.Error("Proxy.handler() json error without message")
+			}
+
+			requestID := string(ctx.Response.Header.Peek(defaultRequestIDHeader))
+			if body.RequestID == "" || body.RequestID != requestID {
+				t.Errorf("Proxy.handler() json error request ID == '%s', want '%s'", body.RequestID, requestID)
+			}
+		})
+	}
+
+	cfg := testConfig()
+	cfg.FileConfig.ErrorFormat = "xml"
+
+	if _, err := New(cfg); err == nil {
+		t.Errorf("New() with invalid error format, want error")
+	}
+}
+
+type mockRevalidatingBackend struct {
+	etag        string
+	calls       int
+	ifNoneMatch string
+}
+
+func (mock *mockRevalidatingBackend) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	mock.calls++
+	mock.ifNoneMatch = string(req.Header.Peek(headerIfNoneMatch))
+
+	if mock.ifNoneMatch == mock.etag {
+		resp.SetStatusCode(fasthttp.StatusNotModified)
+		return nil
+	}
+
+	resp.SetStatusCode(fasthttp.StatusOK)
+	resp.Header.Set(headerETag, mock.etag)
+	resp.SetBodyString("body " + mock.etag)
+
+	return nil
+}
+
+func TestProxy_handler_ConditionalRevalidation(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.ConditionalRevalidation = true
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockRevalidatingBackend{etag: `"v1"`}
+	p.backends = []fetcher{backend}
+	p.totalBackends = 1
+
+	host := []byte("www.kratgo.com")
+	path := []byte("/asset.js")
+
+	do := func(ifNoneMatch string) *fasthttp.RequestCtx {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURIBytes(path)
+		ctx.Request.Header.SetHostBytes(host)
+		if ifNoneMatch != "" {
+			ctx.Request.Header.Set(headerIfNoneMatch, ifNoneMatch)
+		}
+
+		p.handler(ctx)
+
+		return ctx
+	}
+
+	expire := func() {
+		entry := cache.AcquireEntry()
+		defer cache.ReleaseEntry(entry)
+
+		if err := p.cache.GetBytes(host, entry); err != nil {
+			t.Fatal(err)
+		}
+
+		entry.GetResponse(path).ExpiresAt = 1
+		if err := p.cache.SetBytes(host, *entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	do("")
+	expire()
+
+	// The client validator must not be sent instead of the cached one
+	ctx := do(`"other"`)
+	if backend.calls != 2 || backend.ifNoneMatch != `"v1"` {
+		t.Fatalf("Proxy.handler() backend calls == '%d' with If-None-Match '%s', want '%d' with '%s'",
+			backend.calls, backend.ifNoneMatch, 2, `"v1"`)
+	}
+
+	if statusCode := ctx.Response.StatusCode(); statusCode != fasthttp.StatusOK {
+		t.Errorf("Proxy.handler() revalidated status code == '%d', want '%d'", statusCode, fasthttp.StatusOK)
+	}
+
+	if body := string(ctx.Response.Body()); body != `body "v1"` {
+		t.Errorf("Proxy.handler() revalidated body == '%s', want '%s'", body, `body "v1"`)
+	}
+
+	// Refreshed, so it's served from cache
+	do("")
+	if backend.calls != 2 {
+		t.Errorf("Proxy.handler() backend calls == '%d', want '%d'", backend.calls, 2)
+	}
+
+	// Changed in the backend
+	backend.etag = `"v2"`
+	expire()
+
+	ctx = do("")
+	if body := string(ctx.Response.Body()); backend.calls != 3 || body != `body "v2"` {
+		t.Errorf("Proxy.handler() backend calls == '%d' with body '%s', want '%d' with '%s'", backend.calls, body, 3, `body "v2"`)
+	}
+
+	ctx = do("")
+	if body := string(ctx.Response.Body()); backend.calls != 3 || body != `body "v2"` {
+		t.Errorf("Proxy.handler() backend calls == '%d' with body '%s', want '%d' with '%s'", backend.calls, body, 3, `body "v2"`)
+	}
+}
+
+func TestProxy_saveBackendResponse_TTLByContentType(t *testing.T) {
+	c, err := cache.New(cache.Config{
+		FileConfig: config.Cache{
+			TTL:              10,
+			CleanFrequency:   5,
+			MaxEntries:       5,
+			MaxEntrySize:     20,
+			HardMaxCacheSize: 30,
+			TTLByContentType: []config.ContentTypeTTL{
+				{ContentType: "application/json", TTL: 1},
+				{ContentType: "image/*", TTL: 60},
+			},
+		},
+		LogLevel:  logger.ERROR,
+		LogOutput: os.Stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig()
+	cfg.Cache = c
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		contentType   string
+		wantExpiresIn int64
+	}{
+		{name: "JSON", contentType: "application/json; charset=utf-8", wantExpiresIn: 60},
+		{name: "Image", contentType: "image/png", wantExpiresIn: 0},
+		{name: "Unmatched", contentType: "text/html", wantExpiresIn: 600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheKey := []byte("ttl-" + tt.name)
+			path := []byte("/ttl/")
+			entry := cache.AcquireEntry()
+			defer cache.ReleaseEntry(entry)
+
+			resp := fasthttp.AcquireResponse()
+			defer fasthttp.ReleaseResponse(resp)
+
+			resp.SetBody([]byte("Test Body"))
+			resp.Header.SetContentType(tt.contentType)
+
+			if err := p.saveBackendResponse(cacheKey, path, nil, resp, entry); err != nil {
+				t.Fatalf("Proxy.saveBackendResponse() returns err: %v", err)
+			}
+
+			entry.Reset()
+			if err := p.cache.GetBytes(cacheKey, entry); err != nil {
+				t.Fatal(err)
+			}
+
+			r := entry.GetResponse(path)
+			if r == nil {
+				t.Fatal("Proxy.saveBackendResponse() has not been cached the response")
+			}
+
+			var wantExpiresAt int64
+			if tt.wantExpiresIn > 0 {
+				wantExpiresAt = r.StoredAt + tt.wantExpiresIn
+			}
+
+			if r.ExpiresAt != wantExpiresAt {
+				t.Errorf("Proxy.saveBackendResponse() ExpiresAt == '%d', want '%d'", r.ExpiresAt, wantExpiresAt)
+			}
+		})
+	}
+}
+
+func TestProxy_saveBackendResponse_Surrogate(t *testing.T) {
+	p, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		control       string
+		wantCached    bool
+		wantExpiresIn int64
+	}{
+		{name: "MaxAge", control: "max-age=60", wantCached: true, wantExpiresIn: 60},
+		{name: "NoStore", control: "no-store", wantCached: false},
+		{name: "Without", control: "", wantCached: true, wantExpiresIn: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheKey := []byte("surrogate-" + tt.name)
+			path := []byte("/surrogate/")
+			entry := cache.AcquireEntry()
+
+			resp := fasthttp.AcquireResponse()
+			resp.SetBody([]byte("Test Body"))
+			resp.Header.Set(headerSurrogateKey, "product-1  category-2")
+			if tt.control != "" {
+				resp.Header.Set(headerSurrogateControl, tt.control)
+			}
+
+			if err := p.saveBackendResponse(cacheKey, path, nil, resp, entry); err != nil {
+				t.Fatalf("Proxy.saveBackendResponse() returns err: %v", err)
+			}
+
+			if v := resp.Header.Peek(headerSurrogateControl); len(v) > 0 {
+				t.Errorf("Proxy.saveBackendResponse() header '%s' has not been removed", headerSurrogateControl)
+			}
+
+			entry.Reset()
+			if err := p.cache.GetBytes(cacheKey, entry); err != nil {
+				t.Fatal(err)
+			}
+
+			r := entry.GetResponse(path)
+			if (r != nil) != tt.wantCached {
+				t.Fatalf("Proxy.saveBackendResponse() cached == '%v', want '%v'", r != nil, tt.wantCached)
+			}
+
+			if !tt.wantCached {
+				return
+			}
+
+			var wantExpiresAt int64
+			if tt.wantExpiresIn > 0 {
+				wantExpiresAt = r.StoredAt + tt.wantExpiresIn
+			}
+
+			if r.ExpiresAt != wantExpiresAt {
+				t.Errorf("Proxy.saveBackendResponse() ExpiresAt == '%d', want '%d'", r.ExpiresAt, wantExpiresAt)
+			}
+
+			for _, tag := range []string{"product-1", "category-2"} {
+				if !r.HasTag([]byte(tag)) {
+					t.Errorf("Proxy.saveBackendResponse() tag '%s' not found in cache", tag)
+				}
+			}
+		})
+	}
+}
+
+func TestProxy_saveBackendResponse_TTLHeader(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.TTLHeader = "X-Kratgo-TTL"
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		ttl           string
+		control       string
+		wantCached    bool
+		wantExpiresIn int64
+	}{
+		{name: "Valid", ttl: "120", wantCached: true, wantExpiresIn: 120},
+		{name: "OverSurrogateMaxAge", ttl: "120", control: "max-age=60", wantCached: true, wantExpiresIn: 120},
+		{name: "SurrogateNoStore", ttl: "120", control: "no-store", wantCached: false},
+		{name: "Invalid", ttl: "2m", wantCached: true, wantExpiresIn: 0},
+		{name: "Zero", ttl: "0", wantCached: true, wantExpiresIn: 0},
+		{name: "Without", ttl: "", wantCached: true, wantExpiresIn: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheKey := []byte("ttl-header-" + tt.name)
+			path := []byte("/ttl-header/")
+			entry := cache.AcquireEntry()
+			defer cache.ReleaseEntry(entry)
+
+			resp := fasthttp.AcquireResponse()
+			defer fasthttp.ReleaseResponse(resp)
+
+			resp.SetBody([]byte("Test Body"))
+			if tt.ttl != "" {
+				resp.Header.Set(cfg.FileConfig.TTLHeader, tt.ttl)
+			}
+			if tt.control != "" {
+				resp.Header.Set(headerSurrogateControl, tt.control)
+			}
+
+			if err := p.saveBackendResponse(cacheKey, path, nil, resp, entry); err != nil {
+				t.Fatalf("Proxy.saveBackendResponse() returns err: %v", err)
+			}
+
+			if v := resp.Header.Peek(cfg.FileConfig.TTLHeader); len(v) > 0 {
+				t.Errorf("Proxy.saveBackendResponse() header '%s' has not been removed", cfg.FileConfig.TTLHeader)
+			}
+
+			entry.Reset()
+			if err := p.cache.GetBytes(cacheKey, entry); err != nil {
+				t.Fatal(err)
+			}
+
+			r := entry.GetResponse(path)
+			if (r != nil) != tt.wantCached {
+				t.Fatalf("Proxy.saveBackendResponse() cached == '%v', want '%v'", r != nil, tt.wantCached)
+			}
+
+			if !tt.wantCached {
+				return
+			}
+
+			var wantExpiresAt int64
+			if tt.wantExpiresIn > 0 {
+				wantExpiresAt = r.StoredAt + tt.wantExpiresIn
+			}
+
+			if r.ExpiresAt != wantExpiresAt {
+				t.Errorf("Proxy.saveBackendResponse() ExpiresAt == '%d', want '%d'", r.ExpiresAt, wantExpiresAt)
+			}
+
+			if v := r.Header([]byte(cfg.FileConfig.TTLHeader)); len(v) > 0 {
+				t.Errorf("Proxy.saveBackendResponse() header '%s' has been saved in cache", cfg.FileConfig.TTLHeader)
+			}
+		})
+	}
+}
+
+func TestProxy_fetchFromBackend(t *testing.T) {
+	type args struct {
+		cacheKey     []byte
+		path         []byte
+		body         []byte
+		method       []byte
+		headers      map[string][]byte
+		statusCode   int
+		noCacheRules []string
+		headersRules []config.Header
+
+		httpClientError          error
+		forceCheckIfNoCacheError bool
+	}
+
+	type want struct {
+		saveInCache bool
+		err         bool
+	}
+
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "StatusOk",
+			args: args{
+				cacheKey: []byte("test"),
+				path:     []byte("/test/"),
+				body:     []byte("Test Body"),
+				method:   []byte("POST"),
+				headers: map[string][]byte{
+					"X-Data":   []byte("1"),
+					"X-Data-2": []byte("2"),
+					"X-Data-3": []byte("3"),
+				},
+				statusCode: 200,
+			},
+			want: want{
+				saveInCache: true,
+				err:         false,
+			},
+		},
+		{
+			name: "StatusRedirect",
+			args: args{
+				cacheKey: []byte("test"),
+				path:     []byte("/test/"),
+				body:     []byte("Test Body"),
+				method:   []byte("GET"),
+				headers: map[string][]byte{
+					headerLocation: []byte("http://www.kratgo.com"),
+				},
+				statusCode: 301,
+			},
+			want: want{
+				saveInCache: false,
+				err:         false,
+			},
+		},
+		{
+			name: "NoCacheByRule",
+			args: args{
+				cacheKey: []byte("test"),
+				path:     []byte("/test/"),
+				body:     []byte("Test Body"),
+				method:   []byte("GET"),
+				headers: map[string][]byte{
+					"X-Data": []byte("1"),
+				},
+				statusCode: 200,
+				noCacheRules: []string{
+					"$(path) == '/test/'",
+				},
+			},
+			want: want{
+				saveInCache: false,
+				err:         false,
+			},
+		},
+		{
+			name: "NoCacheByStatusCode",
+			args: args{
+				cacheKey: []byte("test"),
+				path:     []byte("/test/"),
+				body:     []byte("Test Body"),
+				method:   []byte("GET"),
+				headers: map[string][]byte{
+					"X-Data": []byte("1"),
+				},
+				statusCode: 404,
+			},
+			want: want{
+				saveInCache: false,
+				err:         false,
+			},
+		},
+		{
+			name: "ErrorHttpClientDo",
+			args: args{
+				cacheKey: []byte("test"),
+				path:     []byte("/test/"),
+				body:     []byte("Test Body"),
+				method:   []byte("GET"),
+				headers: map[string][]byte{
+					"X-Data": []byte("1"),
+				},
+				statusCode:      404,
+				httpClientError: errors.New("Error"),
+			},
+			want: want{
+				saveInCache: false,
+				err:         true,
+			},
+		},
+		{
+			name: "InvalidCheckIfNoCache",
+			args: args{
+				cacheKey: []byte("test"),
+				path:     []byte("/test/"),
+				body:     []byte("Test Body"),
+				method:   []byte("GET"),
+				headers: map[string][]byte{
+					"X-Data": []byte("1"),
+				},
+				statusCode: 404,
+				noCacheRules: []string{
+					"$(path) == '/test/'",
+				},
+				forceCheckIfNoCacheError: true,
+			},
+			want: want{
+				saveInCache: false,
+				err:         false,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.Nocache = tt.args.noCacheRules
+			cfg.FileConfig.Response.Headers.Set = tt.args.headersRules
+
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
 			}
 
 			if tt.args.forceCheckIfNoCacheError {
@@ -951,7 +2819,7 @@ func TestProxy_fetchFromBackend(t *testing.T) {
 				ctx.Request.Header.SetCanonical([]byte(k), v)
 			}
 
-			err = p.fetchFromBackend(tt.args.cacheKey, tt.args.path, ctx, pt)
+			err = p.fetchFromBackend(tt.args.cacheKey, tt.args.path, nil, ctx, pt)
 			if (err != nil) != tt.want.err {
 				t.Errorf("Proxy.fetchFromBackend() Unexpected error: %v", err)
 			}
@@ -1074,7 +2942,7 @@ func TestProxy_handler(t *testing.T) {
 			},
 		},
 		{
-			name: "ErrorCheckIfNoCache",
+			name: "InvalidCheckIfNoCache",
 			args: args{
 				host: []byte("www.kratgo.com"),
 				noCacheRules: []string{
@@ -1083,7 +2951,9 @@ func TestProxy_handler(t *testing.T) {
 				forceProcessHeaderRulesError: true,
 			},
 			want: want{
-				err: true,
+				getFromCache:   false,
+				getFromBackend: true,
+				err:            false,
 			},
 		},
 		{
@@ -1134,7 +3004,7 @@ func TestProxy_handler(t *testing.T) {
 
 			p.handler(ctx)
 
-			if (ctx.Response.StatusCode() == fasthttp.StatusInternalServerError) != tt.want.err {
+			if (ctx.Response.StatusCode() >= fasthttp.StatusInternalServerError) != tt.want.err {
 				t.Errorf("Proxy.handler() Unexpected error: %s", ctx.Response.Body())
 			}
 
@@ -1166,6 +3036,264 @@ func TestProxy_handler(t *testing.T) {
 	}
 }
 
+func TestProxy_handler_Age(t *testing.T) {
+	p, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host := []byte("www.kratgo.com")
+	path := []byte("/age/")
+
+	entry := cache.AcquireEntry()
+	response := cache.AcquireResponse()
+	response.Path = path
+	response.StoredAt = time.Now().Unix() - 30
+	entry.SetResponse(*response)
+	p.cache.SetBytes(host, *entry)
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURIBytes(path)
+	ctx.Request.Header.SetHostBytes(host)
+
+	p.handler(ctx)
+
+	age, err := strconv.Atoi(string(ctx.Response.Header.Peek(headerAge)))
+	if err != nil {
+		t.Fatalf("Proxy.handler() invalid header '%s': %v", headerAge, err)
+	}
+
+	if age < 30 || age > 31 {
+		t.Errorf("Proxy.handler() header '%s' == '%d', want '%d'", headerAge, age, 30)
+	}
+}
+
+func TestProxy_handler_Expired(t *testing.T) {
+	p, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{body: []byte("Fresh body"), statusCode: fasthttp.StatusOK}
+	p.backends = []fetcher{backend}
+	p.totalBackends = 1
+
+	host := []byte("www.kratgo.com")
+	path := []byte("/expired/")
+
+	entry := cache.AcquireEntry()
+	response := cache.AcquireResponse()
+	response.Path = path
+	response.Body = []byte("Expired body")
+	response.StoredAt = time.Now().Unix() - 60
+	response.ExpiresAt = time.Now().Unix() - 1
+	entry.SetResponse(*response)
+	p.cache.SetBytes(host, *entry)
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURIBytes(path)
+	ctx.Request.Header.SetHostBytes(host)
+
+	p.handler(ctx)
+
+	if !backend.called {
+		t.Errorf("Proxy.handler() expired response has not been fetched from backend")
+	}
+
+	if body := ctx.Response.Body(); !bytes.Equal(body, backend.body) {
+		t.Errorf("Proxy.handler() body == '%s', want '%s'", body, backend.body)
+	}
+}
+
+func TestProxy_handler_SlowRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		delay     time.Duration
+		logged    bool
+	}{
+		{name: "Slow", threshold: 5, delay: 20 * time.Millisecond, logged: true},
+		{name: "Fast", threshold: 1000, delay: 0, logged: false},
+		{name: "Disabled", threshold: 0, delay: 20 * time.Millisecond, logged: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := new(bytes.Buffer)
+
+			cfg := testConfig()
+			cfg.FileConfig.SlowRequestThreshold = tt.threshold
+			cfg.LogLevel = logger.WARNING
+			cfg.LogOutput = output
+
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p.backends = []fetcher{&mockBackend{statusCode: fasthttp.StatusOK, delay: tt.delay}}
+			p.totalBackends = 1
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.SetRequestURI("/slow/")
+			ctx.Request.Header.SetHost("www.kratgo.com")
+
+			p.handler(ctx)
+
+			logged := strings.Contains(output.String(), "Slow request GET /slow/")
+			if logged != tt.logged {
+				t.Errorf("Proxy.handler() slow request logged == '%v', want '%v' (output: %s)", logged, tt.logged, output)
+			}
+
+			if logged && !strings.Contains(output.String(), cfg.FileConfig.BackendAddrs[0]) {
+				t.Errorf("Proxy.handler() slow request log without backend: %s", output)
+			}
+		})
+	}
+}
+
+func TestProxy_handler_RequestID(t *testing.T) {
+	longID := strings.Repeat("a", maxRequestIDLength+1)
+
+	tests := []struct {
+		name      string
+		requestID string
+		generated bool
+	}{
+		{
+			name:      "Incoming",
+			requestID: "abc-123",
+			generated: false,
+		},
+		{
+			name:      "Missing",
+			requestID: "",
+			generated: true,
+		},
+		{
+			name:      "TooLong",
+			requestID: longID,
+			generated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(testConfig())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			backend := &mockBackend{
+				statusCode: fasthttp.StatusOK,
+				headers: map[string][]byte{
+					defaultRequestIDHeader: []byte("backend-id"),
+				},
+			}
+			p.backends = []fetcher{backend}
+			p.totalBackends = 1
+
+			host := []byte("www.kratgo.com")
+			path := []byte("/request-id/" + tt.name)
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.SetRequestURIBytes(path)
+			ctx.Request.Header.SetHostBytes(host)
+			if tt.requestID != "" {
+				ctx.Request.Header.Set(defaultRequestIDHeader, tt.requestID)
+			}
+
+			p.handler(ctx)
+
+			id := string(ctx.Response.Header.Peek(defaultRequestIDHeader))
+			if tt.generated {
+				if len(id) != 32 || id == tt.requestID {
+					t.Errorf("Proxy.handler() request id == '%s', want a generated one", id)
+				}
+			} else if id != tt.requestID {
+				t.Errorf("Proxy.handler() request id == '%s', want '%s'", id, tt.requestID)
+			}
+
+			if string(backend.requestID) != id {
+				t.Errorf("Proxy.handler() backend request id == '%s', want '%s'", backend.requestID, id)
+			}
+
+			if v := ctx.UserValue(requestIDUserValueKey); v != id {
+				t.Errorf("Proxy.handler() user value request id == '%v', want '%s'", v, id)
+			}
+
+			entry := cache.AcquireEntry()
+			if err := p.cache.GetBytes(host, entry); err != nil {
+				t.Fatal(err)
+			}
+
+			r := entry.GetResponse(path)
+			if r == nil {
+				t.Fatal("Proxy.handler() response has not been saved in cache")
+			}
+
+			for _, h := range r.Headers {
+				if strings.EqualFold(string(h.Key), defaultRequestIDHeader) {
+					t.Errorf("Proxy.handler() request id header has been saved in cache")
+				}
+			}
+		})
+	}
+}
+
+func TestProxy_handler_Tracing(t *testing.T) {
+	tracer, err := tracing.New(tracing.Config{
+		FileConfig: config.Tracing{Endpoint: "http://localhost:4318/v1/traces"},
+		LogLevel:   logger.FATAL,
+		LogOutput:  os.Stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig()
+	cfg.Tracer = tracer
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{statusCode: fasthttp.StatusOK}
+	p.backends = []fetcher{backend}
+	p.totalBackends = 1
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	incoming := "00-" + traceID + "-00f067aa0ba902b7-01"
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/tracing/")
+	ctx.Request.Header.SetHost("www.kratgo.com")
+	ctx.Request.Header.Set(tracing.HeaderTraceparent, incoming)
+
+	p.handler(ctx)
+
+	traceparent := string(backend.traceparent)
+	if !strings.HasPrefix(traceparent, "00-"+traceID+"-") || traceparent == incoming {
+		t.Errorf("Proxy.handler() backend traceparent == '%s', want a child of '%s'", traceparent, incoming)
+	}
+
+	// Without tracer, the incoming trace context is forwarded as is
+	p.tracer = nil
+	backend.traceparent = nil
+
+	ctx = new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/tracing/nocache")
+	ctx.Request.Header.SetHost("www.kratgo.com")
+	ctx.Request.Header.Set(tracing.HeaderTraceparent, incoming)
+
+	p.handler(ctx)
+
+	if traceparent := string(backend.traceparent); traceparent != incoming {
+		t.Errorf("Proxy.handler() backend traceparent == '%s', want '%s'", traceparent, incoming)
+	}
+}
+
 func TestProxy_ListenAndServe(t *testing.T) {
 	serverMock := new(mockServer)
 	addr := "localhost:9999"
@@ -1191,6 +3319,33 @@ func TestProxy_ListenAndServe(t *testing.T) {
 
 }
 
+func TestProxy_ListenAndServe_ProxyProtocol(t *testing.T) {
+	serverMock := new(mockServer)
+
+	p, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.fileConfig.Addr = "127.0.0.1:0"
+	p.fileConfig.ProxyProtocol = true
+	p.server = serverMock
+
+	if err := p.ListenAndServe(); err != nil {
+		t.Fatal(err)
+	}
+
+	serverMock.mu.RLock()
+	defer serverMock.mu.RUnlock()
+
+	if serverMock.listenAndServeCalled {
+		t.Error("Proxy.ListenAndServe() with PROXY protocol has been called the server ListenAndServe")
+	}
+
+	if _, ok := serverMock.listener.(*proxyProtocolListener); !ok {
+		t.Errorf("Proxy.ListenAndServe() listener is '%T', want '%T'", serverMock.listener, &proxyProtocolListener{})
+	}
+}
+
 func BenchmarkHandler(b *testing.B) {
 	p, err := New(testConfig())
 	if err != nil {
@@ -1217,6 +3372,66 @@ func BenchmarkHandler(b *testing.B) {
 	}
 }
 
+func BenchmarkHandlerParallel(b *testing.B) {
+	hosts := make([]string, 64)
+	for i := range hosts {
+		hosts[i] = fmt.Sprintf("host%d.kratgo.com", i)
+	}
+
+	for _, shards := range []int{1, 16, 1024} {
+		b.Run(fmt.Sprintf("Shards%d", shards), func(b *testing.B) {
+			c, err := cache.New(cache.Config{
+				FileConfig: config.Cache{
+					TTL:            10,
+					CleanFrequency: 5,
+					MaxEntries:     len(hosts),
+					MaxEntrySize:   500,
+					Shards:         shards,
+				},
+				LogLevel:  logger.ERROR,
+				LogOutput: os.Stderr,
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			cfg := testConfig()
+			cfg.Cache = c
+
+			p, err := New(cfg)
+			if err != nil {
+				b.Fatal(err)
+			}
+			p.backends = []fetcher{
+				&mockBackend{
+					body:       []byte("Benchmark Response Body"),
+					statusCode: 200,
+				},
+			}
+			p.totalBackends = len(p.backends)
+
+			// Warm up the cache, so the backend is not called concurrently
+			for _, host := range hosts {
+				ctx := new(fasthttp.RequestCtx)
+				ctx.Request.SetRequestURI("/bench")
+				ctx.Request.SetHost(host)
+				p.handler(ctx)
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				ctx := new(fasthttp.RequestCtx)
+				ctx.Request.SetRequestURI("/bench")
+
+				for i := 0; pb.Next(); i++ {
+					ctx.Request.SetHost(hosts[i%len(hosts)])
+					p.handler(ctx)
+				}
+			})
+		})
+	}
+}
+
 func BenchmarkHandlerWithoutCache(b *testing.B) {
 	path := "/bench"
 	cfg := testConfig()
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/savsgio/gotils"
+	"github.com/valyala/fasthttp"
+)
+
+// validatePurgeOnStatus checks that the purge status codes are valid HTTP status codes
+func validatePurgeOnStatus(codes []int) error {
+	for _, code := range codes {
+		if code < fasthttp.StatusContinue || code > 599 {
+			return fmt.Errorf("Invalid status code '%d' in Proxy.PurgeOnStatus", code)
+		}
+	}
+
+	return nil
+}
+
+// purgeOnStatus deletes the cached responses of the path, in all its variants, if the backend responds
+// with one of the purge status codes, ex: 410 when the resource has been removed.
+// The entry is the one of the cache lookup, so only the requests that had found it cached purge it
+func (p *Proxy) purgeOnStatus(ctx *fasthttp.RequestCtx, pt *proxyTools, cacheKey, path []byte) {
+	if len(p.fileConfig.PurgeOnStatus) == 0 || !pt.entry.HasResponse(path) {
+		return
+	}
+
+	statusCode := ctx.Response.StatusCode()
+
+	purge := false
+	for _, code := range p.fileConfig.PurgeOnStatus {
+		if code == statusCode {
+			purge = true
+			break
+		}
+	}
+
+	if !purge {
+		return
+	}
+
+	pt.entry.DelResponse(path)
+
+	var err error
+	if pt.entry.Len() == 0 {
+		err = p.cache.Del(gotils.B2S(cacheKey))
+	} else {
+		err = p.cache.SetBytes(cacheKey, *pt.entry)
+	}
+
+	if err != nil {
+		atomic.AddUint64(p.cacheStoreErrors, 1)
+		p.log.Errorf("[%s] Could not purge the cached response of key '%s' and path '%s': %v", pt.requestID, cacheKey, path, err)
+		return
+	}
+
+	pt.trace.store = traceStorePurged
+
+	p.log.Infof("[%s] Purged the cached response of key '%s' and path '%s', the backend responded %d",
+		pt.requestID, cacheKey, path, statusCode)
+}
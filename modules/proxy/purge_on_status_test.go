@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/cache"
+	"github.com/valyala/fasthttp"
+)
+
+func Test_validatePurgeOnStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		codes   []int
+		wantErr bool
+	}{
+		{name: "Empty", codes: nil, wantErr: false},
+		{name: "Valid", codes: []int{404, 410}, wantErr: false},
+		{name: "TooLow", codes: []int{99}, wantErr: true},
+		{name: "TooHigh", codes: []int{410, 600}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePurgeOnStatus(tt.codes); (err != nil) != tt.wantErr {
+				t.Errorf("validatePurgeOnStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProxy_handler_PurgeOnStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		wantPurged bool
+	}{
+		{name: "Gone", statusCode: fasthttp.StatusGone, wantPurged: true},
+		{name: "NotFound", statusCode: fasthttp.StatusNotFound, wantPurged: false},
+		{name: "ServerError", statusCode: fasthttp.StatusInternalServerError, wantPurged: false},
+	}
+
+	host := []byte("www.kratgo.com")
+	path := []byte("/removed/")
+	otherPath := []byte("/other/")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.PurgeOnStatus = []int{fasthttp.StatusGone}
+
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			backend := &mockBackend{body: []byte("Gone"), statusCode: tt.statusCode}
+			p.backends = []fetcher{backend}
+			p.totalBackends = 1
+
+			entry := cache.AcquireEntry()
+			defer cache.ReleaseEntry(entry)
+
+			for _, cachedPath := range [][]byte{path, otherPath} {
+				response := cache.AcquireResponse()
+				response.Path = cachedPath
+				response.Body = []byte("Expired body")
+				response.StoredAt = time.Now().Unix() - 60
+				response.ExpiresAt = time.Now().Unix() - 1
+				entry.SetResponse(*response)
+				cache.ReleaseResponse(response)
+			}
+
+			if err := p.cache.SetBytes(host, *entry); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.SetRequestURIBytes(path)
+			ctx.Request.Header.SetHostBytes(host)
+
+			p.handler(ctx)
+
+			if statusCode := ctx.Response.StatusCode(); statusCode != tt.statusCode {
+				t.Errorf("Proxy.handler() status code == '%d', want '%d'", statusCode, tt.statusCode)
+			}
+
+			entry.Reset()
+			if err := p.cache.GetBytes(host, entry); err != nil {
+				t.Fatal(err)
+			}
+
+			if purged := !entry.HasResponse(path); purged != tt.wantPurged {
+				t.Errorf("Proxy.handler() purged == '%v', want '%v'", purged, tt.wantPurged)
+			}
+
+			if !entry.HasResponse(otherPath) {
+				t.Errorf("Proxy.handler() the cached response of other path has been purged")
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"sort"
+	"strconv"
+
+	"github.com/savsgio/gotils"
+	"github.com/valyala/fasthttp"
+)
+
+var errInvalidRange = errors.New("Invalid range")
+var errUnsatisfiableRange = errors.New("Unsatisfiable range")
+
+type byteRange struct {
+	start int
+	end   int // inclusive
+}
+
+func (br byteRange) length() int {
+	return br.end - br.start + 1
+}
+
+func (br byteRange) contentRange(size int) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.start, br.end, size)
+}
+
+// parseByteRanges returns the ranges of the "Range" header, sorted and with the overlapping
+// and adjacent ones merged, so the response is never bigger than the body (ex: bytes=0-,0-,0-).
+// More than maxByteRanges ranges are invalid, and the full body is served
+func parseByteRanges(value []byte, size int) ([]byteRange, error) {
+	if !bytes.HasPrefix(value, rangeUnitPrefix) {
+		return nil, errInvalidRange
+	}
+
+	specs := bytes.Split(value[len(rangeUnitPrefix):], []byte{','})
+	if len(specs) > maxByteRanges {
+		return nil, errInvalidRange
+	}
+
+	var ranges []byteRange
+
+	for _, spec := range specs {
+		spec = bytes.TrimSpace(spec)
+		if len(spec) == 0 {
+			continue
+		}
+
+		i := bytes.IndexByte(spec, '-')
+		if i < 0 {
+			return nil, errInvalidRange
+		}
+
+		first, last := bytes.TrimSpace(spec[:i]), bytes.TrimSpace(spec[i+1:])
+
+		br := byteRange{}
+
+		if len(first) == 0 {
+			// Suffix range: the last N bytes
+			n, err := strconv.Atoi(gotils.B2S(last))
+			if err != nil || n < 0 {
+				return nil, errInvalidRange
+			}
+
+			if n == 0 || size == 0 {
+				continue
+			}
+
+			if n > size {
+				n = size
+			}
+
+			br.start = size - n
+			br.end = size - 1
+
+		} else {
+			start, err := strconv.Atoi(gotils.B2S(first))
+			if err != nil || start < 0 {
+				return nil, errInvalidRange
+			}
+
+			end := size - 1
+			if len(last) > 0 {
+				if end, err = strconv.Atoi(gotils.B2S(last)); err != nil || end < start {
+					return nil, errInvalidRange
+				}
+			}
+
+			if start >= size {
+				continue
+			}
+
+			if end >= size {
+				end = size - 1
+			}
+
+			br.start = start
+			br.end = end
+		}
+
+		ranges = append(ranges, br)
+	}
+
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+
+	return mergeByteRanges(ranges), nil
+}
+
+// mergeByteRanges sorts the ranges by their start, merging the overlapping and adjacent ones
+func mergeByteRanges(ranges []byteRange) []byteRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start < ranges[j].start
+	})
+
+	merged := ranges[:1]
+
+	for _, br := range ranges[1:] {
+		last := &merged[len(merged)-1]
+
+		if br.start > last.end+1 {
+			merged = append(merged, br)
+		} else if br.end > last.end {
+			last.end = br.end
+		}
+	}
+
+	return merged
+}
+
+func ifRangeMatches(ctx *fasthttp.RequestCtx) bool {
+	ifRange := ctx.Request.Header.Peek(headerIfRange)
+	if len(ifRange) == 0 {
+		return true
+	}
+
+	if bytes.HasPrefix(ifRange, []byte("W/")) {
+		// Weak validators never match (RFC 7233, section 3.2)
+		return false
+	}
+
+	if ifRange[0] == '"' {
+		return bytes.Equal(ifRange, ctx.Response.Header.Peek(headerETag))
+	}
+
+	return bytes.Equal(ifRange, ctx.Response.Header.Peek(headerLastModified))
+}
+
+// serveRange writes in the response the requested ranges of body,
+// returns false if the request must be served with the full body
+func serveRange(ctx *fasthttp.RequestCtx, body []byte) bool {
+	value := ctx.Request.Header.Peek(headerRange)
+	if len(value) == 0 || !ctx.IsGet() || !ifRangeMatches(ctx) {
+		return false
+	}
+
+	size := len(body)
+
+	ranges, err := parseByteRanges(value, size)
+	if err == errInvalidRange {
+		return false
+
+	} else if err == errUnsatisfiableRange {
+		ctx.Response.Header.Set(headerContentRange, fmt.Sprintf("bytes */%d", size))
+		ctx.Response.ResetBody()
+		ctx.SetStatusCode(fasthttp.StatusRequestedRangeNotSatisfiable)
+
+		return true
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusPartialContent)
+
+	if len(ranges) == 1 {
+		br := ranges[0]
+
+		ctx.Response.Header.Set(headerContentRange, br.contentRange(size))
+		ctx.SetBody(body[br.start : br.end+1])
+
+		return true
+	}
+
+	contentType := string(ctx.Response.Header.ContentType())
+
+	buf := bytes.NewBuffer(nil)
+	mw := multipart.NewWriter(buf)
+
+	for _, br := range ranges {
+		part, _ := mw.CreatePart(textproto.MIMEHeader{
+			fasthttp.HeaderContentType: {contentType},
+			headerContentRange:         {br.contentRange(size)},
+		})
+		part.Write(body[br.start : br.end+1])
+	}
+	mw.Close()
+
+	ctx.Response.Header.SetContentType("multipart/byteranges; boundary=" + mw.Boundary())
+	ctx.SetBody(buf.Bytes())
+
+	return true
+}
@@ -0,0 +1,307 @@
+package proxy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func Test_parseByteRanges(t *testing.T) {
+	type args struct {
+		value string
+		size  int
+	}
+
+	type want struct {
+		ranges []byteRange
+		err    error
+	}
+
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "Single",
+			args: args{value: "bytes=0-4", size: 10},
+			want: want{ranges: []byteRange{{start: 0, end: 4}}},
+		},
+		{
+			name: "OpenEnd",
+			args: args{value: "bytes=6-", size: 10},
+			want: want{ranges: []byteRange{{start: 6, end: 9}}},
+		},
+		{
+			name: "Suffix",
+			args: args{value: "bytes=-3", size: 10},
+			want: want{ranges: []byteRange{{start: 7, end: 9}}},
+		},
+		{
+			name: "SuffixGreaterThanSize",
+			args: args{value: "bytes=-30", size: 10},
+			want: want{ranges: []byteRange{{start: 0, end: 9}}},
+		},
+		{
+			name: "EndGreaterThanSize",
+			args: args{value: "bytes=5-100", size: 10},
+			want: want{ranges: []byteRange{{start: 5, end: 9}}},
+		},
+		{
+			name: "Multi",
+			args: args{value: "bytes=0-1, 4-5", size: 10},
+			want: want{ranges: []byteRange{{start: 0, end: 1}, {start: 4, end: 5}}},
+		},
+		{
+			name: "MultiUnsorted",
+			args: args{value: "bytes=6-7,0-1", size: 10},
+			want: want{ranges: []byteRange{{start: 0, end: 1}, {start: 6, end: 7}}},
+		},
+		{
+			name: "MultiOverlapping",
+			args: args{value: "bytes=0-,0-,2-5,-3", size: 10},
+			want: want{ranges: []byteRange{{start: 0, end: 9}}},
+		},
+		{
+			name: "MultiAdjacent",
+			args: args{value: "bytes=0-1,2-3,6-7,5-5", size: 10},
+			want: want{ranges: []byteRange{{start: 0, end: 3}, {start: 5, end: 7}}},
+		},
+		{
+			name: "TooManyRanges",
+			args: args{value: "bytes=" + strings.Repeat("0-,", maxByteRanges) + "0-", size: 10},
+			want: want{err: errInvalidRange},
+		},
+		{
+			name: "Unsatisfiable",
+			args: args{value: "bytes=20-30", size: 10},
+			want: want{err: errUnsatisfiableRange},
+		},
+		{
+			name: "InvalidUnit",
+			args: args{value: "items=0-4", size: 10},
+			want: want{err: errInvalidRange},
+		},
+		{
+			name: "InvalidSpec",
+			args: args{value: "bytes=a-b", size: 10},
+			want: want{err: errInvalidRange},
+		},
+		{
+			name: "InvalidOrder",
+			args: args{value: "bytes=5-2", size: 10},
+			want: want{err: errInvalidRange},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges, err := parseByteRanges([]byte(tt.args.value), tt.args.size)
+			if err != tt.want.err {
+				t.Fatalf("parseByteRanges() error == '%v', want '%v'", err, tt.want.err)
+			}
+
+			if !reflect.DeepEqual(ranges, tt.want.ranges) {
+				t.Errorf("parseByteRanges() == '%v', want '%v'", ranges, tt.want.ranges)
+			}
+		})
+	}
+}
+
+func Test_ifRangeMatches(t *testing.T) {
+	type args struct {
+		ifRange      string
+		etag         string
+		lastModified string
+	}
+
+	type want struct {
+		match bool
+	}
+
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "NoIfRange",
+			args: args{},
+			want: want{match: true},
+		},
+		{
+			name: "ETagMatch",
+			args: args{ifRange: "\"abc\"", etag: "\"abc\""},
+			want: want{match: true},
+		},
+		{
+			name: "ETagMismatch",
+			args: args{ifRange: "\"abc\"", etag: "\"def\""},
+			want: want{match: false},
+		},
+		{
+			name: "WeakETag",
+			args: args{ifRange: "W/\"abc\"", etag: "W/\"abc\""},
+			want: want{match: false},
+		},
+		{
+			name: "LastModifiedMatch",
+			args: args{ifRange: "Wed, 21 Oct 2015 07:28:00 GMT", lastModified: "Wed, 21 Oct 2015 07:28:00 GMT"},
+			want: want{match: true},
+		},
+		{
+			name: "LastModifiedMismatch",
+			args: args{ifRange: "Wed, 21 Oct 2015 07:28:00 GMT", lastModified: "Thu, 22 Oct 2015 07:28:00 GMT"},
+			want: want{match: false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := new(fasthttp.RequestCtx)
+			if tt.args.ifRange != "" {
+				ctx.Request.Header.Set(headerIfRange, tt.args.ifRange)
+			}
+			if tt.args.etag != "" {
+				ctx.Response.Header.Set(headerETag, tt.args.etag)
+			}
+			if tt.args.lastModified != "" {
+				ctx.Response.Header.Set(headerLastModified, tt.args.lastModified)
+			}
+
+			if match := ifRangeMatches(ctx); match != tt.want.match {
+				t.Errorf("ifRangeMatches() == '%v', want '%v'", match, tt.want.match)
+			}
+		})
+	}
+}
+
+func Test_serveRange(t *testing.T) {
+	type args struct {
+		method string
+		value  string
+	}
+
+	type want struct {
+		served       bool
+		statusCode   int
+		contentRange string
+		body         string
+		multipart    bool
+	}
+
+	body := []byte("0123456789")
+
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "NoRange",
+			args: args{method: "GET"},
+			want: want{served: false},
+		},
+		{
+			name: "NotGet",
+			args: args{method: "POST", value: "bytes=0-4"},
+			want: want{served: false},
+		},
+		{
+			name: "Single",
+			args: args{method: "GET", value: "bytes=2-4"},
+			want: want{
+				served:       true,
+				statusCode:   fasthttp.StatusPartialContent,
+				contentRange: "bytes 2-4/10",
+				body:         "234",
+			},
+		},
+		{
+			name: "Multi",
+			args: args{method: "GET", value: "bytes=0-1,8-9"},
+			want: want{
+				served:     true,
+				statusCode: fasthttp.StatusPartialContent,
+				multipart:  true,
+			},
+		},
+		{
+			name: "MultiOverlapping",
+			args: args{method: "GET", value: "bytes=0-,0-,0-,1-5,-4"},
+			want: want{
+				served:       true,
+				statusCode:   fasthttp.StatusPartialContent,
+				contentRange: "bytes 0-9/10",
+				body:         "0123456789",
+			},
+		},
+		{
+			name: "TooManyRanges",
+			args: args{method: "GET", value: "bytes=" + strings.Repeat("0-,", 100) + "0-"},
+			want: want{served: false},
+		},
+		{
+			name: "Unsatisfiable",
+			args: args{method: "GET", value: "bytes=20-"},
+			want: want{
+				served:       true,
+				statusCode:   fasthttp.StatusRequestedRangeNotSatisfiable,
+				contentRange: "bytes */10",
+			},
+		},
+		{
+			name: "Invalid",
+			args: args{method: "GET", value: "bytes=x-y"},
+			want: want{served: false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.Header.SetMethod(tt.args.method)
+			ctx.Response.Header.SetContentType("text/plain")
+			if tt.args.value != "" {
+				ctx.Request.Header.Set(headerRange, tt.args.value)
+			}
+
+			served := serveRange(ctx, body)
+			if served != tt.want.served {
+				t.Fatalf("serveRange() == '%v', want '%v'", served, tt.want.served)
+			}
+
+			if !served {
+				return
+			}
+
+			if statusCode := ctx.Response.StatusCode(); statusCode != tt.want.statusCode {
+				t.Errorf("serveRange() status code == '%d', want '%d'", statusCode, tt.want.statusCode)
+			}
+
+			if v := string(ctx.Response.Header.Peek(headerContentRange)); v != tt.want.contentRange {
+				t.Errorf("serveRange() header '%s' == '%s', want '%s'", headerContentRange, v, tt.want.contentRange)
+			}
+
+			respBody := string(ctx.Response.Body())
+
+			if tt.want.multipart {
+				contentType := string(ctx.Response.Header.ContentType())
+				if !strings.HasPrefix(contentType, "multipart/byteranges; boundary=") {
+					t.Errorf("serveRange() content type == '%s', want multipart/byteranges", contentType)
+				}
+
+				for _, part := range []string{"bytes 0-1/10", "bytes 8-9/10", "\r\n\r\n01\r\n", "\r\n\r\n89\r\n"} {
+					if !strings.Contains(respBody, part) {
+						t.Errorf("serveRange() multipart body does not contain '%q'", part)
+					}
+				}
+
+			} else if respBody != tt.want.body {
+				t.Errorf("serveRange() body == '%s', want '%s'", respBody, tt.want.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// newRateLimiter returns the rate limits of the requests by rule and client IP, or nil if there are not rules
+func (p *Proxy) newRateLimiter() (*rateLimiter, error) {
+	cfg := p.fileConfig.RateLimitRules
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+
+	l := &rateLimiter{limits: make([]*rateLimit, 0, len(cfg))}
+	conditions := make([]string, 0, len(cfg))
+
+	for i, r := range cfg {
+		if r.When == "" {
+			return nil, fmt.Errorf("Proxy.RateLimitRules[%d] has not condition", i)
+		}
+
+		if r.Rate <= 0 {
+			return nil, fmt.Errorf("Proxy.RateLimitRules[%d].Rate must be greater than 0", i)
+		}
+
+		if r.Burst < 0 {
+			return nil, fmt.Errorf("Proxy.RateLimitRules[%d].Burst must be 0 (default) or greater", i)
+		}
+
+		// By default, the requests of one second
+		burst := float64(r.Burst)
+		if burst == 0 {
+			burst = math.Max(1, math.Ceil(r.Rate))
+		}
+
+		conditions = append(conditions, r.When)
+		l.limits = append(l.limits, &rateLimit{rate: r.Rate, burst: burst, buckets: make(map[string]*tokenBucket)})
+	}
+
+	var err error
+	if l.rules, err = p.parseRules(conditions); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// allow takes a token of the bucket of the key, refilled with the elapsed time since its last request.
+// If it's empty, it returns the time until the next token
+func (l *rateLimit) allow(key string, now int64) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now-l.lastSweep > int64(rateLimitSweepInterval) {
+		l.sweep(now)
+	}
+
+	b := l.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: l.burst}
+		l.buckets[key] = b
+	} else {
+		b.tokens = math.Min(l.burst, b.tokens+l.rate*float64(now-b.last)/float64(time.Second))
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), false
+}
+
+// sweep deletes the buckets that are full again, as they are the same as new ones,
+// to not keep the client IPs that have not sent requests lately. It must be called with the lock held
+func (l *rateLimit) sweep(now int64) {
+	for key, b := range l.buckets {
+		if b.tokens+l.rate*float64(now-b.last)/float64(time.Second) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.lastSweep = now
+}
+
+// serveRateLimit responds with a 429 if the client IP has exceeded the rate limit of the first rule
+// that matches the request. It returns true if the request has been responded
+func (p *Proxy) serveRateLimit(ctx *fasthttp.RequestCtx, pt *proxyTools) (bool, error) {
+	l := p.rateLimiter
+	if l == nil {
+		return false, nil
+	}
+
+	i, err := matchFirst(ctx, l.rules, pt.params)
+	if err != nil {
+		return false, fmt.Errorf("Invalid rate limit rule: %v", err)
+	} else if i < 0 {
+		return false, nil
+	}
+
+	wait, ok := l.limits[i].allow(p.clientIP(ctx).String(), time.Now().UnixNano())
+	if ok {
+		return false, nil
+	}
+
+	atomic.AddUint64(&l.limited, 1)
+
+	p.errorResponse(ctx, pt, fasthttp.StatusMessage(fasthttp.StatusTooManyRequests), fasthttp.StatusTooManyRequests)
+	ctx.Response.Header.Set(headerRetryAfter, strconv.FormatInt(int64(math.Ceil(wait.Seconds())), 10))
+
+	return true, nil
+}
+
+func (l *rateLimiter) limitedRequests() uint64 {
+	if l == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&l.limited)
+}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxy_newRateLimiter(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       []config.RateLimitRule
+		wantBurst float64
+		err       bool
+	}{
+		{name: "Ok", cfg: []config.RateLimitRule{{When: "$(path) == '/login'", Rate: 2, Burst: 5}}, wantBurst: 5},
+		{name: "DefaultBurst", cfg: []config.RateLimitRule{{When: "$(path) == '/login'", Rate: 2.5}}, wantBurst: 3},
+		{name: "DefaultBurstSlowRate", cfg: []config.RateLimitRule{{When: "$(path) == '/login'", Rate: 0.1}}, wantBurst: 1},
+		{name: "WithoutCondition", cfg: []config.RateLimitRule{{Rate: 2}}, err: true},
+		{name: "InvalidRate", cfg: []config.RateLimitRule{{When: "$(path) == '/login'"}}, err: true},
+		{name: "InvalidBurst", cfg: []config.RateLimitRule{{When: "$(path) == '/login'", Rate: 2, Burst: -1}}, err: true},
+		{name: "InvalidRule", cfg: []config.RateLimitRule{{When: "$(path) ==", Rate: 2}}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.RateLimitRules = tt.cfg
+
+			p, err := New(cfg)
+			if (err != nil) != tt.err {
+				t.Fatalf("New() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if tt.err {
+				return
+			}
+
+			if burst := p.rateLimiter.limits[0].burst; burst != tt.wantBurst {
+				t.Errorf("Proxy.newRateLimiter() burst == '%v', want '%v'", burst, tt.wantBurst)
+			}
+		})
+	}
+}
+
+func Test_rateLimit_allow(t *testing.T) {
+	l := &rateLimit{rate: 1, burst: 2, buckets: make(map[string]*tokenBucket)}
+	start := time.Now().UnixNano()
+
+	requests := []struct {
+		key      string
+		elapsed  time.Duration
+		wantWait time.Duration
+		wantOk   bool
+	}{
+		{key: "192.0.2.1", elapsed: 0, wantOk: true},
+		{key: "192.0.2.1", elapsed: 0, wantOk: true},
+		{key: "192.0.2.1", elapsed: 0, wantWait: time.Second, wantOk: false},
+		{key: "192.0.2.2", elapsed: 0, wantOk: true},
+		{key: "192.0.2.1", elapsed: 500 * time.Millisecond, wantWait: 500 * time.Millisecond, wantOk: false},
+		{key: "192.0.2.1", elapsed: time.Second, wantOk: true},
+		{key: "192.0.2.1", elapsed: time.Second, wantWait: time.Second, wantOk: false},
+	}
+
+	for i, r := range requests {
+		wait, ok := l.allow(r.key, start+int64(r.elapsed))
+		if ok != r.wantOk || wait != r.wantWait {
+			t.Errorf("rateLimit.allow() request %d == '%v' with wait '%v', want '%v' with '%v'", i, ok, wait, r.wantOk, r.wantWait)
+		}
+	}
+
+	// The full buckets are deleted, as they are the same as new ones
+	l.allow("192.0.2.3", start+int64(rateLimitSweepInterval+5*time.Second))
+
+	if _, ok := l.buckets["192.0.2.1"]; ok || len(l.buckets) != 1 {
+		t.Errorf("rateLimit.sweep() buckets == '%d', want '%d'", len(l.buckets), 1)
+	}
+}
+
+func TestProxy_handler_RateLimit(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.RateLimitRules = []config.RateLimitRule{
+		{When: "$(path) == '/login'", Rate: 0.5, Burst: 1},
+		{When: "$(path) =~ '^/login'", Rate: 100},
+	}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{body: []byte("Body"), statusCode: fasthttp.StatusOK}
+	p.backends = []fetcher{backend}
+	p.totalBackends = 1
+
+	requests := []struct {
+		path           string
+		remoteIP       string
+		wantStatusCode int
+		wantRetryAfter string
+	}{
+		{path: "/login", remoteIP: "192.0.2.1", wantStatusCode: fasthttp.StatusOK},
+		{path: "/login", remoteIP: "192.0.2.1", wantStatusCode: fasthttp.StatusTooManyRequests, wantRetryAfter: "2"},
+		{path: "/login", remoteIP: "192.0.2.2", wantStatusCode: fasthttp.StatusOK},
+		{path: "/login/help", remoteIP: "192.0.2.1", wantStatusCode: fasthttp.StatusOK},
+		{path: "/static/", remoteIP: "192.0.2.1", wantStatusCode: fasthttp.StatusOK},
+	}
+
+	for i, r := range requests {
+		req := fasthttp.AcquireRequest()
+		req.SetRequestURI(r.path)
+		req.Header.SetHost("www.kratgo.com")
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Init(req, &net.TCPAddr{IP: net.ParseIP(r.remoteIP)}, nil)
+
+		p.handler(ctx)
+
+		if statusCode := ctx.Response.StatusCode(); statusCode != r.wantStatusCode {
+			t.Errorf("Proxy.handler() request %d status code == '%d', want '%d'", i, statusCode, r.wantStatusCode)
+		}
+
+		if v := string(ctx.Response.Header.Peek(headerRetryAfter)); v != r.wantRetryAfter {
+			t.Errorf("Proxy.handler() request %d header '%s' == '%s', want '%s'", i, headerRetryAfter, v, r.wantRetryAfter)
+		}
+
+		fasthttp.ReleaseRequest(req)
+	}
+
+	if limited := p.Stats().RateLimited; limited != 1 {
+		t.Errorf("Proxy.Stats() RateLimited == '%d', want '%d'", limited, 1)
+	}
+}
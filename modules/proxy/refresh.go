@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Refresh fetches the response of the path from the backends through the proxy, saving it in cache,
+// ex: after its invalidation. It's requested without cookies nor private headers, so only the shared
+// response is refreshed
+func (p *Proxy) Refresh(host, path string) error {
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI(path)
+	ctx.Request.SetHost(host)
+
+	p.handler(ctx)
+
+	if statusCode := ctx.Response.StatusCode(); statusCode >= fasthttp.StatusInternalServerError {
+		return fmt.Errorf("Could not refresh '%s%s', unexpected status code %d", host, path, statusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/savsgio/kratgo/modules/cache"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxy_Refresh(t *testing.T) {
+	p, err := New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{body: []byte("Kratgo"), statusCode: fasthttp.StatusOK}
+	p.backends = []fetcher{backend}
+	p.totalBackends = len(p.backends)
+
+	if err := p.Refresh("www.kratgo.com", "/fast"); err != nil {
+		t.Fatalf("Proxy.Refresh() unexpected error: %v", err)
+	}
+
+	if host := string(backend.host); host != "www.kratgo.com" {
+		t.Errorf("Proxy.Refresh() backend request host == '%s', want '%s'", host, "www.kratgo.com")
+	}
+
+	entry := cache.AcquireEntry()
+	defer cache.ReleaseEntry(entry)
+
+	if err := p.cache.Get("www.kratgo.com", entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := entry.GetVariantResponse([]byte("/fast"), nil); r == nil || string(r.Body) != "Kratgo" {
+		t.Errorf("Proxy.Refresh() response not saved in cache")
+	}
+
+	backend.err = errors.New("Backend error")
+
+	if err := p.Refresh("www.kratgo.com", "/slow"); err == nil {
+		t.Error("Proxy.Refresh() with backend error, want error")
+	}
+}
@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/valyala/fasthttp"
+)
+
+// setRequireHost sets how the requests without host are served: with the configured status code,
+// or with the default host. Without any of both, they share the cache entry of the empty host
+func (p *Proxy) setRequireHost() error {
+	cfg := p.fileConfig.RequireHost
+
+	if cfg.StatusCode != 0 && cfg.DefaultHost != "" {
+		return fmt.Errorf("Proxy.RequireHost could not have a status code and a default host at the same time")
+	}
+
+	if cfg.StatusCode != 0 && (cfg.StatusCode < fasthttp.StatusContinue || cfg.StatusCode > 599) {
+		return fmt.Errorf("Invalid status code '%d' in Proxy.RequireHost", cfg.StatusCode)
+	}
+
+	p.missingHostStatus = cfg.StatusCode
+	p.defaultHost = []byte(cfg.DefaultHost)
+
+	return nil
+}
+
+// serveMissingHost sets the default host to the request without host, so it's cached and forwarded with it,
+// or responds with the configured status code. It returns true if the request has been responded
+func (p *Proxy) serveMissingHost(ctx *fasthttp.RequestCtx, pt *proxyTools) bool {
+	if len(ctx.Host()) > 0 {
+		return false
+	}
+
+	if len(p.defaultHost) > 0 {
+		ctx.Request.Header.SetHostBytes(p.defaultHost)
+		ctx.Request.URI().SetHostBytes(p.defaultHost)
+
+		return false
+	}
+
+	if p.missingHostStatus == 0 {
+		return false
+	}
+
+	p.errorResponse(ctx, pt, fasthttp.StatusMessage(p.missingHostStatus), p.missingHostStatus)
+
+	return true
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/savsgio/kratgo/modules/cache"
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxy_setRequireHost(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.RequireHost
+		err  bool
+	}{
+		{name: "Default", cfg: config.RequireHost{}},
+		{name: "StatusCode", cfg: config.RequireHost{StatusCode: fasthttp.StatusBadRequest}},
+		{name: "DefaultHost", cfg: config.RequireHost{DefaultHost: "www.kratgo.com"}},
+		{name: "InvalidStatusCode", cfg: config.RequireHost{StatusCode: 600}, err: true},
+		{
+			name: "StatusCodeAndDefaultHost",
+			cfg:  config.RequireHost{StatusCode: fasthttp.StatusBadRequest, DefaultHost: "www.kratgo.com"},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.RequireHost = tt.cfg
+
+			if _, err := New(cfg); (err != nil) != tt.err {
+				t.Errorf("New() error == '%v', want '%v'", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestProxy_handler_MissingHost(t *testing.T) {
+	tests := []struct {
+		name           string
+		cfg            config.RequireHost
+		wantStatusCode int
+		wantCalled     bool
+		wantHost       string
+	}{
+		{
+			name:           "Reject",
+			cfg:            config.RequireHost{StatusCode: fasthttp.StatusBadRequest},
+			wantStatusCode: fasthttp.StatusBadRequest,
+		},
+		{
+			name:           "DefaultHost",
+			cfg:            config.RequireHost{DefaultHost: "default.kratgo.com"},
+			wantStatusCode: fasthttp.StatusOK,
+			wantCalled:     true,
+			wantHost:       "default.kratgo.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.RequireHost = tt.cfg
+
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			backend := &mockBackend{body: []byte("Kratgo"), statusCode: fasthttp.StatusOK}
+			p.backends = []fetcher{backend}
+			p.totalBackends = len(p.backends)
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.SetRequestURI("/hostless/")
+
+			p.handler(ctx)
+
+			if statusCode := ctx.Response.StatusCode(); statusCode != tt.wantStatusCode {
+				t.Errorf("Proxy.handler() status code == '%d', want '%d'", statusCode, tt.wantStatusCode)
+			}
+
+			if backend.called != tt.wantCalled {
+				t.Fatalf("Proxy.handler() backend called == '%v', want '%v'", backend.called, tt.wantCalled)
+			}
+
+			if !tt.wantCalled {
+				return
+			}
+
+			if host := string(backend.host); host != tt.wantHost {
+				t.Errorf("Proxy.handler() backend request host == '%s', want '%s'", host, tt.wantHost)
+			}
+
+			entry := cache.AcquireEntry()
+			defer cache.ReleaseEntry(entry)
+
+			if err := p.cache.Get(tt.wantHost, entry); err != nil || entry.GetResponse([]byte("/hostless/")) == nil {
+				t.Errorf("Proxy.handler() response not cached with the host '%s': %v", tt.wantHost, err)
+			}
+		})
+	}
+}
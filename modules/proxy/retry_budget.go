@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/config"
+)
+
+// newRetryBudget returns nil if the budget is disabled, so the retries are unlimited
+func newRetryBudget(cfg config.RetryBudget) *retryBudget {
+	if cfg.Ratio <= 0 {
+		return nil
+	}
+
+	window := defaultRetryBudgetWindow
+	if cfg.Window > 0 {
+		window = time.Duration(cfg.Window) * time.Second
+	}
+
+	return &retryBudget{
+		ratio:       cfg.Ratio,
+		window:      int64(window),
+		windowStart: time.Now().UnixNano(),
+	}
+}
+
+// rotate moves the current counters to the previous window when it's over
+func (b *retryBudget) rotate(now int64) {
+	start := atomic.LoadInt64(&b.windowStart)
+	elapsed := now - start
+
+	if elapsed < b.window || !atomic.CompareAndSwapInt64(&b.windowStart, start, now) {
+		return
+	}
+
+	requests := atomic.SwapInt64(&b.requests, 0)
+	retries := atomic.SwapInt64(&b.retries, 0)
+
+	if elapsed >= 2*b.window {
+		requests, retries = 0, 0
+	}
+
+	atomic.StoreInt64(&b.prevRequests, requests)
+	atomic.StoreInt64(&b.prevRetries, retries)
+}
+
+// weighted estimates the count of the sliding window,
+// weighting the previous window by its remaining part
+func (b *retryBudget) weighted(now int64, current, prev *int64) float64 {
+	weight := 1 - float64(now-atomic.LoadInt64(&b.windowStart))/float64(b.window)
+	if weight < 0 {
+		weight = 0
+	}
+
+	return float64(atomic.LoadInt64(current)) + float64(atomic.LoadInt64(prev))*weight
+}
+
+func (b *retryBudget) addRequest(now int64) {
+	if b == nil {
+		return
+	}
+
+	b.rotate(now)
+	atomic.AddInt64(&b.requests, 1)
+}
+
+// allowRetry reports if there is budget for one more retry, and spends it
+func (b *retryBudget) allowRetry(now int64) bool {
+	if b == nil {
+		return true
+	}
+
+	b.rotate(now)
+
+	requests := b.weighted(now, &b.requests, &b.prevRequests)
+	retries := b.weighted(now, &b.retries, &b.prevRetries)
+
+	if retries+1 > b.ratio*requests {
+		return false
+	}
+
+	atomic.AddInt64(&b.retries, 1)
+
+	return true
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/config"
+)
+
+func Test_newRetryBudget(t *testing.T) {
+	if b := newRetryBudget(config.RetryBudget{}); b != nil {
+		t.Errorf("newRetryBudget() == '%v', want '%v'", b, nil)
+	}
+
+	b := newRetryBudget(config.RetryBudget{Ratio: 0.1})
+	if b == nil {
+		t.Fatalf("newRetryBudget() == '%v'", nil)
+	}
+
+	if b.window != int64(defaultRetryBudgetWindow) {
+		t.Errorf("newRetryBudget() window == '%d', want '%d'", b.window, defaultRetryBudgetWindow)
+	}
+}
+
+func Test_retryBudget_allowRetry(t *testing.T) {
+	var nilBudget *retryBudget
+	if !nilBudget.allowRetry(0) {
+		t.Errorf("retryBudget.allowRetry() without budget == '%v', want '%v'", false, true)
+	}
+
+	window := int64(10 * time.Second)
+	b := &retryBudget{ratio: 0.1, window: window}
+
+	for i := 0; i < 20; i++ {
+		b.addRequest(0)
+	}
+
+	// 10% of 20 requests
+	for i := 0; i < 2; i++ {
+		if !b.allowRetry(0) {
+			t.Fatalf("retryBudget.allowRetry() retry %d == '%v', want '%v'", i+1, false, true)
+		}
+	}
+
+	if b.allowRetry(0) {
+		t.Errorf("retryBudget.allowRetry() budget exhausted == '%v', want '%v'", true, false)
+	}
+
+	// The previous window is still counted when the new one starts
+	if b.allowRetry(window + window/2) {
+		t.Errorf("retryBudget.allowRetry() in sliding window == '%v', want '%v'", true, false)
+	}
+
+	// The previous window is too old
+	for i := 0; i < 20; i++ {
+		b.addRequest(4 * window)
+	}
+
+	if !b.allowRetry(4 * window) {
+		t.Errorf("retryBudget.allowRetry() in new window == '%v', want '%v'", false, true)
+	}
+}
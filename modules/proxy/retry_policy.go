@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+// newRetryPolicy returns the retries by upper case method, or nil if it's not configured
+func newRetryPolicy(cfg config.RetryPolicy) (map[string]methodRetry, error) {
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+
+	policy := make(map[string]methodRetry, len(cfg))
+
+	for method, mr := range cfg {
+		if mr.Retries < 0 {
+			return nil, fmt.Errorf("Proxy.RetryPolicy retries of method '%s' must be 0 or greater", method)
+		}
+
+		policy[strings.ToUpper(method)] = methodRetry{retries: mr.Retries, requireHeader: mr.RequireHeader}
+	}
+
+	return policy, nil
+}
+
+// maxRetries returns the retries of the request by its method, the backendRetries if the method is not in the policy.
+// The requests without the required header of their method are never retried
+func (p *Proxy) maxRetries(ctx *fasthttp.RequestCtx) int {
+	mr, ok := p.retryPolicy[string(ctx.Method())]
+	if !ok {
+		return p.fileConfig.BackendRetries
+	}
+
+	if mr.requireHeader != "" && len(ctx.Request.Header.Peek(mr.requireHeader)) == 0 {
+		return 0
+	}
+
+	return mr.retries
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+func testRetryPolicy() config.RetryPolicy {
+	return config.RetryPolicy{
+		"GET":    {Retries: 2},
+		"head":   {Retries: 2},
+		"PUT":    {Retries: 0},
+		"DELETE": {Retries: 0},
+		"POST":   {Retries: 1, RequireHeader: "Idempotency-Key"},
+	}
+}
+
+func TestProxy_newRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.RetryPolicy
+		err  bool
+	}{
+		{name: "Ok", cfg: testRetryPolicy()},
+		{name: "Disabled", cfg: nil},
+		{name: "InvalidRetries", cfg: config.RetryPolicy{"GET": {Retries: -1}}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.RetryPolicy = tt.cfg
+
+			p, err := New(cfg)
+			if (err != nil) != tt.err {
+				t.Fatalf("New() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if !tt.err && len(p.retryPolicy) != len(tt.cfg) {
+				t.Errorf("Proxy.newRetryPolicy() methods == '%d', want '%d'", len(p.retryPolicy), len(tt.cfg))
+			}
+		})
+	}
+}
+
+func TestProxy_fetchFromBackend_RetryPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		header    bool
+		budget    config.RetryBudget
+		wantCalls int
+	}{
+		{name: "GET", method: "GET", wantCalls: 3},
+		{name: "HEAD", method: "HEAD", wantCalls: 3},
+		{name: "PUT", method: "PUT", wantCalls: 1},
+		{name: "DELETE", method: "DELETE", wantCalls: 1},
+		{name: "POSTWithHeader", method: "POST", header: true, wantCalls: 2},
+		{name: "POSTWithoutHeader", method: "POST", wantCalls: 1},
+		{name: "NotInPolicy", method: "PATCH", wantCalls: 2},
+		{name: "BudgetExhausted", method: "GET", budget: config.RetryBudget{Ratio: 0.1, Window: 10}, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.BackendRetries = 1
+			cfg.FileConfig.RetryPolicy = testRetryPolicy()
+			cfg.FileConfig.RetryBudget = tt.budget
+
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			backend := &mockBackend{statusCode: fasthttp.StatusServiceUnavailable}
+			p.backends = []fetcher{backend, backend, backend}
+			p.totalBackends = len(p.backends)
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.Header.SetMethod(tt.method)
+			ctx.Request.SetRequestURI("/retry/")
+			if tt.header {
+				ctx.Request.Header.Set("Idempotency-Key", "1")
+			}
+
+			pt := p.acquireTools()
+			defer p.releaseTools(pt)
+
+			if err := p.fetchFromBackend([]byte("retry"), []byte("/retry/"), nil, ctx, pt); err != nil {
+				t.Fatalf("Proxy.fetchFromBackend() returns err: %v", err)
+			}
+
+			if backend.calls != tt.wantCalls {
+				t.Errorf("Proxy.fetchFromBackend() %s backend calls == '%d', want '%d'", tt.method, backend.calls, tt.wantCalls)
+			}
+		})
+	}
+}
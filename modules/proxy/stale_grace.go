@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/savsgio/kratgo/modules/cache"
+
+	"github.com/valyala/fasthttp"
+)
+
+// newStaleGrace returns nil if there is no condition, so the expired responses are never served
+func (p *Proxy) newStaleGrace() (*staleGrace, error) {
+	cfg := p.fileConfig.StaleGrace
+	if cfg.When == "" {
+		return nil, nil
+	}
+
+	if cfg.Grace <= 0 {
+		return nil, fmt.Errorf("Proxy.StaleGrace.Grace must be greater than 0 with condition")
+	}
+
+	expr, params, err := p.newEvaluableExpression(cfg.When)
+	if err != nil {
+		return nil, fmt.Errorf("Could not get the evaluable expression for stale grace: %v", err)
+	}
+
+	s := &staleGrace{grace: int64(cfg.Grace)}
+	s.expr = expr
+	s.params = params
+
+	return s, nil
+}
+
+// serveStale serves the expired response, if it's within the grace period and the request matches
+// the condition, and fetches it again in background. The rest of requests are fetched synchronously
+func (p *Proxy) serveStale(ctx *fasthttp.RequestCtx, pt *proxyTools, cacheKey, path []byte, r *cache.Response, now int64) bool {
+	s := p.staleGrace
+	if s == nil || r == nil || ctx.UserValue(staleRefreshUserValueKey) != nil {
+		return false
+	}
+
+	if !p.cache.Stale(r, now, s.grace) {
+		return false
+	}
+
+	match, err := evalRule(ctx, s.rule, pt.params)
+	if err != nil {
+		p.log.Errorf("[%s] Invalid stale grace rule: %v", pt.requestID, err)
+		return false
+	} else if !match {
+		return false
+	}
+
+	p.serveCached(ctx, r, now)
+	ctx.Response.Header.Set(headerWarning, warningStale)
+	p.refreshStale(ctx, string(cacheKey)+string(path)+string(pt.variant))
+
+	return true
+}
+
+// refreshStale fetches the response again in background with a copy of the request,
+// only once at the same time for each response
+func (p *Proxy) refreshStale(ctx *fasthttp.RequestCtx, key string) {
+	if _, loaded := p.staleGrace.refreshes.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+
+	refreshCtx := new(fasthttp.RequestCtx)
+	ctx.Request.CopyTo(&refreshCtx.Request)
+	refreshCtx.SetUserValue(staleRefreshUserValueKey, true)
+
+	go func() {
+		defer p.staleGrace.refreshes.Delete(key)
+
+		p.handler(refreshCtx)
+	}()
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/cache"
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxy_newStaleGrace(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.StaleGrace
+		disabled bool
+		err      bool
+	}{
+		{
+			name: "Ok",
+			cfg:  config.StaleGrace{When: "$(req.header::User-Agent) =~ 'Googlebot'", Grace: 60},
+		},
+		{
+			name:     "Disabled",
+			cfg:      config.StaleGrace{Grace: 60},
+			disabled: true,
+		},
+		{
+			name: "WithoutGrace",
+			cfg:  config.StaleGrace{When: "$(req.header::User-Agent) =~ 'Googlebot'"},
+			err:  true,
+		},
+		{
+			name: "InvalidRule",
+			cfg:  config.StaleGrace{When: "$(req.header::User-Agent) ==", Grace: 60},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.StaleGrace = tt.cfg
+
+			p, err := New(cfg)
+			if (err != nil) != tt.err {
+				t.Fatalf("New() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if !tt.err && (p.staleGrace == nil) != tt.disabled {
+				t.Errorf("Proxy.newStaleGrace() == '%v', want nil '%v'", p.staleGrace, tt.disabled)
+			}
+		})
+	}
+}
+
+func TestProxy_handler_StaleGrace(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.StaleGrace = config.StaleGrace{When: "$(req.header::User-Agent) =~ 'Googlebot'", Grace: 60}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host := []byte("stale.kratgo.com")
+	path := []byte("/stale/")
+
+	body := func() string {
+		entry := cache.AcquireEntry()
+		defer cache.ReleaseEntry(entry)
+
+		if err := p.cache.GetBytes(host, entry); err != nil {
+			t.Fatal(err)
+		}
+
+		r := entry.GetResponse(path)
+		if r == nil {
+			t.Fatal("Proxy.handler() response is not cached")
+		}
+
+		return string(r.Body)
+	}
+
+	expire := func(expiresAt int64) {
+		entry := cache.AcquireEntry()
+		defer cache.ReleaseEntry(entry)
+
+		if err := p.cache.GetBytes(host, entry); err != nil {
+			t.Fatal(err)
+		}
+
+		entry.GetResponse(path).ExpiresAt = expiresAt
+		if err := p.cache.SetBytes(host, *entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	do := func(backendBody, userAgent string) *fasthttp.RequestCtx {
+		p.backends = []fetcher{&mockBackend{body: []byte(backendBody), statusCode: fasthttp.StatusOK}}
+		p.totalBackends = len(p.backends)
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURIBytes(path)
+		ctx.Request.Header.SetHostBytes(host)
+		ctx.Request.Header.SetUserAgent(userAgent)
+
+		p.handler(ctx)
+
+		return ctx
+	}
+
+	do("v1", "Mozilla/5.0")
+	expire(time.Now().Unix() - 10)
+
+	// The crawlers get the expired response, while it's fetched again in background
+	ctx := do("v2", "Mozilla/5.0 (compatible; Googlebot/2.1)")
+	if got := string(ctx.Response.Body()); got != "v1" {
+		t.Errorf("Proxy.handler() crawler body == '%s', want '%s'", got, "v1")
+	}
+
+	if got := string(ctx.Response.Header.Peek(headerWarning)); got != warningStale {
+		t.Errorf("Proxy.handler() crawler header '%s' == '%s', want '%s'", headerWarning, got, warningStale)
+	}
+
+	for i := 0; i < 100 && body() != "v2"; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := body(); got != "v2" {
+		t.Fatalf("Proxy.handler() cached body after the background refresh == '%s', want '%s'", got, "v2")
+	}
+
+	// The users get the response fetched synchronously
+	expire(time.Now().Unix() - 10)
+
+	ctx = do("v3", "Mozilla/5.0")
+	if got := string(ctx.Response.Body()); got != "v3" {
+		t.Errorf("Proxy.handler() user body == '%s', want '%s'", got, "v3")
+	}
+
+	if got := ctx.Response.Header.Peek(headerWarning); got != nil {
+		t.Errorf("Proxy.handler() user header '%s' == '%s', want empty", headerWarning, got)
+	}
+
+	// Out of the grace period, the crawlers get the response fetched synchronously too
+	expire(time.Now().Unix() - 61)
+
+	ctx = do("v4", "Mozilla/5.0 (compatible; Googlebot/2.1)")
+	if got := string(ctx.Response.Body()); got != "v4" {
+		t.Errorf("Proxy.handler() crawler body out of the grace == '%s', want '%s'", got, "v4")
+	}
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+// newStaticResponses returns the responses served without backends nor cache, in the order of the configuration
+func newStaticResponses(cfg []config.StaticResponse) ([]*staticResponse, error) {
+	responses := make([]*staticResponse, 0, len(cfg))
+
+	for _, sr := range cfg {
+		regex, err := regexp.Compile(sr.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid static response pattern '%s': %v", sr.Pattern, err)
+		}
+
+		if sr.Body != "" && sr.BodyFile != "" {
+			return nil, fmt.Errorf("Static response '%s' could not have a body and a body file at the same time", sr.Pattern)
+		}
+
+		s := &staticResponse{
+			regex:       regex,
+			statusCode:  sr.StatusCode,
+			contentType: sr.ContentType,
+			bodyFile:    sr.BodyFile,
+		}
+
+		if s.statusCode == 0 {
+			s.statusCode = fasthttp.StatusOK
+		} else if s.statusCode < fasthttp.StatusContinue || s.statusCode > 599 {
+			return nil, fmt.Errorf("Invalid status code '%d' in static response '%s'", s.statusCode, sr.Pattern)
+		}
+
+		if s.contentType == "" {
+			s.contentType = defaultStaticContentType
+		}
+
+		s.headers = sortedHeaders(sr.Headers)
+		s.body.Store([]byte(sr.Body))
+
+		if s.bodyFile != "" {
+			if err := s.reload(); err != nil {
+				return nil, err
+			}
+		}
+
+		responses = append(responses, s)
+	}
+
+	return responses, nil
+}
+
+// reload reads the body file again, if it has been modified since the last read
+func (s *staticResponse) reload() error {
+	info, err := os.Stat(s.bodyFile)
+	if err != nil {
+		return fmt.Errorf("Could not read the static response body file '%s': %v", s.bodyFile, err)
+	}
+
+	if info.ModTime().Equal(s.modTime) {
+		return nil
+	}
+
+	body, err := ioutil.ReadFile(s.bodyFile)
+	if err != nil {
+		return fmt.Errorf("Could not read the static response body file '%s': %v", s.bodyFile, err)
+	}
+
+	s.body.Store(body)
+	s.modTime = info.ModTime()
+
+	return nil
+}
+
+// runStaticFilesWatcher reloads the modified body files of the static responses,
+// keeping the last body if a file could not be read
+func (p *Proxy) runStaticFilesWatcher() {
+	ticker := time.NewTicker(staticFilesCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, s := range p.staticResponses {
+			if s.bodyFile == "" {
+				continue
+			}
+
+			if err := s.reload(); err != nil {
+				p.log.Errorf("%v", err)
+			}
+		}
+	}
+}
+
+// serveStatic writes the first static response whose pattern matches the path of the request
+func (p *Proxy) serveStatic(ctx *fasthttp.RequestCtx) bool {
+	path := ctx.URI().PathOriginal()
+
+	for _, s := range p.staticResponses {
+		if !s.regex.Match(path) {
+			continue
+		}
+
+		ctx.SetStatusCode(s.statusCode)
+		ctx.SetContentType(s.contentType)
+
+		for _, h := range s.headers {
+			ctx.Response.Header.Set(h[0], h[1])
+		}
+
+		ctx.SetBody(s.body.Load().([]byte))
+
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+func Test_newStaticResponses(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  []config.StaticResponse
+		err  bool
+	}{
+		{
+			name: "Ok",
+			cfg:  []config.StaticResponse{{Pattern: "^/robots.txt$", Body: "User-agent: *"}},
+		},
+		{
+			name: "InvalidPattern",
+			cfg:  []config.StaticResponse{{Pattern: "(", Body: "User-agent: *"}},
+			err:  true,
+		},
+		{
+			name: "InvalidStatusCode",
+			cfg:  []config.StaticResponse{{Pattern: "^/status$", StatusCode: 600}},
+			err:  true,
+		},
+		{
+			name: "BodyAndBodyFile",
+			cfg:  []config.StaticResponse{{Pattern: "^/status$", Body: "{}", BodyFile: "/tmp/status.json"}},
+			err:  true,
+		},
+		{
+			name: "MissingBodyFile",
+			cfg:  []config.StaticResponse{{Pattern: "^/status$", BodyFile: "/tmp/kratgo-missing-static-body"}},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newStaticResponses(tt.cfg); (err != nil) != tt.err {
+				t.Errorf("newStaticResponses() error == '%v', want '%v'", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestStaticResponse_reload(t *testing.T) {
+	f, err := ioutil.TempFile("", "kratgo-static-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(`{"status": "ok"}`)
+	f.Close()
+
+	responses, err := newStaticResponses([]config.StaticResponse{{Pattern: "^/status$", BodyFile: f.Name()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := responses[0]
+
+	if body := string(s.body.Load().([]byte)); body != `{"status": "ok"}` {
+		t.Errorf("newStaticResponses() body == '%s', want '%s'", body, `{"status": "ok"}`)
+	}
+
+	if err := ioutil.WriteFile(f.Name(), []byte(`{"status": "degraded"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(f.Name(), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.reload(); err != nil {
+		t.Fatalf("staticResponse.reload() unexpected error: %v", err)
+	}
+
+	if body := string(s.body.Load().([]byte)); body != `{"status": "degraded"}` {
+		t.Errorf("staticResponse.reload() body == '%s', want '%s'", body, `{"status": "degraded"}`)
+	}
+
+	// The last body is kept if the file could not be read
+	os.Remove(f.Name())
+
+	if err := s.reload(); err == nil {
+		t.Error("staticResponse.reload() of a removed file, want error")
+	}
+
+	if body := string(s.body.Load().([]byte)); body != `{"status": "degraded"}` {
+		t.Errorf("staticResponse.reload() body == '%s', want '%s'", body, `{"status": "degraded"}`)
+	}
+}
+
+func TestProxy_handler_StaticResponses(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.StaticResponses = []config.StaticResponse{
+		{
+			Pattern:     "^/robots.txt$",
+			Body:        "User-agent: *\nDisallow: /admin/",
+			Headers:     map[string]string{"Cache-Control": "max-age=3600"},
+			ContentType: "text/plain",
+		},
+		{Pattern: "^/gone/", StatusCode: fasthttp.StatusGone},
+	}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &mockBackend{body: []byte("Kratgo"), statusCode: fasthttp.StatusOK}
+	p.backends = []fetcher{backend}
+	p.totalBackends = len(p.backends)
+
+	tests := []struct {
+		path           string
+		wantStatusCode int
+		wantBody       string
+		wantHeader     string
+	}{
+		{path: "/robots.txt", wantStatusCode: fasthttp.StatusOK, wantBody: "User-agent: *\nDisallow: /admin/", wantHeader: "max-age=3600"},
+		{path: "/gone/page", wantStatusCode: fasthttp.StatusGone, wantBody: ""},
+	}
+
+	for _, tt := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(tt.path)
+		ctx.Request.SetHost("static.kratgo.com")
+
+		p.handler(ctx)
+
+		if statusCode := ctx.Response.StatusCode(); statusCode != tt.wantStatusCode {
+			t.Errorf("Proxy.handler() path '%s' status code == '%d', want '%d'", tt.path, statusCode, tt.wantStatusCode)
+		}
+
+		if body := string(ctx.Response.Body()); body != tt.wantBody {
+			t.Errorf("Proxy.handler() path '%s' body == '%s', want '%s'", tt.path, body, tt.wantBody)
+		}
+
+		if header := string(ctx.Response.Header.Peek("Cache-Control")); header != tt.wantHeader {
+			t.Errorf("Proxy.handler() path '%s' Cache-Control == '%s', want '%s'", tt.path, header, tt.wantHeader)
+		}
+	}
+
+	if backend.called {
+		t.Error("Proxy.handler() the backend has been called for the static responses")
+	}
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/other/")
+	ctx.Request.SetHost("static.kratgo.com")
+
+	p.handler(ctx)
+
+	if !backend.called {
+		t.Error("Proxy.handler() the backend has not been called for the path without static response")
+	}
+}
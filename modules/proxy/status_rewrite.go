@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/valyala/fasthttp"
+)
+
+// newStatusRewrites returns the rules to remap the status codes of the responses, in the order of the configuration
+func (p *Proxy) newStatusRewrites() ([]statusRewrite, error) {
+	rewrites := make([]statusRewrite, 0, len(p.fileConfig.StatusRewrite))
+
+	for i, cfg := range p.fileConfig.StatusRewrite {
+		for _, code := range []int{cfg.From, cfg.To} {
+			if code < fasthttp.StatusContinue || code > 599 {
+				return nil, fmt.Errorf("Invalid status code '%d' in Proxy.StatusRewrite[%d]", code, i)
+			}
+		}
+
+		r := statusRewrite{from: cfg.From, to: cfg.To}
+
+		if cfg.When != "" {
+			expr, params, err := p.newEvaluableExpression(cfg.When)
+			if err != nil {
+				return nil, fmt.Errorf("Could not get the evaluable expression for status rewrite: %v", err)
+			}
+
+			r.expr = expr
+			r.params = params
+		}
+
+		rewrites = append(rewrites, r)
+	}
+
+	return rewrites, nil
+}
+
+// rewriteStatus remaps the status code of the response with the first rule of it that matches the request
+func (p *Proxy) rewriteStatus(ctx *fasthttp.RequestCtx, pt *proxyTools) error {
+	statusCode := ctx.Response.StatusCode()
+
+	for _, r := range p.statusRewrites {
+		if r.from != statusCode {
+			continue
+		}
+
+		if r.expr != nil {
+			ok, err := evalRule(ctx, r.rule, pt.params)
+			if err != nil {
+				return fmt.Errorf("Invalid status rewrite rule: %v", err)
+			} else if !ok {
+				continue
+			}
+		}
+
+		ctx.Response.SetStatusCode(r.to)
+
+		return nil
+	}
+
+	return nil
+}
+
+// rewriteServedStatus remaps the status code of the response served to the client, from cache or not,
+// if the cache has the original status codes
+func (p *Proxy) rewriteServedStatus(ctx *fasthttp.RequestCtx, pt *proxyTools) {
+	if len(p.statusRewrites) == 0 || p.fileConfig.CacheRewrittenStatus {
+		return
+	}
+
+	if err := p.rewriteStatus(ctx, pt); err != nil {
+		p.handleError(ctx, pt, err)
+	}
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxy_newStatusRewrites(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  []config.StatusRewrite
+		err  bool
+	}{
+		{name: "Ok", cfg: []config.StatusRewrite{{From: 202, To: 200}}},
+		{name: "WithCondition", cfg: []config.StatusRewrite{{When: "$(path) =~ '^/api/'", From: 500, To: 503}}},
+		{name: "InvalidFrom", cfg: []config.StatusRewrite{{To: 200}}, err: true},
+		{name: "InvalidTo", cfg: []config.StatusRewrite{{From: 202, To: 600}}, err: true},
+		{name: "InvalidRule", cfg: []config.StatusRewrite{{When: "$(path) ==", From: 202, To: 200}}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.StatusRewrite = tt.cfg
+
+			p, err := New(cfg)
+			if (err != nil) != tt.err {
+				t.Fatalf("New() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if !tt.err && len(p.statusRewrites) != len(tt.cfg) {
+				t.Errorf("Proxy.newStatusRewrites() rules == '%d', want '%d'", len(p.statusRewrites), len(tt.cfg))
+			}
+		})
+	}
+}
+
+func TestProxy_handler_StatusRewrite(t *testing.T) {
+	rewrites := []config.StatusRewrite{
+		{From: fasthttp.StatusAccepted, To: fasthttp.StatusOK},
+		{When: "$(path) =~ '^/api/'", From: fasthttp.StatusInternalServerError, To: fasthttp.StatusServiceUnavailable},
+		{When: "$(path) == '/legacy/'", From: fasthttp.StatusOK, To: fasthttp.StatusNonAuthoritativeInfo},
+	}
+
+	tests := []struct {
+		name       string
+		cached     bool
+		path       string
+		statusCode int
+		wantStatus int
+		wantCalls  int
+	}{
+		{name: "Original", path: "/accepted/", statusCode: 202, wantStatus: 200, wantCalls: 2},
+		{name: "Rewritten", cached: true, path: "/accepted/", statusCode: 202, wantStatus: 200, wantCalls: 1},
+		{name: "Matched", path: "/api/", statusCode: 500, wantStatus: 503, wantCalls: 2},
+		{name: "NotMatched", path: "/other/", statusCode: 500, wantStatus: 500, wantCalls: 2},
+		{name: "OriginalCached", path: "/legacy/", statusCode: 200, wantStatus: 203, wantCalls: 1},
+		{name: "RewrittenNotCached", cached: true, path: "/legacy/", statusCode: 200, wantStatus: 203, wantCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.StatusRewrite = rewrites
+			cfg.FileConfig.CacheRewrittenStatus = tt.cached
+
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			backend := &mockBackend{body: []byte("Body"), statusCode: tt.statusCode}
+			p.backends = []fetcher{backend}
+			p.totalBackends = 1
+
+			for i := 0; i < 2; i++ {
+				ctx := new(fasthttp.RequestCtx)
+				ctx.Request.SetRequestURI(tt.path)
+				ctx.Request.Header.SetHost("www.kratgo.com")
+
+				p.handler(ctx)
+
+				if statusCode := ctx.Response.StatusCode(); statusCode != tt.wantStatus {
+					t.Errorf("Proxy.handler() request %d status code == '%d', want '%d'", i, statusCode, tt.wantStatus)
+				}
+			}
+
+			if backend.calls != tt.wantCalls {
+				t.Errorf("Proxy.handler() backend calls == '%d', want '%d'", backend.calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"strconv"
+
+	"github.com/valyala/fasthttp"
+)
+
+// logTrace logs the decision trail of the request in a single line, ex:
+// "[id] kratgo-trace: GET /foo key=example.com/foo variant=- nocache=- lookup=miss backend=localhost:8000 store=stored status=200"
+func (p *Proxy) logTrace(ctx *fasthttp.RequestCtx, pt *proxyTools) {
+	noCache := "-"
+	if pt.trace.noCacheRule >= 0 {
+		noCache = "rule#" + strconv.Itoa(pt.trace.noCacheRule)
+	}
+
+	p.log.Debugf("[%s] %s %s %s key=%s variant=%s nocache=%s lookup=%s backend=%s store=%s status=%d",
+		pt.requestID, traceLogPrefix, ctx.Method(), ctx.Path(),
+		traceValue(string(pt.trace.cacheKey)), traceValue(string(pt.variant)), noCache,
+		traceValue(pt.trace.lookup), traceValue(pt.backend), traceValue(pt.trace.store),
+		ctx.Response.StatusCode())
+}
+
+// traceValue returns "-" for the empty values, to keep the fields of the trace separated by spaces
+func traceValue(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
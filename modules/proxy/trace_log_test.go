@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	logger "github.com/savsgio/go-logger/v2"
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxy_logTrace(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{
+			name: "Miss",
+			path: "/trace/",
+			want: []string{"GET /trace/ key=www.kratgo.com variant=- nocache=- lookup=miss backend=localhost:9990 store=stored status=200"},
+		},
+		{
+			name: "Hit",
+			path: "/trace/",
+			want: []string{"GET /trace/ key=www.kratgo.com variant=- nocache=- lookup=hit backend=- store=- status=200"},
+		},
+		{
+			name: "Nocache",
+			path: "/private/",
+			want: []string{"GET /private/ key=www.kratgo.com variant=- nocache=rule#1 lookup=skip backend=localhost:9990 store=nocache status=200"},
+		},
+	}
+
+	output := new(bytes.Buffer)
+
+	cfg := testConfig()
+	cfg.LogLevel = logger.DEBUG
+	cfg.LogOutput = output
+	cfg.FileConfig.Nocache = []string{"$(method) == 'POST'", "$(path) == '/private/'"}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.backends = []fetcher{&mockBackend{body: []byte("Kratgo"), statusCode: fasthttp.StatusOK}}
+	p.totalBackends = len(p.backends)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output.Reset()
+
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.SetRequestURI(tt.path)
+			ctx.Request.Header.SetHost("www.kratgo.com")
+
+			p.handler(ctx)
+
+			var traces []string
+			for _, line := range strings.Split(output.String(), "\n") {
+				if i := strings.Index(line, traceLogPrefix); i >= 0 {
+					traces = append(traces, line[i+len(traceLogPrefix)+1:])
+				}
+			}
+
+			if len(traces) != len(tt.want) {
+				t.Fatalf("Proxy.logTrace() traces == '%v', want '%v'", traces, tt.want)
+			}
+
+			for i := range tt.want {
+				if traces[i] != tt.want[i] {
+					t.Errorf("Proxy.logTrace() trace == '%s', want '%s'", traces[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestProxy_logTrace_Disabled(t *testing.T) {
+	output := new(bytes.Buffer)
+
+	cfg := testConfig()
+	cfg.LogLevel = logger.INFO
+	cfg.LogOutput = output
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.backends = []fetcher{&mockBackend{body: []byte("Kratgo"), statusCode: fasthttp.StatusOK}}
+	p.totalBackends = len(p.backends)
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/trace/")
+	ctx.Request.Header.SetHost("www.kratgo.com")
+
+	p.handler(ctx)
+
+	if strings.Contains(output.String(), traceLogPrefix) {
+		t.Errorf("Proxy.logTrace() logged with level '%s': %s", cfg.LogLevel, output.String())
+	}
+}
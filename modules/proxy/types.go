@@ -1,11 +1,17 @@
 package proxy
 
 import (
+	"bufio"
 	"io"
+	"net"
+	"regexp"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/savsgio/kratgo/modules/cache"
 	"github.com/savsgio/kratgo/modules/config"
+	"github.com/savsgio/kratgo/modules/tracing"
 
 	logger "github.com/savsgio/go-logger/v2"
 	"github.com/savsgio/govaluate/v3"
@@ -16,9 +22,12 @@ import (
 type Config struct {
 	FileConfig config.Proxy
 	Cache      *cache.Cache
+	Tracer     *tracing.Tracer
 
 	HTTPScheme string
 
+	EvalVars map[string]config.EvalVarResolver
+
 	LogLevel  string
 	LogOutput io.Writer
 }
@@ -30,23 +39,211 @@ type Proxy struct {
 	server server
 	cache  *cache.Cache
 
-	backends       []fetcher
-	totalBackends  int
-	currentBackend int
+	// cacheStoreErrors counts the backend responses that could not be saved in cache
+	cacheStoreErrors *uint64
 
-	httpScheme string
+	// cacheTooLarge counts the backend responses that were not cached, as the entry is bigger than the cache allows
+	cacheTooLarge *uint64
 
-	nocacheRules []rule
-	headersRules []headerRule
+	// cacheReadErrors counts the failed cache lookups
+	cacheReadErrors *uint64
+
+	backends         []fetcher
+	totalBackends    int
+	currentBackend   int
+	backendKeepAlive bool
+	backendOptions   backendOptions
+
+	// backendHeaders are the headers injected in the requests of each backend, by its address
+	backendHeaders map[string][][2]string
+
+	httpScheme     string
+	trustedProxies []*net.IPNet
+	evalVars       map[string]config.EvalVarResolver
+	retryBudget    *retryBudget
+	backendLimiter *backendLimiter
+
+	// retryPolicy are the retries by request method, backendRetries is used without it
+	retryPolicy map[string]methodRetry
+
+	// overloads are the unix nano times until the backends are skipped, by their "Retry-After"
+	overloads sync.Map
+
+	requestIDHeader  string
+	jsonErrors       bool
+	uriNormalization string
+
+	clientTimeoutHeader string
+	maxClientTimeout    time.Duration
+	tracer              *tracing.Tracer
+	canary              *canary
+	backendPools        []*backendPool
+	noMatchPool         *backendPool
+	noMatchStatus       int
+	missingHostStatus   int
+	defaultHost         []byte
+	bodyRewrite         *bodyRewrite
+	maintenance         *maintenance
+	connLimiter         *connLimiter
+	deny                *deny
+	rateLimiter         *rateLimiter
+	staleGrace          *staleGrace
+	staticResponses     []*staticResponse
+	prefetch            *prefetch
+	deviceDetection     *deviceDetection
+	bodyHashRules       []bodyHashRule
+	statusRewrites      []statusRewrite
+
+	maxPooledEvalParams int
+	maxPooledBufferSize int
+	poolStats           *poolStats
+
+	slowRequestThreshold time.Duration
+
+	backendLatencies []*latencyHistogram
+	routeLabels      []routeLabel
+	cacheKeyHosts    []hostRewrite
+
+	// requestSizes and responseSizes are only set if the size metrics are enabled
+	requestSizes  *sizeHistogram
+	responseSizes *sizeHistogram
+
+	// ruleSet could be replaced by ReloadRules, so it's read with rules()
+	ruleSet
+	rulesMu sync.RWMutex
+
+	// debug logs the decision trail of each request
+	debug bool
 
 	log   *logger.Logger
 	tools sync.Pool
 	mu    sync.RWMutex
 }
 
+// ruleSet are the rules of the nocache and headers sections of the configuration
+type ruleSet struct {
+	nocacheRules []rule
+	headersRules []headerRule
+
+	// cacheOnlyWhen has the rule that the backend responses must match to be cached, if it's configured
+	cacheOnlyWhen []rule
+
+	// alwaysHeaders are set in all the responses, after the rules
+	alwaysHeaders []config.Header
+
+	requestHeadersRules []headerRule
+}
+
 type proxyTools struct {
-	params *evalParams
-	entry  *cache.Entry
+	params    *evalParams
+	entry     *cache.Entry
+	variant   []byte
+	requestID []byte
+	span      *tracing.Span
+	canary    bool
+	pool      *backendPool
+
+	// benchEcho requests are served with a canned response instead of the backends
+	benchEcho bool
+
+	// uncacheable requests are neither looked up nor saved in cache, as their cache key could not be built
+	uncacheable bool
+
+	// stale is the expired cached response revalidated with a conditional request
+	stale *cache.Response
+
+	// deadline of the backend requests, from the client timeout header
+	deadline time.Time
+
+	// Timings of the request, only measured if the slow requests are logged
+	start       time.Time
+	cacheTime   time.Duration
+	backendTime time.Duration
+	backend     string
+
+	// trace are the cache decisions of the request, only logged in debug level
+	trace requestTrace
+}
+
+// requestTrace is the decision trail of a request, from the cache key to the backend response
+type requestTrace struct {
+	cacheKey []byte
+
+	// noCacheRule is the index of the nocache rule that matched, or -1
+	noCacheRule int
+	lookup      string
+	store       string
+}
+
+// backendError is a failed request to the backends, with the status code for the client
+type backendError struct {
+	err        error
+	statusCode int
+}
+
+// errorBody is the body of the errors in json format
+type errorBody struct {
+	Error     string `json:"error"`
+	Status    int    `json:"status"`
+	RequestID string `json:"requestId"`
+}
+
+// proxyProtocolListener is a listener whose connections start with the PROXY protocol header
+type proxyProtocolListener struct {
+	net.Listener
+}
+
+// connLimitListener is a listener that limits the simultaneous connections of each client IP
+type connLimitListener struct {
+	net.Listener
+
+	limiter *connLimiter
+}
+
+type connLimiter struct {
+	maxConns int
+	allowIPs []*net.IPNet
+	rejected uint64
+
+	conns map[string]int
+	mu    sync.Mutex
+}
+
+type connLimitConn struct {
+	net.Conn
+
+	limiter   *connLimiter
+	ip        string
+	err       error
+	once      sync.Once
+	closeOnce sync.Once
+}
+
+type proxyProtocolConn struct {
+	net.Conn
+
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+	err        error
+	once       sync.Once
+}
+
+// backendOptions are the connection options of the backends clients
+type backendOptions struct {
+	dialTimeout         time.Duration
+	maxIdleConnDuration time.Duration
+	maxConnDuration     time.Duration
+	maxResponseBodySize int
+
+	tls config.BackendTLS
+}
+
+// urlBackend is a backend configured as URL, with its own scheme and path prefix
+type urlBackend struct {
+	client fetcher
+
+	scheme     []byte
+	pathPrefix []byte
 }
 
 type httpClient struct {
@@ -58,21 +255,337 @@ type httpClient struct {
 
 type evalParams struct {
 	p map[string]interface{}
+
+	// peak is the max length since the last release, as the maps don't shrink
+	peak int
 }
 
-type ruleParam struct {
+type poolStats struct {
+	gets      uint64
+	puts      uint64
+	news      uint64
+	discarded uint64
+}
+
+// methodRetry are the retries of the requests of a method, only if they have the header if it's required
+type methodRetry struct {
+	retries       int
+	requireHeader string
+}
+
+// backendLimiter limits the in-flight backend requests of all the clients, with a slot by request
+type backendLimiter struct {
+	slots    chan struct{}
+	timeout  time.Duration
+	rejected uint64
+}
+
+type retryBudget struct {
+	ratio  float64
+	window int64
+
+	windowStart  int64
+	requests     int64
+	retries      int64
+	prevRequests int64
+	prevRetries  int64
+}
+
+type latencyHistogram struct {
 	name   string
-	subKey string
+	counts [histogramBuckets]uint64
+	total  uint64
+}
+
+// sizeHistogram counts the body sizes by bucket, the last count is for the sizes over all the bounds
+type sizeHistogram struct {
+	bounds []int
+	counts []uint64
+	total  uint64
+	sum    uint64
+}
+
+// backendPool is a named group of backends, serving the requests that match its condition
+type backendPool struct {
+	rule
+
+	name      string
+	backends  []fetcher
+	addrs     []string
+	latencies []*latencyHistogram
+	current   int
+
+	mu sync.Mutex
+}
+
+type canary struct {
+	backends  []fetcher
+	addrs     []string
+	latencies []*latencyHistogram
+	current   int
+
+	// threshold is the percent in hundredths, compared against the bucket of the request
+	threshold uint32
+	bucketBy  *headerValue
+
+	// ramp replaces the threshold if it's configured
+	ramp *canaryRamp
+
+	mu sync.Mutex
+}
+
+// canaryRamp increases the threshold of the canary linearly, from start to end during the duration
+type canaryRamp struct {
+	start    uint32
+	end      uint32
+	duration int64
+
+	// startedAt is the unix nano time of the start of the ramp, restarted with RestartCanaryRamp
+	startedAt int64
+}
+
+type bodyRewrite struct {
+	contentTypes []string
+	maxBodySize  int
+	rules        []bodyRewriteRule
+	compression  compression
+}
+
+// compression are the levels of the encoded bodies, by content encoding
+type compression struct {
+	gzipLevel    int
+	deflateLevel int
+	brotliLevel  int
+}
+
+// limitedBuffer is a writer with a max size, to decode the bodies
+type limitedBuffer struct {
+	b   []byte
+	max int
+}
+
+type bodyRewriteRule struct {
+	match   []byte
+	replace []byte
+	regex   *regexp.Regexp
+}
+
+type maintenance struct {
+	enabled int32
+
+	statusCode  int
+	body        []byte
+	contentType string
+	retryAfter  string
+	allowPaths  [][]byte
+	allowIPs    []*net.IPNet
+}
+
+// staleGrace serves the expired responses to the requests that match the rule, during the grace seconds
+type staleGrace struct {
+	rule
+
+	grace int64
+
+	// refreshes are the responses that are being fetched in background
+	refreshes sync.Map
+}
+
+// bodyHashRule caches the requests that match it by a hash of their body, if it's not bigger than the max size
+type bodyHashRule struct {
+	rule
+
+	maxBodySize int
+}
+
+// statusRewrite remaps the status code of the responses, only if they match the rule when it's set
+type statusRewrite struct {
+	rule
+
+	from int
+	to   int
+}
+
+// deviceDetection classifies the requests by the User-Agent, to cache the responses of each device apart
+type deviceDetection struct {
+	devices       []device
+	defaultDevice string
+
+	// header is set in the backend requests with the device, if it's configured
+	header string
+}
+
+type device struct {
+	name  string
+	regex *regexp.Regexp
+}
+
+// prefetch fetches in background the URLs hinted by the backend responses, to cache them before they are requested
+type prefetch struct {
+	header        string
+	link          bool
+	workers       int
+	maxPerRequest int
+
+	queue chan *fasthttp.RequestCtx
+
+	// pending are the URLs queued or being fetched, to not prefetch them twice at the same time
+	pending sync.Map
+}
+
+// staticResponse is served from the configuration to the requests whose path matches the regex
+type staticResponse struct {
+	regex       *regexp.Regexp
+	statusCode  int
+	contentType string
+	headers     [][2]string
+
+	// body is replaced by the watcher when the body file is modified
+	body     atomic.Value
+	bodyFile string
+	modTime  time.Time
+}
+
+type deny struct {
+	rules      []rule
+	allowRules []rule
+
+	statusCode  int
+	body        []byte
+	contentType string
+}
+
+// rateLimiter limits the requests of each client IP by the first rule that matches them,
+// with the limit of the same index
+type rateLimiter struct {
+	rules   []rule
+	limits  []*rateLimit
+	limited uint64
+}
+
+// rateLimit is a token bucket by client IP, refilled with rate tokens per second up to burst
+type rateLimit struct {
+	rate  float64
+	burst float64
+
+	buckets   map[string]*tokenBucket
+	lastSweep int64
+	mu        sync.Mutex
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   int64
+}
+
+// hostRewrite is the canonical host of the cache key of the hosts that match the pattern,
+// the suffix of the wildcard patterns starts with the dot, ex: ".example.com"
+type hostRewrite struct {
+	pattern  []byte
+	wildcard bool
+	host     []byte
+}
+
+type routeLabel struct {
+	regex   *regexp.Regexp
+	latency *latencyHistogram
+}
+
+// LatencySummary ...
+type LatencySummary struct {
+	Name  string  `json:"name"`
+	Count uint64  `json:"count"`
+	P50   float64 `json:"p50Ms"`
+	P95   float64 `json:"p95Ms"`
+	P99   float64 `json:"p99Ms"`
+}
+
+// SizeBucket ...
+type SizeBucket struct {
+	LE    int    `json:"le"`
+	Count uint64 `json:"count"`
+}
+
+// SizeSummary ...
+type SizeSummary struct {
+	Buckets []SizeBucket `json:"buckets"`
+	Count   uint64       `json:"count"`
+	Sum     uint64       `json:"sum"`
+}
+
+// RuleStats ...
+type RuleStats struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Header  string `json:"header,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Matches uint64 `json:"matches"`
+}
+
+// PoolStats ...
+type PoolStats struct {
+	Gets      uint64 `json:"gets"`
+	Puts      uint64 `json:"puts"`
+	News      uint64 `json:"news"`
+	Discarded uint64 `json:"discarded"`
+}
+
+// Stats ...
+type Stats struct {
+	Backends []LatencySummary `json:"backends"`
+	Routes   []LatencySummary `json:"routes"`
+	Rules    []RuleStats      `json:"rules,omitempty"`
+	Pool     *PoolStats       `json:"pool,omitempty"`
+
+	CacheStoreErrors uint64 `json:"cacheStoreErrors"`
+	CacheReadErrors  uint64 `json:"cacheReadErrors"`
+	CacheTooLarge    uint64 `json:"cacheTooLarge"`
+
+	// CacheDemotionsDropped are the entries evicted from memory that were not written to the disk tier
+	CacheDemotionsDropped uint64 `json:"cacheDemotionsDropped"`
+
+	// RejectedConns are the connections closed as their client IP was over Proxy.MaxConnsPerIP
+	RejectedConns uint64 `json:"rejectedConns"`
+
+	// RateLimited are the requests responded with a 429, as they exceeded a rate limit rule
+	RateLimited uint64 `json:"rateLimited"`
+
+	// BackendRequestsRejected are the requests not sent to the backends, as they were over Proxy.MaxConcurrentBackendRequests
+	BackendRequestsRejected uint64 `json:"backendRequestsRejected"`
+
+	// MemoryPressure is true while the responses are not cached, as the heap is over the high watermark
+	MemoryPressure bool `json:"memoryPressure"`
+
+	RequestSizes  *SizeSummary `json:"requestSizes,omitempty"`
+	ResponseSizes *SizeSummary `json:"responseSizes,omitempty"`
+}
+
+type ruleParam struct {
+	// name is the param of the expression, and evalName the variable of its value
+	// if it's not the name, like in the numeric comparisons (see config.EvalNumericSuffix)
+	name     string
+	evalName string
+	subKey   string
+	numeric  bool
+	resolver config.EvalVarResolver
 }
 
 type headerValue struct {
-	value  string
-	subKey string
+	value    string
+	subKey   string
+	resolver config.EvalVarResolver
 }
 
 type rule struct {
 	expr   *govaluate.EvaluableExpression
 	params []ruleParam
+
+	// condition is the expression of the configuration, to log the evaluation errors
+	condition string
+
+	// source and matches are only set if the rule metrics are enabled
+	source  string
+	matches *uint64
 }
 
 type typeHeaderAction int
@@ -87,11 +600,24 @@ type headerRule struct {
 
 // ###### INTERFACES ######
 
+// headerSetter is the request or the response header
+type headerSetter interface {
+	Set(key, value string)
+	Add(key, value string)
+	Del(key string)
+}
+
 type fetcher interface {
 	Do(req *fasthttp.Request, resp *fasthttp.Response) error
 }
 
+// deadlineFetcher is a fetcher that could bound the request with a deadline
+type deadlineFetcher interface {
+	DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error
+}
+
 // Server ...
 type server interface {
 	ListenAndServe(addr string) error
+	Serve(ln net.Listener) error
 }
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"net/url"
+
+	"github.com/savsgio/gotils"
+	"github.com/valyala/fasthttp"
+)
+
+// normalizeURI replaces the path of the request by the one of the URI normalization, which is
+// the same for the cache key, the rules and the backends, since fasthttp normalizes it by default
+// only when it's sent to the backends:
+//
+// - raw: the path as it's received, ex: /a%2Fb/../c
+// - decode: the path percent-decoded, ex: /a/b/../c
+// - normalize: the path percent-decoded, without duplicated slashes nor dot segments, ex: /a/c
+func (p *Proxy) normalizeURI(ctx *fasthttp.RequestCtx) {
+	uri := ctx.URI()
+	uri.DisablePathNormalizing = true
+
+	switch p.uriNormalization {
+	case uriNormalizationDecode:
+		// The invalid escapes are kept as they are received
+		if path, err := url.PathUnescape(gotils.B2S(uri.PathOriginal())); err == nil {
+			uri.SetPath(escapePath(path))
+		}
+
+	case uriNormalizationNormalize:
+		uri.SetPath(escapePath(gotils.B2S(uri.Path())))
+	}
+}
+
+// escapePath returns the path escaped to be sent in the request line,
+// with the same escapes than fasthttp (ex: the spaces, but not the slashes)
+func escapePath(path string) string {
+	u := url.URL{Path: path}
+
+	return u.EscapedPath()
+}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+// uriBackend saves the request URI sent to the backend, as it's written by fasthttp
+type uriBackend struct {
+	mockBackend
+
+	uris []string
+}
+
+func (b *uriBackend) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	b.uris = append(b.uris, string(req.URI().RequestURI()))
+
+	return b.mockBackend.Do(req, resp)
+}
+
+func TestProxy_normalizeURI(t *testing.T) {
+	tests := []struct {
+		uri           string
+		wantRaw       string
+		wantDecode    string
+		wantNormalize string
+	}{
+		{
+			uri:           "/a%2Fb/../c%20d?q=%2F",
+			wantRaw:       "/a%2Fb/../c%20d?q=%2F",
+			wantDecode:    "/a/b/../c%20d?q=%2F",
+			wantNormalize: "/a/c%20d?q=%2F",
+		},
+		{
+			uri:           "//a/./b%7E",
+			wantRaw:       "//a/./b%7E",
+			wantDecode:    "//a/./b~",
+			wantNormalize: "/a/b~",
+		},
+		{
+			uri:           "/a%zz",
+			wantRaw:       "/a%zz",
+			wantDecode:    "/a%zz",
+			wantNormalize: "/a%25zz",
+		},
+	}
+
+	for _, tt := range tests {
+		for mode, want := range map[string]string{
+			uriNormalizationRaw:       tt.wantRaw,
+			uriNormalizationDecode:    tt.wantDecode,
+			uriNormalizationNormalize: tt.wantNormalize,
+		} {
+			t.Run(mode+tt.uri, func(t *testing.T) {
+				p := &Proxy{uriNormalization: mode}
+
+				ctx := new(fasthttp.RequestCtx)
+				ctx.Request.SetRequestURI(tt.uri)
+				ctx.Request.Header.SetHost("www.kratgo.com")
+
+				p.normalizeURI(ctx)
+
+				if uri := string(ctx.URI().RequestURI()); uri != want {
+					t.Errorf("Proxy.normalizeURI() request URI == '%s', want '%s'", uri, want)
+				}
+
+				// The path of the cache key and the rules is the same as the one sent to the backends
+				wantPath := strings.SplitN(want, "?", 2)[0]
+				if path := string(ctx.URI().PathOriginal()); path != wantPath {
+					t.Errorf("Proxy.normalizeURI() path == '%s', want '%s'", path, wantPath)
+				}
+			})
+		}
+	}
+}
+
+func TestProxy_handler_URINormalization(t *testing.T) {
+	tests := []struct {
+		normalization string
+		wantURIs      []string
+	}{
+		{normalization: "", wantURIs: []string{"/a%2Fb", "/a/b"}},
+		{normalization: uriNormalizationRaw, wantURIs: []string{"/a%2Fb", "/a/b"}},
+		{normalization: uriNormalizationDecode, wantURIs: []string{"/a/b"}},
+		{normalization: uriNormalizationNormalize, wantURIs: []string{"/a/b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.normalization, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FileConfig.URINormalization = tt.normalization
+
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			backend := &uriBackend{mockBackend: mockBackend{body: []byte("Body"), statusCode: fasthttp.StatusOK}}
+			p.backends = []fetcher{backend}
+			p.totalBackends = 1
+
+			// The second one is served from cache if it has the same path after the normalization
+			for _, uri := range []string{"/a%2Fb", "/a/b"} {
+				ctx := new(fasthttp.RequestCtx)
+				ctx.Request.SetRequestURI(uri)
+				ctx.Request.Header.SetHost("www.kratgo.com")
+
+				p.handler(ctx)
+
+				if statusCode := ctx.Response.StatusCode(); statusCode != fasthttp.StatusOK {
+					t.Fatalf("Proxy.handler() status code == '%d', want '%d'", statusCode, fasthttp.StatusOK)
+				}
+			}
+
+			if len(backend.uris) != len(tt.wantURIs) {
+				t.Fatalf("Proxy.handler() backend URIs == '%v', want '%v'", backend.uris, tt.wantURIs)
+			}
+
+			for i, uri := range backend.uris {
+				if uri != tt.wantURIs[i] {
+					t.Errorf("Proxy.handler() backend URI == '%s', want '%s'", uri, tt.wantURIs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestProxy_New_URINormalization(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.URINormalization = "lowercase"
+
+	if _, err := New(cfg); err == nil {
+		t.Errorf("New() with URI normalization '%s', want error", cfg.FileConfig.URINormalization)
+	}
+}
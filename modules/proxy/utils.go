@@ -1,9 +1,18 @@
 package proxy
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"math"
+	"net"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/savsgio/kratgo/modules/config"
 
@@ -18,8 +27,8 @@ var hopHeaders = []string{
 	"Keep-Alive",
 	"Proxy-Authenticate",
 	"Proxy-Authorization",
-	"Te", // canonicalized version of "TE"
-	"Trailers",
+	"Te",      // canonicalized version of "TE"
+	"Trailer", // not Trailers, see https://www.rfc-editor.org/errata_search.php?eid=4522
 	"Transfer-Encoding",
 	"Upgrade",
 }
@@ -54,6 +63,22 @@ func stringSliceInclude(vs []string, t string) bool {
 
 // HTTP
 
+// sortedHeaders returns the headers of the map as name and value pairs, sorted by name
+func sortedHeaders(headers map[string]string) [][2]string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([][2]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, [2]string{name, headers[name]})
+	}
+
+	return pairs
+}
+
 func cloneHeaders(dst, src *fasthttp.RequestHeader) {
 	src.VisitAll(func(key, value []byte) {
 		if !stringSliceInclude(hopHeaders, gotils.B2S(key)) {
@@ -63,6 +88,358 @@ func cloneHeaders(dst, src *fasthttp.RequestHeader) {
 	})
 }
 
+func headerNameInclude(names []string, k []byte) bool {
+	for _, name := range names {
+		if strings.EqualFold(name, gotils.B2S(k)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isCacheableHeader reports if the response header could be saved in cache,
+// checking the allow (if not empty) and deny lists
+func isCacheableHeader(cfg config.ProxyCacheHeaders, k []byte) bool {
+	if len(cfg.Allow) > 0 && !headerNameInclude(cfg.Allow, k) {
+		return false
+	}
+
+	return !headerNameInclude(cfg.Deny, k)
+}
+
+// addCachedHeader adds a header of a cached response, keeping all values of the
+// multi-valued headers. The single-valued headers managed by fasthttp are set instead
+func addCachedHeader(dst *fasthttp.ResponseHeader, k, v []byte) {
+	switch gotils.B2S(k) {
+	case fasthttp.HeaderContentType, fasthttp.HeaderServer, fasthttp.HeaderContentLength,
+		fasthttp.HeaderConnection, fasthttp.HeaderTransferEncoding, fasthttp.HeaderDate,
+		fasthttp.HeaderSetCookie: // Each Set-Cookie is added as a different cookie
+		dst.SetCanonical(k, v)
+	default:
+		dst.AddBytesKV(k, v)
+	}
+}
+
+// mediaType returns the media type of the content type, in lower case and without parameters
+func mediaType(contentType []byte) string {
+	if i := bytes.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+
+	return strings.ToLower(strings.TrimSpace(gotils.B2S(contentType)))
+}
+
+// contentTypeInclude reports if the media type is one of the content types,
+// which could be a whole type like "image/*"
+func contentTypeInclude(contentTypes []string, mediaType string) bool {
+	for _, ct := range contentTypes {
+		if strings.EqualFold(ct, mediaType) {
+			return true
+		}
+
+		if strings.HasSuffix(ct, "/*") && len(mediaType) > len(ct)-1 &&
+			strings.EqualFold(ct[:len(ct)-1], mediaType[:len(ct)-1]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isCacheableContentType reports if the response could be saved in cache by its content type,
+// checking the allow (if not empty) and deny lists
+func isCacheableContentType(cfg config.ProxyCacheableContentTypes, contentType []byte) bool {
+	mt := mediaType(contentType)
+
+	if len(cfg.Allow) > 0 && !contentTypeInclude(cfg.Allow, mt) {
+		return false
+	}
+
+	return !contentTypeInclude(cfg.Deny, mt)
+}
+
+// isFramingHeader reports if the header is about the framing of the body
+func isFramingHeader(k []byte) bool {
+	return strings.EqualFold(gotils.B2S(k), headerContentLength) ||
+		strings.EqualFold(gotils.B2S(k), headerTransferEncoding)
+}
+
+// requestID returns the request ID from the header, or a new random one
+// if it's not present or it's too long
+func requestID(ctx *fasthttp.RequestCtx, header string, dst []byte) []byte {
+	if id := ctx.Request.Header.Peek(header); len(id) > 0 && len(id) <= maxRequestIDLength {
+		return append(dst, id...)
+	}
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// Unique enough, in the very unlikely case of error
+		binary.BigEndian.PutUint64(b[:8], ctx.ID())
+		binary.BigEndian.PutUint64(b[8:], uint64(time.Now().UnixNano()))
+	}
+
+	n := len(dst)
+	dst = append(dst, make([]byte, hex.EncodedLen(len(b)))...)
+	hex.Encode(dst[n:], b[:])
+
+	return dst
+}
+
+// clientTimeout returns the timeout requested by the client in the header, capped by max.
+// The value is a duration like "2s" or "500ms", or in the gRPC format if the header is "grpc-timeout".
+// It returns 0 if the header is not present or it's invalid
+func clientTimeout(ctx *fasthttp.RequestCtx, header string, max time.Duration) time.Duration {
+	value := gotils.B2S(ctx.Request.Header.Peek(header))
+	if value == "" {
+		return 0
+	}
+
+	var timeout time.Duration
+	var err error
+
+	if strings.EqualFold(header, headerGRPCTimeout) {
+		timeout, err = parseGRPCTimeout(value)
+	} else {
+		timeout, err = time.ParseDuration(value)
+	}
+
+	if err != nil || timeout <= 0 {
+		return 0
+	} else if timeout > max {
+		return max
+	}
+
+	return timeout
+}
+
+// parseGRPCTimeout parses the value of the gRPC timeout header, up to 8 digits with its unit:
+// H (hours), M (minutes), S (seconds), m (milliseconds), u (microseconds) or n (nanoseconds)
+func parseGRPCTimeout(value string) (time.Duration, error) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, fmt.Errorf("Invalid gRPC timeout '%s'", value)
+	}
+
+	var unit time.Duration
+
+	switch value[len(value)-1] {
+	case 'H':
+		unit = time.Hour
+	case 'M':
+		unit = time.Minute
+	case 'S':
+		unit = time.Second
+	case 'm':
+		unit = time.Millisecond
+	case 'u':
+		unit = time.Microsecond
+	case 'n':
+		unit = time.Nanosecond
+	default:
+		return 0, fmt.Errorf("Invalid gRPC timeout unit of '%s'", value)
+	}
+
+	n, err := strconv.ParseUint(value[:len(value)-1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid gRPC timeout '%s': %v", value, err)
+	}
+
+	if n > uint64(math.MaxInt64/unit) {
+		return math.MaxInt64, nil
+	}
+
+	return time.Duration(n) * unit, nil
+}
+
+// shouldRetry reports if the backend request failed or the backend answered with a server error
+func shouldRetry(err error, resp *fasthttp.Response, retryableStatusCodes []int) bool {
+	if err == fasthttp.ErrBodyTooLarge {
+		// The backend will respond the same body again
+		return false
+	}
+
+	return err != nil || isRetryableStatusCode(resp.StatusCode(), retryableStatusCodes)
+}
+
+// isRetryableStatusCode reports if the status code is in the retryable ones, or if it's a 5xx without them
+func isRetryableStatusCode(statusCode int, retryableStatusCodes []int) bool {
+	if len(retryableStatusCodes) == 0 {
+		return statusCode >= fasthttp.StatusInternalServerError
+	}
+
+	for _, code := range retryableStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// retryAfter returns the duration of the "Retry-After" header, in seconds or as HTTP date,
+// capped to maxRetryAfter. It returns 0 if the header is missing or invalid
+func retryAfter(resp *fasthttp.Response, now time.Time) time.Duration {
+	value := resp.Header.Peek(headerRetryAfter)
+	if len(value) == 0 {
+		return 0
+	}
+
+	var d time.Duration
+
+	if seconds, err := strconv.Atoi(gotils.B2S(value)); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if date, err := fasthttp.ParseHTTPDate(value); err == nil {
+		d = date.Sub(now)
+	}
+
+	if d <= 0 {
+		return 0
+	} else if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+
+	return d
+}
+
+// surrogateMaxAge returns the max-age of the Surrogate-Control header,
+// and if it's present. The no-store directive is handled as max-age=0
+func surrogateMaxAge(resp *fasthttp.Response) (int64, bool) {
+	value := resp.Header.Peek(headerSurrogateControl)
+	if len(value) == 0 {
+		return 0, false
+	}
+
+	for _, directive := range bytes.Split(value, []byte(",")) {
+		directive = bytes.TrimSpace(directive)
+
+		if bytes.EqualFold(directive, surrogateNoStore) {
+			return 0, true
+		}
+
+		if !bytes.HasPrefix(directive, surrogateMaxAgePrefix) {
+			continue
+		}
+
+		maxAge, err := strconv.ParseInt(gotils.B2S(directive[len(surrogateMaxAgePrefix):]), 10, 64)
+		if err != nil {
+			return 0, false
+		}
+
+		return maxAge, true
+	}
+
+	return 0, false
+}
+
+// headerTTL returns the TTL in seconds of the header of the backend response,
+// or false if it's not configured, missing or its value is not a positive integer
+func headerTTL(resp *fasthttp.Response, name string) (int64, bool) {
+	if name == "" {
+		return 0, false
+	}
+
+	ttl, err := strconv.ParseInt(gotils.B2S(resp.Header.Peek(name)), 10, 64)
+	if err != nil || ttl <= 0 {
+		return 0, false
+	}
+
+	return ttl, true
+}
+
+func parseTrustedProxies(cidrs []string) ([]*net.IPNet, error) {
+	return parseIPNets(cidrs, "trusted proxy")
+}
+
+// parseIPNets parses the CIDRs or IPs, the name is only used in the errors
+func parseIPNets(cidrs []string, name string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid %s '%s'", name, cidr)
+			}
+
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+
+			cidr = fmt.Sprintf("%s/%d", cidr, bits)
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s '%s': %v", name, cidr, err)
+		}
+
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+func isTrustedProxy(ip net.IP, trustedProxies []*net.IPNet) bool {
+	return ipNetsContain(trustedProxies, ip)
+}
+
+func ipNetsContain(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP returns the real client IP. The X-Forwarded-For header is only
+// read when the immediate peer is a trusted proxy, taking the rightmost untrusted hop.
+func clientIP(ctx *fasthttp.RequestCtx, trustedProxies []*net.IPNet) net.IP {
+	remoteIP := ctx.RemoteIP()
+
+	if !isTrustedProxy(remoteIP, trustedProxies) {
+		return remoteIP
+	}
+
+	xff := ctx.Request.Header.Peek(headerXForwardedFor)
+	if len(xff) == 0 {
+		return remoteIP
+	}
+
+	hops := bytes.Split(xff, []byte{','})
+
+	var ip net.IP
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip = net.ParseIP(gotils.B2S(bytes.TrimSpace(hops[i])))
+		if ip == nil {
+			// A malformed hop could be spoofed, so nothing on its left is reliable
+			return remoteIP
+		}
+
+		if !isTrustedProxy(ip, trustedProxies) {
+			return ip
+		}
+	}
+
+	// All hops are trusted, so the leftmost is the client
+	return ip
+}
+
+// respCookieValue returns the value of the cookie set by the response with Set-Cookie
+func respCookieValue(resp *fasthttp.Response, name string) string {
+	cookie := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(cookie)
+
+	cookie.SetKey(name)
+	if !resp.Header.Cookie(cookie) {
+		return ""
+	}
+
+	return string(cookie.Value())
+}
+
 func getEvalValue(ctx *fasthttp.RequestCtx, name, key string) string {
 	value := name
 
@@ -82,6 +459,19 @@ func getEvalValue(ctx *fasthttp.RequestCtx, name, key string) string {
 	case config.EvalStatusCodeVar:
 		value = strconv.Itoa(ctx.Response.StatusCode())
 
+	case config.EvalHasBodyVar:
+		value = strconv.FormatBool(len(ctx.Request.Body()) > 0)
+
+	case config.EvalContentLengthVar:
+		value = strconv.Itoa(len(ctx.Request.Body()))
+
+	case config.EvalClientIPVar:
+		if ip, ok := ctx.UserValue(clientIPUserValueKey).(string); ok {
+			value = ip
+		} else {
+			value = ctx.RemoteIP().String()
+		}
+
 	default:
 		if strings.HasPrefix(name, config.EvalReqHeaderVar) {
 			value = gotils.B2S(ctx.Request.Header.Peek(key))
@@ -91,62 +481,166 @@ func getEvalValue(ctx *fasthttp.RequestCtx, name, key string) string {
 
 		} else if strings.HasPrefix(name, config.EvalCookieVar) {
 			value = gotils.B2S(ctx.Request.Header.Cookie(key))
+
+		} else if strings.HasPrefix(name, config.EvalRespCookieVar) {
+			value = respCookieValue(&ctx.Response, key)
 		}
 	}
 
 	return value
 }
 
-func checkIfNoCache(ctx *fasthttp.RequestCtx, rules []rule, params *evalParams) (bool, error) {
-	for _, r := range rules {
-		params.reset()
+func getHeaderValue(ctx *fasthttp.RequestCtx, v headerValue) string {
+	if v.resolver != nil {
+		return v.resolver(ctx, &ctx.Response, v.subKey)
+	}
 
-		for _, p := range r.params {
-			params.set(p.name, getEvalValue(ctx, p.name, p.subKey))
+	return getEvalValue(ctx, v.value, v.subKey)
+}
+
+func getEvalParamValue(ctx *fasthttp.RequestCtx, p ruleParam) interface{} {
+	var value string
+
+	if p.resolver != nil {
+		value = p.resolver(ctx, &ctx.Response, p.subKey)
+	} else {
+		name := p.name
+		if p.evalName != "" {
+			name = p.evalName
 		}
 
-		result, err := r.expr.Evaluate(params.all())
+		value = getEvalValue(ctx, name, p.subKey)
+	}
+
+	if p.numeric {
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	}
+
+	return value
+}
+
+// match counts a match of the rule, if the rule metrics are enabled
+func (r rule) match() {
+	if r.matches != nil {
+		atomic.AddUint64(r.matches, 1)
+	}
+}
+
+// evaluate evaluates the expression of the rule with the values of the request. The panics are
+// returned as errors, as some values could break the evaluation (ex: a ternary that returns a string)
+func evaluate(ctx *fasthttp.RequestCtx, r rule, params *evalParams) (result bool, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			result, err = false, fmt.Errorf("Panic evaluating the rule '%s': %v", r.condition, v)
+		}
+	}()
+
+	params.reset()
+
+	for _, p := range r.params {
+		params.set(p.name, getEvalParamValue(ctx, p))
+	}
+
+	value, err := r.expr.Evaluate(params.all())
+	if err != nil {
+		return false, fmt.Errorf("Could not evaluate the rule '%s': %v", r.condition, err)
+	}
+
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("The rule '%s' returned '%v' instead of a boolean", r.condition, value)
+	}
+
+	return result, nil
+}
+
+// evalRule evaluates the rule with the values of the request, counting the match
+func evalRule(ctx *fasthttp.RequestCtx, r rule, params *evalParams) (bool, error) {
+	ok, err := evaluate(ctx, r, params)
+	if ok {
+		r.match()
+	}
+
+	return ok, err
+}
+
+// matchAny reports if any of the rules matches the request
+func matchAny(ctx *fasthttp.RequestCtx, rules []rule, params *evalParams) (bool, error) {
+	i, err := matchFirst(ctx, rules, params)
+
+	return i >= 0, err
+}
+
+// matchFirst returns the index of the first rule that matches, or -1 if none of them
+func matchFirst(ctx *fasthttp.RequestCtx, rules []rule, params *evalParams) (int, error) {
+	for i, r := range rules {
+		ok, err := evalRule(ctx, r, params)
 		if err != nil {
-			return false, fmt.Errorf("Invalid nocache rule: %v", err)
+			return -1, err
 		}
 
-		if result.(bool) {
-			return true, nil
+		if ok {
+			return i, nil
 		}
 	}
 
-	return false, nil
+	return -1, nil
 }
 
-func processHeaderRules(ctx *fasthttp.RequestCtx, rules []headerRule, params *evalParams) error {
-	for _, r := range rules {
-		params.reset()
+// checkIfNoCache returns the index of the first nocache rule that matches, or -1 if none of them
+func checkIfNoCache(ctx *fasthttp.RequestCtx, rules []rule, params *evalParams) (int, error) {
+	i, err := matchFirst(ctx, rules, params)
+	if err != nil {
+		return -1, fmt.Errorf("Invalid nocache rule: %v", err)
+	}
 
-		executeHeaderRule := true
+	return i, nil
+}
 
+// checkIfNotCacheOnly returns true if the response doesn't match the cacheOnlyWhen rule, if any
+func checkIfNotCacheOnly(ctx *fasthttp.RequestCtx, rules []rule, params *evalParams) (bool, error) {
+	if len(rules) == 0 {
+		return false, nil
+	}
+
+	cacheable, err := matchAny(ctx, rules, params)
+	if err != nil {
+		return false, fmt.Errorf("Invalid cacheOnlyWhen rule: %v", err)
+	}
+
+	return !cacheable, nil
+}
+
+// processHeaderRules applies the header rules whose condition matches. The rules that fail are skipped,
+// so the rest are applied anyway, and the first error is returned
+func processHeaderRules(ctx *fasthttp.RequestCtx, header headerSetter, rules []headerRule, params *evalParams) error {
+	var firstErr error
+
+	for _, r := range rules {
 		if r.expr != nil {
-			for _, p := range r.params {
-				params.set(p.name, getEvalValue(ctx, p.name, p.subKey))
+			ok, err := evaluate(ctx, r.rule, params)
+			if err != nil && firstErr == nil {
+				firstErr = err
 			}
 
-			result, err := r.expr.Evaluate(params.all())
-			if err != nil {
-				return err
+			if !ok {
+				continue
 			}
-
-			executeHeaderRule = result.(bool)
 		}
 
-		if !executeHeaderRule {
-			continue
-		}
+		r.match()
 
-		if r.action == setHeaderAction {
-			ctx.Response.Header.Set(r.name, getEvalValue(ctx, r.value.value, r.value.subKey))
-		} else {
-			ctx.Response.Header.Del(r.name)
+		switch r.action {
+		case setHeaderAction:
+			header.Set(r.name, getHeaderValue(ctx, r.value))
+		case appendHeaderAction:
+			header.Add(r.name, getHeaderValue(ctx, r.value))
+		default:
+			header.Del(r.name)
 		}
 	}
 
-	return nil
+	return firstErr
 }
@@ -1,8 +1,12 @@
 package proxy
 
 import (
+	"net"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/savsgio/kratgo/modules/config"
 
@@ -99,6 +103,304 @@ func Test_cloneHeaders(t *testing.T) {
 	}
 }
 
+func Test_isCacheableHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.ProxyCacheHeaders
+		header string
+		want   bool
+	}{
+		{name: "Empty", cfg: config.ProxyCacheHeaders{}, header: "Server", want: true},
+		{name: "Denied", cfg: config.ProxyCacheHeaders{Deny: []string{"x-powered-by"}}, header: "X-Powered-By", want: false},
+		{name: "NotDenied", cfg: config.ProxyCacheHeaders{Deny: []string{"X-Powered-By"}}, header: "Content-Type", want: true},
+		{name: "Allowed", cfg: config.ProxyCacheHeaders{Allow: []string{"Content-Type"}}, header: "Content-Type", want: true},
+		{name: "NotAllowed", cfg: config.ProxyCacheHeaders{Allow: []string{"Content-Type"}}, header: "Server", want: false},
+		{
+			name:   "AllowedAndDenied",
+			cfg:    config.ProxyCacheHeaders{Allow: []string{"Content-Type"}, Deny: []string{"Content-Type"}},
+			header: "Content-Type",
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isCacheableHeader(tt.cfg, []byte(tt.header)); got != tt.want {
+				t.Errorf("isCacheableHeader() = '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isCacheableContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         config.ProxyCacheableContentTypes
+		contentType string
+		want        bool
+	}{
+		{name: "Empty", cfg: config.ProxyCacheableContentTypes{}, contentType: "text/html", want: true},
+		{
+			name:        "Allowed",
+			cfg:         config.ProxyCacheableContentTypes{Allow: []string{"text/html"}},
+			contentType: "Text/HTML; charset=utf-8",
+			want:        true,
+		},
+		{
+			name:        "NotAllowed",
+			cfg:         config.ProxyCacheableContentTypes{Allow: []string{"text/html"}},
+			contentType: "application/json",
+			want:        false,
+		},
+		{
+			name:        "AllowedWildcard",
+			cfg:         config.ProxyCacheableContentTypes{Allow: []string{"image/*"}},
+			contentType: "image/png",
+			want:        true,
+		},
+		{
+			name:        "NotAllowedWildcard",
+			cfg:         config.ProxyCacheableContentTypes{Allow: []string{"image/*"}},
+			contentType: "imagex/png",
+			want:        false,
+		},
+		{
+			name:        "Denied",
+			cfg:         config.ProxyCacheableContentTypes{Deny: []string{"application/octet-stream"}},
+			contentType: "application/octet-stream",
+			want:        false,
+		},
+		{
+			name:        "AllowedAndDenied",
+			cfg:         config.ProxyCacheableContentTypes{Allow: []string{"text/*"}, Deny: []string{"text/event-stream"}},
+			contentType: "text/event-stream",
+			want:        false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isCacheableContentType(tt.cfg, []byte(tt.contentType)); got != tt.want {
+				t.Errorf("isCacheableContentType() = '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_clientTimeout(t *testing.T) {
+	max := 10 * time.Second
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   time.Duration
+	}{
+		{name: "Empty", header: "X-Request-Timeout", want: 0},
+		{name: "Duration", header: "X-Request-Timeout", value: "2s", want: 2 * time.Second},
+		{name: "Milliseconds", header: "X-Request-Timeout", value: "500ms", want: 500 * time.Millisecond},
+		{name: "Capped", header: "X-Request-Timeout", value: "1h", want: max},
+		{name: "Invalid", header: "X-Request-Timeout", value: "soon", want: 0},
+		{name: "Negative", header: "X-Request-Timeout", value: "-1s", want: 0},
+		{name: "GRPCMilliseconds", header: "grpc-timeout", value: "100m", want: 100 * time.Millisecond},
+		{name: "GRPCSeconds", header: "Grpc-Timeout", value: "3S", want: 3 * time.Second},
+		{name: "GRPCOverflow", header: "grpc-timeout", value: "99999999H", want: max},
+		{name: "GRPCInvalidUnit", header: "grpc-timeout", value: "3s", want: 0},
+		{name: "GRPCTooLong", header: "grpc-timeout", value: "123456789S", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := new(fasthttp.RequestCtx)
+			if tt.value != "" {
+				ctx.Request.Header.Set(tt.header, tt.value)
+			}
+
+			if got := clientTimeout(ctx, tt.header, max); got != tt.want {
+				t.Errorf("clientTimeout() == '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isFramingHeader(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{header: "Content-Length", want: true},
+		{header: "transfer-encoding", want: true},
+		{header: "Content-Type", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := isFramingHeader([]byte(tt.header)); got != tt.want {
+				t.Errorf("isFramingHeader() = '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_surrogateMaxAge(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      string
+		wantMaxAge int64
+		wantOk     bool
+	}{
+		{name: "MaxAge", value: "max-age=60", wantMaxAge: 60, wantOk: true},
+		{name: "Directives", value: "content=\"ESI/1.0\", max-age=30", wantMaxAge: 30, wantOk: true},
+		{name: "NoStore", value: "no-store", wantMaxAge: 0, wantOk: true},
+		{name: "Invalid", value: "max-age=abc", wantMaxAge: 0, wantOk: false},
+		{name: "Empty", value: "", wantMaxAge: 0, wantOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := fasthttp.AcquireResponse()
+			defer fasthttp.ReleaseResponse(resp)
+
+			if tt.value != "" {
+				resp.Header.Set(headerSurrogateControl, tt.value)
+			}
+
+			maxAge, ok := surrogateMaxAge(resp)
+			if maxAge != tt.wantMaxAge || ok != tt.wantOk {
+				t.Errorf("surrogateMaxAge() = '%d, %v', want '%d, %v'", maxAge, ok, tt.wantMaxAge, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_parseTrustedProxies(t *testing.T) {
+	type args struct {
+		cidrs []string
+	}
+
+	type want struct {
+		nets []string
+		err  bool
+	}
+
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "CIDR",
+			args: args{cidrs: []string{"10.0.0.0/8", "fd00::/8"}},
+			want: want{nets: []string{"10.0.0.0/8", "fd00::/8"}},
+		},
+		{
+			name: "IP",
+			args: args{cidrs: []string{"192.168.1.1", "::1"}},
+			want: want{nets: []string{"192.168.1.1/32", "::1/128"}},
+		},
+		{
+			name: "InvalidIP",
+			args: args{cidrs: []string{"192.168.1"}},
+			want: want{err: true},
+		},
+		{
+			name: "InvalidCIDR",
+			args: args{cidrs: []string{"192.168.1.0/40"}},
+			want: want{err: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nets, err := parseTrustedProxies(tt.args.cidrs)
+			if (err != nil) != tt.want.err {
+				t.Fatalf("parseTrustedProxies() error == '%v', want '%v'", err, tt.want.err)
+			}
+
+			if tt.want.err {
+				return
+			}
+
+			if len(nets) != len(tt.want.nets) {
+				t.Fatalf("parseTrustedProxies() == '%v', want '%v'", nets, tt.want.nets)
+			}
+
+			for i, ipNet := range nets {
+				if ipNet.String() != tt.want.nets[i] {
+					t.Errorf("parseTrustedProxies()[%d] == '%s', want '%s'", i, ipNet, tt.want.nets[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_clientIP(t *testing.T) {
+	trustedProxies, err := parseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type args struct {
+		remoteIP string
+		xff      string
+	}
+
+	type want struct {
+		ip string
+	}
+
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "UntrustedPeer",
+			args: args{remoteIP: "1.2.3.4", xff: "5.6.7.8"},
+			want: want{ip: "1.2.3.4"},
+		},
+		{
+			name: "TrustedPeerWithoutXFF",
+			args: args{remoteIP: "10.0.0.1"},
+			want: want{ip: "10.0.0.1"},
+		},
+		{
+			name: "TrustedPeer",
+			args: args{remoteIP: "10.0.0.1", xff: "5.6.7.8"},
+			want: want{ip: "5.6.7.8"},
+		},
+		{
+			name: "RightmostUntrustedHop",
+			args: args{remoteIP: "10.0.0.1", xff: "9.9.9.9, 5.6.7.8, 10.0.0.2"},
+			want: want{ip: "5.6.7.8"},
+		},
+		{
+			name: "AllHopsTrusted",
+			args: args{remoteIP: "10.0.0.1", xff: "10.0.0.3, 10.0.0.2"},
+			want: want{ip: "10.0.0.3"},
+		},
+		{
+			name: "MalformedHop",
+			args: args{remoteIP: "10.0.0.1", xff: "5.6.7.8, fake"},
+			want: want{ip: "10.0.0.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Init(&ctx.Request, &net.TCPAddr{IP: net.ParseIP(tt.args.remoteIP)}, nil)
+			if tt.args.xff != "" {
+				ctx.Request.Header.Set(headerXForwardedFor, tt.args.xff)
+			}
+
+			if ip := clientIP(ctx, trustedProxies); ip.String() != tt.want.ip {
+				t.Errorf("clientIP() == '%s', want '%s'", ip, tt.want.ip)
+			}
+		})
+	}
+}
+
 func Test_getEvalValue(t *testing.T) {
 	ctx := new(fasthttp.RequestCtx)
 
@@ -113,17 +415,25 @@ func Test_getEvalValue(t *testing.T) {
 	respHeaderValue := "false"
 	cookieName := "kratcookie"
 	cookieValue := "1234"
+	respCookieValue := "5678"
 
 	ctx.Request.SetRequestURI(path)
 	ctx.Request.Header.SetMethod(method)
 	ctx.Request.Header.SetHost(host)
 	ctx.Request.Header.Set(reqHeaderName, reqHeaderValue)
 	ctx.Request.Header.SetCookie(cookieName, cookieValue)
+	ctx.Request.SetBodyString("Kratgo")
 
 	ctx.Response.Header.SetContentType(contentType)
 	ctx.Response.Header.Set(respHeaderName, respHeaderValue)
 	ctx.Response.SetStatusCode(statusCode)
 
+	respCookie := fasthttp.AcquireCookie()
+	respCookie.SetKey(cookieName)
+	respCookie.SetValue(respCookieValue)
+	ctx.Response.Header.SetCookie(respCookie)
+	fasthttp.ReleaseCookie(respCookie)
+
 	type args struct {
 		name string
 		key  string
@@ -213,6 +523,53 @@ func Test_getEvalValue(t *testing.T) {
 				value: cookieValue,
 			},
 		},
+		{
+			name: "response-cookie",
+			args: args{
+				name: config.EvalRespCookieVar,
+				key:  cookieName,
+			},
+			want: want{
+				value: respCookieValue,
+			},
+		},
+		{
+			name: "response-cookie-not-set",
+			args: args{
+				name: config.EvalRespCookieVar,
+				key:  "unknown",
+			},
+			want: want{
+				value: "",
+			},
+		},
+		{
+			name: "has-body",
+			args: args{
+				name: config.EvalHasBodyVar,
+			},
+			want: want{
+				value: "true",
+			},
+		},
+		{
+			name: "content-length",
+			args: args{
+				name: config.EvalContentLengthVar,
+			},
+			want: want{
+				value: "6",
+			},
+		},
+		{
+			name: "client-ip",
+			args: args{
+				name: config.EvalClientIPVar,
+			},
+			want: want{
+				value: "0.0.0.0",
+			},
+		},
 		{
 			name: "unknown",
 			args: args{
@@ -338,13 +695,58 @@ func Test_checkIfNoCache(t *testing.T) {
 				return
 			}
 
-			if noCache != tt.want.noCache {
+			if (noCache >= 0) != tt.want.noCache {
 				t.Errorf("checkIfNoCache() = '%v', want '%v'", noCache, tt.want.noCache)
 			}
 		})
 	}
 }
 
+func Test_checkIfNoCache_NumericStatusCode(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.Nocache = []string{
+		"$(statusCode) >= 500 && $(statusCode) < 600",
+		"$(statusCode) == '404'",
+		"$(statusCode) < 200 || $(statusCode) == '302'",
+	}
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		statusCode int
+		want       bool
+	}{
+		{statusCode: 100, want: true},
+		{statusCode: 200, want: false},
+		{statusCode: 302, want: true},
+		{statusCode: 404, want: true},
+		{statusCode: 500, want: true},
+		{statusCode: 503, want: true},
+		{statusCode: 600, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.statusCode), func(t *testing.T) {
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Response.SetStatusCode(tt.statusCode)
+
+			params := acquireEvalParams()
+			defer releaseEvalParams(params)
+
+			noCache, err := checkIfNoCache(ctx, p.nocacheRules, params)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if (noCache >= 0) != tt.want {
+				t.Errorf("checkIfNoCache() = '%v', want '%v'", noCache, tt.want)
+			}
+		})
+	}
+}
+
 func TestHTTPClient_processHeaderRules(t *testing.T) {
 	type args struct {
 		processWithoutRuleParams bool
@@ -445,7 +847,7 @@ func TestHTTPClient_processHeaderRules(t *testing.T) {
 			ctx.Response.Header.Set("FakeHeader", "fake data")
 			ctx.Response.Header.Set("Content-Type", "text/html")
 
-			err := processHeaderRules(ctx, p.headersRules, params)
+			err := processHeaderRules(ctx, &ctx.Response.Header, p.headersRules, params)
 			if (err != nil) != tt.want.err {
 				t.Errorf("Unexpected error: %v", err)
 			}
@@ -478,3 +880,235 @@ func TestHTTPClient_processHeaderRules(t *testing.T) {
 		})
 	}
 }
+
+func Test_processHeaderRules_Append(t *testing.T) {
+	preload := "</app.css>; rel=preload; as=style"
+
+	cfg := testConfig()
+	cfg.FileConfig.Response.Headers.Append = []config.Header{
+		{Name: "Link", Value: preload},
+		{Name: "Link", Value: "</never.js>; rel=preload", When: "$(path) == '/never/'"},
+	}
+	cfg.FileConfig.Request.Headers.Append = []config.Header{
+		{Name: "X-Forwarded-Proto", Value: "https"},
+	}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/test/")
+	ctx.Request.Header.Set("X-Forwarded-Proto", "http")
+	ctx.Response.Header.Add("Link", "</font.woff2>; rel=preload; as=font")
+	ctx.Response.Header.Add("Link", "<https://cdn.kratgo.com>; rel=preconnect")
+
+	params := acquireEvalParams()
+	defer releaseEvalParams(params)
+
+	if err := processHeaderRules(ctx, &ctx.Response.Header, p.headersRules, params); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := processHeaderRules(ctx, &ctx.Request.Header, p.requestHeadersRules, params); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var links []string
+	ctx.Response.Header.VisitAll(func(k, v []byte) {
+		if string(k) == "Link" {
+			links = append(links, string(v))
+		}
+	})
+
+	wantLinks := []string{"</font.woff2>; rel=preload; as=font", "<https://cdn.kratgo.com>; rel=preconnect", preload}
+	if !reflect.DeepEqual(links, wantLinks) {
+		t.Errorf("processHeaderRules() response headers 'Link' == '%v', want '%v'", links, wantLinks)
+	}
+
+	var protos []string
+	ctx.Request.Header.VisitAll(func(k, v []byte) {
+		if string(k) == "X-Forwarded-Proto" {
+			protos = append(protos, string(v))
+		}
+	})
+
+	wantProtos := []string{"http", "https"}
+	if !reflect.DeepEqual(protos, wantProtos) {
+		t.Errorf("processHeaderRules() request headers 'X-Forwarded-Proto' == '%v', want '%v'", protos, wantProtos)
+	}
+}
+
+func Test_checkIfNoCache_CustomVar(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.Nocache = []string{"$(tenant::plan) == 'free'"}
+	cfg.FileConfig.Response.Headers.Set = []config.Header{
+		{Name: "X-Tenant", Value: "$(tenant::name)"},
+	}
+	cfg.EvalVars = map[string]config.EvalVarResolver{
+		"tenant": func(ctx *fasthttp.RequestCtx, resp *fasthttp.Response, subKey string) string {
+			return string(ctx.Request.Header.Peek("X-Tenant-" + subKey))
+		},
+	}
+
+	unregisteredCfg := testConfig()
+	unregisteredCfg.FileConfig.Nocache = cfg.FileConfig.Nocache
+	if _, err := New(unregisteredCfg); err == nil {
+		t.Errorf("New() with unregistered custom variable, want error")
+	}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		plan string
+		want bool
+	}{
+		{plan: "free", want: true},
+		{plan: "pro", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.plan, func(t *testing.T) {
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.Header.Set("X-Tenant-plan", tt.plan)
+			ctx.Request.Header.Set("X-Tenant-name", "acme")
+
+			params := acquireEvalParams()
+			defer releaseEvalParams(params)
+
+			noCache, err := checkIfNoCache(ctx, p.nocacheRules, params)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if (noCache >= 0) != tt.want {
+				t.Errorf("checkIfNoCache() = '%v', want '%v'", noCache, tt.want)
+			}
+
+			if err := processHeaderRules(ctx, &ctx.Response.Header, p.headersRules, params); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if v := string(ctx.Response.Header.Peek("X-Tenant")); v != "acme" {
+				t.Errorf("processHeaderRules() header X-Tenant = '%s', want '%s'", v, "acme")
+			}
+		})
+	}
+}
+
+func Test_evalRule_InvalidValues(t *testing.T) {
+	cfg := testConfig()
+	cfg.FileConfig.Nocache = []string{
+		"$(req.header::X-Count) > 5",
+		"$(req.header::X-Mode) == 'a' ? 'yes' : false",
+		"$(tenant::plan) == 'free'",
+	}
+	cfg.EvalVars = map[string]config.EvalVarResolver{
+		"tenant": func(ctx *fasthttp.RequestCtx, resp *fasthttp.Response, subKey string) string {
+			// Panics if the header hasn't the plan, ex: "acme.free"
+			return strings.Split(string(ctx.Request.Header.Peek("X-Tenant")), ".")[1]
+		},
+	}
+
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		rule   int
+		header string
+		value  string
+		want   bool
+		err    bool
+	}{
+		{name: "NotNumeric", rule: 0, header: "X-Count", value: "abc", err: true},
+		{name: "Boolean", rule: 1, header: "X-Mode", value: "b", want: false},
+		{name: "NotBoolean", rule: 1, header: "X-Mode", value: "a", err: true},
+		{name: "Resolver", rule: 2, header: "X-Tenant", value: "acme.free", want: true},
+		{name: "ResolverPanic", rule: 2, header: "X-Tenant", value: "acme", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.Header.Set(tt.header, tt.value)
+
+			params := acquireEvalParams()
+			defer releaseEvalParams(params)
+
+			got, err := evalRule(ctx, p.nocacheRules[tt.rule], params)
+			if (err != nil) != tt.err {
+				t.Fatalf("evalRule() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if got != tt.want {
+				t.Errorf("evalRule() == '%v', want '%v'", got, tt.want)
+			}
+
+			if err != nil && !strings.Contains(err.Error(), cfg.FileConfig.Nocache[tt.rule]) {
+				t.Errorf("evalRule() error == '%v', want the rule '%s'", err, cfg.FileConfig.Nocache[tt.rule])
+			}
+		})
+	}
+}
+
+func Test_isRetryableStatusCode(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		codes      []int
+		want       bool
+	}{
+		{name: "Default5xx", statusCode: 500, want: true},
+		{name: "Default4xx", statusCode: 429, want: false},
+		{name: "Configured", statusCode: 429, codes: []int{429, 503}, want: true},
+		{name: "NotConfigured", statusCode: 500, codes: []int{429, 503}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableStatusCode(tt.statusCode, tt.codes); got != tt.want {
+				t.Errorf("isRetryableStatusCode() == '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_retryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "Missing", value: "", want: 0},
+		{name: "Seconds", value: "120", want: 2 * time.Minute},
+		{name: "Date", value: "Wed, 01 Jan 2020 00:00:30 GMT", want: 30 * time.Second},
+		{name: "PastDate", value: "Tue, 31 Dec 2019 23:00:00 GMT", want: 0},
+		{name: "Negative", value: "-1", want: 0},
+		{name: "Capped", value: "3600", want: maxRetryAfter},
+		{name: "Invalid", value: "soon", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := fasthttp.AcquireResponse()
+			defer fasthttp.ReleaseResponse(resp)
+
+			if tt.value != "" {
+				resp.Header.Set(headerRetryAfter, tt.value)
+			}
+
+			if got := retryAfter(resp, now); got != tt.want {
+				t.Errorf("retryAfter() == '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package tracing
+
+import "time"
+
+// HeaderTraceparent is the W3C trace context header
+const HeaderTraceparent = "traceparent"
+
+const traceparentVersion = "00"
+const traceparentSampled = "01"
+const traceparentLength = 55
+
+const defaultServiceName = "kratgo"
+
+const (
+	queueSize     = 2048
+	batchSize     = 512
+	flushInterval = 5 * time.Second
+	exportTimeout = 10 * time.Second
+)
+
+// Span kinds, as defined by OTLP
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+const statusCodeError = 2
+
+const (
+	attrString attrType = iota
+	attrInt
+	attrBool
+)
@@ -0,0 +1,139 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func stringAttribute(key, value string) attribute {
+	return attribute{key: key, typ: attrString, str: value}
+}
+
+func (a attribute) encode() otlpKeyValue {
+	kv := otlpKeyValue{Key: a.key}
+
+	switch a.typ {
+	case attrInt:
+		// The OTLP JSON encoding uses strings for 64-bit integers
+		kv.Value = map[string]interface{}{"intValue": strconv.FormatInt(a.integer, 10)}
+	case attrBool:
+		kv.Value = map[string]interface{}{"boolValue": a.boolean}
+	default:
+		kv.Value = map[string]interface{}{"stringValue": a.str}
+	}
+
+	return kv
+}
+
+// SetAttribute ...
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.attrs = append(s.attrs, stringAttribute(key, value))
+}
+
+// SetBytesAttribute is like SetAttribute, but the value is only copied if the span is not nil
+func (s *Span) SetBytesAttribute(key string, value []byte) {
+	if s == nil {
+		return
+	}
+
+	s.attrs = append(s.attrs, stringAttribute(key, string(value)))
+}
+
+// SetIntAttribute ...
+func (s *Span) SetIntAttribute(key string, value int) {
+	if s == nil {
+		return
+	}
+
+	s.attrs = append(s.attrs, attribute{key: key, typ: attrInt, integer: int64(value)})
+}
+
+// SetBoolAttribute ...
+func (s *Span) SetBoolAttribute(key string, value bool) {
+	if s == nil {
+		return
+	}
+
+	s.attrs = append(s.attrs, attribute{key: key, typ: attrBool, boolean: value})
+}
+
+// SetError marks the span as failed, with the error message as attribute
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.err = true
+	s.attrs = append(s.attrs, stringAttribute("error.message", err.Error()))
+}
+
+// Inject sets the trace context of the span in the request headers
+func (s *Span) Inject(header *fasthttp.RequestHeader) {
+	if s == nil {
+		return
+	}
+
+	header.Set(HeaderTraceparent, formatTraceparent(s.traceID, s.spanID))
+}
+
+// TraceID returns the hex encoded trace ID, or an empty string if the span is nil
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// End finishes the span and queues it to be exported
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.end = time.Now().UnixNano()
+	s.tracer.add(s)
+}
+
+// parseTraceparent returns the trace ID and the parent span ID of the header,
+// with the format: <version>-<trace-id>-<parent-id>-<flags>
+func parseTraceparent(value []byte) ([16]byte, [8]byte, bool) {
+	var traceID [16]byte
+	var spanID [8]byte
+
+	if len(value) < traceparentLength || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return traceID, spanID, false
+	}
+
+	// Version "ff" is forbidden, and version "00" has no more fields
+	version := string(value[:2])
+	if version == "ff" || (version == traceparentVersion && len(value) != traceparentLength) ||
+		(len(value) > traceparentLength && value[traceparentLength] != '-') {
+		return traceID, spanID, false
+	}
+
+	if _, err := hex.Decode(traceID[:], value[3:35]); err != nil {
+		return traceID, spanID, false
+	}
+
+	if _, err := hex.Decode(spanID[:], value[36:52]); err != nil {
+		return traceID, spanID, false
+	}
+
+	if traceID == [16]byte{} || spanID == [8]byte{} {
+		return traceID, spanID, false
+	}
+
+	return traceID, spanID, true
+}
+
+func formatTraceparent(traceID [16]byte, spanID [8]byte) string {
+	return traceparentVersion + "-" + hex.EncodeToString(traceID[:]) + "-" + hex.EncodeToString(spanID[:]) + "-" + traceparentSampled
+}
@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"testing"
+)
+
+func Test_parseTraceparent(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{
+			name:  "Ok",
+			value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			ok:    true,
+		},
+		{
+			name:  "FutureVersion",
+			value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			ok:    true,
+		},
+		{
+			name:  "FutureVersionInvalidSuffix",
+			value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01extra",
+			ok:    false,
+		},
+		{
+			name:  "Empty",
+			value: "",
+			ok:    false,
+		},
+		{
+			name:  "ForbiddenVersion",
+			value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			ok:    false,
+		},
+		{
+			name:  "TooLong",
+			value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			ok:    false,
+		},
+		{
+			name:  "InvalidHex",
+			value: "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+			ok:    false,
+		},
+		{
+			name:  "ZeroTraceID",
+			value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			ok:    false,
+		},
+		{
+			name:  "ZeroSpanID",
+			value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+			ok:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			traceID, spanID, ok := parseTraceparent([]byte(tt.value))
+			if ok != tt.ok {
+				t.Fatalf("parseTraceparent() ok == '%v', want '%v'", ok, tt.ok)
+			}
+
+			if !ok {
+				return
+			}
+
+			want := "00" + tt.value[2:55]
+			if tp := formatTraceparent(traceID, spanID); tp != want {
+				t.Errorf("formatTraceparent() == '%s', want '%s'", tp, want)
+			}
+		})
+	}
+}
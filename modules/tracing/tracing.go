@@ -0,0 +1,224 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	logger "github.com/savsgio/go-logger/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// New returns nil if the OTLP endpoint is not configured, so tracing is disabled
+func New(cfg Config) (*Tracer, error) {
+	if cfg.FileConfig.Endpoint == "" {
+		return nil, nil
+	}
+
+	uri := fasthttp.AcquireURI()
+	defer fasthttp.ReleaseURI(uri)
+
+	if err := uri.Parse(nil, []byte(cfg.FileConfig.Endpoint)); err != nil || len(uri.Host()) == 0 {
+		return nil, fmt.Errorf("Invalid tracing endpoint '%s'", cfg.FileConfig.Endpoint)
+	}
+
+	t := &Tracer{
+		endpoint:    cfg.FileConfig.Endpoint,
+		serviceName: cfg.FileConfig.ServiceName,
+		client:      &fasthttp.Client{},
+		chSpans:     make(chan *Span, queueSize),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+		log:         logger.New("kratgo-tracing", cfg.LogLevel, cfg.LogOutput),
+	}
+
+	if t.serviceName == "" {
+		t.serviceName = defaultServiceName
+	}
+
+	go t.run()
+
+	return t, nil
+}
+
+func randomID(dst []byte) {
+	if _, err := rand.Read(dst); err != nil {
+		// Unique enough, in the very unlikely case of error
+		binary.BigEndian.PutUint64(dst[len(dst)-8:], uint64(time.Now().UnixNano()))
+	}
+}
+
+// Start returns a new span, child of the parent if it's not nil
+func (t *Tracer) Start(name string, kind SpanKind, parent *Span) *Span {
+	if t == nil {
+		return nil
+	}
+
+	s := &Span{tracer: t, name: name, kind: kind, start: time.Now().UnixNano()}
+
+	if parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		randomID(s.traceID[:])
+	}
+	randomID(s.spanID[:])
+
+	return s
+}
+
+// StartFromRequest returns a new span, child of the trace context of the request headers if any
+func (t *Tracer) StartFromRequest(name string, kind SpanKind, header *fasthttp.RequestHeader) *Span {
+	if t == nil {
+		return nil
+	}
+
+	s := t.Start(name, kind, nil)
+
+	if traceID, spanID, ok := parseTraceparent(header.Peek(HeaderTraceparent)); ok {
+		s.traceID = traceID
+		s.parentID = spanID
+	}
+
+	return s
+}
+
+func (t *Tracer) export(spans []*Span) error {
+	data, err := json.Marshal(t.encode(spans))
+	if err != nil {
+		return fmt.Errorf("Could not encode the spans: %v", err)
+	}
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer func() {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+	}()
+
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetContentType("application/json")
+	req.SetRequestURI(t.endpoint)
+	req.SetBody(data)
+
+	if err := t.client.DoTimeout(req, resp, exportTimeout); err != nil {
+		return fmt.Errorf("Could not export the spans: %v", err)
+	}
+
+	if code := resp.StatusCode(); code < 200 || code >= 300 {
+		return fmt.Errorf("Could not export the spans: unexpected status code %d", code)
+	}
+
+	return nil
+}
+
+func (t *Tracer) flush(batch []*Span) []*Span {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	if err := t.export(batch); err != nil {
+		t.log.Errorf("%v (%d spans lost)", err, len(batch))
+	}
+
+	return batch[:0]
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	batch := make([]*Span, 0, batchSize)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case s := <-t.chSpans:
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				batch = t.flush(batch)
+			}
+
+		case <-ticker.C:
+			batch = t.flush(batch)
+
+		case <-t.stop:
+			for {
+				select {
+				case s := <-t.chSpans:
+					batch = append(batch, s)
+				default:
+					t.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *Tracer) add(s *Span) {
+	select {
+	case t.chSpans <- s:
+	default:
+		if t.log.DebugEnabled() {
+			t.log.Debugf("The spans queue is full, span '%s' is discarded", s.name)
+		}
+	}
+}
+
+// Stop exports the ended spans which are not exported yet
+func (t *Tracer) Stop() error {
+	if t == nil {
+		return nil
+	}
+
+	t.once.Do(func() { close(t.stop) })
+	<-t.done
+
+	return nil
+}
+
+func (t *Tracer) encode(spans []*Span) otlpTraces {
+	result := make([]otlpSpan, 0, len(spans))
+
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start, 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end, 10),
+		}
+
+		if s.parentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+
+		for _, a := range s.attrs {
+			span.Attributes = append(span.Attributes, a.encode())
+		}
+
+		if s.err {
+			span.Status = &otlpStatus{Code: statusCodeError}
+		}
+
+		result = append(result, span)
+	}
+
+	return otlpTraces{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpKeyValue{stringAttribute("service.name", t.serviceName).encode()},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: defaultServiceName},
+				Spans: result,
+			}},
+		}},
+	}
+}
@@ -0,0 +1,205 @@
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	logger "github.com/savsgio/go-logger/v2"
+	"github.com/valyala/fasthttp"
+)
+
+type mockExporter struct {
+	bodies [][]byte
+	err    error
+
+	mu sync.Mutex
+}
+
+func (mock *mockExporter) DoTimeout(req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error {
+	mock.mu.Lock()
+	mock.bodies = append(mock.bodies, append([]byte(nil), req.Body()...))
+	mock.mu.Unlock()
+
+	resp.SetStatusCode(fasthttp.StatusOK)
+
+	return mock.err
+}
+
+func testTracer(t *testing.T) (*Tracer, *mockExporter) {
+	tracer, err := New(Config{
+		FileConfig: config.Tracing{Endpoint: "http://localhost:4318/v1/traces"},
+		LogLevel:   logger.FATAL,
+		LogOutput:  os.Stderr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exporter := new(mockExporter)
+	tracer.client = exporter
+
+	return tracer, exporter
+}
+
+func TestTracer_New(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		disabled bool
+		err      bool
+	}{
+		{
+			name:     "Ok",
+			endpoint: "http://localhost:4318/v1/traces",
+		},
+		{
+			name:     "Disabled",
+			endpoint: "",
+			disabled: true,
+		},
+		{
+			name:     "InvalidEndpoint",
+			endpoint: "/v1/traces",
+			err:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer, err := New(Config{
+				FileConfig: config.Tracing{Endpoint: tt.endpoint},
+				LogLevel:   logger.FATAL,
+				LogOutput:  os.Stderr,
+			})
+			if (err != nil) != tt.err {
+				t.Fatalf("New() error == '%v', want '%v'", err, tt.err)
+			}
+
+			if (tracer == nil) != (tt.disabled || tt.err) {
+				t.Fatalf("New() tracer == '%v', want nil '%v'", tracer, tt.disabled || tt.err)
+			}
+
+			if tracer != nil && tracer.serviceName != defaultServiceName {
+				t.Errorf("New() serviceName == '%s', want '%s'", tracer.serviceName, defaultServiceName)
+			}
+
+			tracer.Stop()
+		})
+	}
+}
+
+func TestTracer_Nil(t *testing.T) {
+	var tracer *Tracer
+
+	header := new(fasthttp.RequestHeader)
+
+	span := tracer.StartFromRequest("test", SpanKindServer, header)
+	if span != nil {
+		t.Fatalf("Tracer.StartFromRequest() span == '%v', want nil", span)
+	}
+
+	span.SetAttribute("key", "value")
+	span.SetBoolAttribute("key", true)
+	span.SetError(errors.New("error"))
+	span.Inject(header)
+	span.End()
+
+	if v := header.Peek(HeaderTraceparent); len(v) > 0 {
+		t.Errorf("Span.Inject() nil span has set the header '%s'", v)
+	}
+
+	if err := tracer.Stop(); err != nil {
+		t.Errorf("Tracer.Stop() unexpected error: %v", err)
+	}
+}
+
+func TestTracer_StartFromRequest(t *testing.T) {
+	tracer, _ := testTracer(t)
+	defer tracer.Stop()
+
+	header := new(fasthttp.RequestHeader)
+	header.Set(HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	span := tracer.StartFromRequest("test", SpanKindServer, header)
+
+	if traceID := span.TraceID(); traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Tracer.StartFromRequest() traceID == '%s', want the incoming one", traceID)
+	}
+
+	child := tracer.Start("child", SpanKindClient, span)
+	if child.traceID != span.traceID || child.parentID != span.spanID {
+		t.Errorf("Tracer.Start() child is not in the trace of the parent")
+	}
+
+	child.Inject(header)
+
+	want := formatTraceparent(child.traceID, child.spanID)
+	if v := string(header.Peek(HeaderTraceparent)); v != want {
+		t.Errorf("Span.Inject() traceparent == '%s', want '%s'", v, want)
+	}
+
+	header.Del(HeaderTraceparent)
+
+	root := tracer.StartFromRequest("root", SpanKindServer, header)
+	if root.traceID == span.traceID || root.parentID != [8]byte{} {
+		t.Errorf("Tracer.StartFromRequest() without traceparent is not a new trace")
+	}
+}
+
+func TestTracer_Stop(t *testing.T) {
+	tracer, exporter := testTracer(t)
+
+	span := tracer.Start("test", SpanKindServer, nil)
+	span.SetAttribute("http.method", "GET")
+	span.SetIntAttribute("http.status_code", 500)
+	span.SetBoolAttribute("kratgo.cache_hit", false)
+	span.SetError(errors.New("failed"))
+	span.End()
+
+	if err := tracer.Stop(); err != nil {
+		t.Fatalf("Tracer.Stop() unexpected error: %v", err)
+	}
+
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+
+	if len(exporter.bodies) != 1 {
+		t.Fatalf("Tracer.Stop() exports == '%d', want '%d'", len(exporter.bodies), 1)
+	}
+
+	traces := otlpTraces{}
+	if err := json.Unmarshal(exporter.bodies[0], &traces); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 1 {
+		t.Fatalf("Tracer.Stop() exported spans == '%d', want '%d'", len(spans), 1)
+	}
+
+	s := spans[0]
+	if s.Name != "test" || s.Kind != SpanKindServer || s.TraceID != span.TraceID() {
+		t.Errorf("Tracer.Stop() exported span == '%+v'", s)
+	}
+
+	if s.Status == nil || s.Status.Code != statusCodeError {
+		t.Errorf("Tracer.Stop() exported span status == '%v', want error", s.Status)
+	}
+
+	if len(s.Attributes) != 4 {
+		t.Fatalf("Tracer.Stop() exported attributes == '%d', want '%d'", len(s.Attributes), 4)
+	}
+
+	if v := s.Attributes[1].Value["intValue"]; v != "500" {
+		t.Errorf("Tracer.Stop() exported int attribute == '%v', want '%s'", v, "500")
+	}
+
+	// Stop twice must not panic
+	tracer.Stop()
+}
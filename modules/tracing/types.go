@@ -0,0 +1,116 @@
+package tracing
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/savsgio/kratgo/modules/config"
+
+	logger "github.com/savsgio/go-logger/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// Config ...
+type Config struct {
+	FileConfig config.Tracing
+
+	LogLevel  string
+	LogOutput io.Writer
+}
+
+// Tracer records the spans and exports them in batches to the OTLP endpoint.
+// A nil tracer is valid, and discards everything, so tracing has no overhead when disabled
+type Tracer struct {
+	endpoint    string
+	serviceName string
+
+	client exporter
+
+	chSpans chan *Span
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	log *logger.Logger
+}
+
+// SpanKind ...
+type SpanKind int
+
+// Span ...
+type Span struct {
+	tracer *Tracer
+
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+
+	name  string
+	kind  SpanKind
+	start int64
+	end   int64
+	err   bool
+	attrs []attribute
+}
+
+type attrType int
+
+type attribute struct {
+	key     string
+	typ     attrType
+	str     string
+	integer int64
+	boolean bool
+}
+
+// ###### OTLP JSON ######
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code"`
+}
+
+// ###### INTERFACES ######
+
+type exporter interface {
+	DoTimeout(req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error
+}